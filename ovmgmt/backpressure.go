@@ -0,0 +1,154 @@
+package ovmgmt
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// BackpressurePolicy tells what the client does when the event channel
+// is full, see WithBackpressure.
+type BackpressurePolicy int
+
+const (
+	// BackpressureBlock waits for the consumer, which blocks the replies
+	// to commands as well. It's the default.
+	BackpressureBlock BackpressurePolicy = iota
+	// BackpressureDropNewest drops the event which doesn't fit into
+	// the channel.
+	BackpressureDropNewest
+	// BackpressureDropOldest keeps up to the channel capacity of events
+	// in the internal queue, in addition to the channel buffer, dropping
+	// the oldest queued one for the new one.
+	BackpressureDropOldest
+)
+
+func (p BackpressurePolicy) String() string {
+	switch p {
+	case BackpressureBlock:
+		return "block"
+	case BackpressureDropNewest:
+		return "drop-newest"
+	case BackpressureDropOldest:
+		return "drop-oldest"
+	default:
+		return "unknown"
+	}
+}
+
+// WithBackpressure sets the policy for the full event channel. With
+// the dropping policies, a slow consumer loses events instead of stalling
+// the commands, DroppedEvents counts them, and OverflowEvent reports
+// each gap once the consumer catches up. FatalEvent, the last event
+// before the channel is closed, is never dropped.
+func WithBackpressure(policy BackpressurePolicy) Option {
+	return func(o *clientOptions) {
+		o.backpressure = policy
+	}
+}
+
+// DroppedEvents returns the number of events dropped according to
+// the backpressure policy.
+func (c *MgmtClient) DroppedEvents() uint64 {
+	return atomic.LoadUint64(&c.droppedEvents)
+}
+
+func (c *MgmtClient) dropEvent(evt Event) {
+	atomic.AddUint64(&c.droppedEvents, 1)
+	c.gap.add(evt)
+}
+
+// eventQueue is the bounded FIFO of events, dropping the oldest one
+// when it's full
+type eventQueue struct {
+	mu sync.Mutex
+	// ring of the events, count of them starting at head
+	events []Event
+	head   int
+	count  int
+	closed bool
+	// signaled on push and close
+	signal chan struct{}
+	// closed when the pump is done
+	done chan struct{}
+}
+
+func newEventQueue(max int) *eventQueue {
+	if max < 1 {
+		max = 1
+	}
+	return &eventQueue{
+		events: make([]Event, max),
+		signal: make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+}
+
+// push appends the event, onDrop is called with the dropped one, if any,
+// before it can be popped
+func (q *eventQueue) push(evt Event, onDrop func(Event)) {
+	q.mu.Lock()
+	if q.count == len(q.events) {
+		onDrop(q.events[q.head])
+		q.events[q.head] = nil
+		q.head = (q.head + 1) % len(q.events)
+		q.count--
+	}
+	q.events[(q.head+q.count)%len(q.events)] = evt
+	q.count++
+	q.mu.Unlock()
+
+	q.notify()
+}
+
+// pop returns the oldest event, more is false once the queue is closed
+// and empty
+func (q *eventQueue) pop() (evt Event, ok bool, more bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.count == 0 {
+		return nil, false, !q.closed
+	}
+	evt = q.events[q.head]
+	q.events[q.head] = nil
+	q.head = (q.head + 1) % len(q.events)
+	q.count--
+	return evt, true, true
+}
+
+// close makes the pump finish once the queue is empty
+func (q *eventQueue) close() {
+	q.mu.Lock()
+	q.closed = true
+	q.mu.Unlock()
+	q.notify()
+}
+
+func (q *eventQueue) notify() {
+	select {
+	case q.signal <- struct{}{}:
+	default:
+	}
+}
+
+// pumpEvents sends the queued events to the event channel, preceded by
+// OverflowEvent after a gap
+func (c *MgmtClient) pumpEvents() {
+	defer close(c.queue.done)
+	for {
+		evt, ok, more := c.queue.pop()
+		switch {
+		case ok:
+			if !c.sendOverflow(true) || !c.send(evt) {
+				return
+			}
+		case !more:
+			return
+		default:
+			select {
+			case <-c.queue.signal:
+			case <-c.closed:
+				return
+			}
+		}
+	}
+}
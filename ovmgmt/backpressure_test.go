@@ -0,0 +1,219 @@
+package ovmgmt
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBackpressure(t *testing.T) {
+	defer checkGoroutineLeaks(t)()
+
+	type TestCase struct {
+		Policy      BackpressurePolicy
+		WantEvents  []string
+		WantDropped uint64
+	}
+	fatal := "FATAL: Connection closed by OpenVPN"
+	testCases := []TestCase{
+		{BackpressureBlock, []string{"1", "2", "3", "4", "5", fatal}, 0},
+		{BackpressureDropNewest, []string{"1", "overflow 4", fatal}, 4},
+	}
+
+	for i, tc := range testCases {
+		daemonConn, clientConn := net.Pipe()
+		eventCh := make(chan Event, 1)
+		c := NewMgmtClientWithOptions(clientConn, eventCh, WithBackpressure(tc.Policy))
+
+		go func() {
+			for j := 1; j <= 5; j++ {
+				fmt.Fprintf(daemonConn, ">LOG:1584536294,I,%d\n", j)
+			}
+			daemonConn.Close()
+		}()
+
+		// the consumer is stalled until the client is done with dropping
+		deadline := time.Now().Add(2 * time.Second)
+		for c.DroppedEvents() < tc.WantDropped && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		time.Sleep(20 * time.Millisecond)
+
+		var got []string
+		for evt := range eventCh {
+			switch e := evt.(type) {
+			case LogEvent:
+				got = append(got, e.Message())
+			case OverflowEvent:
+				got = append(got, fmt.Sprintf("overflow %d", e.Dropped()))
+			default:
+				got = append(got, evt.String())
+			}
+		}
+		if !reflect.DeepEqual(got, tc.WantEvents) {
+			t.Errorf("test %d (%s) got events %q; want %q", i, tc.Policy, got, tc.WantEvents)
+		}
+		if dropped := c.DroppedEvents(); dropped != tc.WantDropped {
+			t.Errorf("test %d (%s) DroppedEvents returned %d; want %d", i, tc.Policy, dropped, tc.WantDropped)
+		}
+		c.Close()
+	}
+}
+
+func TestBackpressureDropOldest(t *testing.T) {
+	defer checkGoroutineLeaks(t)()
+
+	daemonConn, clientConn := net.Pipe()
+	eventCh := make(chan Event, 1)
+	c := NewMgmtClientWithOptions(clientConn, eventCh, WithBackpressure(BackpressureDropOldest))
+	defer c.Close()
+
+	const n = 20
+	go func() {
+		for j := 1; j <= n; j++ {
+			fmt.Fprintf(daemonConn, ">LOG:1584536294,I,%d\n", j)
+		}
+		daemonConn.Close()
+	}()
+	// the consumer is stalled while the lines are read
+	time.Sleep(50 * time.Millisecond)
+
+	// which events are dropped depends on when the internal queue
+	// is pumped, the newest ones are kept anyway
+	var got []Event
+	for evt := range eventCh {
+		got = append(got, evt)
+	}
+	if len(got) == 0 {
+		t.Fatalf("no events delivered")
+	}
+	if _, ok := got[len(got)-1].(FatalEvent); !ok {
+		t.Errorf("last event is %s; want FatalEvent", got[len(got)-1])
+	}
+	// the gaps are reported before the next event delivered, the last one
+	// right before the queued FatalEvent
+	var overflows []OverflowEvent
+	var overflowDropped, keywordDropped uint64
+	prev := 0
+	for _, evt := range got[:len(got)-1] {
+		var j int
+		switch e := evt.(type) {
+		case OverflowEvent:
+			overflows = append(overflows, e)
+			overflowDropped += e.Dropped()
+			keywordDropped += e.DroppedKeywords()[logEventKW]
+		case LogEvent:
+			if fmt.Sscan(e.Message(), &j); j <= prev {
+				t.Errorf("event %d is delivered after %d", j, prev)
+			}
+			prev = j
+		default:
+			t.Errorf("got unexpected event %s", evt)
+		}
+	}
+	if len(overflows) == 0 {
+		t.Fatalf("got no OverflowEvent")
+	}
+	if _, ok := got[len(got)-2].(OverflowEvent); !ok {
+		t.Errorf("event before FatalEvent is %s; want OverflowEvent", got[len(got)-2])
+	}
+	dropped := c.DroppedEvents()
+	if overflowDropped != dropped || keywordDropped != dropped {
+		t.Errorf("OverflowEvents report %d dropped, %d of %s; want %d", overflowDropped, keywordDropped, logEventKW, dropped)
+	}
+	if delivered := len(got) - len(overflows); int(dropped)+delivered != n+1 {
+		t.Errorf("DroppedEvents returned %d with %d events delivered; want %d in total", dropped, delivered, n+1)
+	}
+}
+
+func TestBackpressureClose(t *testing.T) {
+	defer checkGoroutineLeaks(t)()
+
+	for _, policy := range []BackpressurePolicy{BackpressureBlock, BackpressureDropNewest, BackpressureDropOldest} {
+		daemonConn, clientConn := net.Pipe()
+		eventCh := make(chan Event, 1)
+		c := NewMgmtClientWithOptions(clientConn, eventCh, WithBackpressure(policy))
+		go func() {
+			for j := 1; j <= 5; j++ {
+				if _, err := io.WriteString(daemonConn, ">LOG:1584536294,I,msg\n"); err != nil {
+					return
+				}
+			}
+		}()
+		time.Sleep(20 * time.Millisecond)
+
+		// Close doesn't wait for the stalled consumer
+		closed := make(chan struct{})
+		go func() {
+			c.Close()
+			close(closed)
+		}()
+		select {
+		case <-closed:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("%s: Close is stuck", policy)
+		}
+		for range eventCh {
+		}
+		daemonConn.Close()
+	}
+}
+
+func TestEventQueue(t *testing.T) {
+	q := newEventQueue(2)
+	for i := 1; i <= 3; i++ {
+		var dropped []string
+		q.push(NewSimpleEvent("E", fmt.Sprint(i)), func(evt Event) {
+			dropped = append(dropped, evt.String())
+		})
+		var want []string
+		if i == 3 {
+			want = []string{"E: 1"}
+		}
+		if !reflect.DeepEqual(dropped, want) {
+			t.Errorf("push %d dropped %q; want %q", i, dropped, want)
+		}
+	}
+	q.close()
+
+	var got []string
+	for {
+		evt, ok, more := q.pop()
+		if !more {
+			break
+		}
+		if !ok {
+			t.Fatalf("pop returned no event from the closed queue")
+		}
+		got = append(got, evt.String())
+	}
+	if want := []string{"E: 2", "E: 3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("popped %q; want %q", got, want)
+	}
+}
+
+func TestEventQueueWrap(t *testing.T) {
+	q := newEventQueue(3)
+	next := 0
+	// interleaved pushes and pops wrap around the ring several times,
+	// the oldest events are dropped once it's full
+	for i := 0; i < 20; i++ {
+		q.push(NewSimpleEvent("E", fmt.Sprint(2*i)), func(Event) {
+			t.Fatalf("push %d dropped an event of the queue which isn't full", 2*i)
+		})
+		q.push(NewSimpleEvent("E", fmt.Sprint(2*i+1)), func(evt Event) {
+			if want := fmt.Sprintf("E: %d", next); evt.String() != want {
+				t.Errorf("push %d dropped %s; want %s", 2*i+1, evt, want)
+			}
+			next++
+		})
+		evt, ok, _ := q.pop()
+		if want := fmt.Sprintf("E: %d", next); !ok || evt.String() != want {
+			t.Fatalf("pop %d returned %v, %t; want %s", i, evt, ok, want)
+		}
+		next++
+	}
+}
@@ -0,0 +1,131 @@
+package ovmgmt
+
+import (
+	"sync"
+	"time"
+)
+
+// ByteCountAggregator turns absolute counters of successive ByteCountEvent
+// (or ByteCountClientEvent of a single client) values into rates
+// and cumulative totals.
+//
+// A counter smaller than the previous one means the daemon (or client
+// session) was restarted, the new value is then counted from zero.
+// Rates are computed using the local receive time, so irregular event
+// arrival intervals are handled correctly.
+//
+// One aggregator tracks one counter stream; feeding it with events of
+// different clients gives meaningless results, see ClientByteCountTracker
+// for server mode. It is safe for concurrent use.
+type ByteCountAggregator struct {
+	mu       sync.Mutex
+	now      func() time.Time
+	hasLast  bool
+	lastIn   int64
+	lastOut  int64
+	lastAt   time.Time
+	totalIn  int64
+	totalOut int64
+	rateIn   float64
+	rateOut  float64
+	resets   int
+}
+
+func NewByteCountAggregator() *ByteCountAggregator {
+	return &ByteCountAggregator{now: time.Now}
+}
+
+// Add consumes ByteCountEvent or ByteCountClientEvent at the time it was
+// received, see ReceivedEvent, or at the current time if it's zero (e.g.
+// for the events built by hand). Other events are ignored and false is
+// returned.
+func (a *ByteCountAggregator) Add(evt Event) bool {
+	switch e := evt.(type) {
+	case ByteCountEvent:
+		a.AddAt(e.BytesIn(), e.BytesOut(), a.receivedAt(e))
+	case ByteCountClientEvent:
+		a.AddAt(e.BytesIn(), e.BytesOut(), a.receivedAt(e))
+	default:
+		return false
+	}
+	return true
+}
+
+func (a *ByteCountAggregator) receivedAt(e ReceivedEvent) time.Time {
+	if at := e.ReceivedAt(); !at.IsZero() {
+		return at
+	}
+	return a.now()
+}
+
+// AddAt consumes absolute counters received at the given time.
+func (a *ByteCountAggregator) AddAt(bytesIn, bytesOut int64, at time.Time) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if !a.hasLast {
+		a.hasLast = true
+		a.totalIn, a.totalOut = bytesIn, bytesOut
+		a.lastIn, a.lastOut, a.lastAt = bytesIn, bytesOut, at
+		return
+	}
+
+	deltaIn, deltaOut := bytesIn-a.lastIn, bytesOut-a.lastOut
+	if deltaIn < 0 || deltaOut < 0 {
+		// counters were reset, the daemon was restarted
+		a.resets++
+		deltaIn, deltaOut = bytesIn, bytesOut
+	}
+	a.totalIn += deltaIn
+	a.totalOut += deltaOut
+
+	if elapsed := at.Sub(a.lastAt).Seconds(); elapsed > 0 {
+		a.rateIn = float64(deltaIn) / elapsed
+		a.rateOut = float64(deltaOut) / elapsed
+	}
+	a.lastIn, a.lastOut, a.lastAt = bytesIn, bytesOut, at
+}
+
+// RateIn returns the incoming rate in bytes/sec between the last two samples.
+func (a *ByteCountAggregator) RateIn() float64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.rateIn
+}
+
+// RateOut returns the outgoing rate in bytes/sec between the last two samples.
+func (a *ByteCountAggregator) RateOut() float64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.rateOut
+}
+
+// TotalIn returns the cumulative incoming bytes, including the ones counted
+// before the counter resets.
+func (a *ByteCountAggregator) TotalIn() int64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.totalIn
+}
+
+// TotalOut returns the cumulative outgoing bytes, including the ones counted
+// before the counter resets.
+func (a *ByteCountAggregator) TotalOut() int64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.totalOut
+}
+
+// Resets returns the number of detected counter resets.
+func (a *ByteCountAggregator) Resets() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.resets
+}
+
+// LastSeen returns the receive time of the last sample.
+func (a *ByteCountAggregator) LastSeen() time.Time {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.lastAt
+}
@@ -0,0 +1,129 @@
+package ovmgmt
+
+import (
+	"testing"
+	"time"
+)
+
+func TestByteCountAggregator(t *testing.T) {
+	type Sample struct {
+		In, Out int64
+		After   time.Duration
+	}
+	type TestCase struct {
+		Samples      []Sample
+		WantRateIn   float64
+		WantRateOut  float64
+		WantTotalIn  int64
+		WantTotalOut int64
+		WantResets   int
+	}
+	testCases := []TestCase{
+		{
+			Samples:      []Sample{{100, 200, 0}},
+			WantRateIn:   0,
+			WantRateOut:  0,
+			WantTotalIn:  100,
+			WantTotalOut: 200,
+		},
+		{
+			Samples:      []Sample{{100, 200, 0}, {600, 1200, 5 * time.Second}},
+			WantRateIn:   100,
+			WantRateOut:  200,
+			WantTotalIn:  600,
+			WantTotalOut: 1200,
+		},
+		{
+			// irregular intervals
+			Samples:      []Sample{{0, 0, 0}, {500, 500, 5 * time.Second}, {1500, 700, 2 * time.Second}},
+			WantRateIn:   500,
+			WantRateOut:  100,
+			WantTotalIn:  1500,
+			WantTotalOut: 700,
+		},
+		{
+			// daemon restart
+			Samples:      []Sample{{1000, 2000, 0}, {2000, 4000, 5 * time.Second}, {300, 100, 5 * time.Second}},
+			WantRateIn:   60,
+			WantRateOut:  20,
+			WantTotalIn:  2300,
+			WantTotalOut: 4100,
+			WantResets:   1,
+		},
+		{
+			// same receive time, rate is kept
+			Samples:      []Sample{{0, 0, 0}, {100, 100, time.Second}, {200, 200, 0}},
+			WantRateIn:   100,
+			WantRateOut:  100,
+			WantTotalIn:  200,
+			WantTotalOut: 200,
+		},
+	}
+
+	for i, testCase := range testCases {
+		a := NewByteCountAggregator()
+		at := time.Unix(1584536294, 0)
+		a.now = func() time.Time { return at }
+
+		for _, s := range testCase.Samples {
+			at = at.Add(s.After)
+			if !a.Add(ByteCountEvent{bytesIn: s.In, bytesOut: s.Out}) {
+				t.Errorf("test %d Add rejected ByteCountEvent", i)
+			}
+		}
+
+		if got, want := a.RateIn(), testCase.WantRateIn; got != want {
+			t.Errorf("test %d RateIn returned %f; want %f", i, got, want)
+		}
+		if got, want := a.RateOut(), testCase.WantRateOut; got != want {
+			t.Errorf("test %d RateOut returned %f; want %f", i, got, want)
+		}
+		if got, want := a.TotalIn(), testCase.WantTotalIn; got != want {
+			t.Errorf("test %d TotalIn returned %d; want %d", i, got, want)
+		}
+		if got, want := a.TotalOut(), testCase.WantTotalOut; got != want {
+			t.Errorf("test %d TotalOut returned %d; want %d", i, got, want)
+		}
+		if got, want := a.Resets(), testCase.WantResets; got != want {
+			t.Errorf("test %d Resets returned %d; want %d", i, got, want)
+		}
+		if got, want := a.LastSeen(), at; !got.Equal(want) {
+			t.Errorf("test %d LastSeen returned %s; want %s", i, got, want)
+		}
+	}
+}
+
+func TestByteCountAggregatorClientEvent(t *testing.T) {
+	a := NewByteCountAggregator()
+	at := time.Unix(1584536294, 0)
+	a.now = func() time.Time { return at }
+
+	a.Add(ByteCountClientEvent{cid: 1, bytesIn: 10, bytesOut: 20})
+	at = at.Add(time.Second)
+	a.Add(ByteCountClientEvent{cid: 1, bytesIn: 20, bytesOut: 40})
+
+	if a.RateIn() != 10 || a.RateOut() != 20 {
+		t.Errorf("got rates %f/%f; want 10/20", a.RateIn(), a.RateOut())
+	}
+	if a.Add(NewHoldEvent("")) {
+		t.Errorf("Add accepted HoldEvent")
+	}
+}
+
+func TestByteCountAggregatorReceivedAt(t *testing.T) {
+	a := NewByteCountAggregator()
+	// the events are consumed in a burst, long after they are received
+	now := time.Unix(1584536394, 0)
+	a.now = func() time.Time { return now }
+
+	at := time.Unix(1584536294, 0)
+	a.Add(stampEvent(ByteCountEvent{bytesIn: 100, bytesOut: 200}, at))
+	a.Add(stampEvent(ByteCountEvent{bytesIn: 600, bytesOut: 1200}, at.Add(5*time.Second)))
+
+	if a.RateIn() != 100 || a.RateOut() != 200 {
+		t.Errorf("got rates %f/%f; want 100/200", a.RateIn(), a.RateOut())
+	}
+	if got, want := a.LastSeen(), at.Add(5*time.Second); !got.Equal(want) {
+		t.Errorf("LastSeen returned %s; want %s", got, want)
+	}
+}
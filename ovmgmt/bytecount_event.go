@@ -12,6 +12,7 @@ import (
 // single connection managed by the target process, and ClientId returns
 // the empty string.
 type ByteCountClientEvent struct {
+	receivedAt
 	body     string
 	cid      int64
 	bytesIn  int64
@@ -41,6 +42,10 @@ func NewByteCountClientEvent(body string) (ByteCountClientEvent, error) {
 	return e, nil
 }
 
+func (e ByteCountClientEvent) Keyword() string {
+	return byteCountCliEventKW
+}
+
 func (e ByteCountClientEvent) Raw() string {
 	return e.body
 }
@@ -68,6 +73,7 @@ func (e ByteCountClientEvent) String() string {
 // single connection managed by the target process, and ClientId returns
 // the empty string.
 type ByteCountEvent struct {
+	receivedAt
 	body     string
 	bytesIn  int64
 	bytesOut int64
@@ -90,6 +96,10 @@ func NewByteCountEvent(body string) (ByteCountEvent, error) {
 	return e, nil
 }
 
+func (e ByteCountEvent) Keyword() string {
+	return byteCountEventKW
+}
+
 func (e ByteCountEvent) Raw() string {
 	return e.body
 }
@@ -0,0 +1,182 @@
+package ovmgmt
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ClientUsage is the traffic of a single client session.
+//
+// BytesIn is the number of bytes received from the client,
+// BytesOut is the number of bytes sent to the client.
+type ClientUsage struct {
+	ClientId   int64
+	CommonName string
+	BytesIn    int64
+	BytesOut   int64
+	FirstSeen  time.Time
+	LastSeen   time.Time
+	// Final is set when the usage is finalized by DISCONNECT notification
+	Final bool
+	// Expired is set when the usage is finalized by Expire
+	Expired bool
+}
+
+// ClientByteCountTracker maintains per-client traffic in server mode.
+//
+// It ingests ByteCountClientEvent samples and CLIENT notifications. When
+// the client disconnects, its usage is finalized with bytes_received and
+// bytes_sent env values as the authoritative final numbers, removed from
+// the tracker and passed to the OnFinal callback. Sessions which never
+// got DISCONNECT notification can be finalized with Expire.
+//
+// It is safe for concurrent use.
+type ClientByteCountTracker struct {
+	mu      sync.Mutex
+	now     func() time.Time
+	clients map[int64]*ClientUsage
+	onFinal func(ClientUsage)
+}
+
+func NewClientByteCountTracker() *ClientByteCountTracker {
+	return &ClientByteCountTracker{
+		now:     time.Now,
+		clients: make(map[int64]*ClientUsage),
+	}
+}
+
+// OnFinal sets the callback called for each finalized client usage.
+// The callback is called without holding internal locks.
+func (t *ClientByteCountTracker) OnFinal(fn func(ClientUsage)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.onFinal = fn
+}
+
+// Add consumes ByteCountClientEvent or ClientEvent received just now,
+// other events are ignored and false is returned.
+func (t *ClientByteCountTracker) Add(evt Event) bool {
+	var final []ClientUsage
+
+	switch e := evt.(type) {
+	case ByteCountClientEvent:
+		t.mu.Lock()
+		u := t.get(e.ClientId())
+		u.BytesIn, u.BytesOut = e.BytesIn(), e.BytesOut()
+		t.mu.Unlock()
+	case ClientEvent:
+		final = t.addClientEvent(e)
+	default:
+		return false
+	}
+
+	t.finalize(final)
+	return true
+}
+
+func (t *ClientByteCountTracker) addClientEvent(e ClientEvent) []ClientUsage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var final []ClientUsage
+	cid := e.ClientId()
+
+	switch e.Type() {
+	case CEConnect:
+		// CID reuse: the previous session is gone for sure
+		if u, ok := t.clients[cid]; ok {
+			delete(t.clients, cid)
+			u.Expired = true
+			final = append(final, *u)
+		}
+		t.get(cid).CommonName = e.RawEnv("common_name")
+	case CEEstablished, CEReauth:
+		t.get(cid).CommonName = e.RawEnv("common_name")
+	case CEDisconnect:
+		u := t.get(cid)
+		delete(t.clients, cid)
+		if cn := e.RawEnv("common_name"); cn != "" {
+			u.CommonName = cn
+		}
+		if v, err := strconv.ParseInt(e.RawEnv("bytes_received"), 10, 64); err == nil {
+			u.BytesIn = v
+		}
+		if v, err := strconv.ParseInt(e.RawEnv("bytes_sent"), 10, 64); err == nil {
+			u.BytesOut = v
+		}
+		u.Final = true
+		final = append(final, *u)
+	}
+	return final
+}
+
+// get returns the usage of the client, creating it if needed.
+// Must be called with t.mu held.
+func (t *ClientByteCountTracker) get(cid int64) *ClientUsage {
+	now := t.now()
+	u, ok := t.clients[cid]
+	if !ok {
+		u = &ClientUsage{ClientId: cid, FirstSeen: now}
+		t.clients[cid] = u
+	}
+	u.LastSeen = now
+	return u
+}
+
+// Expire finalizes the usage of clients not seen since the given time
+// and returns it.
+func (t *ClientByteCountTracker) Expire(notSeenSince time.Time) []ClientUsage {
+	t.mu.Lock()
+	var final []ClientUsage
+	for cid, u := range t.clients {
+		if u.LastSeen.Before(notSeenSince) {
+			delete(t.clients, cid)
+			u.Expired = true
+			final = append(final, *u)
+		}
+	}
+	t.mu.Unlock()
+
+	sortClientUsage(final)
+	t.finalize(final)
+	return final
+}
+
+// Snapshot returns a copy of the current usage of active clients,
+// sorted by client id.
+func (t *ClientByteCountTracker) Snapshot() []ClientUsage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	snap := make([]ClientUsage, 0, len(t.clients))
+	for _, u := range t.clients {
+		snap = append(snap, *u)
+	}
+	sortClientUsage(snap)
+	return snap
+}
+
+func (t *ClientByteCountTracker) finalize(final []ClientUsage) {
+	if len(final) == 0 {
+		return
+	}
+
+	t.mu.Lock()
+	fn := t.onFinal
+	t.mu.Unlock()
+
+	if fn == nil {
+		return
+	}
+	for _, u := range final {
+		fn(u)
+	}
+}
+
+func sortClientUsage(u []ClientUsage) {
+	sort.Slice(u, func(i, j int) bool {
+		return u[i].ClientId < u[j].ClientId
+	})
+}
@@ -0,0 +1,88 @@
+package ovmgmt
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func mustClientEvent(t *testing.T, payload ...string) ClientEvent {
+	t.Helper()
+	ce, err := NewClientEvent(payload)
+	if err != nil {
+		t.Fatalf("can't build client event from %q: %s", payload, err)
+	}
+	return ce
+}
+
+func TestClientByteCountTracker(t *testing.T) {
+	tr := NewClientByteCountTracker()
+	start := time.Unix(1584536294, 0)
+	at := start
+	tr.now = func() time.Time { return at }
+
+	var final []ClientUsage
+	tr.OnFinal(func(u ClientUsage) {
+		final = append(final, u)
+	})
+
+	tr.Add(mustClientEvent(t, "CONNECT,1,0", "ENV,common_name=alice"))
+	tr.Add(mustClientEvent(t, "CONNECT,2,0", "ENV,common_name=bob"))
+	at = at.Add(5 * time.Second)
+	tr.Add(ByteCountClientEvent{cid: 1, bytesIn: 100, bytesOut: 200})
+	tr.Add(ByteCountClientEvent{cid: 2, bytesIn: 10, bytesOut: 20})
+	if tr.Add(NewHoldEvent("")) {
+		t.Errorf("Add accepted HoldEvent")
+	}
+
+	snap := tr.Snapshot()
+	wantSnap := []ClientUsage{
+		{ClientId: 1, CommonName: "alice", BytesIn: 100, BytesOut: 200, FirstSeen: start, LastSeen: at},
+		{ClientId: 2, CommonName: "bob", BytesIn: 10, BytesOut: 20, FirstSeen: start, LastSeen: at},
+	}
+	if !reflect.DeepEqual(snap, wantSnap) {
+		t.Errorf("Snapshot returned\n%+v\nwant\n%+v", snap, wantSnap)
+	}
+	// snapshot is a copy
+	snap[0].BytesIn = 0
+	if tr.Snapshot()[0].BytesIn != 100 {
+		t.Errorf("Snapshot is not a copy")
+	}
+
+	// env values are authoritative
+	at = at.Add(time.Second)
+	tr.Add(mustClientEvent(t, "DISCONNECT,1", "ENV,common_name=alice", "ENV,bytes_received=150", "ENV,bytes_sent=250"))
+	wantFinal := []ClientUsage{
+		{ClientId: 1, CommonName: "alice", BytesIn: 150, BytesOut: 250, FirstSeen: start, LastSeen: at, Final: true},
+	}
+	if !reflect.DeepEqual(final, wantFinal) {
+		t.Errorf("OnFinal got\n%+v\nwant\n%+v", final, wantFinal)
+	}
+
+	// CID reuse after disconnect starts a fresh session
+	final = nil
+	tr.Add(ByteCountClientEvent{cid: 1, bytesIn: 1, bytesOut: 2})
+	snap = tr.Snapshot()
+	if len(snap) != 2 || snap[0].BytesIn != 1 || !snap[0].FirstSeen.Equal(at) {
+		t.Errorf("CID reuse after disconnect got %+v", snap)
+	}
+
+	// CID reuse without disconnect finalizes the old session
+	tr.Add(mustClientEvent(t, "CONNECT,1,0", "ENV,common_name=carol"))
+	if len(final) != 1 || !final[0].Expired || final[0].BytesIn != 1 {
+		t.Errorf("CID reuse without disconnect got final %+v", final)
+	}
+
+	// missing DISCONNECT, bob was last seen at start+5s
+	final = nil
+	expired := tr.Expire(start.Add(6 * time.Second))
+	if len(expired) != 1 || expired[0].ClientId != 2 || !expired[0].Expired || expired[0].Final {
+		t.Errorf("Expire returned %+v", expired)
+	}
+	if !reflect.DeepEqual(final, expired) {
+		t.Errorf("OnFinal got %+v; want %+v", final, expired)
+	}
+	if snap := tr.Snapshot(); len(snap) != 1 || snap[0].CommonName != "carol" {
+		t.Errorf("Snapshot after Expire returned %+v", snap)
+	}
+}
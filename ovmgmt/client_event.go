@@ -1,8 +1,10 @@
 package ovmgmt
 
 import (
+	"encoding/base64"
 	"errors"
 	"fmt"
+	"net"
 	"strconv"
 	"strings"
 )
@@ -45,6 +47,15 @@ import (
 //
 //     >CLIENT:ADDRESS,{CID},{ADDR},{PRI}
 //
+// (5) Notify that a client answered a pending challenge (OpenVPN 2.5+).
+//     The response is base64 encoded.
+//
+//     >CLIENT:CR_RESPONSE,{CID},{KID},{response_base64}
+//     >CLIENT:ENV,name1=val1
+//     >CLIENT:ENV,name2=val2
+//     >CLIENT:ENV,...
+//     >CLIENT:ENV,END
+//
 // Variables:
 //
 // CID --  Client ID, numerical ID for each connecting client, sequence = 0,1,2,...
@@ -71,23 +82,116 @@ const (
 	CEEstablished ClientEventNotification = "ESTABLISHED"
 	CEDisconnect  ClientEventNotification = "DISCONNECT"
 	CEAddress     ClientEventNotification = "ADDRESS"
+	CECRResponse  ClientEventNotification = "CR_RESPONSE"
 )
 
 type OVpnEnvironment map[string]string
 
+// EnvVar is a single env variable of CLIENT or UPDOWN notification.
+type EnvVar struct {
+	Name  string
+	Value string
+}
+
+// envBlock is a parsed ENV block, names are kept in the wire order
+type envBlock struct {
+	vars  OVpnEnvironment
+	names []string
+	dups  []string
+}
+
+// env returns the value of the variable and whether it is present
+func (b envBlock) env(key string, o *parseOptions) (string, bool) {
+	v, ok := b.vars[key]
+	return o.sanitize(v), ok
+}
+
+// list returns a copy of the variables in the wire order
+func (b envBlock) list(o *parseOptions) []EnvVar {
+	vars := make([]EnvVar, len(b.names))
+	for i, name := range b.names {
+		vars[i] = EnvVar{Name: o.sanitize(name), Value: o.sanitize(b.vars[name])}
+	}
+	return vars
+}
+
+// keys returns a copy of the names in the wire order
+func (b envBlock) keys() []string {
+	names := make([]string, len(b.names))
+	copy(names, b.names)
+	return names
+}
+
+// defaultRedactedEnvKeys are env variables hidden from ClientEvent String()
+// and Raw() output by default, see DefaultRedactedEnvKeys
+var defaultRedactedEnvKeys = []string{
+	"password",
+	"untrusted_password",
+	"auth_token",
+	"session_id",
+	"pkcs11_pin",
+}
+
+var defaultRedactedEnvKeySet = envKeySet(defaultRedactedEnvKeys)
+
+// DefaultRedactedEnvKeys returns the env variables hidden from ClientEvent
+// String() and Raw() output by default, see WithRedactedEnvKeys.
+func DefaultRedactedEnvKeys() []string {
+	keys := make([]string, len(defaultRedactedEnvKeys))
+	copy(keys, defaultRedactedEnvKeys)
+	return keys
+}
+
+func envKeySet(keys []string) map[string]bool {
+	set := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		set[k] = true
+	}
+	return set
+}
+
+// redactedEnvKeys returns the set of WithRedactedEnvKeys, the default one
+// if it's not set
+func (o *parseOptions) redactedEnvKeys() map[string]bool {
+	if o == nil || o.redactedEnvKeySet == nil {
+		return defaultRedactedEnvKeySet
+	}
+	return o.redactedEnvKeySet
+}
+
+// redacted returns a copy of envs with the values of keys replaced
+func (envs OVpnEnvironment) redacted(keys map[string]bool) OVpnEnvironment {
+	r := make(OVpnEnvironment, len(envs))
+	for k, v := range envs {
+		if keys[k] {
+			v = redactedValue
+		}
+		r[k] = v
+	}
+	return r
+}
+
 type ClientEvent struct {
+	receivedAt
 	rawHeader string
 	ceType    ClientEventNotification
 	cid       int64
 	kid       int64
 	addr      string
 	isAddrPri bool
-	envs      OVpnEnvironment
+	response  []byte
+	envs      envBlock
+	truncated bool
+	// options of the client which received the event
+	opts *parseOptions
 }
 
 func NewClientEvent(payload []string) (ClientEvent, error) {
 	//     >CLIENT:CONNECT|REAUTH,{CID},{KID}
-	c := ClientEvent{}
+	c := ClientEvent{ceType: CEUnknown}
+	if len(payload) == 0 {
+		return c, errors.New("empty client event")
+	}
 
 	c.rawHeader = payload[0]
 	params := stringsSplitNK(payload[0], fieldSep, 4, 4)
@@ -103,6 +207,8 @@ func NewClientEvent(payload []string) (ClientEvent, error) {
 		c.ceType = CEDisconnect
 	case CEAddress:
 		c.ceType = CEAddress
+	case CECRResponse:
+		c.ceType = CECRResponse
 	default:
 		c.ceType = CEUnknown
 		return c, errors.New("unknown client event type: " + params[0])
@@ -115,14 +221,22 @@ func NewClientEvent(payload []string) (ClientEvent, error) {
 		return c, err
 	}
 
-	// >CLIENT:CONNECT|REAUTH,{CID},{KID}
-	if c.ceType == CEConnect || c.ceType == CEReauth {
+	// >CLIENT:CONNECT|REAUTH|CR_RESPONSE,{CID},{KID}
+	if c.ceType == CEConnect || c.ceType == CEReauth || c.ceType == CECRResponse {
 		c.kid, err = strconv.ParseInt(params[2], 10, 64)
 		if err != nil {
 			return c, err
 		}
 	}
 
+	// >CLIENT:CR_RESPONSE,{CID},{KID},{response_base64}
+	if c.ceType == CECRResponse {
+		c.response, err = base64.StdEncoding.DecodeString(params[3])
+		if err != nil {
+			return c, err
+		}
+	}
+
 	// >CLIENT:ADDRESS,{CID},{ADDR},{PRI}
 	if c.ceType == CEAddress {
 		c.addr = params[2]
@@ -132,21 +246,48 @@ func NewClientEvent(payload []string) (ClientEvent, error) {
 	}
 
 	// multiline client events
-	c.envs = make(OVpnEnvironment, bigMessageLines)
-	for _, line := range payload[1:] {
+	c.envs, err = parseEnvLines(payload[1:])
+	return c, err
+}
+
+// parseEnvLines parses "ENV,name=val" lines of multi-line notifications.
+// If the name is duplicated, the last value wins, but the name keeps
+// the position of its first occurrence.
+func parseEnvLines(lines []string) (envBlock, error) {
+	envs := envBlock{
+		vars:  make(OVpnEnvironment, len(lines)),
+		names: make([]string, 0, len(lines)),
+	}
+	for _, line := range lines {
 		if !strings.HasPrefix(line, clientEnvMarker+fieldSep) {
-			return c, errors.New("no env prefix in client event line: " + line)
+			return envs, errors.New("no env prefix in event line: " + line)
 		}
 		kvLine := line[len(clientEnvMarker+fieldSep):]
 		parts := stringsSplitNK(kvLine, clientEnvKVSep, 2, 2)
-		c.envs[parts[0]] = parts[1]
+		if _, ok := envs.vars[parts[0]]; ok {
+			envs.dups = append(envs.dups, parts[0])
+		} else {
+			envs.names = append(envs.names, parts[0])
+		}
+		envs.vars[parts[0]] = parts[1]
 	}
+	return envs, nil
+}
 
-	return c, nil
+func (c ClientEvent) Keyword() string {
+	return clientEventKW
 }
 
+// Raw returns the event header and env variables, with secret values
+// redacted, see WithRedactedEnvKeys.
 func (c ClientEvent) Raw() string {
-	return fmt.Sprintf("%s\t%s", c.rawHeader, c.envs)
+	return fmt.Sprintf("%s\t%s", c.rawHeader, c.envs.vars.redacted(c.opts.redactedEnvKeys()))
+}
+
+// RawUnredacted is the same as Raw, but secret values are not redacted.
+// Be careful, its output is not supposed to be logged.
+func (c ClientEvent) RawUnredacted() string {
+	return fmt.Sprintf("%s\t%s", c.rawHeader, c.envs.vars)
 }
 
 func (c ClientEvent) Type() ClientEventNotification {
@@ -165,23 +306,73 @@ func (c ClientEvent) Addr() string {
 	return c.addr
 }
 
+// AddrNet returns the address of ADDRESS notification as net.IPNet, host
+// addresses get the full-length mask. The address may be in either
+// 1.2.3.4, 1.2.3.0/255.255.255.0 or IPv6 form.
+func (c ClientEvent) AddrNet() (*net.IPNet, error) {
+	return ParseIPNet(c.addr)
+}
+
+// IsSubnet reports whether the address of ADDRESS notification is
+// a subnet rather than a host address.
+func (c ClientEvent) IsSubnet() bool {
+	ipNet, err := c.AddrNet()
+	if err != nil {
+		return false
+	}
+	ones, bits := ipNet.Mask.Size()
+	return ones != bits
+}
+
 func (c ClientEvent) IsAddrPrimary() bool {
 	return c.isAddrPri
 }
 
+// Response returns the decoded challenge response of CR_RESPONSE event.
+func (c ClientEvent) Response() []byte {
+	return c.response
+}
+
 func (c ClientEvent) RawEnv(key string) string {
-	return c.envs[key]
+	return c.opts.sanitize(c.envs.vars[key])
+}
+
+// Complete reports whether the whole notification is received, i.e.
+// the env block isn't cut off before ENV,END.
+func (c ClientEvent) Complete() bool {
+	return !c.truncated
+}
+
+// Envs returns a copy of env variables in the wire order. Values are not
+// redacted.
+func (c ClientEvent) Envs() []EnvVar {
+	return c.envs.list(c.opts)
+}
+
+// EnvKeys returns names of env variables in the wire order.
+func (c ClientEvent) EnvKeys() []string {
+	return c.envs.keys()
+}
+
+// DuplicateEnvKeys returns names of env variables which occurred more than
+// once in the notification, only the last value of such variables is kept.
+func (c ClientEvent) DuplicateEnvKeys() []string {
+	dups := make([]string, len(c.envs.dups))
+	copy(dups, c.envs.dups)
+	return dups
 }
 
 func (c ClientEvent) String() string {
 	switch c.Type() {
 	case CEConnect, CEReauth:
-		return fmt.Sprintf("[%s]cid:%d,kid:%d,env:%v", c.Type(), c.ClientId(), c.KeyId(), c.envs)
+		return Sanitize(fmt.Sprintf("[%s]cid:%d,kid:%d,env:%v", c.Type(), c.ClientId(), c.KeyId(), c.envs.vars.redacted(c.opts.redactedEnvKeys())))
+	case CECRResponse:
+		return Sanitize(fmt.Sprintf("[%s]cid:%d,kid:%d,response:%d bytes,env:%v", c.Type(), c.ClientId(), c.KeyId(), len(c.Response()), c.envs.vars.redacted(c.opts.redactedEnvKeys())))
 	case CEEstablished, CEDisconnect:
-		return fmt.Sprintf("[%s]cid:%d,envs:%v", c.Type(), c.ClientId(), c.envs)
+		return Sanitize(fmt.Sprintf("[%s]cid:%d,envs:%v", c.Type(), c.ClientId(), c.envs.vars.redacted(c.opts.redactedEnvKeys())))
 	case CEAddress:
-		return fmt.Sprintf("[%s]cid:%d,addr:%s,isPrimary:%t", c.Type(), c.ClientId(), c.Addr(), c.IsAddrPrimary())
+		return Sanitize(fmt.Sprintf("[%s]cid:%d,addr:%s,isPrimary:%t", c.Type(), c.ClientId(), c.Addr(), c.IsAddrPrimary()))
 	default:
-		return fmt.Sprintf("[%s]%s", c.Type(), c.Raw())
+		return Sanitize(fmt.Sprintf("[%s]%s", c.Type(), c.Raw()))
 	}
 }
@@ -0,0 +1,224 @@
+package ovmgmt
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Well-known env variables of CLIENT notifications, see "Environmental
+// Variables" section of the OpenVPN man page.
+const (
+	EnvCommonName    = "common_name"
+	EnvUsername      = "username"
+	EnvUntrustedIP   = "untrusted_ip"
+	EnvUntrustedIP6  = "untrusted_ip6"
+	EnvUntrustedPort = "untrusted_port"
+	EnvTrustedIP     = "trusted_ip"
+	EnvTrustedIP6    = "trusted_ip6"
+	EnvTrustedPort   = "trusted_port"
+	EnvIVVer         = "IV_VER"
+	EnvIVPlat        = "IV_PLAT"
+	EnvIVCiphers     = "IV_CIPHERS"
+	EnvIVProto       = "IV_PROTO"
+	EnvTimeUnix      = "time_unix"
+	EnvTimeAscii     = "time_ascii"
+	EnvBytesReceived = "bytes_received"
+	EnvBytesSent     = "bytes_sent"
+	EnvTimeDuration  = "time_duration"
+	EnvSignal        = "signal"
+)
+
+var ErrNoEnvVariable = NewOVpnError("no such env variable")
+
+// Env returns the value of env variable and whether it is present.
+func (c ClientEvent) Env(key string) (string, bool) {
+	return c.envs.env(key, c.opts)
+}
+
+// CommonName returns the X509 common name of the client (common_name).
+// UNDEF is returned as the empty string if WithNormalizeUndef is set.
+func (c ClientEvent) CommonName() (string, bool) {
+	v, ok := c.Env(EnvCommonName)
+	return c.opts.undef(v), ok
+}
+
+// Username returns the username provided by the client (username).
+// UNDEF is returned as the empty string if WithNormalizeUndef is set.
+func (c ClientEvent) Username() (string, bool) {
+	v, ok := c.Env(EnvUsername)
+	return c.opts.undef(v), ok
+}
+
+// IsAuthenticated reports whether the common name of the client is known,
+// i.e. present, not empty and not UNDEF.
+func (c ClientEvent) IsAuthenticated() bool {
+	return isKnownCommonName(c.envs.vars[EnvCommonName])
+}
+
+// UntrustedIP returns the actual IP address of the connecting client
+// (untrusted_ip or untrusted_ip6), before it is authenticated.
+func (c ClientEvent) UntrustedIP() (net.IP, error) {
+	return c.envIP(EnvUntrustedIP, EnvUntrustedIP6)
+}
+
+// UntrustedPort returns the actual port number of the connecting client
+// (untrusted_port), before it is authenticated.
+func (c ClientEvent) UntrustedPort() (int, error) {
+	return c.envInt(EnvUntrustedPort)
+}
+
+// TrustedIP returns the actual IP address of the authenticated client
+// (trusted_ip or trusted_ip6).
+func (c ClientEvent) TrustedIP() (net.IP, error) {
+	return c.envIP(EnvTrustedIP, EnvTrustedIP6)
+}
+
+// TrustedPort returns the actual port number of the authenticated client
+// (trusted_port).
+func (c ClientEvent) TrustedPort() (int, error) {
+	return c.envInt(EnvTrustedPort)
+}
+
+// IVVer returns the OpenVPN version of the client (IV_VER), if the client
+// sends it with --push-peer-info.
+func (c ClientEvent) IVVer() (string, bool) {
+	return c.Env(EnvIVVer)
+}
+
+// TimeUnix returns the client connection time (time_unix).
+func (c ClientEvent) TimeUnix() (time.Time, error) {
+	ts, err := c.envInt64(EnvTimeUnix)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(ts, 0), nil
+}
+
+// time_ascii is formatted by ctime(3) in the daemon's local time zone
+const envTimeAsciiLayout = time.ANSIC
+
+// ConnectedAt returns the client connection time. It's taken from time_unix
+// and falls back to time_ascii if the former is absent, which is parsed
+// in the location of WithStatusTimeLocation.
+func (c ClientEvent) ConnectedAt() (time.Time, error) {
+	ts, err := c.TimeUnix()
+	if err != ErrNoEnvVariable {
+		return ts, err
+	}
+
+	v, ok := c.Env(EnvTimeAscii)
+	if !ok {
+		return time.Time{}, ErrNoEnvVariable
+	}
+	return time.ParseInLocation(envTimeAsciiLayout, v, c.opts.location())
+}
+
+// Duration returns the session age at the given moment, or 0 if
+// the connection time is unknown.
+func (c ClientEvent) Duration(now time.Time) time.Duration {
+	ts, err := c.ConnectedAt()
+	if err != nil {
+		return 0
+	}
+	return now.Sub(ts)
+}
+
+// BytesReceived returns the total number of bytes received from the client
+// during the session (bytes_received). Present in DISCONNECT notifications.
+func (c ClientEvent) BytesReceived() (int64, error) {
+	return c.envInt64(EnvBytesReceived)
+}
+
+// BytesSent returns the total number of bytes sent to the client
+// during the session (bytes_sent). Present in DISCONNECT notifications.
+func (c ClientEvent) BytesSent() (int64, error) {
+	return c.envInt64(EnvBytesSent)
+}
+
+// SessionSummary is the final session counters of a disconnected client.
+type SessionSummary struct {
+	BytesReceived int64
+	BytesSent     int64
+	Duration      time.Duration
+	// Signal is the disconnect reason, e.g. SIGTERM or SIGUSR1
+	Signal string
+	errs   []error
+}
+
+func (s SessionSummary) ParsingErrors() []error {
+	return s.errs
+}
+
+func (s SessionSummary) Error() string {
+	if len(s.errs) == 0 {
+		return ""
+	}
+
+	errstr := make([]string, len(s.errs))
+	for i, err := range s.errs {
+		errstr[i] = err.Error()
+	}
+	return strings.Join(errstr, "; ")
+}
+
+// SessionSummary returns the final session counters from DISCONNECT env
+// (bytes_received, bytes_sent, time_duration and signal). Unlike the last
+// BYTECOUNT_CLI sample, these are the authoritative final numbers.
+//
+// Fields which are absent or can't be parsed are left zero, the errors
+// are available via ParsingErrors().
+func (c ClientEvent) SessionSummary() SessionSummary {
+	s := SessionSummary{}
+	if c.ceType != CEDisconnect {
+		s.errs = append(s.errs, errors.New("not a DISCONNECT event: "+string(c.ceType)))
+	}
+
+	var err error
+	s.BytesReceived, err = c.BytesReceived()
+	if err != nil {
+		s.errs = append(s.errs, fmt.Errorf("%s: %w", EnvBytesReceived, err))
+	}
+	s.BytesSent, err = c.BytesSent()
+	if err != nil {
+		s.errs = append(s.errs, fmt.Errorf("%s: %w", EnvBytesSent, err))
+	}
+
+	duration, err := c.envInt64(EnvTimeDuration)
+	if err != nil {
+		s.errs = append(s.errs, fmt.Errorf("%s: %w", EnvTimeDuration, err))
+	}
+	s.Duration = time.Duration(duration) * time.Second
+
+	s.Signal, _ = c.Env(EnvSignal)
+	return s
+}
+
+func (c ClientEvent) envInt64(key string) (int64, error) {
+	v, ok := c.Env(key)
+	if !ok {
+		return 0, ErrNoEnvVariable
+	}
+	return strconv.ParseInt(v, 10, 64)
+}
+
+func (c ClientEvent) envInt(key string) (int, error) {
+	v, ok := c.Env(key)
+	if !ok {
+		return 0, ErrNoEnvVariable
+	}
+	return strconv.Atoi(v)
+}
+
+func (c ClientEvent) envIP(key4, key6 string) (net.IP, error) {
+	v, ok := c.Env(key4)
+	if !ok {
+		if v, ok = c.Env(key6); !ok {
+			return nil, ErrNoEnvVariable
+		}
+	}
+	return ParseIPAddr(v)
+}
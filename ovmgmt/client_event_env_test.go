@@ -0,0 +1,255 @@
+package ovmgmt
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// captured from OpenVPN 2.4 server with --management-client-auth
+var connectEnvPayload = []string{
+	"CONNECT,5,1",
+	"ENV,n_clients=1",
+	"ENV,password=",
+	"ENV,untrusted_port=52331",
+	"ENV,untrusted_ip=198.51.100.7",
+	"ENV,common_name=alice",
+	"ENV,username=alice@example.com",
+	"ENV,IV_COMP_STUB=1",
+	"ENV,IV_COMP_STUBv2=1",
+	"ENV,IV_LZ4=1",
+	"ENV,IV_LZ4v2=1",
+	"ENV,IV_LZO=1",
+	"ENV,IV_NCP=2",
+	"ENV,IV_PROTO=2",
+	"ENV,IV_TCPNL=1",
+	"ENV,IV_PLAT=linux",
+	"ENV,IV_VER=2.4.7",
+	"ENV,tls_serial_hex_0=2b:a9:6e:19:d4:d9:1a:3b:7e:5c:10:0f:3c:4f:56:33",
+	"ENV,tls_serial_0=57921234856393428740458327081374750259",
+	"ENV,tls_digest_0=df:5a:7c:e0:e4:14:4e:d4:2f:0d:2e:48:2a:d5:c6:97:a6:19:0c:2e",
+	"ENV,tls_id_0=CN=alice",
+	"ENV,X509_0_CN=alice",
+	"ENV,remote_port_1=1194",
+	"ENV,local_port_1=1194",
+	"ENV,proto_1=udp",
+	"ENV,daemon_pid=1742",
+	"ENV,daemon_start_time=1584536200",
+	"ENV,daemon_log_redirect=0",
+	"ENV,daemon=1",
+	"ENV,verb=3",
+	"ENV,config=/etc/openvpn/server.conf",
+	"ENV,ifconfig_local=10.8.0.1",
+	"ENV,ifconfig_netmask=255.255.255.0",
+	"ENV,script_context=init",
+	"ENV,tun_mtu=1500",
+	"ENV,dev=tun0",
+	"ENV,dev_type=tun",
+	"ENV,redirect_gateway=0",
+}
+
+var disconnectEnvPayload = []string{
+	"DISCONNECT,5",
+	"ENV,n_clients=0",
+	"ENV,bytes_sent=7391",
+	"ENV,bytes_received=5523",
+	"ENV,time_duration=93",
+	"ENV,time_unix=1584536294",
+	"ENV,time_ascii=Wed Mar 18 12:58:14 2020",
+	"ENV,ifconfig_pool_remote_ip=10.8.0.6",
+	"ENV,trusted_port=52331",
+	"ENV,trusted_ip=198.51.100.7",
+	"ENV,common_name=alice",
+	"ENV,username=alice@example.com",
+	"ENV,IV_VER=2.4.7",
+	"ENV,signal=SIGTERM",
+	"ENV,dev=tun0",
+}
+
+func TestClientEventEnvAccessors(t *testing.T) {
+	connect := mustClientEvent(t, connectEnvPayload...)
+	disconnect := mustClientEvent(t, disconnectEnvPayload...)
+
+	if cn, ok := connect.CommonName(); !ok || cn != "alice" {
+		t.Errorf("CommonName returned %q, %t", cn, ok)
+	}
+	if u, ok := connect.Username(); !ok || u != "alice@example.com" {
+		t.Errorf("Username returned %q, %t", u, ok)
+	}
+	if ip, err := connect.UntrustedIP(); err != nil || !ip.Equal(net.ParseIP("198.51.100.7")) {
+		t.Errorf("UntrustedIP returned %s, %v", ip, err)
+	}
+	if port, err := connect.UntrustedPort(); err != nil || port != 52331 {
+		t.Errorf("UntrustedPort returned %d, %v", port, err)
+	}
+	if ip, err := connect.TrustedIP(); err != ErrNoEnvVariable || ip != nil {
+		t.Errorf("TrustedIP of CONNECT returned %s, %v", ip, err)
+	}
+	if v, ok := connect.IVVer(); !ok || v != "2.4.7" {
+		t.Errorf("IVVer returned %q, %t", v, ok)
+	}
+	if ts, err := connect.TimeUnix(); err != ErrNoEnvVariable || !ts.IsZero() {
+		t.Errorf("TimeUnix of CONNECT returned %s, %v", ts, err)
+	}
+	if b, err := connect.BytesReceived(); err != ErrNoEnvVariable || b != 0 {
+		t.Errorf("BytesReceived of CONNECT returned %d, %v", b, err)
+	}
+
+	if ip, err := disconnect.TrustedIP(); err != nil || !ip.Equal(net.ParseIP("198.51.100.7")) {
+		t.Errorf("TrustedIP returned %s, %v", ip, err)
+	}
+	if port, err := disconnect.TrustedPort(); err != nil || port != 52331 {
+		t.Errorf("TrustedPort returned %d, %v", port, err)
+	}
+	if ts, err := disconnect.TimeUnix(); err != nil || !ts.Equal(time.Unix(1584536294, 0)) {
+		t.Errorf("TimeUnix returned %s, %v", ts, err)
+	}
+	if b, err := disconnect.BytesReceived(); err != nil || b != 5523 {
+		t.Errorf("BytesReceived returned %d, %v", b, err)
+	}
+	if b, err := disconnect.BytesSent(); err != nil || b != 7391 {
+		t.Errorf("BytesSent returned %d, %v", b, err)
+	}
+	if _, err := disconnect.UntrustedPort(); err != ErrNoEnvVariable {
+		t.Errorf("UntrustedPort of DISCONNECT returned %v", err)
+	}
+
+	// unparsable values
+	bad := mustClientEvent(t, "DISCONNECT,5",
+		"ENV,trusted_ip=not-an-ip",
+		"ENV,trusted_port=port",
+		"ENV,time_unix=yesterday",
+		"ENV,bytes_sent=-",
+		"ENV,common_name=",
+	)
+	if ip, err := bad.TrustedIP(); err == nil || ip != nil {
+		t.Errorf("TrustedIP returned %s, %v", ip, err)
+	}
+	if port, err := bad.TrustedPort(); err == nil || port != 0 {
+		t.Errorf("TrustedPort returned %d, %v", port, err)
+	}
+	if ts, err := bad.TimeUnix(); err == nil || !ts.IsZero() {
+		t.Errorf("TimeUnix returned %s, %v", ts, err)
+	}
+	if b, err := bad.BytesSent(); err == nil || b != 0 {
+		t.Errorf("BytesSent returned %d, %v", b, err)
+	}
+	if cn, ok := bad.CommonName(); !ok || cn != "" {
+		t.Errorf("CommonName returned %q, %t; want empty, present", cn, ok)
+	}
+	if u, ok := bad.Username(); ok || u != "" {
+		t.Errorf("Username returned %q, %t; want empty, absent", u, ok)
+	}
+
+	ipv6 := mustClientEvent(t, "CONNECT,6,0", "ENV,untrusted_ip6=2001:db8::7")
+	if ip, err := ipv6.UntrustedIP(); err != nil || !ip.Equal(net.ParseIP("2001:db8::7")) {
+		t.Errorf("UntrustedIP returned %s, %v", ip, err)
+	}
+}
+
+func TestClientEventSessionSummary(t *testing.T) {
+	s := mustClientEvent(t, disconnectEnvPayload...).SessionSummary()
+	if len(s.ParsingErrors()) != 0 {
+		t.Errorf("SessionSummary returned errors: %s", s.Error())
+	}
+	want := SessionSummary{
+		BytesReceived: 5523,
+		BytesSent:     7391,
+		Duration:      93 * time.Second,
+		Signal:        "SIGTERM",
+	}
+	if !reflect.DeepEqual(s, want) {
+		t.Errorf("SessionSummary returned %+v; want %+v", s, want)
+	}
+
+	// no time_duration
+	payload := make([]string, 0, len(disconnectEnvPayload))
+	for _, line := range disconnectEnvPayload {
+		if !strings.HasPrefix(line, "ENV,time_duration=") {
+			payload = append(payload, line)
+		}
+	}
+	s = mustClientEvent(t, payload...).SessionSummary()
+	if len(s.ParsingErrors()) != 1 || !errors.Is(s.ParsingErrors()[0], ErrNoEnvVariable) {
+		t.Errorf("SessionSummary returned errors %q; want one for time_duration", s.Error())
+	}
+	if s.BytesReceived != 5523 || s.BytesSent != 7391 || s.Duration != 0 {
+		t.Errorf("SessionSummary returned %+v", s)
+	}
+
+	// not a DISCONNECT
+	s = mustClientEvent(t, connectEnvPayload...).SessionSummary()
+	if len(s.ParsingErrors()) != 4 {
+		t.Errorf("SessionSummary of CONNECT returned errors %q", s.Error())
+	}
+}
+
+func TestClientEventConnectedAt(t *testing.T) {
+	type TestCase struct {
+		Payload  []string
+		Expected time.Time
+		Error    bool
+	}
+
+	testCases := []TestCase{
+		{
+			Payload:  []string{"ESTABLISHED,5", "ENV,time_unix=1584536294", "ENV,time_ascii=Thu Jan  1 00:00:00 1970"},
+			Expected: time.Unix(1584536294, 0),
+		},
+		{
+			Payload:  []string{"ESTABLISHED,5", "ENV,time_ascii=Wed Mar 18 12:58:14 2020"},
+			Expected: time.Date(2020, time.March, 18, 12, 58, 14, 0, time.Local),
+		},
+		{
+			Payload:  []string{"ESTABLISHED,5", "ENV,time_ascii=Wed Mar  4 02:08:14 2020"},
+			Expected: time.Date(2020, time.March, 4, 2, 8, 14, 0, time.Local),
+		},
+		{
+			Payload: []string{"ESTABLISHED,5", "ENV,time_unix=now", "ENV,time_ascii=Wed Mar 18 12:58:14 2020"},
+			Error:   true,
+		},
+		{
+			Payload: []string{"ESTABLISHED,5", "ENV,time_ascii=yesterday"},
+			Error:   true,
+		},
+		{
+			Payload: []string{"ESTABLISHED,5", "ENV,common_name=alice"},
+			Error:   true,
+		},
+	}
+
+	for i, tc := range testCases {
+		e := mustClientEvent(t, tc.Payload...)
+		ts, err := e.ConnectedAt()
+		if tc.Error {
+			if err == nil {
+				t.Errorf("test %d ConnectedAt returned %s; want error", i, ts)
+			}
+			if d := e.Duration(time.Now()); d != 0 {
+				t.Errorf("test %d Duration returned %s; want 0", i, d)
+			}
+			continue
+		}
+		if err != nil || !ts.Equal(tc.Expected) {
+			t.Errorf("test %d ConnectedAt returned %s, %v; want %s", i, ts, err, tc.Expected)
+		}
+		if d := e.Duration(tc.Expected.Add(93 * time.Second)); d != 93*time.Second {
+			t.Errorf("test %d Duration returned %s; want 93s", i, d)
+		}
+	}
+
+	if _, err := mustClientEvent(t, "ESTABLISHED,5").ConnectedAt(); err != ErrNoEnvVariable {
+		t.Errorf("ConnectedAt returned %v; want %v", err, ErrNoEnvVariable)
+	}
+
+	// the time zone of the daemon
+	loc := time.FixedZone("UTC+3", 3*60*60)
+	e := mustClientEvent(t, "ESTABLISHED,5", "ENV,time_ascii=Wed Mar 18 12:58:14 2020")
+	e.opts = &parseOptions{statusLocation: loc}
+	if ts, err := e.ConnectedAt(); err != nil || !ts.Equal(time.Date(2020, time.March, 18, 12, 58, 14, 0, loc)) {
+		t.Errorf("ConnectedAt returned %s, %v; want in %s", ts, err, loc)
+	}
+}
@@ -0,0 +1,335 @@
+package ovmgmt
+
+import (
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestClientEventCRResponse(t *testing.T) {
+	lines := []string{
+		">CLIENT:CR_RESPONSE,7,1,MTIzNDU2",
+		">CLIENT:ENV,common_name=alice",
+		">CLIENT:ENV,untrusted_ip=198.51.100.7",
+		">CLIENT:ENV,END",
+		">BYTECOUNT_CLI:7,100,200",
+	}
+
+	events := replayEvents(lines)
+	if len(events) != 2 {
+		t.Fatalf("got %d events; want 2: %v", len(events), events)
+	}
+
+	ce, ok := events[0].(ClientEvent)
+	if !ok {
+		t.Fatalf("event 0 got %T; want %T", events[0], ce)
+	}
+	if got, want := ce.Type(), CECRResponse; got != want {
+		t.Errorf("Type returned %q; want %q", got, want)
+	}
+	if got, want := ce.ClientId(), int64(7); got != want {
+		t.Errorf("ClientId returned %d; want %d", got, want)
+	}
+	if got, want := ce.KeyId(), int64(1); got != want {
+		t.Errorf("KeyId returned %d; want %d", got, want)
+	}
+	if got, want := string(ce.Response()), "123456"; got != want {
+		t.Errorf("Response returned %q; want %q", got, want)
+	}
+	if got, want := ce.RawEnv("common_name"), "alice"; got != want {
+		t.Errorf("RawEnv returned %q; want %q", got, want)
+	}
+
+	if _, ok := events[1].(ByteCountClientEvent); !ok {
+		t.Errorf("event 1 got %T; want ByteCountClientEvent", events[1])
+	}
+}
+
+func TestClientEventCRResponseInvalid(t *testing.T) {
+	testCases := [][]string{
+		{"CR_RESPONSE,7,1,not base64!", "ENV,common_name=alice"},
+		{"CR_RESPONSE,7,,MTIzNDU2"},
+		{"CR_RESPONSE,,1,MTIzNDU2"},
+	}
+
+	for i, testCase := range testCases {
+		evt := upgradeMultilineEvent(clientEventKW, testCase)
+		inv, ok := evt.(InvalidEvent)
+		if !ok {
+			t.Errorf("test %d got %T; want %T", i, evt, inv)
+			continue
+		}
+		if _, ok := inv.Origin().(ClientEvent); !ok {
+			t.Errorf("test %d got %T; want ClientEvent", i, inv.Origin())
+		}
+	}
+}
+
+func TestClientEventRedaction(t *testing.T) {
+	const secret = "s3cr3t-value"
+	ce := mustClientEvent(t,
+		"CONNECT,1,0",
+		"ENV,common_name=alice",
+		"ENV,password="+secret,
+		"ENV,untrusted_password="+secret,
+		"ENV,auth_token="+secret,
+		"ENV,custom_secret="+secret,
+	)
+
+	for _, out := range []string{ce.String(), ce.Raw()} {
+		if !strings.Contains(out, "alice") {
+			t.Errorf("output lacks common_name: %q", out)
+		}
+		if !strings.Contains(out, "custom_secret:"+secret) {
+			t.Errorf("output lacks not redacted value: %q", out)
+		}
+		if strings.Count(out, secret) != 1 {
+			t.Errorf("output leaks the secret: %q", out)
+		}
+		if !strings.Contains(out, "password:***") {
+			t.Errorf("output lacks redacted value: %q", out)
+		}
+	}
+	if got := ce.RawUnredacted(); strings.Count(got, secret) != 4 {
+		t.Errorf("RawUnredacted returned %q; want all values", got)
+	}
+	if got, want := ce.RawEnv("password"), secret; got != want {
+		t.Errorf("RawEnv returned %q; want %q", got, want)
+	}
+
+	// the events of the client use its set
+	withKeys := func(keys ...string) ClientEvent {
+		opts := defaultClientOptions()
+		WithRedactedEnvKeys(keys...)(&opts)
+		return withParseOptions(ce, &opts.parse).(ClientEvent)
+	}
+	extended := withKeys(append(DefaultRedactedEnvKeys(), "custom_secret")...)
+	for _, out := range []string{extended.String(), extended.Raw()} {
+		if strings.Contains(out, secret) {
+			t.Errorf("output leaks the secret: %q", out)
+		}
+	}
+	if got := withKeys().String(); strings.Count(got, secret) != 4 {
+		t.Errorf("String returned %q; want no redaction", got)
+	}
+	// the defaults are intact
+	if got := ce.String(); strings.Count(got, secret) != 1 {
+		t.Errorf("String returned %q; want the default redaction", got)
+	}
+
+	keys := DefaultRedactedEnvKeys()
+	keys[0] = "common_name"
+	if got := DefaultRedactedEnvKeys()[0]; got != "password" {
+		t.Errorf("DefaultRedactedEnvKeys returned %q first after the change of the copy", got)
+	}
+}
+
+func TestClientEventAddrNet(t *testing.T) {
+	type TestCase struct {
+		Input       string
+		WantErr     bool
+		WantNet     string
+		WantSubnet  bool
+		WantPrimary bool
+	}
+	testCases := []TestCase{
+		{"CLIENT:ADDRESS,1,10.8.0.6,1", false, "10.8.0.6/32", false, true},
+		{"CLIENT:ADDRESS,1,192.168.10.0/255.255.255.0,0", false, "192.168.10.0/24", true, false},
+		{"CLIENT:ADDRESS,1,192.168.10.7/255.255.255.0,0", false, "192.168.10.0/24", true, false},
+		{"CLIENT:ADDRESS,1,192.168.10.0/24,0", false, "192.168.10.0/24", true, false},
+		{"CLIENT:ADDRESS,1,2001:db8::1000,1", false, "2001:db8::1000/128", false, true},
+		{"CLIENT:ADDRESS,1,2001:db8:1::/64,0", false, "2001:db8:1::/64", true, false},
+		{"CLIENT:ADDRESS,1,bad,1", true, "", false, true},
+		{"CLIENT:ADDRESS,1,192.168.10.0/255.0.255.0,0", true, "", false, false},
+		{"CLIENT:ADDRESS,1,192.168.10.0/33,0", true, "", false, false},
+		{"CLIENT:ADDRESS,1,,1", true, "", false, true},
+	}
+
+	for i, testCase := range testCases {
+		_, kw, body := splitEvent(testCase.Input)
+		event := upgradeEvent(kw, body)
+
+		ce, ok := event.(ClientEvent)
+		if !ok {
+			t.Errorf("test %d got %T; want %T", i, event, ce)
+			continue
+		}
+
+		ipNet, err := ce.AddrNet()
+		if testCase.WantErr {
+			if err == nil {
+				t.Errorf("test %d AddrNet returned %s; want error", i, ipNet)
+			}
+		} else if err != nil || ipNet.String() != testCase.WantNet {
+			t.Errorf("test %d AddrNet returned %s, %v; want %s", i, ipNet, err, testCase.WantNet)
+		}
+		if got, want := ce.IsSubnet(), testCase.WantSubnet; got != want {
+			t.Errorf("test %d IsSubnet returned %t; want %t", i, got, want)
+		}
+		if got, want := ce.IsAddrPrimary(), testCase.WantPrimary; got != want {
+			t.Errorf("test %d IsAddrPrimary returned %t; want %t", i, got, want)
+		}
+	}
+}
+
+func TestClientEventEnvOrder(t *testing.T) {
+	ce := mustClientEvent(t,
+		"CONNECT,5,1",
+		"ENV,untrusted_port=52331",
+		"ENV,untrusted_ip=198.51.100.7",
+		"ENV,common_name=alice",
+		"ENV,foreign_option_1=dhcp-option DNS 10.8.0.1",
+		"ENV,untrusted_port=52332",
+		"ENV,IV_VER=2.4.7",
+	)
+
+	wantKeys := []string{"untrusted_port", "untrusted_ip", "common_name", "foreign_option_1", "IV_VER"}
+	if got := ce.EnvKeys(); !reflect.DeepEqual(got, wantKeys) {
+		t.Errorf("EnvKeys returned %q; want %q", got, wantKeys)
+	}
+
+	wantEnvs := []EnvVar{
+		{Name: "untrusted_port", Value: "52332"},
+		{Name: "untrusted_ip", Value: "198.51.100.7"},
+		{Name: "common_name", Value: "alice"},
+		{Name: "foreign_option_1", Value: "dhcp-option DNS 10.8.0.1"},
+		{Name: "IV_VER", Value: "2.4.7"},
+	}
+	if got := ce.Envs(); !reflect.DeepEqual(got, wantEnvs) {
+		t.Errorf("Envs returned %v; want %v", got, wantEnvs)
+	}
+	if got, want := ce.RawEnv("untrusted_port"), "52332"; got != want {
+		t.Errorf("RawEnv returned %q; want %q", got, want)
+	}
+	if got, want := ce.DuplicateEnvKeys(), []string{"untrusted_port"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("DuplicateEnvKeys returned %q; want %q", got, want)
+	}
+
+	// returned slices must not alias the event
+	envs := ce.Envs()
+	envs[2].Value = "mallory"
+	keys := ce.EnvKeys()
+	keys[0] = "password"
+	dups := ce.DuplicateEnvKeys()
+	dups[0] = "password"
+
+	if got := ce.Envs(); !reflect.DeepEqual(got, wantEnvs) {
+		t.Errorf("Envs after modification returned %v; want %v", got, wantEnvs)
+	}
+	if got := ce.EnvKeys(); !reflect.DeepEqual(got, wantKeys) {
+		t.Errorf("EnvKeys after modification returned %q; want %q", got, wantKeys)
+	}
+	if got, want := ce.DuplicateEnvKeys(), []string{"untrusted_port"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("DuplicateEnvKeys after modification returned %q; want %q", got, want)
+	}
+	if got, want := ce.RawEnv("common_name"), "alice"; got != want {
+		t.Errorf("RawEnv after modification returned %q; want %q", got, want)
+	}
+
+	if n := len(mustClientEvent(t, "ESTABLISHED,5").Envs()); n != 0 {
+		t.Errorf("Envs of empty env returned %d vars; want 0", n)
+	}
+}
+
+func TestClientEventTruncated(t *testing.T) {
+	lines := []string{
+		">CLIENT:CONNECT,5,1",
+		">CLIENT:ENV,untrusted_ip=198.51.100.7",
+		">CLIENT:ENV,common_name=alice",
+	}
+
+	checkTruncated := func(name string, evt Event) {
+		inv, ok := evt.(InvalidEvent)
+		if !ok {
+			t.Fatalf("%s: got %T; want InvalidEvent", name, evt)
+		}
+		if inv.FirstError() != ErrTruncatedEvent {
+			t.Errorf("%s: FirstError returned %v; want %v", name, inv.FirstError(), ErrTruncatedEvent)
+		}
+		ce, ok := inv.Origin().(ClientEvent)
+		if !ok {
+			t.Fatalf("%s: origin got %T; want ClientEvent", name, inv.Origin())
+		}
+		if ce.Complete() {
+			t.Errorf("%s: Complete returned true; want false", name)
+		}
+		if got, want := ce.RawEnv("common_name"), "alice"; got != want {
+			t.Errorf("%s: RawEnv returned %q; want %q", name, got, want)
+		}
+	}
+
+	// connection closed gracefully
+	events := replayEvents(lines)
+	if len(events) != 1 {
+		t.Fatalf("got %d events; want 1: %v", len(events), events)
+	}
+	checkTruncated("EOF", events[0])
+
+	// read error, truncated event must precede FATAL
+	eventCh := make(chan Event, 10)
+	r := io.MultiReader(mockReader(lines), &alwaysErroringReader{})
+	NewMgmtClient(mockConn{r, ioutil.Discard}, eventCh)
+	events = events[:0]
+	for evt := range eventCh {
+		events = append(events, evt)
+	}
+	if len(events) != 2 {
+		t.Fatalf("got %d events; want 2: %v", len(events), events)
+	}
+	checkTruncated("read error", events[0])
+	if kw := events[1].(KeywordedEvent).Keyword(); kw != fatalEventKW {
+		t.Errorf("event 1 got %s; want FATAL", events[1])
+	}
+
+	// complete events
+	events = replayEvents(append(lines, ">CLIENT:ENV,END"))
+	if len(events) != 1 {
+		t.Fatalf("got %d events; want 1: %v", len(events), events)
+	}
+	if ce, ok := events[0].(ClientEvent); !ok || !ce.Complete() {
+		t.Errorf("event 0 got %#v; want complete ClientEvent", events[0])
+	}
+	if !mustClientEvent(t, "ADDRESS,5,10.8.0.6,1").Complete() {
+		t.Errorf("Complete of ADDRESS returned false; want true")
+	}
+}
+
+func TestClientEventInterleaved(t *testing.T) {
+	lines := []string{
+		">CLIENT:CONNECT,5,1",
+		">CLIENT:ENV,untrusted_ip=198.51.100.7",
+		">LOG:1584536294,I,198.51.100.7:52331 TLS: Initial packet",
+		">CLIENT:ENV,common_name=alice",
+		">BYTECOUNT_CLI:4,100,200",
+		">CLIENT:ADDRESS,4,10.8.0.6,1",
+		">CLIENT:ENV,END",
+	}
+
+	events := replayEvents(lines)
+	if len(events) != 4 {
+		t.Fatalf("got %d events; want 4: %v", len(events), events)
+	}
+
+	if le, ok := events[0].(LogEvent); !ok || le.Message() != "198.51.100.7:52331 TLS: Initial packet" {
+		t.Errorf("event 0 got %#v; want LogEvent", events[0])
+	}
+	if _, ok := events[1].(ByteCountClientEvent); !ok {
+		t.Errorf("event 1 got %T; want ByteCountClientEvent", events[1])
+	}
+	if ce, ok := events[2].(ClientEvent); !ok || ce.Type() != CEAddress || ce.ClientId() != 4 {
+		t.Errorf("event 2 got %#v; want ADDRESS ClientEvent", events[2])
+	}
+
+	ce, ok := events[3].(ClientEvent)
+	if !ok {
+		t.Fatalf("event 3 got %#v; want ClientEvent", events[3])
+	}
+	if !ce.Complete() || ce.Type() != CEConnect || ce.ClientId() != 5 {
+		t.Errorf("event 3 got %s; want complete CONNECT", ce)
+	}
+	if got, want := ce.EnvKeys(), []string{"untrusted_ip", "common_name"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("EnvKeys returned %q; want %q", got, want)
+	}
+}
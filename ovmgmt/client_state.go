@@ -0,0 +1,132 @@
+package ovmgmt
+
+import "sync"
+
+// ClientState is the lifecycle state of MgmtClient, see State.
+type ClientState int
+
+const (
+	// ClientStateConnecting is the state until the first line is received
+	// from the daemon, usually the greeting INFO.
+	ClientStateConnecting ClientState = iota
+	// ClientStateReady is the state of the responsive daemon.
+	ClientStateReady
+	// ClientStateDegraded is the state of the client created with
+	// WithKeepalive, when the keepalive check isn't replied within half
+	// of its timeout. It's Ready again once it is.
+	ClientStateDegraded
+	// ClientStateClosing is the state of the client being terminated,
+	// due to Close or to the connection error.
+	ClientStateClosing
+	// ClientStateClosed is the final state, the client is terminated.
+	ClientStateClosed
+)
+
+func (s ClientState) String() string {
+	switch s {
+	case ClientStateConnecting:
+		return "connecting"
+	case ClientStateReady:
+		return "ready"
+	case ClientStateDegraded:
+		return "degraded"
+	case ClientStateClosing:
+		return "closing"
+	case ClientStateClosed:
+		return "closed"
+	default:
+		return "unknown"
+	}
+}
+
+type stateTransition struct {
+	old, new ClientState
+}
+
+// stateMachine tracks the client state and notifies the callbacks
+// of the transitions, in order, from a single goroutine
+type stateMachine struct {
+	mu        sync.Mutex
+	state     ClientState
+	callbacks []func(old, new ClientState)
+	// transitions not notified yet
+	pending []stateTransition
+	signal  chan struct{}
+	started bool
+}
+
+func (m *stateMachine) get() ClientState {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.state
+}
+
+// set makes the transition, unless it's not allowed: Ready is set back
+// from Degraded, Closing is followed by Closed only, which is final
+func (m *stateMachine) set(state ClientState) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	old := m.state
+	switch {
+	case old == state, old == ClientStateClosed:
+		return
+	case old == ClientStateClosing && state != ClientStateClosed:
+		return
+	}
+	m.state = state
+	if m.started {
+		m.pending = append(m.pending, stateTransition{old, state})
+		select {
+		case m.signal <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// onChange adds the callback, the notifier is started with the first one
+func (m *stateMachine) onChange(fn func(old, new ClientState)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.callbacks = append(m.callbacks, fn)
+	if !m.started && m.state != ClientStateClosed {
+		m.started = true
+		m.signal = make(chan struct{}, 1)
+		go m.notify()
+	}
+}
+
+// notify calls the callbacks for the transitions, without holding
+// the lock, until the one to Closed
+func (m *stateMachine) notify() {
+	for range m.signal {
+		m.mu.Lock()
+		pending := m.pending
+		m.pending = nil
+		callbacks := append([]func(old, new ClientState){}, m.callbacks...)
+		m.mu.Unlock()
+
+		for _, t := range pending {
+			for _, fn := range callbacks {
+				fn(t.old, t.new)
+			}
+			if t.new == ClientStateClosed {
+				return
+			}
+		}
+	}
+}
+
+// State returns the lifecycle state of the client.
+func (c *MgmtClient) State() ClientState {
+	return c.states.get()
+}
+
+// OnStateChange adds the function called on each transition of the client
+// state made from then on. The functions are called in order of
+// the transitions, from a single goroutine, the last time with
+// ClientStateClosed; they may call the client methods, including Close.
+func (c *MgmtClient) OnStateChange(fn func(old, new ClientState)) {
+	c.states.onChange(fn)
+}
@@ -0,0 +1,151 @@
+package ovmgmt
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// recordStates returns the channel of the client state transitions
+func recordStates(c *MgmtClient) <-chan string {
+	ch := make(chan string, 100)
+	c.OnStateChange(func(old, new ClientState) {
+		ch <- fmt.Sprintf("%s>%s", old, new)
+	})
+	return ch
+}
+
+func nextStates(t *testing.T, ch <-chan string, n int) []string {
+	t.Helper()
+	var got []string
+	for len(got) < n {
+		select {
+		case s := <-ch:
+			got = append(got, s)
+		case <-time.After(2 * time.Second):
+			return got
+		}
+	}
+	return got
+}
+
+func TestClientState(t *testing.T) {
+	defer checkGoroutineLeaks(t)()
+
+	type TestCase struct {
+		Name string
+		// Reply of the daemon to pid, after the delay
+		Reply      []string
+		ReplyDelay time.Duration
+		// the client is closed once it's ready
+		Close      bool
+		WantStates []string
+	}
+	const interval = 20 * time.Millisecond
+	const timeout = 40 * time.Millisecond
+	testCases := []TestCase{
+		{"eof", nil, 0, false, []string{"connecting>ready", "ready>closing", "closing>closed"}},
+		{"close", nil, 0, true, []string{"connecting>ready", "ready>closing", "closing>closed"}},
+		{"keepalive timeout", nil, time.Hour, false, []string{"connecting>ready", "ready>degraded", "degraded>closing", "closing>closed"}},
+		{"slow reply", []string{"SUCCESS: pid=42"}, 3 * timeout / 4, false, []string{"connecting>ready", "ready>degraded", "degraded>ready"}},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		daemonConn, clientConn := net.Pipe()
+		var opts []Option
+		if tc.ReplyDelay > 0 {
+			opts = append(opts, WithKeepalive(interval, timeout))
+		}
+		eventCh := make(chan Event, 100)
+		c := NewMgmtClientWithOptions(clientConn, eventCh, opts...)
+		if state := c.State(); state != ClientStateConnecting {
+			t.Errorf("%s: initial State returned %s", tc.Name, state)
+		}
+		states := recordStates(c)
+
+		stop := make(chan struct{})
+		go func() {
+			io.WriteString(daemonConn, ">INFO:OpenVPN Management Interface Version 1 -- type 'help' for more info\n")
+			if tc.ReplyDelay == 0 && !tc.Close {
+				daemonConn.Close()
+				return
+			}
+			fakeDaemon(daemonConn, func(cmd string) []string {
+				select {
+				case <-time.After(tc.ReplyDelay):
+				case <-stop:
+				}
+				return tc.Reply
+			})
+		}()
+
+		if tc.Close {
+			nextStates(t, states, 1)
+			c.Close()
+			tc.WantStates = tc.WantStates[1:]
+		}
+		if got := nextStates(t, states, len(tc.WantStates)); !reflect.DeepEqual(got, tc.WantStates) {
+			t.Errorf("%s: got transitions %q; want %q", tc.Name, got, tc.WantStates)
+		}
+		c.Close()
+		close(stop)
+		daemonConn.Close()
+		for range eventCh {
+		}
+		if state := c.State(); state != ClientStateClosed {
+			t.Errorf("%s: State after Close returned %s", tc.Name, state)
+		}
+	}
+}
+
+func TestClientStateCallback(t *testing.T) {
+	defer checkGoroutineLeaks(t)()
+
+	daemonConn, clientConn := net.Pipe()
+	defer daemonConn.Close()
+	go func() {
+		io.WriteString(daemonConn, ">INFO:OpenVPN Management Interface Version 1\n")
+		fakeDaemon(daemonConn, func(cmd string) []string {
+			return []string{"SUCCESS: pid=42"}
+		})
+	}()
+	eventCh := make(chan Event, 10)
+	c := NewMgmtClient(clientConn, eventCh)
+
+	// the callback may use the client, including Close
+	done := make(chan []string, 1)
+	var got []string
+	c.OnStateChange(func(old, new ClientState) {
+		got = append(got, fmt.Sprintf("%s %s", new, c.State()))
+		switch new {
+		case ClientStateReady:
+			if pid, err := c.Pid(); err != nil || pid != 42 {
+				t.Errorf("Pid in callback returned %d, %v", pid, err)
+			}
+			c.Close()
+		case ClientStateClosed:
+			done <- got
+		}
+	})
+
+	select {
+	case got := <-done:
+		want := []string{"ready ready", "closing closed", "closed closed"}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got transitions %q; want %q", got, want)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("callback is stuck")
+	}
+	for range eventCh {
+	}
+
+	// no callbacks after Closed
+	c.OnStateChange(func(old, new ClientState) {
+		t.Errorf("got transition %s>%s after Closed", old, new)
+	})
+}
@@ -0,0 +1,154 @@
+package ovmgmt
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultClockSkewWindow is the number of recent samples ClockSkewEstimator
+// created by the client takes into account.
+const DefaultClockSkewWindow = 32
+
+const clockSkewEventKW = "CLOCK_SKEW"
+
+// ClockSkewEstimator estimates the skew between the daemon clock and
+// the local one, comparing timestamps of TimestampedEvent with their local
+// receive time.
+//
+// Daemon timestamps have one-second resolution and events are delayed by
+// the network and processing, so the difference of a single sample is
+// always less than the real skew. The estimator takes the maximum of
+// the last samples, which converges to the real skew within a second.
+// Stale timestamps (e.g. log history replayed by 'log on all') are
+// ignored for the same reason.
+//
+// It is safe for concurrent use.
+type ClockSkewEstimator struct {
+	mu      sync.Mutex
+	samples []time.Duration
+	next    int
+	full    bool
+}
+
+func NewClockSkewEstimator(window int) *ClockSkewEstimator {
+	if window < 1 {
+		window = 1
+	}
+	return &ClockSkewEstimator{samples: make([]time.Duration, window)}
+}
+
+// Add consumes the event which has both the daemon timestamp and the local
+// receive time, other events are ignored and false is returned.
+func (e *ClockSkewEstimator) Add(evt Event) bool {
+	te, ok := evt.(TimestampedEvent)
+	if !ok || te.Timestamp() <= 0 {
+		return false
+	}
+	re, ok := evt.(ReceivedEvent)
+	if !ok || re.ReceivedAt().IsZero() {
+		return false
+	}
+	e.AddSample(te.Time(), re.ReceivedAt())
+	return true
+}
+
+// AddSample consumes the daemon timestamp and the local time
+// it is received at.
+func (e *ClockSkewEstimator) AddSample(daemonTime, receivedAt time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.samples[e.next] = daemonTime.Sub(receivedAt)
+	e.next++
+	if e.next == len(e.samples) {
+		e.next = 0
+		e.full = true
+	}
+}
+
+// Skew returns the estimated skew, positive if the daemon clock is ahead
+// of the local one, and whether there are any samples.
+func (e *ClockSkewEstimator) Skew() (time.Duration, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	n := e.next
+	if e.full {
+		n = len(e.samples)
+	}
+	if n == 0 {
+		return 0, false
+	}
+
+	skew := e.samples[0]
+	for _, s := range e.samples[1:n] {
+		if s > skew {
+			skew = s
+		}
+	}
+	return skew, true
+}
+
+// ClockSkewEvent is a synthetic event emitted by the client created with
+// WithClockSkewDetection, when the estimated clock skew exceeds
+// the threshold.
+type ClockSkewEvent struct {
+	receivedAt
+	skew      time.Duration
+	threshold time.Duration
+}
+
+func (e ClockSkewEvent) Keyword() string {
+	return clockSkewEventKW
+}
+
+func (e ClockSkewEvent) Raw() string {
+	return fmt.Sprintf("%s%s%s", clockSkewEventKW, eventSep, e.skew)
+}
+
+// Skew returns the estimated skew, positive if the daemon clock is ahead
+// of the local one.
+func (e ClockSkewEvent) Skew() time.Duration {
+	return e.skew
+}
+
+func (e ClockSkewEvent) Threshold() time.Duration {
+	return e.threshold
+}
+
+func (e ClockSkewEvent) String() string {
+	return fmt.Sprintf("%s: daemon clock is off by %s, threshold %s", clockSkewEventKW, e.skew, e.threshold)
+}
+
+// ClockSkew returns the estimated skew between the daemon clock and
+// the local one, positive if the daemon clock is ahead, and whether
+// it's known. It's never known unless the client is created with
+// WithClockSkewDetection.
+func (c *MgmtClient) ClockSkew() (time.Duration, bool) {
+	if c.clockSkew == nil {
+		return 0, false
+	}
+	return c.clockSkew.Skew()
+}
+
+// checkClockSkew feeds the event to the estimator and returns ClockSkewEvent
+// when the skew starts exceeding the threshold
+func (c *MgmtClient) checkClockSkew(evt Event) (ClockSkewEvent, bool) {
+	if c.clockSkew == nil || !c.clockSkew.Add(evt) {
+		return ClockSkewEvent{}, false
+	}
+
+	skew, _ := c.clockSkew.Skew()
+	exceeds := c.opts.clockSkewThreshold > 0 && (skew > c.opts.clockSkewThreshold || skew < -c.opts.clockSkewThreshold)
+	if !exceeds || c.clockSkewExceeded {
+		c.clockSkewExceeded = exceeds
+		return ClockSkewEvent{}, false
+	}
+	c.clockSkewExceeded = true
+	return ClockSkewEvent{
+		receivedAt: receivedAt{evt.(ReceivedEvent).ReceivedAt()},
+		skew:       skew,
+		threshold:  c.opts.clockSkewThreshold,
+	}, true
+}
@@ -0,0 +1,127 @@
+package ovmgmt
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestClockSkewEstimator(t *testing.T) {
+	type TestCase struct {
+		Skew time.Duration
+	}
+
+	testCases := []TestCase{
+		{0},
+		{90*time.Second + 300*time.Millisecond},
+		{-(42*time.Minute + 700*time.Millisecond)},
+		{time.Duration(1584536294) * time.Second},
+	}
+
+	rnd := rand.New(rand.NewSource(1))
+	base := time.Date(2020, time.March, 18, 12, 58, 14, 123000000, time.UTC)
+
+	for i, testCase := range testCases {
+		e := NewClockSkewEstimator(DefaultClockSkewWindow)
+		if _, ok := e.Skew(); ok {
+			t.Errorf("test %d Skew is known without samples", i)
+		}
+
+		local := base
+		for n := 0; n < 100; n++ {
+			local = local.Add(700 * time.Millisecond)
+			// network and processing delay up to 200ms, with rare spikes
+			delay := time.Duration(rnd.Int63n(int64(200 * time.Millisecond)))
+			if n%10 == 0 {
+				delay += 3 * time.Second
+			}
+			// one-second resolution of the daemon timestamp
+			daemon := local.Add(testCase.Skew - delay).Truncate(time.Second)
+			e.AddSample(daemon, local)
+
+			skew, ok := e.Skew()
+			if !ok {
+				t.Fatalf("test %d Skew is unknown after %d samples", i, n+1)
+			}
+			if skew > testCase.Skew {
+				t.Errorf("test %d Skew returned %s after %d samples; want not more than %s", i, skew, n+1, testCase.Skew)
+			}
+			if n >= 10 && testCase.Skew-skew > 1200*time.Millisecond {
+				t.Errorf("test %d Skew returned %s after %d samples; want about %s", i, skew, n+1, testCase.Skew)
+			}
+			if n >= DefaultClockSkewWindow && testCase.Skew-skew > 300*time.Millisecond {
+				t.Errorf("test %d Skew returned %s after %d samples; want close to %s", i, skew, n+1, testCase.Skew)
+			}
+		}
+	}
+}
+
+func TestClockSkewEstimatorAdd(t *testing.T) {
+	e := NewClockSkewEstimator(4)
+	at := time.Unix(1584536300, 500000000)
+
+	state := stampEvent(upgradeEvent(stateEventKW, "1584536294,CONNECTED,SUCCESS,10.8.0.6"), at)
+	if !e.Add(state) {
+		t.Errorf("Add of StateEvent returned false")
+	}
+	if skew, ok := e.Skew(); !ok || skew != -6500*time.Millisecond {
+		t.Errorf("Skew returned %s, %t; want -6.5s", skew, ok)
+	}
+
+	for _, evt := range []Event{
+		stampEvent(upgradeEvent(byteCountEventKW, "1,2"), at),
+		stampEvent(upgradeEvent(logEventKW, "0,I,no timestamp"), at),
+		upgradeEvent(logEventKW, "1584536294,I,not received"),
+	} {
+		if e.Add(evt) {
+			t.Errorf("Add of %s returned true", evt)
+		}
+	}
+}
+
+func TestClientClockSkew(t *testing.T) {
+	lines := []string{
+		">INFO:OpenVPN Management Interface Version 1",
+		">STATE:1584536294,CONNECTED,SUCCESS,10.8.0.6,192.168.4.1",
+		">LOG:1584536295,I,msg",
+		">BYTECOUNT:1,2",
+	}
+
+	events := replayEvents(lines, WithClockSkewDetection(time.Hour))
+	if len(events) != 5 {
+		t.Fatalf("got %d events; want 5: %v", len(events), events)
+	}
+	skewEvt, ok := events[2].(ClockSkewEvent)
+	if !ok {
+		t.Fatalf("event 2 got %T; want ClockSkewEvent", events[2])
+	}
+	want := time.Unix(1584536294, 0).Sub(events[1].(StateEvent).ReceivedAt())
+	if skewEvt.Skew() != want || skewEvt.Threshold() != time.Hour {
+		t.Errorf("ClockSkewEvent got skew %s, threshold %s; want %s, 1h", skewEvt.Skew(), skewEvt.Threshold(), want)
+	}
+	if skewEvt.ReceivedAt() != events[1].(StateEvent).ReceivedAt() {
+		t.Errorf("ClockSkewEvent ReceivedAt returned %s", skewEvt.ReceivedAt())
+	}
+
+	// no threshold
+	events = replayEvents(lines, WithClockSkewDetection(0))
+	if len(events) != 4 {
+		t.Fatalf("got %d events; want 4: %v", len(events), events)
+	}
+
+	eventCh := make(chan Event, 10)
+	c := NewMgmtClientWithOptions(mockConn{mockReader(lines), nil}, eventCh, WithClockSkewDetection(0))
+	for range eventCh {
+	}
+	if skew, ok := c.ClockSkew(); !ok || skew > -time.Hour {
+		t.Errorf("ClockSkew returned %s, %t; want years", skew, ok)
+	}
+
+	eventCh = make(chan Event, 10)
+	c = NewMgmtClient(mockConn{mockReader(lines), nil}, eventCh)
+	for range eventCh {
+	}
+	if skew, ok := c.ClockSkew(); ok {
+		t.Errorf("ClockSkew returned %s, %t; want unknown", skew, ok)
+	}
+}
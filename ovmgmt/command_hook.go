@@ -0,0 +1,59 @@
+package ovmgmt
+
+import (
+	"strings"
+	"time"
+)
+
+const redactedArgument = "[REDACTED]"
+
+// redactCommand returns the command with secrets replaced: 'password'
+// and 'username' keep the type, which may be quoted, cr-response keeps
+// nothing
+func redactCommand(cmd string) string {
+	verb, args := cmd, ""
+	if i := strings.IndexByte(cmd, ' '); i >= 0 {
+		verb, args = cmd[:i], cmd[i+1:]
+	}
+	switch verb {
+	case "password", "username":
+		typ, rest := splitCommandArgument(args)
+		if rest == "" {
+			return cmd
+		}
+		return verb + " " + typ + " " + redactedArgument
+	case "cr-response":
+		if args == "" {
+			return cmd
+		}
+		return verb + " " + redactedArgument
+	}
+	return cmd
+}
+
+// splitCommandArgument splits off the first argument, which may be quoted
+func splitCommandArgument(args string) (arg, rest string) {
+	if strings.HasPrefix(args, `"`) {
+		for i := 1; i < len(args); i++ {
+			switch args[i] {
+			case '\\':
+				i++
+			case '"':
+				return args[:i+1], strings.TrimLeft(args[i+1:], " ")
+			}
+		}
+		return args, ""
+	}
+	if i := strings.IndexByte(args, ' '); i >= 0 {
+		return args[:i], strings.TrimLeft(args[i+1:], " ")
+	}
+	return args, ""
+}
+
+// commandDone calls the command hook, if any, the command must be
+// released by now
+func (c *MgmtClient) commandDone(cmd string, err error, start time.Time) {
+	if c.opts.commandHook != nil {
+		c.opts.commandHook(redactCommand(cmd), err, time.Since(start))
+	}
+}
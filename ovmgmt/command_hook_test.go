@@ -0,0 +1,121 @@
+package ovmgmt
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRedactCommand(t *testing.T) {
+	type TestCase struct {
+		Cmd  string
+		Want string
+	}
+
+	testCases := []TestCase{
+		{"password Auth s3cret", "password Auth [REDACTED]"},
+		{`password "Private Key" "s3cret with spaces"`, `password "Private Key" [REDACTED]`},
+		{`password "Auth \"quoted\"" s3cret`, `password "Auth \"quoted\"" [REDACTED]`},
+		{"username Auth alice", "username Auth [REDACTED]"},
+		{"cr-response c2VjcmV0", "cr-response [REDACTED]"},
+		// nothing to redact
+		{"password", "password"},
+		{"password Auth", "password Auth"},
+		{"cr-response", "cr-response"},
+		{"hold release", "hold release"},
+		{`kill alice`, `kill alice`},
+		{"passwords Auth x", "passwords Auth x"},
+	}
+
+	for i, tc := range testCases {
+		if got := redactCommand(tc.Cmd); got != tc.Want {
+			t.Errorf("test %d redactCommand(%q) returned %q; want %q", i, tc.Cmd, got, tc.Want)
+		}
+	}
+}
+
+func TestCommandHook(t *testing.T) {
+	type call struct {
+		Cmd string
+		Err string
+	}
+	var mu sync.Mutex
+	var calls []call
+	var c *MgmtClient
+	hook := func(cmd string, err error, took time.Duration) {
+		if took <= 0 {
+			t.Errorf("hook of %q got duration %s", cmd, took)
+		}
+		mu.Lock()
+		calls = append(calls, call{cmd, fmt.Sprint(err)})
+		mu.Unlock()
+		// the hook may issue commands itself
+		if cmd == "hold release" {
+			c.Pid()
+		}
+	}
+
+	c = newReplyingClient(t, make(chan Event, 10), func(cmd string) []string {
+		switch cmd {
+		case "pid":
+			return []string{"SUCCESS: pid=42"}
+		case "state":
+			return []string{"1584536294,CONNECTED,SUCCESS,10.8.0.6,,,,", "END"}
+		case "status 3":
+			return []string{"END"}
+		case `signal "SIGFOO"`:
+			return []string{"ERROR: signal 'SIGFOO' is not a known signal type"}
+		}
+		return []string{"SUCCESS: ok"}
+	}, WithCommandHook(hook))
+	defer c.Close()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.HoldRelease()
+		c.SendSignal("SIGFOO")
+		c.LatestState()
+		c.LatestStatus3()
+		c.StreamStatus3(func(Status3Record) error { return nil })
+		// no such method, but the hook sees what's sent
+		c.simpleCommand("password Auth s3cret")
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("commands are stuck")
+	}
+
+	want := []call{
+		{"hold release", "<nil>"},
+		{"pid", "<nil>"},
+		{`signal "SIGFOO"`, `command "signal": signal 'SIGFOO' is not a known signal type`},
+		{"state", "<nil>"},
+		{"status 3", "<nil>"},
+		{"status 3", "<nil>"},
+		{"password Auth [REDACTED]", "<nil>"},
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("hook got calls\n%q\nwant\n%q", calls, want)
+	}
+}
+
+func TestCommandHookClosed(t *testing.T) {
+	var got []error
+	c := newReplyingClient(t, make(chan Event, 10), func(string) []string { return nil },
+		WithCommandHook(func(cmd string, err error, took time.Duration) {
+			got = append(got, err)
+		}))
+	c.Close()
+
+	c.HoldRelease()
+	if len(got) != 1 || !errors.Is(got[0], ErrClientClosed) {
+		t.Errorf("hook got errors %v; want %v", got, ErrClientClosed)
+	}
+}
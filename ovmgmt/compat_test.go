@@ -0,0 +1,217 @@
+package ovmgmt
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// compatVersions are the OpenVPN versions captured in testdata/compat,
+// each has a management transcript (.mgmt) and 'status 3' output (.status)
+var compatVersions = []string{"2.4", "2.5", "2.6"}
+
+func readCompatFixture(t testing.TB, version, ext string) []byte {
+	t.Helper()
+	data, err := ioutil.ReadFile(filepath.Join("testdata", "compat", "openvpn-"+version+ext))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func compatLines(data []byte) []string {
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+}
+
+// compatSummary describes the event by the fields which differ by version
+func compatSummary(evt Event) string {
+	switch e := evt.(type) {
+	case HoldEvent:
+		return fmt.Sprintf("HOLD %q wait=%d", e.Message(), e.WaitSeconds())
+	case ClientEvent:
+		cn, _ := e.CommonName()
+		s := fmt.Sprintf("CLIENT:%s cid=%d cn=%s", e.Type(), e.ClientId(), cn)
+		switch e.Type() {
+		case CEConnect:
+			ip, _ := e.UntrustedIP()
+			ver, _ := e.IVVer()
+			ciphers, _ := e.Env(EnvIVCiphers)
+			s += fmt.Sprintf(" ip=%s ver=%s ciphers=%s", ip, ver, ciphers)
+		case CEEstablished:
+			ip, _ := e.TrustedIP()
+			s += fmt.Sprintf(" ip=%s pool=%s pool6=%s", ip, e.RawEnv("ifconfig_pool_remote_ip"), e.RawEnv("ifconfig_pool_remote_ip6"))
+		case CEAddress:
+			n, _ := e.AddrNet()
+			s += fmt.Sprintf(" addr=%s primary=%t", n, e.IsAddrPrimary())
+		case CECRResponse:
+			s += fmt.Sprintf(" response=%s", e.Response())
+		case CEDisconnect:
+			sum := e.SessionSummary()
+			s += fmt.Sprintf(" in=%d out=%d duration=%s signal=%s", sum.BytesReceived, sum.BytesSent, sum.Duration, sum.Signal)
+		}
+		return s
+	case ByteCountClientEvent:
+		return fmt.Sprintf("BYTECOUNT_CLI cid=%d in=%d out=%d", e.ClientId(), e.BytesIn(), e.BytesOut())
+	case LogEvent:
+		return fmt.Sprintf("LOG %s", e.Severity())
+	case StateEvent:
+		return fmt.Sprintf("STATE %s local=%s remote=%s:%s local6=%s", e.State(), e.LocalTunnelAddr(), e.RemoteAddr(), e.RemotePort(), e.LocalTunnelAddr6())
+	case PasswordEvent:
+		return fmt.Sprintf("PASSWORD token=%t", e.IsAuthToken())
+	case SimpleEvent:
+		return fmt.Sprintf("%s %s", e.Keyword(), e.Body())
+	}
+	return fmt.Sprintf("%T %s", evt, evt)
+}
+
+func TestCompatTranscripts(t *testing.T) {
+	want := map[string][]string{
+		"2.4": {
+			"INFO OpenVPN Management Interface Version 1 -- type 'help' for more info",
+			`HOLD "Waiting for hold release" wait=0`,
+			"CLIENT:CONNECT cid=0 cn=alice ip=198.51.100.7 ver=2.4.8 ciphers=",
+			"CLIENT:ESTABLISHED cid=0 cn=alice ip=198.51.100.7 pool=10.8.0.6 pool6=",
+			"CLIENT:ADDRESS cid=0 cn= addr=10.8.0.6/32 primary=true",
+			"BYTECOUNT_CLI cid=0 in=5523 out=7391",
+			"LOG INFO",
+			"CLIENT:DISCONNECT cid=0 cn=alice in=6000 out=8000 duration=2m0s signal=SIGTERM",
+		},
+		"2.5": {
+			"INFO OpenVPN Management Interface Version 3 -- type 'help' for more info",
+			`HOLD "Waiting for hold release" wait=0`,
+			"CLIENT:CONNECT cid=0 cn=alice ip=198.51.100.7 ver=2.5.1 ciphers=AES-256-GCM:AES-128-GCM",
+			"CLIENT:ESTABLISHED cid=0 cn=alice ip=198.51.100.7 pool=10.8.0.6 pool6=fd00::1000",
+			"CLIENT:ADDRESS cid=0 cn= addr=10.8.0.6/32 primary=true",
+			"CLIENT:ADDRESS cid=0 cn= addr=fd00::1000/128 primary=true",
+			"BYTECOUNT_CLI cid=0 in=5523 out=7391",
+			"LOG WARNING",
+			"CLIENT:DISCONNECT cid=0 cn=alice in=6000 out=8000 duration=14m39s signal=SIGUSR1",
+		},
+		"2.6": {
+			"INFO OpenVPN Management Interface Version 5 -- type 'help' for more info",
+			`HOLD "Waiting for hold release" wait=10`,
+			"CLIENT:CONNECT cid=0 cn=alice ip=2001:db8::7 ver=2.6.3 ciphers=AES-256-GCM:AES-128-GCM:CHACHA20-POLY1305",
+			"CLIENT:CR_RESPONSE cid=0 cn=alice response=123456",
+			"CLIENT:ESTABLISHED cid=0 cn=alice ip=2001:db8::7 pool=10.8.0.6 pool6=fd00::1000",
+			"CLIENT:ADDRESS cid=0 cn= addr=10.8.0.6/32 primary=true",
+			"CLIENT:ADDRESS cid=0 cn= addr=fd00::1000/128 primary=true",
+			"BYTECOUNT_CLI cid=0 in=5523 out=7391",
+			"INFOMSG WEB_AUTH::https://sso.example.com/auth?session=1",
+			"STATE CONNECTED local=10.8.0.6 remote=203.0.113.1:1194 local6=fd00::1000",
+			"PASSWORD token=true",
+			"CLIENT:DISCONNECT cid=0 cn=alice in=6000 out=8000 duration=1m37s signal=",
+		},
+	}
+
+	for _, version := range compatVersions {
+		events := replayEvents(compatLines(readCompatFixture(t, version, ".mgmt")), WithStrictParsing())
+
+		got := make([]string, len(events))
+		for i, evt := range events {
+			got[i] = compatSummary(evt)
+		}
+		if !equalStrings(got, want[version]) {
+			t.Errorf("OpenVPN %s transcript got\n%s\nwant\n%s", version, strings.Join(got, "\n"), strings.Join(want[version], "\n"))
+		}
+	}
+}
+
+func TestCompatStatus3(t *testing.T) {
+	type TestCase struct {
+		Version   string
+		Major     int
+		Minor     int
+		Cipher    string
+		RealAddr  string
+		Username  string
+		Routes    int
+		DCO       bool
+		GlobalDCO string
+	}
+
+	testCases := []TestCase{
+		{"2.4", 2, 4, "", "198.51.100.7:52331", "UNDEF", 1, false, ""},
+		{"2.5", 2, 5, "AES-256-GCM", "198.51.100.7:52331", "UNDEF", 2, false, ""},
+		{"2.6", 2, 6, "CHACHA20-POLY1305", "2001:db8::7", "alice", 2, true, "1"},
+	}
+
+	for _, testCase := range testCases {
+		data := readCompatFixture(t, testCase.Version, ".status")
+
+		// the same output via the management connection and from the file
+		c := newReplyingClient(t, make(chan Event, 10), func(string) []string {
+			return compatLines(data)
+		}, WithStrictParsing())
+		se, err := c.LatestStatus3()
+		if err != nil {
+			t.Errorf("OpenVPN %s LatestStatus3 returned error: %s", testCase.Version, err)
+			continue
+		}
+		fromFile, err := ParseStatus3(bytes.NewReader(data), nil)
+		if err != nil {
+			t.Errorf("OpenVPN %s ParseStatus3 returned error: %s", testCase.Version, err)
+			continue
+		}
+		if se.String() != fromFile.String() {
+			t.Errorf("OpenVPN %s events differ:\n%s\n%s", testCase.Version, se, fromFile)
+		}
+
+		major, minor, _, ok := se.OpenVPNVersion()
+		if !ok || major != testCase.Major || minor != testCase.Minor {
+			t.Errorf("OpenVPN %s got version %d.%d", testCase.Version, major, minor)
+		}
+		dco := false
+		for _, f := range se.BuildFeatures() {
+			dco = dco || f == "DCO"
+		}
+		if dco != testCase.DCO {
+			t.Errorf("OpenVPN %s got build features %q", testCase.Version, se.BuildFeatures())
+		}
+
+		if len(se.Clients()) != 1 || len(se.Routes()) != testCase.Routes {
+			t.Errorf("OpenVPN %s got %s", testCase.Version, se)
+			continue
+		}
+		cl := se.Clients()[0]
+		if cl.DataChannelCipher != testCase.Cipher || cl.RealAddr.String() != testCase.RealAddr || cl.UsernameRaw != testCase.Username {
+			t.Errorf("OpenVPN %s got client %s", testCase.Version, cl)
+		}
+		for _, r := range se.Routes() {
+			if r.CommonName != "alice" || r.RealAddr.String() != testCase.RealAddr {
+				t.Errorf("OpenVPN %s got route %s", testCase.Version, r)
+			}
+		}
+		if v := se.GlobalStats().Other["dco_enabled"]; v != testCase.GlobalDCO {
+			t.Errorf("OpenVPN %s got dco_enabled %q", testCase.Version, v)
+		}
+	}
+}
+
+func BenchmarkCompatReplay(b *testing.B) {
+	for _, version := range compatVersions {
+		lines := compatLines(readCompatFixture(b, version, ".mgmt"))
+		b.Run(version, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				replayEvents(lines)
+			}
+		})
+	}
+}
+
+func BenchmarkCompatStatus3(b *testing.B) {
+	for _, version := range compatVersions {
+		data := readCompatFixture(b, version, ".status")
+		b.Run(version, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := ParseStatus3(bytes.NewReader(data), nil); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
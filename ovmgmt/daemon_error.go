@@ -0,0 +1,107 @@
+package ovmgmt
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrorKind is the class of the ERROR reply of the daemon, derived from
+// its text, see ClassifyError.
+type ErrorKind int
+
+const (
+	// ErrorKindUnknown is the kind of replies not recognized, e.g.
+	// "client-auth command failed", and of errors not from the daemon.
+	ErrorKindUnknown ErrorKind = iota
+	// ErrorKindUnsupported is the kind of commands the daemon doesn't
+	// know or can't run in its mode, e.g. a newer command sent to
+	// an older version.
+	ErrorKindUnsupported
+	// ErrorKindNotFound is the kind of commands referring to something
+	// which doesn't exist or isn't pending, e.g. a client to kill.
+	ErrorKindNotFound
+	// ErrorKindBadArgument is the kind of commands with missing
+	// or invalid parameters.
+	ErrorKindBadArgument
+)
+
+func (k ErrorKind) String() string {
+	switch k {
+	case ErrorKindUnsupported:
+		return "unsupported"
+	case ErrorKindNotFound:
+		return "not found"
+	case ErrorKindBadArgument:
+		return "bad argument"
+	default:
+		return "unknown"
+	}
+}
+
+// error message patterns of OpenVPN 2.4-2.6, checked in order
+var errorKindPatterns = []struct {
+	kind     ErrorKind
+	patterns []string
+}{
+	{ErrorKindUnsupported, []string{
+		"unknown command",
+		"not supported",
+		"not available",
+		"not allowed",
+		"not enabled",
+	}},
+	{ErrorKindNotFound, []string{
+		"not found",
+		"not pending",
+		"query pending",
+		"currently pending",
+		"not currently available",
+		"no such",
+	}},
+	{ErrorKindBadArgument, []string{
+		"requires",
+		"parameter",
+		"cannot parse",
+		"couldn't parse",
+		"must be",
+		"invalid",
+		"out of range",
+		"not a known",
+		"unknown signal",
+	}},
+}
+
+// ClassifyError returns the kind of the ERROR reply text, with or without
+// the "ERROR: " prefix.
+func ClassifyError(message string) ErrorKind {
+	message = strings.ToLower(strings.TrimPrefix(message, errorPrefix))
+	for _, class := range errorKindPatterns {
+		for _, pattern := range class.patterns {
+			if strings.Contains(message, pattern) {
+				return class.kind
+			}
+		}
+	}
+	return ErrorKindUnknown
+}
+
+// newDaemonError returns the error of the ERROR reply text
+func newDaemonError(message string) *OVpnError {
+	return &OVpnError{msg: message, kind: ClassifyError(message)}
+}
+
+// Kind returns the class of the ERROR reply, ErrorKindUnknown if the error
+// is not from the daemon.
+func (e *OVpnError) Kind() ErrorKind {
+	return e.kind
+}
+
+// ErrorKindOf returns the kind of the ERROR reply the command has failed
+// with, ErrorKindUnknown if err is not one.
+func ErrorKindOf(err error) ErrorKind {
+	var ovpnErr *OVpnError
+	if errors.As(err, &ovpnErr) {
+		return ovpnErr.Kind()
+	}
+	return ErrorKindUnknown
+}
@@ -0,0 +1,81 @@
+package ovmgmt
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestClassifyError(t *testing.T) {
+	type TestCase struct {
+		Message string
+		Want    ErrorKind
+	}
+
+	testCases := []TestCase{
+		{"ERROR: unknown command, enter 'help' for more options", ErrorKindUnsupported},
+		{"ERROR: unknown command [client-pending-auth], enter 'help' for more options", ErrorKindUnsupported},
+		{"ERROR: The 'client-pending-auth' command is not supported by the current daemon mode", ErrorKindUnsupported},
+		{"ERROR: management function client-kill is not available", ErrorKindUnsupported},
+		{"ERROR: The remote command is not allowed", ErrorKindUnsupported},
+		{"ERROR: hold release not pending", ErrorKindNotFound},
+		{"ERROR: common name 'alice' not found", ErrorKindNotFound},
+		{"ERROR: client at 10.8.0.6:1194 not found", ErrorKindNotFound},
+		{"ERROR: no username/password query pending", ErrorKindNotFound},
+		{"ERROR: no needok 'token-insertion-request' query is currently pending", ErrorKindNotFound},
+		{"ERROR: The 'pk-sig' command is not currently available", ErrorKindNotFound},
+		{"ERROR: the 'kill' command requires 1 parameter", ErrorKindBadArgument},
+		{"ERROR: the 'client-auth' command requires 2 parameters", ErrorKindBadArgument},
+		{"ERROR: cannot parse CID", ErrorKindBadArgument},
+		{"ERROR: signal 'SIGFOO' is not a known signal type", ErrorKindBadArgument},
+		{"ERROR: 'log' parameter must be 'on' or 'off' or some number n or 'all'", ErrorKindBadArgument},
+		{"ERROR: verb level is out of range", ErrorKindBadArgument},
+		{"ERROR: client-pending-auth command failed. Extra parameter might be too long", ErrorKindBadArgument},
+		{"ERROR: client-deny command failed", ErrorKindUnknown},
+		{"ERROR: client-auth command failed", ErrorKindUnknown},
+		// without the prefix, as OVpnError has it
+		{"unknown command, enter 'help' for more options", ErrorKindUnsupported},
+		{"", ErrorKindUnknown},
+	}
+
+	for i, tc := range testCases {
+		if got := ClassifyError(tc.Message); got != tc.Want {
+			t.Errorf("test %d %q classified as %s; want %s", i, tc.Message, got, tc.Want)
+		}
+	}
+}
+
+func TestDaemonErrorKind(t *testing.T) {
+	type TestCase struct {
+		Reply string
+		Want  ErrorKind
+		Text  string
+	}
+
+	testCases := []TestCase{
+		{"ERROR: unknown command, enter 'help' for more options", ErrorKindUnsupported, "unknown command, enter 'help' for more options"},
+		{"ERROR: common name 'alice' not found", ErrorKindNotFound, "common name 'alice' not found"},
+		{"ERROR: client-deny command failed", ErrorKindUnknown, "client-deny command failed"},
+	}
+
+	for i, tc := range testCases {
+		reply := tc.Reply
+		c := newReplyingClient(t, make(chan Event, 10), func(string) []string { return []string{reply} })
+		err := c.HoldRelease()
+		if kind := ErrorKindOf(err); kind != tc.Want {
+			t.Errorf("test %d %v is of kind %s; want %s", i, err, kind, tc.Want)
+		}
+		var ovpnErr *OVpnError
+		if !errors.As(err, &ovpnErr) || ovpnErr.Kind() != tc.Want || ovpnErr.Error() != tc.Text {
+			t.Errorf("test %d got %#v; want OVpnError %q", i, err, tc.Text)
+		}
+		c.Close()
+	}
+
+	if kind := ErrorKindOf(fmt.Errorf("wrapped: %w", newDaemonError("hold release not pending"))); kind != ErrorKindNotFound {
+		t.Errorf("wrapped error is of kind %s; want %s", kind, ErrorKindNotFound)
+	}
+	if kind := ErrorKindOf(ErrClientClosed); kind != ErrorKindUnknown {
+		t.Errorf("%v is of kind %s; want %s", ErrClientClosed, kind, ErrorKindUnknown)
+	}
+}
@@ -1,12 +1,28 @@
 package ovmgmt
 
 import (
-	"bufio"
+	"context"
 	"io"
+	"strings"
+	"sync"
+	"time"
 )
 
 var readErrSynthEvent = []byte("FATAL:Error reading from OpenVPN")
 
+// truncatedLineMarker marks the truncated line, see SetMaxLineSize
+const truncatedLineMarker = "\n"
+
+// IsTruncatedLine reports whether the message written to the event channel
+// by Demultiplexer is the truncated line, see SetMaxLineSize, and returns
+// the message without the mark.
+func IsTruncatedLine(msg string) (string, bool) {
+	if strings.HasSuffix(msg, truncatedLineMarker) {
+		return msg[:len(msg)-len(truncatedLineMarker)], true
+	}
+	return msg, false
+}
+
 // Demultiplex reads from the given io.Reader, assumed to be the client
 // end of an OpenVPN Management Protocol connection, and splits it into
 // distinct messages from OpenVPN.
@@ -16,13 +32,19 @@ var readErrSynthEvent = []byte("FATAL:Error reading from OpenVPN")
 // an asynchronous event notification.
 //
 // The buffers written to replyCh are entire raw message lines (without the
-// trailing newlines), while the buffers written to eventCh are the raw
-// event strings with the prototcol's leading '>' indicator omitted.
+// trailing "\n" or "\r\n", both are accepted), while the buffers written
+// to eventCh are the raw event strings with the prototcol's leading '>'
+// indicator omitted.
 //
 // The caller should usually provide buffered channels of sufficient buffer
 // depth so that the reply channel will not be starved by slow event
 // processing.
 //
+// Lines longer than DefaultMaxLineSize are truncated, see
+// Demultiplexer.SetMaxLineSize. The known prompts, which aren't terminated
+// (e.g. "ENTER PASSWORD:"), are written to eventCh as the synthetic
+// "PROMPT:<prompt>" events, see PromptEvent.
+//
 // Once the io.Reader signals EOF, eventCh will be closed, then replyCh
 // will be closed, and then this function will return.
 //
@@ -31,11 +53,168 @@ var readErrSynthEvent = []byte("FATAL:Error reading from OpenVPN")
 // before the two buffers are closed and the function returns. This
 // synthetic message will have the error message "Error reading from OpenVPN".
 func Demultiplex(r io.Reader, rawReplyCh, rawEventCh chan<- string) {
-	scanner := bufio.NewScanner(r)
-	for scanner.Scan() {
-		buf := scanner.Bytes()
+	d := NewDemultiplexer(r, rawReplyCh, rawEventCh)
+	if err := d.run(context.Background()); err != io.EOF {
+		// Generate a synthetic FATAL event so that the caller can
+		// see that the connection was not gracefully closed.
+		rawEventCh <- string(readErrSynthEvent)
+	}
+
+	close(rawEventCh)
+	close(rawReplyCh)
+}
+
+// Demultiplexer splits the stream of messages of an OpenVPN Management
+// Protocol connection into replies and events, as Demultiplex, but it can
+// be stopped and its terminal error is kept.
+type Demultiplexer struct {
+	// updated atomically, keep it first for 64-bit alignment
+	stats seqCounters
+
+	r       io.Reader
+	replyCh chan<- string
+	eventCh chan<- string
+	// used instead of eventCh by the client, the events are stamped with
+	// the time they are read, not the time they are taken from the channel
+	timedEventCh chan<- rawEvent
+	// called with each line read, if it's not nil; the line buffer
+	// is only valid during the call
+	onLine      func(line []byte)
+	maxLineSize int
 
+	mu  sync.Mutex
+	err error
+}
+
+// NewDemultiplexer returns the Demultiplexer of the given io.Reader, which
+// writes the reply lines to replyCh and the event lines to eventCh, the same
+// as Demultiplex does.
+func NewDemultiplexer(r io.Reader, replyCh, eventCh chan<- string) *Demultiplexer {
+	return &Demultiplexer{r: r, replyCh: replyCh, eventCh: eventCh, maxLineSize: DefaultMaxLineSize}
+}
+
+// rawEvent is the event line written to the channel of the Demultiplexer
+// of the client, along with the time it's read
+type rawEvent struct {
+	line string
+	at   time.Time
+}
+
+// newTimedDemultiplexer returns the Demultiplexer which writes the event
+// lines to eventCh along with the time they are read
+func newTimedDemultiplexer(r io.Reader, replyCh chan<- string, eventCh chan<- rawEvent) *Demultiplexer {
+	return &Demultiplexer{r: r, replyCh: replyCh, timedEventCh: eventCh, maxLineSize: DefaultMaxLineSize}
+}
+
+// SetMaxLineSize limits the size of a line, without the line ending, it must
+// be called before Run. Zero or negative size disables the limit, the default
+// is DefaultMaxLineSize.
+//
+// Longer lines are truncated to the size and delivered to eventCh marked
+// with the trailing newline, which the other lines never contain, see
+// IsTruncatedLine. The truncated replies are delivered to replyCh as well,
+// without the mark, so the reply to the command is complete.
+func (d *Demultiplexer) SetMaxLineSize(size int) {
+	d.maxLineSize = size
+}
+
+// Run reads the messages until the io.Reader signals EOF, a read error
+// occurs or ctx is done, then it closes eventCh and replyCh, and returns
+// the error: io.EOF, the read error or ctx.Err(). It's also returned by Err
+// by the time the channels are closed. Unlike Demultiplex, it doesn't write
+// the synthetic FATAL event.
+//
+// When ctx is done, the line being read is dropped. The read in progress is
+// interrupted if the io.Reader supports read deadlines (e.g. net.Conn),
+// by setting the deadline in the past, otherwise Run returns once the read
+// completes. Run must be called once.
+func (d *Demultiplexer) Run(ctx context.Context) error {
+	err := d.run(ctx)
+	d.mu.Lock()
+	d.err = err
+	d.mu.Unlock()
+
+	if d.timedEventCh != nil {
+		close(d.timedEventCh)
+	} else {
+		close(d.eventCh)
+	}
+	close(d.replyCh)
+	return err
+}
+
+// Err returns the error Run has returned, nil while it's running.
+func (d *Demultiplexer) Err() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.err
+}
+
+// run is Run, which doesn't close the channels
+func (d *Demultiplexer) run(ctx context.Context) error {
+	done := ctx.Done()
+	if dl, ok := d.r.(readDeadliner); ok && done != nil {
+		stop := make(chan struct{})
+		defer close(stop)
+		go func() {
+			select {
+			case <-done:
+				dl.SetReadDeadline(time.Unix(1, 0))
+			case <-stop:
+			}
+		}()
+	}
+
+	lr := newLineReader(d.r, d.maxLineSize)
+	sendReply := func(msg string) bool {
+		select {
+		case d.replyCh <- msg:
+			return true
+		case <-done:
+			return false
+		}
+	}
+	sendEvent := func(msg string, at time.Time) bool {
+		if d.timedEventCh == nil {
+			select {
+			case d.eventCh <- msg:
+				return true
+			case <-done:
+				return false
+			}
+		}
+		select {
+		case d.timedEventCh <- rawEvent{msg, at}:
+			return true
+		case <-done:
+			return false
+		}
+	}
+	for {
+		buf, size, kind, err := lr.next()
+		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				// the read is interrupted
+				return ctxErr
+			}
+			return err
+		}
+		at := time.Now()
+		select {
+		case <-done:
+			return ctx.Err()
+		default:
+		}
+
+		if d.onLine != nil {
+			d.onLine(buf)
+		}
+
+		d.stats.begin()
+		d.stats.add(statLines, 1)
+		d.stats.add(statBytesRead, uint64(size))
 		if len(buf) < 1 {
+			d.stats.end()
 			// Should never happen but we'll be robust and ignore this,
 			// rather than crashing below.
 			continue
@@ -43,21 +222,39 @@ func Demultiplex(r io.Reader, rawReplyCh, rawEventCh chan<- string) {
 
 		// Asynchronous messages always start with > to differentiate
 		// them from replies.
-		if buf[0] == '>' {
+		isEvent, msg := false, string(buf)
+		switch {
+		case kind == linePrompt:
+			// the prompt is delivered as the synthetic event
+			isEvent, msg = true, promptEventKW+eventSep+msg
+		case buf[0] == '>':
 			// Trim off the > when we post the message, since it's
 			// redundant after we've demuxed.
-			rawEventCh <- string(buf[1:])
+			isEvent, msg = true, msg[1:]
+		}
+		if isEvent {
+			d.stats.add(statEvents, 1)
 		} else {
-			rawReplyCh <- string(buf)
+			d.stats.add(statReplies, 1)
 		}
-	}
+		d.stats.end()
 
-	if err := scanner.Err(); err != nil {
-		// Generate a synthetic FATAL event so that the caller can
-		// see that the connection was not gracefully closed.
-		rawEventCh <- string(readErrSynthEvent)
+		if kind == lineTruncated {
+			// the truncated reply is delivered, so the reply is complete,
+			// and it's reported as the event as well
+			if !isEvent && !sendReply(msg) {
+				return ctx.Err()
+			}
+			isEvent, msg = true, msg+truncatedLineMarker
+		}
+		var sent bool
+		if isEvent {
+			sent = sendEvent(msg, at)
+		} else {
+			sent = sendReply(msg)
+		}
+		if !sent {
+			return ctx.Err()
+		}
 	}
-
-	close(rawEventCh)
-	close(rawReplyCh)
 }
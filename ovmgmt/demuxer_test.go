@@ -2,10 +2,13 @@ package ovmgmt
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
+	"net"
 	"reflect"
 	"testing"
+	"time"
 )
 
 func TestDemultiplex(t *testing.T) {
@@ -140,11 +143,15 @@ func captureMsgs(r io.Reader) (replies, events []string) {
 	replyCh := make(chan string)
 	eventCh := make(chan string)
 
+	go Demultiplex(r, replyCh, eventCh)
+	return collectMsgs(replyCh, eventCh)
+}
+
+// collectMsgs reads the messages until both channels are closed
+func collectMsgs(replyCh, eventCh <-chan string) (replies, events []string) {
 	replies = make([]string, 0)
 	events = make([]string, 0)
 
-	go Demultiplex(r, replyCh, eventCh)
-
 	for replyCh != nil || eventCh != nil {
 		select {
 
@@ -169,6 +176,165 @@ func captureMsgs(r io.Reader) (replies, events []string) {
 	return replies, events
 }
 
+func TestDemultiplexer(t *testing.T) {
+	readErr := fmt.Errorf("connection reset by peer")
+	lines := []string{
+		">HOLD:Waiting for hold release",
+		"SUCCESS: foo",
+		"",
+		">CLIENT:ENV,a=b=c",
+		"ERROR: bar",
+	}
+
+	crlfLines := make([]string, len(lines))
+	for i, line := range lines {
+		crlfLines[i] = line + "\r"
+	}
+
+	type TestCase struct {
+		Reader    io.Reader
+		WantErr   error
+		WantBytes uint64
+	}
+	testCases := []TestCase{
+		{mockReader(lines), io.EOF, 74},
+		{io.MultiReader(mockReader(lines), failingReader{readErr}), readErr, 74},
+		// the same messages of \r\n terminated lines
+		{mockReader(crlfLines), io.EOF, 79},
+	}
+
+	// the same messages as of Demultiplex
+	wantReplies, wantEvents := captureMsgs(mockReader(lines))
+	for i, tc := range testCases {
+		replyCh := make(chan string)
+		eventCh := make(chan string)
+		d := NewDemultiplexer(tc.Reader, replyCh, eventCh)
+		errCh := make(chan error, 1)
+		go func() {
+			errCh <- d.Run(context.Background())
+		}()
+
+		replies, events := collectMsgs(replyCh, eventCh)
+		if !reflect.DeepEqual(replies, wantReplies) || !reflect.DeepEqual(events, wantEvents) {
+			t.Errorf("test %d got replies %q, events %q; want %q, %q", i, replies, events, wantReplies, wantEvents)
+		}
+		// the error is set by the time the channels are closed
+		if err := d.Err(); err != tc.WantErr {
+			t.Errorf("test %d Err returned %v; want %v", i, err, tc.WantErr)
+		}
+		if err := <-errCh; err != tc.WantErr {
+			t.Errorf("test %d Run returned %v; want %v", i, err, tc.WantErr)
+		}
+		wantStats := DemuxStats{LinesRead: 5, ReplyLines: 2, EventLines: 2, BytesRead: tc.WantBytes}
+		if stats := d.Stats(); stats != wantStats {
+			t.Errorf("test %d Stats returned %+v; want %+v", i, stats, wantStats)
+		}
+	}
+}
+
+func TestDemultiplexerCancel(t *testing.T) {
+	defer checkGoroutineLeaks(t)()
+
+	type TestCase struct {
+		Name string
+		Pipe func() (io.Reader, io.WriteCloser)
+		// the read isn't interrupted, the rest of the line is written
+		// after the cancellation
+		CompleteLine bool
+	}
+	testCases := []TestCase{
+		{"read deadline", func() (io.Reader, io.WriteCloser) {
+			r, w := net.Pipe()
+			return r, w
+		}, false},
+		{"no read deadline", func() (io.Reader, io.WriteCloser) {
+			return io.Pipe()
+		}, true},
+	}
+
+	for _, tc := range testCases {
+		r, w := tc.Pipe()
+		replyCh := make(chan string)
+		eventCh := make(chan string)
+		d := NewDemultiplexer(r, replyCh, eventCh)
+		ctx, cancel := context.WithCancel(context.Background())
+		errCh := make(chan error, 1)
+		go func() {
+			errCh <- d.Run(ctx)
+		}()
+
+		// canceled in the middle of the event line
+		go io.WriteString(w, "SUCCESS: foo\n>LOG:1584536294,I,par")
+		if reply := <-replyCh; reply != "SUCCESS: foo" {
+			t.Errorf("%s: got reply %q", tc.Name, reply)
+		}
+		cancel()
+		if tc.CompleteLine {
+			go io.WriteString(w, "tial\n")
+		}
+
+		select {
+		case err := <-errCh:
+			if err != context.Canceled || d.Err() != context.Canceled {
+				t.Errorf("%s: Run returned %v, Err %v; want %v", tc.Name, err, d.Err(), context.Canceled)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("%s: Run is not stopped", tc.Name)
+		}
+		// the line read partially is dropped
+		if replies, events := collectMsgs(replyCh, eventCh); len(replies)+len(events) != 0 {
+			t.Errorf("%s: got replies %q, events %q after the cancellation", tc.Name, replies, events)
+		}
+		w.Close()
+	}
+}
+
+func TestDemultiplexerCancelBlocked(t *testing.T) {
+	defer checkGoroutineLeaks(t)()
+
+	// nobody reads the events
+	replyCh := make(chan string)
+	eventCh := make(chan string)
+	d := NewDemultiplexer(mockReader([]string{">LOG:1584536294,I,msg"}), replyCh, eventCh)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := d.Run(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Run returned %v; want %v", err, context.DeadlineExceeded)
+	}
+	if _, ok := <-eventCh; ok {
+		t.Errorf("event channel is not closed")
+	}
+	if _, ok := <-replyCh; ok {
+		t.Errorf("reply channel is not closed")
+	}
+}
+
+func TestDemultiplexerMaxLineSize(t *testing.T) {
+	replyCh := make(chan string)
+	eventCh := make(chan string)
+	d := NewDemultiplexer(mockReader([]string{"SUCCESS: abcdef", ">LOG:abcdef", "END"}), replyCh, eventCh)
+	d.SetMaxLineSize(8)
+	go d.Run(context.Background())
+
+	replies, events := collectMsgs(replyCh, eventCh)
+	if want := []string{"SUCCESS:", "END"}; !reflect.DeepEqual(replies, want) {
+		t.Errorf("got replies %q; want %q", replies, want)
+	}
+	// the truncated reply is reported as the event
+	wantEvents := []string{"SUCCESS:", "LOG:abc"}
+	if len(events) != len(wantEvents) {
+		t.Fatalf("got events %q; want truncated %q", events, wantEvents)
+	}
+	for i, msg := range events {
+		if line, ok := IsTruncatedLine(msg); !ok || line != wantEvents[i] {
+			t.Errorf("event %d is %q; want truncated %q", i, msg, wantEvents[i])
+		}
+	}
+	if _, ok := IsTruncatedLine("LOG:abc"); ok {
+		t.Errorf("IsTruncatedLine reports the complete line as truncated")
+	}
+}
+
 type alwaysErroringReader struct{}
 
 func (r *alwaysErroringReader) Read(buf []byte) (int, error) {
@@ -0,0 +1,26 @@
+package ovmgmt
+
+import "strings"
+
+// ErrNamedPipeUnsupported is returned by Dial of a named pipe address
+// on systems other than Windows.
+var ErrNamedPipeUnsupported = NewOVpnError("named pipes are only supported on Windows")
+
+const namedPipePrefix = `\\.\pipe\`
+const namedPipeNetwork = "pipe"
+
+func isNamedPipe(addr string) bool {
+	return len(addr) > len(namedPipePrefix) &&
+		strings.EqualFold(addr[:len(namedPipePrefix)], namedPipePrefix)
+}
+
+// pipeAddr is net.Addr of a named pipe
+type pipeAddr string
+
+func (a pipeAddr) Network() string {
+	return namedPipeNetwork
+}
+
+func (a pipeAddr) String() string {
+	return string(a)
+}
@@ -0,0 +1,13 @@
+//go:build !windows
+// +build !windows
+
+package ovmgmt
+
+import (
+	"context"
+	"net"
+)
+
+func dialPipe(ctx context.Context, addr string) (net.Conn, error) {
+	return nil, &net.OpError{Op: "dial", Net: namedPipeNetwork, Addr: pipeAddr(addr), Err: ErrNamedPipeUnsupported}
+}
@@ -0,0 +1,25 @@
+//go:build !windows
+// +build !windows
+
+package ovmgmt
+
+import (
+	"net"
+	"testing"
+)
+
+func TestDialPipeUnsupported(t *testing.T) {
+	for _, dial := range []func() (*MgmtClient, error){
+		func() (*MgmtClient, error) { return Dial(`\\.\pipe\openvpn-mgmt`, make(chan Event)) },
+		func() (*MgmtClient, error) { return DialNetwork("pipe", `\\.\pipe\openvpn-mgmt`, make(chan Event)) },
+	} {
+		c, err := dial()
+		if err == nil {
+			c.Close()
+			t.Fatalf("dial of named pipe returned no error")
+		}
+		if oe, ok := err.(*net.OpError); !ok || oe.Err != ErrNamedPipeUnsupported {
+			t.Errorf("dial of named pipe returned %v; want %v", err, ErrNamedPipeUnsupported)
+		}
+	}
+}
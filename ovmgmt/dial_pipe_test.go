@@ -0,0 +1,26 @@
+package ovmgmt
+
+import "testing"
+
+func TestIsNamedPipe(t *testing.T) {
+	type TestCase struct {
+		Addr     string
+		Expected bool
+	}
+	testCases := []TestCase{
+		{`\\.\pipe\openvpn-mgmt`, true},
+		{`\\.\PIPE\openvpn-mgmt`, true},
+		{`\\.\pipe\`, false},
+		{`\\server\pipe\openvpn-mgmt`, false},
+		{"127.0.0.1:7505", false},
+		{"/run/openvpn/mgmt.sock", false},
+	}
+	for i, tc := range testCases {
+		if got := isNamedPipe(tc.Addr); got != tc.Expected {
+			t.Errorf("test %d isNamedPipe(%q) returned %v; want %v", i, tc.Addr, got, tc.Expected)
+		}
+		if got := guessNetwork(tc.Addr) == namedPipeNetwork; got != tc.Expected {
+			t.Errorf("test %d guessNetwork(%q) returned %q", i, tc.Addr, guessNetwork(tc.Addr))
+		}
+	}
+}
@@ -0,0 +1,67 @@
+//go:build windows
+// +build windows
+
+package ovmgmt
+
+import (
+	"context"
+	"net"
+	"os"
+	"syscall"
+	"time"
+)
+
+// the pipe has no free instance, the server hasn't called ConnectNamedPipe
+// for the next client yet
+const errorPipeBusy syscall.Errno = 231
+
+// how often the busy pipe is retried
+const pipeBusyRetryInterval = 10 * time.Millisecond
+
+// pipeConn is net.Conn of the client end of a named pipe. The handle is
+// synchronous, deadlines are not supported.
+type pipeConn struct {
+	*os.File
+	handle syscall.Handle
+	addr   pipeAddr
+}
+
+// Close cancels the pending read, which otherwise blocks closing
+// the synchronous handle.
+func (c *pipeConn) Close() error {
+	syscall.CancelIoEx(c.handle, nil)
+	return c.File.Close()
+}
+
+func (c *pipeConn) LocalAddr() net.Addr {
+	return c.addr
+}
+
+func (c *pipeConn) RemoteAddr() net.Addr {
+	return c.addr
+}
+
+func dialPipe(ctx context.Context, addr string) (net.Conn, error) {
+	path, err := syscall.UTF16PtrFromString(addr)
+	if err != nil {
+		return nil, &net.OpError{Op: "dial", Net: namedPipeNetwork, Addr: pipeAddr(addr), Err: err}
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, &net.OpError{Op: "dial", Net: namedPipeNetwork, Addr: pipeAddr(addr), Err: err}
+		}
+		h, err := syscall.CreateFile(path, syscall.GENERIC_READ|syscall.GENERIC_WRITE, 0, nil, syscall.OPEN_EXISTING, 0, 0)
+		if err == nil {
+			return &pipeConn{File: os.NewFile(uintptr(h), addr), handle: h, addr: pipeAddr(addr)}, nil
+		}
+		if err != errorPipeBusy {
+			return nil, &net.OpError{Op: "dial", Net: namedPipeNetwork, Addr: pipeAddr(addr), Err: os.NewSyscallError("CreateFile", err)}
+		}
+
+		select {
+		case <-time.After(pipeBusyRetryInterval):
+		case <-ctx.Done():
+		}
+	}
+}
@@ -0,0 +1,73 @@
+//go:build windows
+// +build windows
+
+package ovmgmt
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"testing"
+	"unsafe"
+)
+
+var (
+	modkernel32          = syscall.NewLazyDLL("kernel32.dll")
+	procCreateNamedPipeW = modkernel32.NewProc("CreateNamedPipeW")
+	procConnectNamedPipe = modkernel32.NewProc("ConnectNamedPipe")
+)
+
+const (
+	pipeAccessDuplex       = 0x3
+	pipeTypeByte           = 0x0
+	pipeUnlimitedInstances = 255
+)
+
+// listenPipe creates the server end of the named pipe and serves a single
+// client, replying to pid
+func listenPipe(t *testing.T, addr string) {
+	t.Helper()
+	path, err := syscall.UTF16PtrFromString(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, _, err := procCreateNamedPipeW.Call(uintptr(unsafe.Pointer(path)), pipeAccessDuplex, pipeTypeByte,
+		pipeUnlimitedInstances, 4096, 4096, 0, 0)
+	h := syscall.Handle(r)
+	if h == syscall.InvalidHandle {
+		t.Fatalf("CreateNamedPipe: %v", err)
+	}
+
+	go func() {
+		// fails with ERROR_PIPE_CONNECTED if the client is faster
+		procConnectNamedPipe.Call(uintptr(h), 0)
+		conn := &pipeConn{File: os.NewFile(uintptr(h), addr), handle: h, addr: pipeAddr(addr)}
+		defer conn.Close()
+		greetingDaemon(conn, func(cmd string) []string {
+			if cmd == "pid" {
+				return []string{"SUCCESS: pid=42"}
+			}
+			return nil
+		})
+	}()
+}
+
+func TestDialPipe(t *testing.T) {
+	addr := fmt.Sprintf(`\\.\pipe\ovmgmt-test-%d`, os.Getpid())
+	listenPipe(t, addr)
+
+	eventCh := make(chan Event, 10)
+	c, err := Dial(addr, eventCh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pid, err := c.Pid(); err != nil || pid != 42 {
+		t.Errorf("Pid returned %d, %v; want 42", pid, err)
+	}
+	if got := c.conn.(*pipeConn).RemoteAddr().String(); got != addr {
+		t.Errorf("RemoteAddr returned %s; want %s", got, addr)
+	}
+	if err := c.Close(); err != nil {
+		t.Errorf("Close returned %v", err)
+	}
+}
@@ -0,0 +1,116 @@
+package ovmgmt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+)
+
+// Defaults of RetryOptions.
+const (
+	DefaultRetryInitialDelay = 100 * time.Millisecond
+	DefaultRetryMaxDelay     = 5 * time.Second
+	DefaultRetryMultiplier   = 2
+)
+
+// RetryOptions configures the backoff of DialRetry, zero fields take
+// the defaults.
+type RetryOptions struct {
+	// InitialDelay is the delay after the first failed attempt.
+	InitialDelay time.Duration
+	// MaxDelay caps the delay between attempts.
+	MaxDelay time.Duration
+	// Multiplier is the factor the delay grows by after each attempt,
+	// the values below 1 are taken as 1.
+	Multiplier float64
+	// MaxAttempts limits the number of attempts, zero means no limit
+	// other than the context.
+	MaxAttempts int
+}
+
+func (o RetryOptions) withDefaults() RetryOptions {
+	if o.InitialDelay <= 0 {
+		o.InitialDelay = DefaultRetryInitialDelay
+	}
+	if o.MaxDelay <= 0 {
+		o.MaxDelay = DefaultRetryMaxDelay
+	}
+	if o.Multiplier == 0 {
+		o.Multiplier = DefaultRetryMultiplier
+	} else if o.Multiplier < 1 {
+		o.Multiplier = 1
+	}
+	return o
+}
+
+// DialRetry is DialContext which retries while the management port isn't
+// there yet, e.g. when OpenVPN has just been started and hasn't created
+// the socket: connection refused and no such file errors are retried with
+// exponential backoff, other errors (e.g. of malformed address) are
+// returned right away.
+//
+// Once the context is done, DialRetry returns an error matching
+// the context error with errors.Is, which mentions the last dial error.
+func DialRetry(ctx context.Context, addr string, eventCh chan<- Event, opts RetryOptions) (*MgmtClient, error) {
+	opts = opts.withDefaults()
+	b := newBackoff(opts)
+
+	for attempt := 1; ; attempt++ {
+		c, err := DialContext(ctx, addr, eventCh)
+		if err == nil {
+			return c, nil
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, fmt.Errorf("%w, last error: %v", ctxErr, err)
+		}
+		if !isRetryableDialError(err) || (opts.MaxAttempts > 0 && attempt >= opts.MaxAttempts) {
+			return nil, err
+		}
+
+		if !sleepContext(ctx, b.next()) {
+			return nil, fmt.Errorf("%w, last error: %v", ctx.Err(), err)
+		}
+	}
+}
+
+// backoff computes the exponentially growing delays between attempts
+type backoff struct {
+	opts  RetryOptions
+	delay time.Duration
+}
+
+// newBackoff returns the backoff of the options with the defaults applied
+func newBackoff(opts RetryOptions) *backoff {
+	return &backoff{opts: opts, delay: opts.InitialDelay}
+}
+
+// next returns the delay after the next failed attempt
+func (b *backoff) next() time.Duration {
+	d := b.delay
+	b.delay = time.Duration(float64(b.delay) * b.opts.Multiplier)
+	if b.delay > b.opts.MaxDelay {
+		b.delay = b.opts.MaxDelay
+	}
+	return d
+}
+
+// sleepContext waits for the delay, it returns false if the context
+// is done first
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// isRetryableDialError reports whether the management port may appear later
+func isRetryableDialError(err error) bool {
+	return errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, os.ErrNotExist)
+}
@@ -0,0 +1,119 @@
+package ovmgmt
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDialRetry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ovmgmt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// a free TCP port, refusing connections
+	free, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tcpAddr := free.Addr().String()
+	free.Close()
+
+	type TestCase struct {
+		Network string
+		Addr    string
+	}
+	testCases := []TestCase{
+		{"unix", filepath.Join(dir, "mgmt.sock")},
+		{"tcp", tcpAddr},
+	}
+
+	for i, tc := range testCases {
+		listening := make(chan net.Listener, 1)
+		time.AfterFunc(50*time.Millisecond, func() {
+			l, err := net.Listen(tc.Network, tc.Addr)
+			if err != nil {
+				t.Error(err)
+				close(listening)
+				return
+			}
+			go servePid(l)
+			listening <- l
+		})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		c, err := DialRetry(ctx, tc.Addr, make(chan Event, 10), RetryOptions{InitialDelay: 5 * time.Millisecond})
+		cancel()
+		if err != nil {
+			t.Errorf("test %d DialRetry returned %v", i, err)
+		} else {
+			if pid, err := c.Pid(); err != nil || pid != 42 {
+				t.Errorf("test %d Pid returned %d, %v; want 42", i, pid, err)
+			}
+			c.Close()
+		}
+		if l, ok := <-listening; ok {
+			l.Close()
+		}
+	}
+}
+
+func TestDialRetryFailure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ovmgmt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	missing := filepath.Join(dir, "missing.sock")
+
+	// malformed address fails fast
+	start := time.Now()
+	if _, err := DialRetry(context.Background(), "127.0.0.1:notaport", make(chan Event), RetryOptions{}); err == nil {
+		t.Errorf("DialRetry of malformed address returned no error")
+	}
+	if elapsed := time.Since(start); elapsed >= DefaultRetryInitialDelay {
+		t.Errorf("DialRetry of malformed address returned after %s", elapsed)
+	}
+
+	// attempts are limited
+	opts := RetryOptions{InitialDelay: time.Millisecond, MaxAttempts: 3}
+	if _, err := DialRetry(context.Background(), missing, make(chan Event), opts); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("DialRetry returned %v; want %v", err, os.ErrNotExist)
+	}
+
+	// canceled during the backoff
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start = time.Now()
+	_, err = DialRetry(ctx, missing, make(chan Event), RetryOptions{InitialDelay: time.Hour})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("DialRetry returned %v; want %v", err, context.Canceled)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("DialRetry returned after %s", elapsed)
+	}
+}
+
+func TestRetryOptionsDefaults(t *testing.T) {
+	type TestCase struct {
+		Opts     RetryOptions
+		Expected RetryOptions
+	}
+	testCases := []TestCase{
+		{RetryOptions{}, RetryOptions{DefaultRetryInitialDelay, DefaultRetryMaxDelay, DefaultRetryMultiplier, 0}},
+		{RetryOptions{time.Second, time.Minute, 1.5, 3}, RetryOptions{time.Second, time.Minute, 1.5, 3}},
+		{RetryOptions{Multiplier: 0.5}, RetryOptions{DefaultRetryInitialDelay, DefaultRetryMaxDelay, 1, 0}},
+	}
+	for i, tc := range testCases {
+		if got := tc.Opts.withDefaults(); got != tc.Expected {
+			t.Errorf("test %d withDefaults returned %+v; want %+v", i, got, tc.Expected)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package ovmgmt
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"time"
+)
+
+// DefaultTLSHandshakeTimeout is the time DialTLS waits for the connection
+// and the TLS handshake.
+const DefaultTLSHandshakeTimeout = 10 * time.Second
+
+// DialTLS is Dial for the management port exposed over TLS, e.g. wrapped
+// with stunnel. The address is a TCP one. If cfg doesn't specify
+// ServerName, it's taken from the address, as tls.Dial does.
+//
+// The connection and the handshake must be done in
+// DefaultTLSHandshakeTimeout. Close sends close_notify alert before
+// closing the connection, so the TLS session is torn down cleanly.
+// The greeting of the daemon is checked then, as of Dial.
+func DialTLS(addr string, cfg *tls.Config, eventCh chan<- Event) (*MgmtClient, error) {
+	return dialTLS(addr, cfg, eventCh, DefaultTLSHandshakeTimeout)
+}
+
+func dialTLS(addr string, cfg *tls.Config, eventCh chan<- Event, timeout time.Duration) (*MgmtClient, error) {
+	deadline := time.Now().Add(timeout)
+	dialer := &net.Dialer{Deadline: deadline}
+	rawConn, err := dialer.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg == nil {
+		cfg = &tls.Config{}
+	}
+	if cfg.ServerName == "" {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			rawConn.Close()
+			return nil, err
+		}
+		cfg = cfg.Clone()
+		cfg.ServerName = host
+	}
+
+	conn := tls.Client(rawConn, cfg)
+	conn.SetDeadline(deadline)
+	if err := conn.Handshake(); err != nil {
+		rawConn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+
+	return newDialedClient(context.Background(), conn, eventCh)
+}
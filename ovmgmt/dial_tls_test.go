@@ -0,0 +1,140 @@
+package ovmgmt
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+)
+
+// selfSignedCert returns the certificate for 127.0.0.1 and the pool
+// which trusts it
+func selfSignedCert(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "openvpn-mgmt"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, pool
+}
+
+func TestDialTLS(t *testing.T) {
+	defer checkGoroutineLeaks(t)()
+
+	cert, pool := selfSignedCert(t)
+	l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	type served struct {
+		handshakeErr error
+		readErr      error
+	}
+	servedCh := make(chan served, 2)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			var s served
+			if s.handshakeErr = conn.(*tls.Conn).Handshake(); s.handshakeErr == nil {
+				greetingDaemon(conn, func(cmd string) []string {
+					if cmd == "pid" {
+						return []string{"SUCCESS: pid=42"}
+					}
+					return nil
+				})
+				// the session is over
+				_, s.readErr = conn.Read(make([]byte, 1))
+			}
+			conn.Close()
+			servedCh <- s
+		}
+	}()
+
+	// not trusted
+	if c, err := DialTLS(l.Addr().String(), nil, make(chan Event)); err == nil {
+		c.Close()
+		t.Errorf("DialTLS with untrusted certificate returned no error")
+	}
+	if s := <-servedCh; s.handshakeErr == nil {
+		t.Errorf("server handshake succeeded with untrusted certificate")
+	}
+
+	eventCh := make(chan Event, 10)
+	cfg := &tls.Config{RootCAs: pool}
+	c, err := DialTLS(l.Addr().String(), cfg, eventCh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.ServerName != "" {
+		t.Errorf("DialTLS modified the config")
+	}
+	if pid, err := c.Pid(); err != nil || pid != 42 {
+		t.Errorf("Pid returned %d, %v; want 42", pid, err)
+	}
+	if err := c.Close(); err != nil {
+		t.Errorf("Close returned %v", err)
+	}
+	for range eventCh {
+	}
+	if s := <-servedCh; s.handshakeErr != nil || s.readErr != io.EOF {
+		t.Errorf("server got %v, %v; want clean close", s.handshakeErr, s.readErr)
+	}
+}
+
+func TestDialTLSHandshakeTimeout(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	// accepts, but never talks TLS
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		io.Copy(ioutil.Discard, conn)
+	}()
+
+	if c, err := dialTLS(l.Addr().String(), &tls.Config{InsecureSkipVerify: true}, make(chan Event), 50*time.Millisecond); err == nil {
+		c.Close()
+		t.Fatalf("DialTLS returned no error")
+	} else if ne, ok := err.(net.Error); !ok || !ne.Timeout() {
+		t.Errorf("DialTLS returned %v; want timeout", err)
+	}
+}
@@ -0,0 +1,105 @@
+package ovmgmt
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// Echo directives of OpenVPN GUI messages, pushed by the server as e.g.:
+//
+//     push "echo msg Your password expires in 3 days."
+//     push "echo msg-n Change it at "
+//     push "echo msg https://example.com/"
+//     push "echo msg-window Password expiry"
+//
+// msg appends the text and the newline to the message, msg-n appends
+// the text only, msg-window and msg-notify finish the message, their
+// argument is the message title.
+const (
+	echoMsg       = "msg"
+	echoMsgN      = "msg-n"
+	echoMsgWindow = "msg-window"
+	echoMsgNotify = "msg-notify"
+	echoMsgEnd    = "msg-end"
+)
+
+// EchoMessage is a message assembled from msg and msg-n echo directives.
+type EchoMessage struct {
+	Title string
+	Text  string
+	// Notify is true if the message should be shown as a notification
+	// (msg-notify) rather than in a window (msg-window)
+	Notify bool
+	// Time is the daemon timestamp of the first part of the message
+	Time time.Time
+}
+
+// EchoCollector reassembles multi-part messages sent by msg/msg-n echo
+// directives, terminated by msg-window, msg-notify or msg-end. Other echo
+// messages (e.g. setenv or forget-token) interleaved with the message parts
+// are ignored.
+//
+// It is safe for concurrent use.
+type EchoCollector struct {
+	mu      sync.Mutex
+	text    strings.Builder
+	started bool
+	at      time.Time
+}
+
+func NewEchoCollector() *EchoCollector {
+	return &EchoCollector{}
+}
+
+// Add consumes EchoEvent and returns the complete message when its last
+// part is received. The trailing newline of the text is trimmed.
+// Terminating directive with no parts received before yields no message.
+func (c *EchoCollector) Add(evt Event) (EchoMessage, bool) {
+	e, ok := evt.(EchoEvent)
+	if !ok {
+		return EchoMessage{}, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	name, args := e.Directive()
+	switch name {
+	case echoMsg, echoMsgN:
+		if !c.started {
+			c.started = true
+			c.at = e.Time()
+		}
+		c.text.WriteString(args)
+		if name == echoMsg {
+			c.text.WriteString(newlineSep)
+		}
+	case echoMsgWindow, echoMsgNotify, echoMsgEnd:
+		if !c.started {
+			return EchoMessage{}, false
+		}
+		msg := EchoMessage{
+			Title:  args,
+			Text:   strings.TrimSuffix(c.text.String(), newlineSep),
+			Notify: name == echoMsgNotify,
+			Time:   c.at,
+		}
+		c.reset()
+		return msg, true
+	}
+	return EchoMessage{}, false
+}
+
+// Reset drops parts of the unfinished message, e.g. on reconnect.
+func (c *EchoCollector) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.reset()
+}
+
+func (c *EchoCollector) reset() {
+	c.text.Reset()
+	c.started = false
+	c.at = time.Time{}
+}
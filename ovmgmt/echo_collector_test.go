@@ -0,0 +1,94 @@
+package ovmgmt
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEchoDirective(t *testing.T) {
+	type TestCase struct {
+		Input    string
+		WantName string
+		WantArgs string
+	}
+
+	testCases := []TestCase{
+		{"1584536294,msg Hello, world", "msg", "Hello, world"},
+		{"1584536294,msg-window Password expiry", "msg-window", "Password expiry"},
+		{"1584536294,forget-token", "forget-token", ""},
+		{"1584536294,setenv IV_SSO openurl", "setenv", "IV_SSO openurl"},
+		{"1584536294,msg  two spaces", "msg", " two spaces"},
+		{"1584536294,", "", ""},
+	}
+
+	for i, testCase := range testCases {
+		e, err := NewEchoEvent(testCase.Input)
+		if err != nil {
+			t.Errorf("test %d returned error: %s", i, err)
+			continue
+		}
+		name, args := e.Directive()
+		if name != testCase.WantName || args != testCase.WantArgs {
+			t.Errorf("test %d Directive returned %q, %q; want %q, %q", i, name, args, testCase.WantName, testCase.WantArgs)
+		}
+	}
+}
+
+func TestEchoCollector(t *testing.T) {
+	lines := []string{
+		">ECHO:1584536294,msg-window Ignored",
+		">ECHO:1584536294,msg Your password expires in 3 days.",
+		">ECHO:1584536294,setenv IV_SSO openurl",
+		">ECHO:1584536295,msg-n Change it at ",
+		">LOG:1584536295,I,unrelated",
+		">ECHO:1584536295,msg https://example.com/",
+		">ECHO:1584536295,forget-token",
+		">ECHO:1584536295,msg-window Password expiry",
+		">ECHO:1584536296,msg-n Maintenance tonight",
+		">ECHO:1584536296,msg-notify Maintenance",
+		">ECHO:1584536297,msg Bye",
+		">ECHO:1584536297,msg-end",
+		">ECHO:1584536298,msg Unfinished",
+	}
+
+	want := []EchoMessage{
+		{
+			Title: "Password expiry",
+			Text:  "Your password expires in 3 days.\nChange it at https://example.com/",
+			Time:  time.Unix(1584536294, 0),
+		},
+		{
+			Title:  "Maintenance",
+			Text:   "Maintenance tonight",
+			Notify: true,
+			Time:   time.Unix(1584536296, 0),
+		},
+		{
+			Text: "Bye",
+			Time: time.Unix(1584536297, 0),
+		},
+	}
+
+	c := NewEchoCollector()
+	var got []EchoMessage
+	for _, evt := range replayEvents(lines) {
+		if msg, ok := c.Add(evt); ok {
+			got = append(got, msg)
+		}
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("got %d messages; want %d: %#v", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("message %d got %#v; want %#v", i, got[i], want[i])
+		}
+	}
+
+	c.Reset()
+	evt, _ := NewEchoEvent("1584536299,msg-window Empty")
+	if msg, ok := c.Add(evt); ok {
+		t.Errorf("Add after Reset returned %#v; want no message", msg)
+	}
+}
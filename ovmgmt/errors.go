@@ -0,0 +1,50 @@
+package ovmgmt
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Categories of the errors returned by the client, to be matched with
+// errors.Is. ErrNotConnected is returned by ReconnectingClient as is.
+var (
+	// ErrClosed matches the errors of commands cut short or refused
+	// because the connection or the client is closed, ErrClientClosed
+	// and ClientClosedError among them.
+	ErrClosed = NewOVpnError("connection is closed")
+	// ErrMalformedReply matches the errors of replies which don't
+	// follow the protocol.
+	ErrMalformedReply = NewOVpnError("malformed reply")
+	// ErrTimeout matches the errors of the daemon not responding in time,
+	// ErrKeepaliveTimeout, ErrReadStall and ErrMultilineEventTimeout.
+	ErrTimeout = NewOVpnError("timed out")
+)
+
+// CommandError is the error of the command issued by the client. It wraps
+// the cause, so the categories above are matched through it.
+type CommandError struct {
+	// Verb is the first word of the command, e.g. "status" of "status 3",
+	// the arguments aren't kept as they may contain secrets.
+	Verb string
+	Err  error
+}
+
+func (e *CommandError) Error() string {
+	return fmt.Sprintf("command %q: %s", e.Verb, e.Err)
+}
+
+func (e *CommandError) Unwrap() error {
+	return e.Err
+}
+
+// commandError wraps err of the command, unless it's nil
+func commandError(cmd string, err error) error {
+	if err == nil {
+		return nil
+	}
+	verb := cmd
+	if i := strings.IndexByte(cmd, ' '); i >= 0 {
+		verb = cmd[:i]
+	}
+	return &CommandError{Verb: verb, Err: err}
+}
@@ -0,0 +1,233 @@
+package ovmgmt
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestErrorCategories(t *testing.T) {
+	type TestCase struct {
+		Err    error
+		Is     []error
+		IsNot  []error
+		String string
+	}
+
+	syntaxErr := &strconv.NumError{Func: "Atoi", Num: "x", Err: strconv.ErrSyntax}
+	testCases := []TestCase{
+		{ErrClientClosed, []error{ErrClientClosed, ErrClosed}, []error{ErrTimeout, ErrMalformedReply}, "client is closed"},
+		{&ClientClosedError{io.EOF}, []error{ErrClientClosed, ErrClosed, io.EOF}, []error{ErrTimeout}, "client is closed: EOF"},
+		{ErrKeepaliveTimeout, []error{ErrTimeout}, []error{ErrClosed, ErrReadStall}, "keepalive timed out"},
+		{readStallError(time.Second), []error{ErrReadStall, ErrTimeout}, []error{ErrKeepaliveTimeout}, "read stalled: nothing received from OpenVPN in 1s"},
+		{ErrMultilineEventTimeout, []error{ErrTimeout}, []error{ErrTruncatedEvent}, "multi-line event is not finished in time"},
+		{newCategoryError(ErrMalformedReply, "bad pid", syntaxErr), []error{ErrMalformedReply, strconv.ErrSyntax}, []error{ErrClosed}, `bad pid: strconv.Atoi: parsing "x": invalid syntax`},
+		// no category
+		{NewOVpnError("daemon error"), nil, []error{ErrClosed, ErrMalformedReply, ErrTimeout}, "daemon error"},
+		{ErrNotConnected, nil, []error{ErrClosed}, "not connected"},
+	}
+
+	for i, tc := range testCases {
+		for _, target := range tc.Is {
+			if !errors.Is(tc.Err, target) {
+				t.Errorf("test %d %v doesn't match %v", i, tc.Err, target)
+			}
+		}
+		for _, target := range tc.IsNot {
+			if errors.Is(tc.Err, target) {
+				t.Errorf("test %d %v matches %v", i, tc.Err, target)
+			}
+		}
+		if tc.Err.Error() != tc.String {
+			t.Errorf("test %d got %q; want %q", i, tc.Err.Error(), tc.String)
+		}
+	}
+
+	var numErr *strconv.NumError
+	if err := newCategoryError(ErrMalformedReply, "bad pid", syntaxErr); !errors.As(err, &numErr) || numErr != syntaxErr {
+		t.Errorf("errors.As of %v got %v; want %v", err, numErr, syntaxErr)
+	}
+	var closedErr *ClientClosedError
+	if err := error(&ClientClosedError{io.EOF}); !errors.As(err, &closedErr) || closedErr.Err != io.EOF {
+		t.Errorf("errors.As of %v got %v", err, closedErr)
+	}
+}
+
+func TestCommandErrorCategories(t *testing.T) {
+	type TestCase struct {
+		Reply []string
+		Call  func(c *MgmtClient) error
+		Is    []error
+	}
+
+	pid := func(c *MgmtClient) error {
+		_, err := c.Pid()
+		return err
+	}
+	testCases := []TestCase{
+		// the stray line is skipped
+		{[]string{"garbage", "SUCCESS: nopid"}, pid, []error{ErrMalformedReply}},
+		{[]string{"SUCCESS: nopid"}, pid, []error{ErrMalformedReply}},
+		{[]string{"SUCCESS: pid=x"}, pid, []error{ErrMalformedReply, strconv.ErrSyntax}},
+		{
+			[]string{"1584536294,CONNECTED,SUCCESS,10.8.0.1,,,,", "1584536295,CONNECTED,SUCCESS,10.8.0.1,,,,", "END"},
+			func(c *MgmtClient) error {
+				_, err := c.LatestState()
+				return err
+			},
+			[]error{ErrMalformedReply},
+		},
+	}
+
+	for i, tc := range testCases {
+		reply := tc.Reply
+		c := newReplyingClient(t, make(chan Event, 10), func(string) []string { return reply })
+		err := tc.Call(c)
+		for _, target := range tc.Is {
+			if !errors.Is(err, target) {
+				t.Errorf("test %d got %v; want it to match %v", i, err, target)
+			}
+		}
+		var ovpnErr *OVpnError
+		if !errors.As(err, &ovpnErr) {
+			t.Errorf("test %d got %T; want *OVpnError", i, err)
+		}
+		c.Close()
+	}
+}
+
+func TestCommandErrorClosed(t *testing.T) {
+	r, w := io.Pipe()
+	written := make(notifyingWriter, 1)
+	c := NewMgmtClient(mockConn{r, written}, make(chan Event, 10))
+	defer c.Close()
+
+	cmdErr := make(chan error, 1)
+	go func() {
+		_, err := c.Pid()
+		cmdErr <- err
+	}()
+	<-written
+	w.Close()
+
+	if err := <-cmdErr; !errors.Is(err, ErrClosed) || !errors.Is(err, io.EOF) {
+		t.Errorf("Pid cut short returned %v; want it to match %v and %v", err, ErrClosed, io.EOF)
+	}
+	if _, err := c.Pid(); !errors.Is(err, ErrClosed) {
+		t.Errorf("Pid after EOF returned %v; want it to match %v", err, ErrClosed)
+	}
+
+	c2 := NewMgmtClient(mockConn{r, ioutil.Discard}, make(chan Event, 10))
+	c2.Close()
+	if _, err := c2.Pid(); !errors.Is(err, ErrClosed) || !errors.Is(err, ErrClientClosed) {
+		t.Errorf("Pid after Close returned %v; want %v", err, ErrClientClosed)
+	}
+}
+
+func TestCommandError(t *testing.T) {
+	type TestCase struct {
+		Reply  []string
+		Call   func(c *MgmtClient) error
+		Prefix string
+		Is     error
+	}
+
+	testCases := []TestCase{
+		{
+			[]string{"ERROR: unknown signal type"},
+			func(c *MgmtClient) error { return c.SendSignal("secret") },
+			`command "signal": `,
+			nil,
+		},
+		{
+			[]string{"SUCCESS: pid=x"},
+			func(c *MgmtClient) error {
+				_, err := c.Pid()
+				return err
+			},
+			`command "pid": `,
+			ErrMalformedReply,
+		},
+		{
+			// the stray line is skipped
+			[]string{"garbage", "ERROR: hold release failed"},
+			func(c *MgmtClient) error { return c.HoldRelease() },
+			`command "hold": `,
+			nil,
+		},
+		{
+			[]string{"1584536294,CONNECTED", "1584536295,CONNECTED", "END"},
+			func(c *MgmtClient) error {
+				_, err := c.LatestState()
+				return err
+			},
+			`command "state": `,
+			ErrMalformedReply,
+		},
+		{
+			[]string{"OpenVPN CLIENT LIST"},
+			func(c *MgmtClient) error {
+				_, err := c.LatestStatus3()
+				return err
+			},
+			`command "status": `,
+			ErrClosed,
+		},
+		{
+			[]string{"OpenVPN CLIENT LIST"},
+			func(c *MgmtClient) error {
+				return c.StreamStatus3(func(Status3Record) error { return nil })
+			},
+			`command "status": `,
+			ErrClosed,
+		},
+	}
+
+	for i, tc := range testCases {
+		r, w := io.Pipe()
+		reply := tc.Reply
+		var rw io.Writer = replyWriter{w, func(string) []string { return reply }}
+		if tc.Is == ErrClosed {
+			// the connection is closed after the reply
+			rw = closingReplyWriter{w, reply}
+		}
+		c := NewMgmtClient(mockConn{r, rw}, make(chan Event, 10))
+
+		err := tc.Call(c)
+		var cmdErr *CommandError
+		if !errors.As(err, &cmdErr) || !strings.HasPrefix(err.Error(), tc.Prefix) {
+			t.Errorf("test %d got %v; want CommandError prefixed with %s", i, err, tc.Prefix)
+		}
+		if tc.Is != nil && !errors.Is(err, tc.Is) {
+			t.Errorf("test %d got %v; want it to match %v", i, err, tc.Is)
+		}
+		// the arguments aren't included
+		if strings.Contains(err.Error(), "secret") {
+			t.Errorf("test %d got %v with the command arguments", i, err)
+		}
+		w.Close()
+		c.Close()
+	}
+}
+
+// closingReplyWriter replies with the lines and closes the connection
+type closingReplyWriter struct {
+	w     *io.PipeWriter
+	lines []string
+}
+
+func (rw closingReplyWriter) Write(p []byte) (int, error) {
+	go func() {
+		for _, line := range rw.lines {
+			if _, err := io.WriteString(rw.w, line+"\n"); err != nil {
+				return
+			}
+		}
+		rw.w.Close()
+	}()
+	return len(p), nil
+}
@@ -2,6 +2,7 @@ package ovmgmt
 
 import (
 	"fmt"
+	"net"
 	"strconv"
 	"strings"
 	"time"
@@ -10,22 +11,133 @@ import (
 // HoldEvent is a notification that the OpenVPN process is in a management
 // hold and will not continue connecting until the hold is released, e.g.
 // by calling client.HoldRelease()
+//
+// Newer daemons append the number of seconds OpenVPN will wait before
+// releasing the hold automatically:
+//
+//     >HOLD:Waiting for hold release:10
 type HoldEvent struct {
-	body string
+	receivedAt
+	body    string
+	msg     string
+	waitSec int
+	// options of the client which received the event
+	opts *parseOptions
 }
 
 func NewHoldEvent(body string) HoldEvent {
-	return HoldEvent{body}
+	e := HoldEvent{body: body, msg: body}
+
+	sepIndex := strings.LastIndex(body, eventSep)
+	if sepIndex == -1 {
+		return e
+	}
+	waitSec, err := strconv.Atoi(body[sepIndex+1:])
+	if err != nil || waitSec < 0 {
+		// no wait hint, the colon is a part of the message
+		return e
+	}
+	e.msg = body[:sepIndex]
+	e.waitSec = waitSec
+	return e
+}
+
+func (e HoldEvent) Keyword() string {
+	return holdEventKW
 }
 
 func (e HoldEvent) Raw() string {
 	return e.body
 }
 
+// Message returns the hold message without the wait hint.
+func (e HoldEvent) Message() string {
+	return e.opts.sanitize(e.msg)
+}
+
+// WaitSeconds returns the number of seconds OpenVPN will wait before
+// releasing the hold by itself, or 0 if the daemon did not send it.
+func (e HoldEvent) WaitSeconds() int {
+	return e.waitSec
+}
+
 func (e HoldEvent) String() string {
+	return Sanitize(e.body)
+}
+
+// NeedCertificateEvent is a request for the certificate, emitted when
+// OpenVPN runs with --management-external-cert:
+//
+//     >NEED-CERTIFICATE:macosx-keychain:subject:o=OpenVPN-TEST
+//
+// The answer is expected to be sent back with the "certificate" command.
+type NeedCertificateEvent struct {
+	receivedAt
+	body string
+}
+
+func NewNeedCertificateEvent(body string) NeedCertificateEvent {
+	return NeedCertificateEvent{body: body}
+}
+
+func (e NeedCertificateEvent) Keyword() string {
+	return needCertificateEventKW
+}
+
+func (e NeedCertificateEvent) Raw() string {
+	return e.body
+}
+
+// Selector returns the certificate selector hint, as it was passed to
+// the --management-external-cert option.
+func (e NeedCertificateEvent) Selector() string {
 	return e.body
 }
 
+func (e NeedCertificateEvent) String() string {
+	return Sanitize(fmt.Sprintf("%s: %s", needCertificateEventKW, e.Selector()))
+}
+
+const (
+	LogFlagInfo     = 'I'
+	LogFlagFatal    = 'F'
+	LogFlagNonFatal = 'N'
+	LogFlagWarning  = 'W'
+	LogFlagDebug    = 'D'
+	// LogFlagMuted marks messages muted by --mute on daemons that report it
+	LogFlagMuted = 'M'
+)
+
+// LogSeverity is an ordered level of LogEvent, suitable for filtering,
+// e.g. e.Severity() >= LogSeverityWarning
+type LogSeverity int
+
+const (
+	LogSeverityUnknown LogSeverity = iota
+	LogSeverityDebug
+	LogSeverityInfo
+	LogSeverityWarning
+	LogSeverityError
+	LogSeverityFatal
+)
+
+func (s LogSeverity) String() string {
+	switch s {
+	case LogSeverityDebug:
+		return "DEBUG"
+	case LogSeverityInfo:
+		return "INFO"
+	case LogSeverityWarning:
+		return "WARNING"
+	case LogSeverityError:
+		return "ERROR"
+	case LogSeverityFatal:
+		return "FATAL"
+	default:
+		return "UNKNOWN"
+	}
+}
+
 // LogEvent
 // Real-time output of log messages.
 //
@@ -39,10 +151,16 @@ func (e HoldEvent) String() string {
 //      W -- warning
 //      D -- debug, and
 //  (c) message text.
+//
+// Unknown flag characters are preserved in RawFlags() and ignored
+// by the severity helpers.
 type LogEvent struct {
+	receivedAt
 	body      string
 	bodyParts []string
 	ts        int64
+	// options of the client which received the event
+	opts *parseOptions
 }
 
 func NewLogEvent(body string) (LogEvent, error) {
@@ -58,6 +176,10 @@ func NewLogEvent(body string) (LogEvent, error) {
 	return e, nil
 }
 
+func (e LogEvent) Keyword() string {
+	return logEventKW
+}
+
 func (e LogEvent) Raw() string {
 	return e.body
 }
@@ -75,13 +197,90 @@ func (e LogEvent) RawFlags() string {
 }
 
 func (e LogEvent) Message() string {
-	return e.bodyParts[2]
+	return e.opts.sanitize(e.bodyParts[2])
+}
+
+// HasFlag reports whether the flag r is present in the message flags.
+func (e LogEvent) HasFlag(r rune) bool {
+	return strings.ContainsRune(e.RawFlags(), r)
+}
+
+// IsFatal reports whether the message is a fatal error.
+func (e LogEvent) IsFatal() bool {
+	return e.HasFlag(LogFlagFatal)
+}
+
+// IsError reports whether the message is an error, either fatal or not.
+func (e LogEvent) IsError() bool {
+	return e.HasFlag(LogFlagNonFatal) || e.HasFlag(LogFlagFatal)
+}
+
+func (e LogEvent) IsWarning() bool {
+	return e.HasFlag(LogFlagWarning)
+}
+
+func (e LogEvent) IsDebug() bool {
+	return e.HasFlag(LogFlagDebug)
+}
+
+func (e LogEvent) IsMuted() bool {
+	return e.HasFlag(LogFlagMuted)
+}
+
+// Severity returns the highest severity among the message flags,
+// or LogSeverityUnknown if there are no known flags.
+func (e LogEvent) Severity() LogSeverity {
+	switch {
+	case e.IsFatal():
+		return LogSeverityFatal
+	case e.HasFlag(LogFlagNonFatal):
+		return LogSeverityError
+	case e.IsWarning():
+		return LogSeverityWarning
+	case e.HasFlag(LogFlagInfo):
+		return LogSeverityInfo
+	case e.IsDebug():
+		return LogSeverityDebug
+	default:
+		return LogSeverityUnknown
+	}
 }
 
 func (e LogEvent) String() string {
-	return fmt.Sprintf("LOG[%s]: %s", e.RawFlags(), e.Message())
+	return Sanitize(fmt.Sprintf("LOG[%s]: %s", e.RawFlags(), e.Message()))
 }
 
+// ConnectionState is the state name of StateEvent:
+//   CONNECTING    -- OpenVPN's initial state.
+//   WAIT          -- (Client only) Waiting for initial response from server.
+//   AUTH          -- (Client only) Authenticating with server.
+//   GET_CONFIG    -- (Client only) Downloading configuration options from server.
+//   ASSIGN_IP     -- Assigning IP address to virtual network interface.
+//   ADD_ROUTES    -- Adding routes to system.
+//   CONNECTED     -- Initialization Sequence Completed.
+//   RECONNECTING  -- A restart has occurred.
+//   EXITING       -- A graceful exit is in progress.
+//   RESOLVE       -- (Client only) DNS lookup.
+//   TCP_CONNECT   -- (Client only) Connecting to TCP server.
+//   AUTH_PENDING  -- (Client only) Authentication pending (OpenVPN 2.5+).
+type ConnectionState string
+
+const (
+	StateUnknown      ConnectionState = "UNKNOWN"
+	StateConnecting   ConnectionState = "CONNECTING"
+	StateWait         ConnectionState = "WAIT"
+	StateAuth         ConnectionState = "AUTH"
+	StateGetConfig    ConnectionState = "GET_CONFIG"
+	StateAssignIP     ConnectionState = "ASSIGN_IP"
+	StateAddRoutes    ConnectionState = "ADD_ROUTES"
+	StateConnected    ConnectionState = "CONNECTED"
+	StateReconnecting ConnectionState = "RECONNECTING"
+	StateExiting      ConnectionState = "EXITING"
+	StateResolve      ConnectionState = "RESOLVE"
+	StateTCPConnect   ConnectionState = "TCP_CONNECT"
+	StateAuthPending  ConnectionState = "AUTH_PENDING"
+)
+
 // StateEvent is a notification of a change of connection state. It can be
 // used, for example, to detect if the OpenVPN connection has been interrupted
 // and the OpenVPN process is attempting to reconnect.
@@ -103,14 +302,18 @@ func (e LogEvent) String() string {
 // (e) is available starting from OpenVPN 2.1
 // (f)-(i) are available starting from OpenVPN 2.4
 type StateEvent struct {
+	receivedAt
 	body      string
 	bodyParts []string
 	ts        int64
+	// options of the client which received the event
+	opts *parseOptions
 }
 
 func NewStateEvent(body string) (StateEvent, error) {
 	e := StateEvent{body: body}
-	e.bodyParts = stringsSplitNK(body, fieldSep, 9, 5)
+	// extra trailing fields (if any) are kept in the 10th part and ignored
+	e.bodyParts = stringsSplitNK(body, fieldSep, 10, 9)
 
 	var err error
 	e.ts, err = strconv.ParseInt(e.bodyParts[0], 10, 64)
@@ -120,6 +323,10 @@ func NewStateEvent(body string) (StateEvent, error) {
 	return e, nil
 }
 
+func (e StateEvent) Keyword() string {
+	return stateEventKW
+}
+
 func (e StateEvent) Raw() string {
 	return e.body
 }
@@ -142,6 +349,30 @@ func (e StateEvent) NewState() string {
 	return e.Name()
 }
 
+// State returns the typed state name, or StateUnknown if the name is not
+// known to this package. The raw name is still available via Name().
+func (e StateEvent) State() ConnectionState {
+	switch st := ConnectionState(e.Name()); st {
+	case StateConnecting, StateWait, StateAuth, StateGetConfig, StateAssignIP,
+		StateAddRoutes, StateConnected, StateReconnecting, StateExiting,
+		StateResolve, StateTCPConnect, StateAuthPending:
+		return st
+	default:
+		return StateUnknown
+	}
+}
+
+// IsConnected reports whether the state is CONNECTED.
+func (e StateEvent) IsConnected() bool {
+	return e.State() == StateConnected
+}
+
+// IsTerminal reports whether the state is EXITING, i.e. OpenVPN process
+// is going to exit and there will be no more state changes.
+func (e StateEvent) IsTerminal() bool {
+	return e.State() == StateExiting
+}
+
 func (e StateEvent) Description() string {
 	return e.bodyParts[2]
 }
@@ -164,23 +395,63 @@ func (e StateEvent) RemoteAddr() string {
 	return e.bodyParts[4]
 }
 
+// RemotePort returns the port of the remote system.
+//
+// This field is only populated for events whose Name returns
+// CONNECTED, starting from OpenVPN 2.4.
+func (e StateEvent) RemotePort() string {
+	return e.bodyParts[5]
+}
+
+// LocalAddr returns the non-tunnel IP address of the local system.
+//
+// This field is only populated for events whose Name returns
+// CONNECTED, starting from OpenVPN 2.4.
+func (e StateEvent) LocalAddr() string {
+	return e.bodyParts[6]
+}
+
+// LocalPort returns the port of the local system.
+//
+// This field is only populated for events whose Name returns
+// CONNECTED, starting from OpenVPN 2.4.
+func (e StateEvent) LocalPort() string {
+	return e.bodyParts[7]
+}
+
+// LocalTunnelAddr6 returns the IPv6 address of the local interface within
+// the tunnel, as a string that can be parsed using net.ParseIP.
+//
+// This field is only populated for events whose Name returns
+// either ASSIGN_IP or CONNECTED, starting from OpenVPN 2.4.
+func (e StateEvent) LocalTunnelAddr6() string {
+	return e.bodyParts[8]
+}
+
 func (e StateEvent) String() string {
 	stateName := e.Name()
-	switch stateName {
-	case "ASSIGN_IP":
-		return fmt.Sprintf("%s: %s", stateName, e.LocalTunnelAddr())
-	case "CONNECTED":
-		return fmt.Sprintf("%s: %s", stateName, e.RemoteAddr())
+	switch ConnectionState(stateName) {
+	case StateAssignIP:
+		return Sanitize(fmt.Sprintf("%s: %s", stateName, e.LocalTunnelAddr()))
+	case StateConnected:
+		if e.RemotePort() != "" {
+			return Sanitize(fmt.Sprintf("%s: %s", stateName, net.JoinHostPort(e.RemoteAddr(), e.RemotePort())))
+		}
+		return Sanitize(fmt.Sprintf("%s: %s", stateName, e.RemoteAddr()))
 	default:
 		desc := e.Description()
 		if desc != "" {
-			return fmt.Sprintf("%s: %s", stateName, desc)
+			return Sanitize(fmt.Sprintf("%s: %s", stateName, desc))
 		} else {
-			return stateName
+			return Sanitize(stateName)
 		}
 	}
 }
 
+const echoArgsSep = " "
+const echoAuthToken = "auth-token"
+const echoForgetToken = "forget-token"
+
 // EchoEvent is emitted by an OpenVPN process running in client mode when
 // an "echo" command is pushed to it by the server it has connected to.
 //
@@ -191,9 +462,12 @@ func (e StateEvent) String() string {
 // This event is emitted only if the management client has turned on events
 // of this type using client.SetEchoEvents(true)
 type EchoEvent struct {
+	receivedAt
 	body string
 	ts   int64
 	msg  string
+	// options of the client which received the event
+	opts *parseOptions
 }
 
 func NewEchoEvent(body string) (EchoEvent, error) {
@@ -213,6 +487,10 @@ func NewEchoEvent(body string) (EchoEvent, error) {
 	return e, nil
 }
 
+func (e EchoEvent) Keyword() string {
+	return echoEventKW
+}
+
 func (e EchoEvent) Raw() string {
 	return e.body
 }
@@ -226,9 +504,46 @@ func (e EchoEvent) Time() time.Time {
 }
 
 func (e EchoEvent) Message() string {
-	return e.msg
+	return e.opts.sanitize(e.msg)
+}
+
+// Directive splits the message into the directive name and its (possibly
+// empty) arguments, e.g. "msg-window Welcome" is split into "msg-window"
+// and "Welcome". Some directives are understood by OpenVPN GUIs: msg,
+// msg-n, msg-window, msg-notify, disable-client-cert, forget-token, setenv.
+// See EchoCollector for assembling msg sequences.
+func (e EchoEvent) Directive() (name string, args string) {
+	name, args = splitEchoDirective(e.msg)
+	return e.opts.sanitize(name), e.opts.sanitize(args)
+}
+
+// AuthToken returns the session token if the echo message is an
+// "auth-token {token}" directive.
+func (e EchoEvent) AuthToken() (string, bool) {
+	name, args := splitEchoDirective(e.msg)
+	if name != echoAuthToken {
+		return "", false
+	}
+	return args, true
+}
+
+// IsForgetToken reports whether the echo message is a "forget-token"
+// directive, i.e. the client should drop any saved session token.
+func (e EchoEvent) IsForgetToken() bool {
+	name, _ := splitEchoDirective(e.msg)
+	return name == echoForgetToken
 }
 
 func (e EchoEvent) String() string {
-	return fmt.Sprintf("ECHO: %s", e.Message())
+	if _, ok := e.AuthToken(); ok {
+		return Sanitize(fmt.Sprintf("ECHO: %s %s", echoAuthToken, redactedValue))
+	}
+	return Sanitize(fmt.Sprintf("ECHO: %s", e.Message()))
+}
+
+// splitEchoDirective splits echo message into the directive name and
+// its (possibly empty) arguments
+func splitEchoDirective(msg string) (string, string) {
+	parts := stringsSplitNK(msg, echoArgsSep, 2, 2)
+	return parts[0], parts[1]
 }
@@ -0,0 +1,100 @@
+package ovmgmt
+
+import "sync/atomic"
+
+// EventBus fans the events of one channel out to multiple subscribers,
+// e.g. the metrics exporter, the auth handler and the UI observing
+// the events of the same client. It reads the channel itself, so it may be
+// the event channel of any client, MgmtClient or ReconnectingClient, with
+// no change to the way the client is created.
+//
+// Each subscriber has its own buffer and never blocks the bus: the events
+// which don't fit are dropped for the subscriber and counted by its
+// Dropped. FatalEvent, the last event of the client, is never dropped.
+// The channels of the subscribers are closed once the source channel is.
+type EventBus struct {
+	subs subscriptions
+	done chan struct{}
+}
+
+// NewEventBus returns the bus reading src up to its close.
+func NewEventBus(src <-chan Event) *EventBus {
+	b := &EventBus{done: make(chan struct{})}
+	go b.run(src)
+	return b
+}
+
+func (b *EventBus) run(src <-chan Event) {
+	defer close(b.done)
+	for evt := range src {
+		b.subs.dispatch(evt)
+	}
+	b.subs.closeAll()
+}
+
+// Done returns the channel which is closed once the source channel is
+// closed, along with the channels of the subscribers.
+func (b *EventBus) Done() <-chan struct{} {
+	return b.done
+}
+
+// Subscribe adds the subscriber, which receives the events read by the bus
+// from now on, up to buffer of them not read yet. Zero or negative buffer
+// is taken as 1. The subscriber of the bus which source channel is closed
+// gets the closed channel.
+func (b *EventBus) Subscribe(buffer int) *BusSubscriber {
+	if buffer < 1 {
+		buffer = 1
+	}
+	// the spare slot is for FatalEvent
+	s := &BusSubscriber{ch: make(chan Event, buffer+1), buffer: buffer}
+	s.cancel = b.subs.add(&subscription{
+		offer: s.offer,
+		close: func() { close(s.ch) },
+	})
+	return s
+}
+
+// BusSubscriber is the subscriber of EventBus.
+type BusSubscriber struct {
+	dropped uint64
+
+	ch     chan Event
+	buffer int
+	cancel func()
+}
+
+// offer is called by the bus only, so the buffer can't be filled
+// concurrently
+func (s *BusSubscriber) offer(evt Event) (bool, bool) {
+	if _, fatal := untagEvent(evt).(FatalEvent); !fatal && len(s.ch) >= s.buffer {
+		atomic.AddUint64(&s.dropped, 1)
+		return true, false
+	}
+	select {
+	case s.ch <- evt:
+		return true, true
+	default:
+		atomic.AddUint64(&s.dropped, 1)
+		return true, false
+	}
+}
+
+// Events returns the channel of the events, which is closed once
+// the source channel of the bus is closed, or the subscriber is removed.
+func (s *BusSubscriber) Events() <-chan Event {
+	return s.ch
+}
+
+// Dropped returns the number of events dropped, since the buffer of
+// the subscriber was full.
+func (s *BusSubscriber) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// Unsubscribe removes the subscriber from the bus and closes its channel,
+// the events buffered by then are still delivered. It doesn't wait for
+// the subscribers to catch up, and it's safe to call it multiple times.
+func (s *BusSubscriber) Unsubscribe() {
+	s.cancel()
+}
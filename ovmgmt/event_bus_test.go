@@ -0,0 +1,212 @@
+package ovmgmt
+
+import (
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// busEvents returns the events of the subscriber up to the close of its
+// channel
+func busEvents(t *testing.T, s *BusSubscriber) []Event {
+	t.Helper()
+	var events []Event
+	for {
+		select {
+		case evt, ok := <-s.Events():
+			if !ok {
+				return events
+			}
+			events = append(events, evt)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("the channel of the subscriber is not closed")
+		}
+	}
+}
+
+func TestEventBus(t *testing.T) {
+	defer checkGoroutineLeaks(t)()
+
+	// the bus of the event channel of the client, as is
+	daemonConn, clientConn := net.Pipe()
+	eventCh := make(chan Event, 10)
+	c := NewMgmtClient(clientConn, eventCh)
+	defer c.Close()
+	bus := NewEventBus(eventCh)
+	var subscribers []*BusSubscriber
+	for i := 0; i < 3; i++ {
+		subscribers = append(subscribers, bus.Subscribe(10))
+	}
+	go writeLines(daemonConn,
+		testGreeting,
+		">LOG:1584536294,I,msg 1",
+		">LOG:1584536294,I,msg 2",
+	)
+
+	for i, s := range subscribers {
+		events := busEvents(t, s)
+		if len(events) != 4 {
+			t.Errorf("subscriber %d got events %v; want 4", i, events)
+			continue
+		}
+		if log, ok := events[2].(LogEvent); !ok || log.Message() != "msg 2" {
+			t.Errorf("subscriber %d got %v; want msg 2", i, events[2])
+		}
+		if fatal, ok := events[3].(FatalEvent); !ok || !errors.Is(fatal.Err(), io.EOF) {
+			t.Errorf("subscriber %d got %v; want FatalEvent of EOF", i, events[3])
+		}
+		if s.Dropped() != 0 {
+			t.Errorf("subscriber %d Dropped returned %d; want 0", i, s.Dropped())
+		}
+	}
+	select {
+	case <-bus.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatalf("the bus is not done")
+	}
+
+	// the source channel is closed
+	s := bus.Subscribe(10)
+	if events := busEvents(t, s); len(events) != 0 {
+		t.Errorf("got events %v after the close", events)
+	}
+	s.Unsubscribe()
+}
+
+func TestEventBusSlow(t *testing.T) {
+	defer checkGoroutineLeaks(t)()
+
+	const buffer = 4
+	src := make(chan Event)
+	bus := NewEventBus(src)
+	slow := bus.Subscribe(buffer)
+	// the other one isn't affected
+	roomy := bus.Subscribe(20)
+
+	for i := 0; i < 10; i++ {
+		src <- NewSimpleEvent(logEventKW, strconv.Itoa(i))
+	}
+	// tagged as well
+	src <- TaggedEvent{Instance: "tun0", Event: newFatalEvent(io.EOF)}
+	close(src)
+
+	if events := busEvents(t, roomy); len(events) != 11 || roomy.Dropped() != 0 {
+		t.Errorf("the roomy subscriber got events %v; want 11", events)
+	}
+	events := busEvents(t, slow)
+	if len(events) != buffer+1 {
+		t.Fatalf("the slow subscriber got events %v; want %d", events, buffer+1)
+	}
+	// the oldest ones, and FatalEvent
+	for i, evt := range events[:buffer] {
+		if evt.(SimpleEvent).Body() != strconv.Itoa(i) {
+			t.Errorf("event %d is %v", i, evt)
+		}
+	}
+	if _, ok := events[buffer].(TaggedEvent); !ok {
+		t.Errorf("got %v; want FatalEvent", events[buffer])
+	}
+	if n := slow.Dropped(); n != 10-buffer {
+		t.Errorf("Dropped returned %d; want %d", n, 10-buffer)
+	}
+}
+
+func TestEventBusJoinLeave(t *testing.T) {
+	defer checkGoroutineLeaks(t)()
+
+	const events = 5000
+	src := make(chan Event)
+	bus := NewEventBus(src)
+	// stays up to the end
+	last := bus.Subscribe(events + 1)
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				s := bus.Subscribe(i)
+				// the events are in order, some of them are dropped
+				prev := -1
+				for j := 0; j < 10; j++ {
+					evt, ok := <-s.Events()
+					if !ok {
+						break
+					}
+					n, _ := strconv.Atoi(evt.(SimpleEvent).Body())
+					if n <= prev {
+						t.Errorf("got event %d after %d", n, prev)
+					}
+					prev = n
+				}
+				if i%2 == 0 {
+					s.Unsubscribe()
+				} else {
+					// concurrently with the bus
+					go s.Unsubscribe()
+				}
+				for range s.Events() {
+				}
+			}
+		}(i)
+	}
+
+	for i := 0; i < events; i++ {
+		src <- NewSimpleEvent(logEventKW, strconv.Itoa(i))
+	}
+	close(stop)
+	close(src)
+	wg.Wait()
+
+	got := busEvents(t, last)
+	if len(got) != events || last.Dropped() != 0 {
+		t.Errorf("got %d events, %d dropped; want %d", len(got), last.Dropped(), events)
+	}
+	<-bus.Done()
+}
+
+func TestEventBusSubscribeBuffer(t *testing.T) {
+	defer checkGoroutineLeaks(t)()
+
+	type TestCase struct {
+		Buffer int
+		Events int
+	}
+
+	testCases := []TestCase{
+		{-1, 1},
+		{0, 1},
+		{1, 1},
+		{3, 3},
+	}
+
+	for i, tc := range testCases {
+		src := make(chan Event)
+		bus := NewEventBus(src)
+		s := bus.Subscribe(tc.Buffer)
+		for j := 0; j < 5; j++ {
+			src <- NewSimpleEvent("E", strconv.Itoa(j))
+		}
+		close(src)
+		<-bus.Done()
+
+		events := busEvents(t, s)
+		if len(events) != tc.Events {
+			t.Errorf("test %d got events %v; want %d", i, events, tc.Events)
+		}
+		if n := s.Dropped(); n != uint64(5-tc.Events) {
+			t.Errorf("test %d Dropped returned %d; want %d", i, n, 5-tc.Events)
+		}
+	}
+}
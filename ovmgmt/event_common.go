@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"reflect"
 	"strings"
+	"time"
 )
 
 type eventEndMarker string
@@ -11,6 +12,7 @@ type eventEndMarker string
 const (
 	emSingleLine eventEndMarker = ""
 	emClient                    = clientEventKW + eventSep + clientEnvMarker + fieldSep + endMessage
+	emUpDown                    = updownEventKW + eventSep + clientEnvMarker + fieldSep + endMessage
 )
 
 const eventSep = ":"
@@ -21,11 +23,16 @@ const echoEventKW = "ECHO"
 const fatalEventKW = "FATAL"
 const holdEventKW = "HOLD"
 const infoEventKW = "INFO"
+const infoMsgEventKW = "INFOMSG"
 const logEventKW = "LOG"
+const needCertificateEventKW = "NEED-CERTIFICATE"
 const needOkEventKW = "NEED-OK"
 const needStrEventKW = "NEED-STR"
 const passwordEventKW = "PASSWORD"
+const pkSignEventKW = "PK_SIGN"
+const rsaSignEventKW = "RSA_SIGN"
 const stateEventKW = "STATE"
+const updownEventKW = "UPDOWN"
 
 const clientEventKW = "CLIENT"
 
@@ -40,19 +47,190 @@ type MultilineEvent interface {
 	Event
 }
 
+// KeywordedEvent is implemented by all event types of this package.
+//
+// Keyword returns the original protocol keyword of the event, e.g. STATE,
+// LOG, CLIENT, BYTECOUNT. InvalidEvent returns the keyword of its origin,
+// MalformedEvent returns the empty string.
+type KeywordedEvent interface {
+	Event
+	Keyword() string
+}
+
+// TimestampedEvent is implemented by events carrying the daemon's own
+// timestamp: StateEvent, LogEvent, EchoEvent and Status3Event.
+//
+// The timestamp comes from the daemon's clock and has one-second
+// resolution.
+type TimestampedEvent interface {
+	Event
+	Timestamp() int64
+	Time() time.Time
+}
+
+var (
+	_ TimestampedEvent = StateEvent{}
+	_ TimestampedEvent = LogEvent{}
+	_ TimestampedEvent = EchoEvent{}
+	_ TimestampedEvent = Status3Event{}
+)
+
+// EventTime returns the daemon's timestamp of the event, or fallback
+// (usually the receive time) if the event carries no timestamp.
+func EventTime(evt Event, fallback time.Time) time.Time {
+	te, ok := evt.(TimestampedEvent)
+	if !ok || te.Timestamp() == 0 {
+		return fallback
+	}
+	return te.Time()
+}
+
+// ReceivedEvent is implemented by all event types of this package.
+//
+// ReceivedAt returns the local time the event was read from the daemon
+// (the first line for multi-line events), or the time the command reply
+// was read for Status3Event. It has the full local clock resolution,
+// unlike daemon timestamps, and is set for events without any timestamp,
+// e.g. HOLD, CLIENT, INFO. It is zero for events built by hand.
+type ReceivedEvent interface {
+	Event
+	ReceivedAt() time.Time
+}
+
+type receivedAt struct {
+	at time.Time
+}
+
+func (r receivedAt) ReceivedAt() time.Time {
+	return r.at
+}
+
+// stampEvent returns a copy of the event with the receive time set.
+// Events of unknown types (e.g. from custom parsers) are returned as is.
+func stampEvent(evt Event, at time.Time) Event {
+	r := receivedAt{at}
+	switch e := evt.(type) {
+	case HoldEvent:
+		e.receivedAt = r
+		return e
+	case NeedCertificateEvent:
+		e.receivedAt = r
+		return e
+	case LogEvent:
+		e.receivedAt = r
+		return e
+	case StateEvent:
+		e.receivedAt = r
+		return e
+	case EchoEvent:
+		e.receivedAt = r
+		return e
+	case SimpleEvent:
+		e.receivedAt = r
+		return e
+	case UnknownEvent:
+		e.receivedAt = r
+		return e
+	case MalformedEvent:
+		e.receivedAt = r
+		return e
+	case InvalidEvent:
+		e.receivedAt = r
+		if e.orig != nil {
+			e.orig = stampEvent(e.orig, at)
+		}
+		return e
+	case ByteCountEvent:
+		e.receivedAt = r
+		return e
+	case ByteCountClientEvent:
+		e.receivedAt = r
+		return e
+	case ClientEvent:
+		e.receivedAt = r
+		return e
+	case UpDownEvent:
+		e.receivedAt = r
+		return e
+	case PasswordEvent:
+		e.receivedAt = r
+		return e
+	case PkSignEvent:
+		e.receivedAt = r
+		return e
+	case PromptEvent:
+		e.receivedAt = r
+		return e
+	case Status3Event:
+		e.receivedAt = r
+		return e
+	case *Status3Event:
+		if e != nil {
+			e.receivedAt = r
+		}
+		return e
+	case StatusDeltaEvent:
+		e.receivedAt = r
+		return e
+	case FatalEvent:
+		e.receivedAt = r
+		return e
+	default:
+		return evt
+	}
+}
+
+// withParseOptions returns a copy of the event which accessors apply
+// the parsing options of the client.
+func withParseOptions(evt Event, o *parseOptions) Event {
+	switch e := evt.(type) {
+	case HoldEvent:
+		e.opts = o
+		return e
+	case LogEvent:
+		e.opts = o
+		return e
+	case EchoEvent:
+		e.opts = o
+		return e
+	case PromptEvent:
+		e.opts = o
+		return e
+	case ClientEvent:
+		e.opts = o
+		return e
+	case UpDownEvent:
+		e.opts = o
+		return e
+	case InvalidEvent:
+		if e.orig != nil {
+			e.orig = withParseOptions(e.orig, o)
+		}
+		return e
+	default:
+		return evt
+	}
+}
+
 type SimpleEvent struct {
-	keyword string
-	body    string
+	receivedAt
+	keyword     string
+	body        string
+	recentLines []string
 }
 
 func NewSimpleEvent(keyword, body string) SimpleEvent {
-	return SimpleEvent{keyword, body}
+	return SimpleEvent{keyword: keyword, body: body}
 }
 
 func (e SimpleEvent) Raw() string {
 	return e.keyword + eventSep + e.body
 }
 
+func (e SimpleEvent) Keyword() string {
+	return e.keyword
+}
+
 func (e SimpleEvent) Type() string {
 	return e.keyword
 }
@@ -62,7 +240,7 @@ func (e SimpleEvent) Body() string {
 }
 
 func (e SimpleEvent) String() string {
-	return fmt.Sprintf("%s: %s", e.keyword, e.body)
+	return Sanitize(fmt.Sprintf("%s: %s", e.keyword, e.body)) + recentLinesSuffix(e.recentLines)
 }
 
 // UnknownEvent represents an event of a type that this package doesn't
@@ -73,18 +251,23 @@ func (e SimpleEvent) String() string {
 // to access unsupported behavior. Backward-compatibility is *not*
 // guaranteed for events of this type.
 type UnknownEvent struct {
+	receivedAt
 	keyword string
 	body    string
 }
 
 func NewUnknownEvent(keyword, body string) UnknownEvent {
-	return UnknownEvent{keyword, body}
+	return UnknownEvent{keyword: keyword, body: body}
 }
 
 func (e UnknownEvent) Raw() string {
 	return e.keyword + eventSep + e.body
 }
 
+func (e UnknownEvent) Keyword() string {
+	return e.keyword
+}
+
 func (e UnknownEvent) Type() string {
 	return e.keyword
 }
@@ -94,7 +277,7 @@ func (e UnknownEvent) Body() string {
 }
 
 func (e UnknownEvent) String() string {
-	return fmt.Sprintf("Unknown event %s: %s", e.keyword, e.body)
+	return Sanitize(fmt.Sprintf("Unknown event %s: %s", e.keyword, e.body))
 }
 
 // MalformedEvent represents a message from the OpenVPN process that is
@@ -105,33 +288,67 @@ func (e UnknownEvent) String() string {
 //
 // One reason for potentially seeing events of this type is when the target
 // program is actually not an OpenVPN process at all, but in fact this client
-// has been connected to a different sort of server by mistake.
+// has been connected to a different sort of server by mistake, which Dial
+// detects, see WithHandshakeCheck.
+//
+// The reply lines which are not a part of any reply, e.g. the garbage
+// received while a command waits for its SUCCESS or ERROR result, are
+// emitted as MalformedEvent as well, see Stray.
 type MalformedEvent struct {
-	raw string
+	receivedAt
+	raw         string
+	recentLines []string
+	truncated   bool
+	stray       bool
 }
 
 func NewMalformedEvent(raw string) MalformedEvent {
-	return MalformedEvent{raw}
+	return MalformedEvent{raw: raw}
 }
 
 func (e MalformedEvent) Raw() string {
 	return e.raw
 }
 
+// Keyword returns the empty string, malformed events have no keyword.
+func (e MalformedEvent) Keyword() string {
+	return ""
+}
+
+// Truncated reports whether the event is the line which exceeds the limit,
+// see WithMaxLineSize. Raw returns the truncated line then, with the leading
+// '>' of the event line omitted.
+func (e MalformedEvent) Truncated() bool {
+	return e.truncated
+}
+
+// Stray reports whether the event is the reply line which is not a part of
+// any reply. Raw returns the line as it's received then.
+func (e MalformedEvent) Stray() bool {
+	return e.stray
+}
+
 func (e MalformedEvent) String() string {
-	return fmt.Sprintf("Malformed Event %q", e.raw)
+	if e.truncated {
+		return fmt.Sprintf("Malformed Event %q (truncated line of %d bytes)", e.raw, len(e.raw)) + recentLinesSuffix(e.recentLines)
+	}
+	if e.stray {
+		return fmt.Sprintf("Malformed Event %q (stray reply line)", e.raw) + recentLinesSuffix(e.recentLines)
+	}
+	return fmt.Sprintf("Malformed Event %q", e.raw) + recentLinesSuffix(e.recentLines)
 }
 
 // InvalidEvent represents a message from the OpenVPN process that is
 // presented as an knowable event but does not comply with the specific
 // event syntax.
 type InvalidEvent struct {
+	receivedAt
 	orig       Event
 	firstError error
 }
 
 func NewInvalidEvent(evt Event, err error) InvalidEvent {
-	return InvalidEvent{evt, err}
+	return InvalidEvent{orig: evt, firstError: err}
 }
 
 func (e InvalidEvent) Raw() string {
@@ -141,8 +358,15 @@ func (e InvalidEvent) Raw() string {
 	return e.orig.Raw()
 }
 
+func (e InvalidEvent) Keyword() string {
+	if ke, ok := e.orig.(KeywordedEvent); ok {
+		return ke.Keyword()
+	}
+	return ""
+}
+
 func (e InvalidEvent) String() string {
-	return fmt.Sprintf("Invalid %q Event: %s; data: %s", reflect.TypeOf(e.Origin()), e.firstError, e.Raw())
+	return Sanitize(fmt.Sprintf("Invalid %q Event: %s; data: %s", reflect.TypeOf(e.Origin()), e.firstError, e.Raw()))
 }
 
 func (e InvalidEvent) Origin() Event {
@@ -171,10 +395,20 @@ func splitEvent(line string) (eventEndMarker, string, string) {
 		// >CLIENT:{notificationType},{notificationParams}
 		if strings.HasPrefix(body, string(CEConnect)) || strings.HasPrefix(body, string(CEReauth)) ||
 			strings.HasPrefix(body, string(CEEstablished)) || strings.HasPrefix(body, string(CEDisconnect)) ||
-			strings.HasPrefix(body, string(clientEnvMarker)) {
+			strings.HasPrefix(body, string(CECRResponse)) || strings.HasPrefix(body, string(clientEnvMarker)) {
 			return emClient, keyword, body
 		}
 	}
+	if keyword == updownEventKW {
+		// >UPDOWN:{direction}
+		if body == string(UDUp) || body == string(UDDown) ||
+			strings.HasPrefix(body, string(clientEnvMarker)) {
+			return emUpDown, keyword, body
+		}
+	}
+	if p, ok := registeredMultilineEventParser(keyword); ok {
+		return p.endMarker, keyword, body
+	}
 	return emSingleLine, keyword, body
 }
 
@@ -191,6 +425,8 @@ func upgradeEvent(keyword, body string) Event {
 		evt, err = NewStateEvent(body)
 	case holdEventKW:
 		evt = NewHoldEvent(body)
+	case promptEventKW:
+		evt = NewPromptEvent(body)
 	case echoEventKW:
 		evt, err = NewEchoEvent(body)
 	case byteCountEventKW:
@@ -199,18 +435,28 @@ func upgradeEvent(keyword, body string) Event {
 		evt, err = NewByteCountClientEvent(body)
 	case clientEventKW:
 		evt, err = NewClientEvent([]string{body})
-	case infoEventKW:
+	case updownEventKW:
+		evt, err = NewUpDownEvent([]string{body})
+	case infoEventKW, infoMsgEventKW:
 		evt = NewSimpleEvent(keyword, body)
+	case needCertificateEventKW:
+		evt = NewNeedCertificateEvent(body)
 	case needOkEventKW:
 		evt = NewSimpleEvent(keyword, body)
 	case needStrEventKW:
 		evt = NewSimpleEvent(keyword, body)
 	case passwordEventKW:
-		evt = NewSimpleEvent(keyword, body)
+		evt, err = NewPasswordEvent(body)
+	case pkSignEventKW, rsaSignEventKW:
+		evt, err = NewPkSignEvent(keyword, body)
 	case fatalEventKW:
 		evt = NewSimpleEvent(keyword, body)
 	default:
-		evt = NewUnknownEvent(keyword, body)
+		if fn, ok := registeredEventParser(keyword); ok {
+			evt, err = parseRegisteredEvent(keyword, body, fn)
+		} else {
+			evt = NewUnknownEvent(keyword, body)
+		}
 	}
 
 	if err != nil {
@@ -228,8 +474,14 @@ func upgradeMultilineEvent(keyword string, body []string) MultilineEvent {
 		evt = NewMalformedEvent(strings.Join(body, newlineSep))
 	case clientEventKW:
 		evt, err = NewClientEvent(body)
+	case updownEventKW:
+		evt, err = NewUpDownEvent(body)
 	default:
-		evt = NewUnknownEvent(keyword, strings.Join(body, newlineSep))
+		if p, ok := registeredMultilineEventParser(keyword); ok {
+			evt, err = parseRegisteredMultilineEvent(keyword, body, p.fn)
+		} else {
+			evt = NewUnknownEvent(keyword, strings.Join(body, newlineSep))
+		}
 	}
 
 	if err != nil {
@@ -238,6 +490,35 @@ func upgradeMultilineEvent(keyword string, body []string) MultilineEvent {
 	return evt
 }
 
+// ErrTruncatedEvent is the error of InvalidEvent emitted for a multi-line
+// event which is cut off before its end marker, e.g. when the connection
+// is closed in the middle of CLIENT notification.
+var ErrTruncatedEvent = NewOVpnError("multi-line event is truncated")
+
+// ErrMultilineEventTimeout is the error of InvalidEvent emitted for
+// a multi-line event which end marker isn't received in time,
+// see MgmtClient.SetMultilineEventTimeout.
+var ErrMultilineEventTimeout = newCategoryError(ErrTimeout, "multi-line event is not finished in time", nil)
+
+// ErrEventTooLarge is the error of InvalidEvent emitted for a multi-line
+// event which exceeds the size limit, see WithMaxEventSize.
+var ErrEventTooLarge = NewOVpnError("multi-line event is too large")
+
+// upgradeTruncatedEvent upgrades lines of multi-line event which has never
+// got its end marker. The partial event is wrapped into InvalidEvent
+// with the given error.
+func upgradeTruncatedEvent(keyword string, body []string, err error) InvalidEvent {
+	evt := Event(upgradeMultilineEvent(keyword, body))
+	if inv, ok := evt.(InvalidEvent); ok {
+		evt = inv.Origin()
+	}
+	if ce, ok := evt.(ClientEvent); ok {
+		ce.truncated = true
+		evt = ce
+	}
+	return NewInvalidEvent(evt, err)
+}
+
 // stringsSplitNK behaves the same as strings.SplitN, except the result
 // will either contain at least K subslices (padded with zero value,
 // if needed), or it will be nil if n == k == 0
@@ -0,0 +1,139 @@
+package ovmgmt
+
+import (
+	"strings"
+	"sync"
+)
+
+// EventParserFunc parses the body of a single-line event, i.e. everything
+// after the "KEYWORD:" prefix.
+type EventParserFunc func(body string) (Event, error)
+
+// MultilineEventParserFunc parses the bodies of all lines of a multi-line
+// event, except the terminating one.
+type MultilineEventParserFunc func(body []string) (Event, error)
+
+var ErrEventParserExists = NewOVpnError("event parser for the keyword is already registered")
+
+var builtinEventKWs = map[string]bool{
+	byteCountEventKW:       true,
+	byteCountCliEventKW:    true,
+	clientEventKW:          true,
+	echoEventKW:            true,
+	fatalEventKW:           true,
+	holdEventKW:            true,
+	infoEventKW:            true,
+	logEventKW:             true,
+	needCertificateEventKW: true,
+	needOkEventKW:          true,
+	needStrEventKW:         true,
+	passwordEventKW:        true,
+	pkSignEventKW:          true,
+	promptEventKW:          true,
+	rsaSignEventKW:         true,
+	stateEventKW:           true,
+	updownEventKW:          true,
+}
+
+type multilineParser struct {
+	endMarker eventEndMarker
+	fn        MultilineEventParserFunc
+}
+
+var eventRegistry = struct {
+	sync.RWMutex
+	single    map[string]EventParserFunc
+	multiline map[string]multilineParser
+}{
+	single:    make(map[string]EventParserFunc),
+	multiline: make(map[string]multilineParser),
+}
+
+// RegisterEventParser registers a parser for single-line events with
+// the given keyword, e.g. "FOO" for ">FOO:..." notifications. Such events
+// are otherwise delivered as UnknownEvent.
+//
+// Built-in keywords can't be overridden and a keyword can be registered
+// only once, ErrEventParserExists is returned otherwise. Errors returned
+// by the parser are wrapped into InvalidEvent just like built-in ones.
+//
+// It is safe to call concurrently with running clients, but it's better
+// to register all parsers before the first client is started.
+func RegisterEventParser(keyword string, fn EventParserFunc) error {
+	eventRegistry.Lock()
+	defer eventRegistry.Unlock()
+
+	if isEventParserRegistered(keyword) {
+		return ErrEventParserExists
+	}
+	eventRegistry.single[keyword] = fn
+	return nil
+}
+
+// RegisterMultilineEventParser registers a parser for multi-line events
+// with the given keyword. All lines of such event must start with
+// "KEYWORD:", the event ends with "KEYWORD:{endBody}" line, e.g.:
+//
+//     >FOO:BEGIN
+//     >FOO:ENV,name1=val1
+//     >FOO:ENV,END
+//
+// where endBody is "ENV,END".
+//
+// See RegisterEventParser for restrictions.
+func RegisterMultilineEventParser(keyword, endBody string, fn MultilineEventParserFunc) error {
+	eventRegistry.Lock()
+	defer eventRegistry.Unlock()
+
+	if isEventParserRegistered(keyword) {
+		return ErrEventParserExists
+	}
+	eventRegistry.multiline[keyword] = multilineParser{
+		endMarker: eventEndMarker(keyword + eventSep + endBody),
+		fn:        fn,
+	}
+	return nil
+}
+
+// must be called with eventRegistry lock held
+func isEventParserRegistered(keyword string) bool {
+	if builtinEventKWs[keyword] {
+		return true
+	}
+	if _, ok := eventRegistry.single[keyword]; ok {
+		return true
+	}
+	_, ok := eventRegistry.multiline[keyword]
+	return ok
+}
+
+func registeredEventParser(keyword string) (EventParserFunc, bool) {
+	eventRegistry.RLock()
+	defer eventRegistry.RUnlock()
+	fn, ok := eventRegistry.single[keyword]
+	return fn, ok
+}
+
+func registeredMultilineEventParser(keyword string) (multilineParser, bool) {
+	eventRegistry.RLock()
+	defer eventRegistry.RUnlock()
+	p, ok := eventRegistry.multiline[keyword]
+	return p, ok
+}
+
+// parseRegisteredEvent returns UnknownEvent if the parser returns no event
+func parseRegisteredEvent(keyword, body string, fn EventParserFunc) (Event, error) {
+	evt, err := fn(body)
+	if evt == nil {
+		evt = NewUnknownEvent(keyword, body)
+	}
+	return evt, err
+}
+
+func parseRegisteredMultilineEvent(keyword string, body []string, fn MultilineEventParserFunc) (Event, error) {
+	evt, err := fn(body)
+	if evt == nil {
+		evt = NewUnknownEvent(keyword, strings.Join(body, newlineSep))
+	}
+	return evt, err
+}
@@ -0,0 +1,96 @@
+package ovmgmt
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+type fooEvent struct {
+	body []string
+}
+
+func (e fooEvent) Raw() string {
+	return strings.Join(e.body, newlineSep)
+}
+
+func (e fooEvent) String() string {
+	return "FOO: " + e.Raw()
+}
+
+var errBadFoo = errors.New("bad foo")
+
+func init() {
+	err := RegisterEventParser("FOO", func(body string) (Event, error) {
+		if body == "bad" {
+			return fooEvent{[]string{body}}, errBadFoo
+		}
+		if body == "nil" {
+			return nil, errBadFoo
+		}
+		return fooEvent{[]string{body}}, nil
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	err = RegisterMultilineEventParser("FOOS", "ENV,END", func(body []string) (Event, error) {
+		return fooEvent{body}, nil
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+func TestRegisterEventParser(t *testing.T) {
+	for _, kw := range []string{"STATE", "CLIENT", "FOO", "FOOS"} {
+		if err := RegisterEventParser(kw, nil); err != ErrEventParserExists {
+			t.Errorf("RegisterEventParser(%q) returned %v; want %v", kw, err, ErrEventParserExists)
+		}
+		if err := RegisterMultilineEventParser(kw, "END", nil); err != ErrEventParserExists {
+			t.Errorf("RegisterMultilineEventParser(%q) returned %v; want %v", kw, err, ErrEventParserExists)
+		}
+	}
+
+	lines := []string{
+		">FOO:hello",
+		">FOOS:BEGIN",
+		">FOOS:ENV,a=b",
+		">FOOS:ENV,END",
+		">FOO:bad",
+		">FOO:nil",
+		">STATE:1584536294,CONNECTED,SUCCESS,10.8.0.6,192.168.4.1",
+	}
+
+	events := replayEvents(lines)
+	if len(events) != 5 {
+		t.Fatalf("got %d events; want 5: %v", len(events), events)
+	}
+
+	if foo, ok := events[0].(fooEvent); !ok || foo.Raw() != "hello" {
+		t.Errorf("event 0 got %#v; want fooEvent", events[0])
+	}
+	if foo, ok := events[1].(fooEvent); !ok || foo.Raw() != "BEGIN\nENV,a=b" {
+		t.Errorf("event 1 got %#v; want multi-line fooEvent", events[1])
+	}
+
+	inv, ok := events[2].(InvalidEvent)
+	if !ok {
+		t.Fatalf("event 2 got %T; want InvalidEvent", events[2])
+	}
+	if _, ok := inv.Origin().(fooEvent); !ok || inv.FirstError() != errBadFoo {
+		t.Errorf("event 2 got origin %T, error %v", inv.Origin(), inv.FirstError())
+	}
+
+	inv, ok = events[3].(InvalidEvent)
+	if !ok {
+		t.Fatalf("event 3 got %T; want InvalidEvent", events[3])
+	}
+	if unk, ok := inv.Origin().(UnknownEvent); !ok || unk.Raw() != "FOO:nil" {
+		t.Errorf("event 3 got origin %#v; want UnknownEvent", inv.Origin())
+	}
+
+	if _, ok := events[4].(StateEvent); !ok {
+		t.Errorf("event 4 got %T; want StateEvent", events[4])
+	}
+}
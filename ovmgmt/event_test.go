@@ -86,13 +86,51 @@ func TestUnknownEvent(t *testing.T) {
 }
 
 func TestHoldEvent(t *testing.T) {
-	testCases := []string{
-		"HOLD:",
-		"HOLD:waiting for hold release",
+	type TestCase struct {
+		Input       string
+		WantMessage string
+		WantWait    int
+	}
+	testCases := []TestCase{
+		{
+			Input:       "HOLD:",
+			WantMessage: "",
+			WantWait:    0,
+		},
+		{
+			Input:       "HOLD:waiting for hold release",
+			WantMessage: "waiting for hold release",
+			WantWait:    0,
+		},
+		{
+			Input:       "HOLD:Waiting for hold release:10",
+			WantMessage: "Waiting for hold release",
+			WantWait:    10,
+		},
+		{
+			Input:       "HOLD:Waiting: for: hold release:5",
+			WantMessage: "Waiting: for: hold release",
+			WantWait:    5,
+		},
+		{
+			Input:       "HOLD:Waiting: for hold release",
+			WantMessage: "Waiting: for hold release",
+			WantWait:    0,
+		},
+		{
+			Input:       "HOLD:Waiting for hold release:",
+			WantMessage: "Waiting for hold release:",
+			WantWait:    0,
+		},
+		{
+			Input:       "HOLD:Waiting for hold release:-1",
+			WantMessage: "Waiting for hold release:-1",
+			WantWait:    0,
+		},
 	}
 
 	for i, testCase := range testCases {
-		_, kw, body := splitEvent(testCase)
+		_, kw, body := splitEvent(testCase.Input)
 		event := upgradeEvent(kw, body)
 
 		var hold HoldEvent
@@ -101,6 +139,16 @@ func TestHoldEvent(t *testing.T) {
 			t.Errorf("test %d got %T; want %T", i, event, hold)
 			continue
 		}
+
+		if got, want := hold.Message(), testCase.WantMessage; got != want {
+			t.Errorf("test %d Message returned %q; want %q", i, got, want)
+		}
+		if got, want := hold.WaitSeconds(), testCase.WantWait; got != want {
+			t.Errorf("test %d WaitSeconds returned %d; want %d", i, got, want)
+		}
+		if got, want := hold.Raw(), body; got != want {
+			t.Errorf("test %d Raw returned %q; want %q", i, got, want)
+		}
 	}
 }
 
@@ -587,3 +635,327 @@ func TestByteCountClientEvent(t *testing.T) {
 		}
 	}
 }
+
+func TestNeedCertificateEvent(t *testing.T) {
+	type TestCase struct {
+		Input        string
+		WantSelector string
+	}
+	testCases := []TestCase{
+		{
+			Input:        "NEED-CERTIFICATE:macosx-keychain:subject:o=OpenVPN-TEST",
+			WantSelector: "macosx-keychain:subject:o=OpenVPN-TEST",
+		},
+		{
+			Input:        "NEED-CERTIFICATE:",
+			WantSelector: "",
+		},
+		{
+			Input:        "NEED-CERTIFICATE:pkcs11-id",
+			WantSelector: "pkcs11-id",
+		},
+	}
+
+	for i, testCase := range testCases {
+		_, kw, body := splitEvent(testCase.Input)
+		event := upgradeEvent(kw, body)
+
+		var nc NeedCertificateEvent
+		var ok bool
+		if nc, ok = event.(NeedCertificateEvent); !ok {
+			t.Errorf("test %d got %T; want %T", i, event, nc)
+			continue
+		}
+
+		if got, want := nc.Selector(), testCase.WantSelector; got != want {
+			t.Errorf("test %d Selector returned %q; want %q", i, got, want)
+		}
+		if got, want := kw+eventSep+nc.Raw(), testCase.Input; got != want {
+			t.Errorf("test %d Raw returned %q; want %q", i, got, want)
+		}
+	}
+}
+
+func TestStateEventFull(t *testing.T) {
+	type TestCase struct {
+		Input          string
+		WantRemoteAddr string
+		WantRemotePort string
+		WantLocalAddr  string
+		WantLocalPort  string
+		WantLocalAddr6 string
+		WantString     string
+	}
+	testCases := []TestCase{
+		{
+			// OpenVPN 2.3
+			Input:          "STATE:1584536294,CONNECTED,SUCCESS,10.8.0.6,192.168.4.1",
+			WantRemoteAddr: "192.168.4.1",
+			WantString:     "CONNECTED: 192.168.4.1",
+		},
+		{
+			// OpenVPN 2.4+
+			Input:          "STATE:1584536294,CONNECTED,SUCCESS,10.8.0.6,192.168.4.1,1194,192.168.4.2,49152,fd00::1000",
+			WantRemoteAddr: "192.168.4.1",
+			WantRemotePort: "1194",
+			WantLocalAddr:  "192.168.4.2",
+			WantLocalPort:  "49152",
+			WantLocalAddr6: "fd00::1000",
+			WantString:     "CONNECTED: 192.168.4.1:1194",
+		},
+		{
+			Input:          "STATE:1584536294,CONNECTED,SUCCESS,10.8.0.6,2001:db8::1,1194,,,",
+			WantRemoteAddr: "2001:db8::1",
+			WantRemotePort: "1194",
+			WantString:     "CONNECTED: [2001:db8::1]:1194",
+		},
+		{
+			// extra trailing fields from a future daemon
+			Input:          "STATE:1584536294,CONNECTED,SUCCESS,10.8.0.6,192.168.4.1,1194,192.168.4.2,49152,fd00::1000,extra,fields",
+			WantRemoteAddr: "192.168.4.1",
+			WantRemotePort: "1194",
+			WantLocalAddr:  "192.168.4.2",
+			WantLocalPort:  "49152",
+			WantLocalAddr6: "fd00::1000",
+			WantString:     "CONNECTED: 192.168.4.1:1194",
+		},
+		{
+			Input:          "STATE:1584536294,ASSIGN_IP,,10.8.0.6,,,,,fd00::1000",
+			WantLocalAddr6: "fd00::1000",
+			WantString:     "ASSIGN_IP: 10.8.0.6",
+		},
+	}
+
+	for i, testCase := range testCases {
+		_, kw, body := splitEvent(testCase.Input)
+		event := upgradeEvent(kw, body)
+
+		var st StateEvent
+		var ok bool
+		if st, ok = event.(StateEvent); !ok {
+			t.Errorf("test %d got %T; want %T", i, event, st)
+			continue
+		}
+
+		if got, want := st.RemoteAddr(), testCase.WantRemoteAddr; got != want {
+			t.Errorf("test %d RemoteAddr returned %q; want %q", i, got, want)
+		}
+		if got, want := st.RemotePort(), testCase.WantRemotePort; got != want {
+			t.Errorf("test %d RemotePort returned %q; want %q", i, got, want)
+		}
+		if got, want := st.LocalAddr(), testCase.WantLocalAddr; got != want {
+			t.Errorf("test %d LocalAddr returned %q; want %q", i, got, want)
+		}
+		if got, want := st.LocalPort(), testCase.WantLocalPort; got != want {
+			t.Errorf("test %d LocalPort returned %q; want %q", i, got, want)
+		}
+		if got, want := st.LocalTunnelAddr6(), testCase.WantLocalAddr6; got != want {
+			t.Errorf("test %d LocalTunnelAddr6 returned %q; want %q", i, got, want)
+		}
+		if got, want := st.String(), testCase.WantString; got != want {
+			t.Errorf("test %d String returned %q; want %q", i, got, want)
+		}
+	}
+}
+
+func TestStateEventState(t *testing.T) {
+	type TestCase struct {
+		Name          string
+		WantState     ConnectionState
+		WantConnected bool
+		WantTerminal  bool
+	}
+	testCases := []TestCase{
+		{"CONNECTING", StateConnecting, false, false},
+		{"WAIT", StateWait, false, false},
+		{"AUTH", StateAuth, false, false},
+		{"GET_CONFIG", StateGetConfig, false, false},
+		{"ASSIGN_IP", StateAssignIP, false, false},
+		{"ADD_ROUTES", StateAddRoutes, false, false},
+		{"CONNECTED", StateConnected, true, false},
+		{"RECONNECTING", StateReconnecting, false, false},
+		{"EXITING", StateExiting, false, true},
+		{"RESOLVE", StateResolve, false, false},
+		{"TCP_CONNECT", StateTCPConnect, false, false},
+		{"AUTH_PENDING", StateAuthPending, false, false},
+		{"CONNECTED_TYPO", StateUnknown, false, false},
+		{"connected", StateUnknown, false, false},
+		{"", StateUnknown, false, false},
+	}
+
+	for i, testCase := range testCases {
+		st, err := NewStateEvent("1584536294," + testCase.Name + ",,,")
+		if err != nil {
+			t.Errorf("test %d returned error %v", i, err)
+			continue
+		}
+
+		if got, want := st.State(), testCase.WantState; got != want {
+			t.Errorf("test %d State returned %q; want %q", i, got, want)
+		}
+		if got, want := st.Name(), testCase.Name; got != want {
+			t.Errorf("test %d Name returned %q; want %q", i, got, want)
+		}
+		if got, want := st.IsConnected(), testCase.WantConnected; got != want {
+			t.Errorf("test %d IsConnected returned %t; want %t", i, got, want)
+		}
+		if got, want := st.IsTerminal(), testCase.WantTerminal; got != want {
+			t.Errorf("test %d IsTerminal returned %t; want %t", i, got, want)
+		}
+	}
+}
+
+func TestLogEventSeverity(t *testing.T) {
+	type TestCase struct {
+		Input        string
+		WantSeverity LogSeverity
+		WantFatal    bool
+		WantError    bool
+		WantWarning  bool
+		WantDebug    bool
+		WantMuted    bool
+	}
+	testCases := []TestCase{
+		{"LOG:", LogSeverityUnknown, false, false, false, false, false},
+		{"LOG:1584536294,,msg", LogSeverityUnknown, false, false, false, false, false},
+		{"LOG:1584536294,I,msg", LogSeverityInfo, false, false, false, false, false},
+		{"LOG:1584536294,D,msg", LogSeverityDebug, false, false, false, true, false},
+		{"LOG:1584536294,W,msg", LogSeverityWarning, false, false, true, false, false},
+		{"LOG:1584536294,IW,msg", LogSeverityWarning, false, false, true, false, false},
+		{"LOG:1584536294,N,msg", LogSeverityError, false, true, false, false, false},
+		{"LOG:1584536294,NW,msg", LogSeverityError, false, true, true, false, false},
+		{"LOG:1584536294,F,msg", LogSeverityFatal, true, true, false, false, false},
+		{"LOG:1584536294,FN,msg", LogSeverityFatal, true, true, false, false, false},
+		{"LOG:1584536294,DM,msg", LogSeverityDebug, false, false, false, true, true},
+		{"LOG:1584536294,XYZ,msg", LogSeverityUnknown, false, false, false, false, false},
+		{"LOG:1584536294,XW,msg", LogSeverityWarning, false, false, true, false, false},
+	}
+
+	for i, testCase := range testCases {
+		_, kw, body := splitEvent(testCase.Input)
+		event := upgradeEvent(kw, body)
+
+		var le LogEvent
+		var ok bool
+		if inv, isInvalid := event.(InvalidEvent); isInvalid {
+			event = inv.Origin()
+		}
+		if le, ok = event.(LogEvent); !ok {
+			t.Errorf("test %d got %T; want %T", i, event, le)
+			continue
+		}
+
+		if got, want := le.Severity(), testCase.WantSeverity; got != want {
+			t.Errorf("test %d Severity returned %s; want %s", i, got, want)
+		}
+		if got, want := le.IsFatal(), testCase.WantFatal; got != want {
+			t.Errorf("test %d IsFatal returned %t; want %t", i, got, want)
+		}
+		if got, want := le.IsError(), testCase.WantError; got != want {
+			t.Errorf("test %d IsError returned %t; want %t", i, got, want)
+		}
+		if got, want := le.IsWarning(), testCase.WantWarning; got != want {
+			t.Errorf("test %d IsWarning returned %t; want %t", i, got, want)
+		}
+		if got, want := le.IsDebug(), testCase.WantDebug; got != want {
+			t.Errorf("test %d IsDebug returned %t; want %t", i, got, want)
+		}
+		if got, want := le.IsMuted(), testCase.WantMuted; got != want {
+			t.Errorf("test %d IsMuted returned %t; want %t", i, got, want)
+		}
+	}
+
+	le, _ := NewLogEvent("1584536294,XW,msg")
+	if !le.HasFlag('X') || le.RawFlags() != "XW" {
+		t.Errorf("unknown flag is not preserved: %q", le.RawFlags())
+	}
+	if !(LogSeverityFatal > LogSeverityError && LogSeverityError > LogSeverityWarning &&
+		LogSeverityWarning > LogSeverityInfo && LogSeverityInfo > LogSeverityDebug) {
+		t.Errorf("severity levels are not ordered")
+	}
+}
+
+func TestEventKeyword(t *testing.T) {
+	type TestCase struct {
+		Input       string
+		WantKeyword string
+	}
+	testCases := []TestCase{
+		{"HOLD:Waiting for hold release", "HOLD"},
+		{"LOG:1584536294,I,msg", "LOG"},
+		{"LOG:bad", "LOG"},
+		{"STATE:1584536294,CONNECTED,SUCCESS,10.8.0.6,192.168.4.1", "STATE"},
+		{"ECHO:1584536294,foo", "ECHO"},
+		{"BYTECOUNT:1,2", "BYTECOUNT"},
+		{"BYTECOUNT_CLI:1,2,3", "BYTECOUNT_CLI"},
+		{"CLIENT:ADDRESS,1,10.8.0.6,1", "CLIENT"},
+		{"INFO:OpenVPN Management Interface Version 1", "INFO"},
+		{"NEED-OK:Need 'token-insertion-request' confirmation MSG:Please insert your token", "NEED-OK"},
+		{"NEED-STR:Need 'name' input MSG:Please specify your name", "NEED-STR"},
+		{"NEED-CERTIFICATE:macosx-keychain:subject:o=OpenVPN-TEST", "NEED-CERTIFICATE"},
+		{"PASSWORD:Need 'Auth' username/password", "PASSWORD"},
+		{"PK_SIGN:aGVsbG8=", "PK_SIGN"},
+		{"RSA_SIGN:aGVsbG8=", "RSA_SIGN"},
+		{"FATAL:Error reading from OpenVPN", "FATAL"},
+		{"DUMMY:baz", "DUMMY"},
+		{"HTTP/1.1 200 OK", ""},
+	}
+
+	for i, testCase := range testCases {
+		_, kw, body := splitEvent(testCase.Input)
+		event := upgradeEvent(kw, body)
+
+		ke, ok := event.(KeywordedEvent)
+		if !ok {
+			t.Errorf("test %d %T does not implement KeywordedEvent", i, event)
+			continue
+		}
+		if got, want := ke.Keyword(), testCase.WantKeyword; got != want {
+			t.Errorf("test %d Keyword of %T returned %q; want %q", i, event, got, want)
+		}
+	}
+
+	multiline := []KeywordedEvent{
+		upgradeMultilineEvent(clientEventKW, []string{"ESTABLISHED,1", "ENV,common_name=alice"}).(KeywordedEvent),
+		upgradeMultilineEvent(updownEventKW, []string{"UP", "ENV,dev=tun0"}).(KeywordedEvent),
+		Status3Event{},
+	}
+	for i, want := range []string{"CLIENT", "UPDOWN", "STATUS3"} {
+		if got := multiline[i].Keyword(); got != want {
+			t.Errorf("multiline test %d Keyword of %T returned %q; want %q", i, multiline[i], got, want)
+		}
+	}
+}
+
+func TestEventTime(t *testing.T) {
+	fallback := time.Unix(42, 0)
+	type TestCase struct {
+		Input    string
+		WantTime time.Time
+	}
+	testCases := []TestCase{
+		{"STATE:1584536294,CONNECTED,SUCCESS,10.8.0.6,192.168.4.1", time.Unix(1584536294, 0)},
+		{"LOG:1584536295,I,msg", time.Unix(1584536295, 0)},
+		{"ECHO:1584536296,foo", time.Unix(1584536296, 0)},
+		{"LOG:bad,I,msg", fallback},
+		{"HOLD:Waiting for hold release", fallback},
+		{"BYTECOUNT:1,2", fallback},
+	}
+
+	for i, testCase := range testCases {
+		_, kw, body := splitEvent(testCase.Input)
+		event := upgradeEvent(kw, body)
+
+		if got, want := EventTime(event, fallback), testCase.WantTime; !got.Equal(want) {
+			t.Errorf("test %d EventTime returned %s; want %s", i, got, want)
+		}
+	}
+
+	se := Status3Event{ts: 1584536297}
+	if got, want := EventTime(se, fallback), time.Unix(1584536297, 0); !got.Equal(want) {
+		t.Errorf("EventTime(Status3Event) returned %s; want %s", got, want)
+	}
+	if got, want := EventTime(&se, fallback), time.Unix(1584536297, 0); !got.Equal(want) {
+		t.Errorf("EventTime(*Status3Event) returned %s; want %s", got, want)
+	}
+}
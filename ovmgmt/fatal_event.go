@@ -0,0 +1,69 @@
+package ovmgmt
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// FatalEvent is a synthetic event emitted by the client as the last event
+// before the event channel is closed, when the connection is terminated
+// by the daemon or by a read error rather than by Close.
+//
+// Its keyword is FATAL, as of the event the daemon sends before exiting,
+// which is still delivered as SimpleEvent, so the two are told apart
+// by the type.
+type FatalEvent struct {
+	receivedAt
+	err error
+	// describes err, the read error by default
+	desc        string
+	recentLines []string
+}
+
+func newFatalEvent(err error) FatalEvent {
+	if errors.Is(err, errStrictParsing) {
+		return FatalEvent{err: err, desc: strictParsingFatalDesc}
+	}
+	return FatalEvent{err: err}
+}
+
+func (e FatalEvent) Keyword() string {
+	return fatalEventKW
+}
+
+func (e FatalEvent) Raw() string {
+	return fatalEventKW + eventSep + e.Body()
+}
+
+// Body returns the description of the error.
+func (e FatalEvent) Body() string {
+	if e.err == io.EOF {
+		return "Connection closed by OpenVPN"
+	}
+	if errors.Is(e.err, ErrManagementBusy) {
+		return fmt.Sprintf("Connection closed by OpenVPN: %s", e.err)
+	}
+	desc := e.desc
+	if desc == "" {
+		desc = "Error reading from OpenVPN"
+	}
+	return fmt.Sprintf("%s: %s", desc, e.err)
+}
+
+// Err returns the error the connection is terminated with, io.EOF if
+// it's closed by the daemon, ManagementBusyError if it's closed right
+// after it's established, the failure of WithStrictParsing, or the last
+// dial error of ReconnectingClient which has given up. Commands fail with
+// ClientClosedError wrapping it from then on.
+func (e FatalEvent) Err() error {
+	return e.err
+}
+
+func (e FatalEvent) Unwrap() error {
+	return e.err
+}
+
+func (e FatalEvent) String() string {
+	return Sanitize(fmt.Sprintf("%s: %s", fatalEventKW, e.Body())) + recentLinesSuffix(e.recentLines)
+}
@@ -0,0 +1,99 @@
+package ovmgmt
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+// notifyingWriter signals each write on the channel
+type notifyingWriter chan struct{}
+
+func (w notifyingWriter) Write(p []byte) (int, error) {
+	w <- struct{}{}
+	return len(p), nil
+}
+
+func TestFatalEvent(t *testing.T) {
+	type TestCase struct {
+		Err      error
+		WantErr  error
+		WantBody string
+	}
+
+	readErr := fmt.Errorf("connection reset by peer")
+	testCases := []TestCase{
+		// abrupt EOF
+		{nil, io.EOF, "Connection closed by OpenVPN"},
+		{readErr, readErr, "Error reading from OpenVPN: connection reset by peer"},
+	}
+
+	for i, tc := range testCases {
+		r, w := io.Pipe()
+		written := make(notifyingWriter, 1)
+		eventCh := make(chan Event, 10)
+		c := NewMgmtClient(mockConn{r, written}, eventCh)
+
+		cmdErr := make(chan error, 1)
+		go func() {
+			_, err := c.Pid()
+			cmdErr <- err
+		}()
+		<-written
+		w.Write([]byte(">HOLD:Waiting for hold release\n"))
+		w.CloseWithError(tc.Err)
+
+		// the command waiting for the reply gets the same error, wrapped
+		if err := <-cmdErr; !errors.Is(err, tc.WantErr) || !errors.Is(err, ErrClientClosed) {
+			t.Errorf("test %d Pid returned %v; want %v", i, err, tc.WantErr)
+		}
+
+		var events []Event
+		for evt := range eventCh {
+			events = append(events, evt)
+		}
+		if len(events) != 2 {
+			t.Fatalf("test %d got %d events; want 2: %v", i, len(events), events)
+		}
+		if _, ok := events[0].(HoldEvent); !ok {
+			t.Errorf("test %d event 0 got %#v; want HoldEvent", i, events[0])
+		}
+		fatal, ok := events[1].(FatalEvent)
+		if !ok {
+			t.Fatalf("test %d event 1 got %#v; want FatalEvent", i, events[1])
+		}
+		if fatal.Err() != tc.WantErr || fatal.Body() != tc.WantBody {
+			t.Errorf("test %d got FatalEvent %v, %q; want %v, %q", i, fatal.Err(), fatal.Body(), tc.WantErr, tc.WantBody)
+		}
+		if fatal.Keyword() != fatalEventKW || fatal.ReceivedAt().IsZero() {
+			t.Errorf("test %d got FatalEvent keyword %q, received at %v", i, fatal.Keyword(), fatal.ReceivedAt())
+		}
+		if err := c.Err(); err != tc.WantErr {
+			t.Errorf("test %d Err returned %v; want %v", i, err, tc.WantErr)
+		}
+		if _, err := c.Pid(); !errors.Is(err, tc.WantErr) || !errors.Is(err, ErrClientClosed) {
+			t.Errorf("test %d Pid after the end returned %v; want %v", i, err, tc.WantErr)
+		}
+		if len(written) != 0 {
+			t.Errorf("test %d Pid after the end is written", i)
+		}
+	}
+}
+
+func TestFatalEventNotOnClose(t *testing.T) {
+	r, w := io.Pipe()
+	defer w.Close()
+	eventCh := make(chan Event, 10)
+	c := NewMgmtClient(mockConn{r, ioutil.Discard}, eventCh)
+
+	w.Write([]byte(">FATAL:daemon is exiting\n"))
+	if evt, ok := (<-eventCh).(SimpleEvent); !ok || evt.Keyword() != fatalEventKW {
+		t.Errorf("got %#v; want SimpleEvent of FATAL", evt)
+	}
+	go c.Close()
+	for evt := range eventCh {
+		t.Errorf("got %s after Close", evt)
+	}
+}
@@ -0,0 +1,197 @@
+package ovmgmt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// DefaultHandshakeTimeout is the time Dial waits for the greeting of
+// the daemon, see WithHandshakeCheck.
+const DefaultHandshakeTimeout = 5 * time.Second
+
+// managementGreeting is the prefix of the line the daemon sends first,
+// e.g. ">INFO:OpenVPN Management Interface Version 3 -- type 'help' for
+// more info"
+const managementGreeting = ">" + infoEventKW + eventSep + "OpenVPN Management Interface"
+
+// ErrNotOpenVPN matches NotOpenVPNError with errors.Is.
+var ErrNotOpenVPN = NewOVpnError("not an OpenVPN management interface")
+
+// NotOpenVPNError is the error of the connection, which is not the one to
+// the OpenVPN management interface, see WithHandshakeCheck.
+type NotOpenVPNError struct {
+	// FirstLine is the first line received instead of the greeting,
+	// empty if nothing is received
+	FirstLine string
+	// Err is the reason nothing is received: the timeout, matching
+	// ErrTimeout, or the connection error
+	Err error
+}
+
+func (e *NotOpenVPNError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: no greeting received: %s", ErrNotOpenVPN, e.Err)
+	}
+	return fmt.Sprintf("%s: got %q instead of the greeting", ErrNotOpenVPN, e.FirstLine)
+}
+
+func (e *NotOpenVPNError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is ErrNotOpenVPN.
+func (e *NotOpenVPNError) Is(target error) bool {
+	return target == ErrNotOpenVPN
+}
+
+// ErrManagementBusy matches ManagementBusyError with errors.Is, as well as
+// its category ErrClosed.
+var ErrManagementBusy = newCategoryError(ErrClosed, "management interface is busy with another client", nil)
+
+// busyMessages are the parts of the INFO or ERROR lines of the daemon
+// refusing the management client, since another one is connected,
+// in lower case
+var busyMessages = []string{
+	"only one management client",
+	"management client already connected",
+	"another management client",
+}
+
+// ManagementBusyError is the error of the connection closed by the daemon
+// right after it's established, which is the way OpenVPN refuses
+// the management client while another one is connected: either nothing is
+// received before the connection is closed, or the line which says so.
+// It's returned by Dial and by the commands, and is the error of FatalEvent.
+type ManagementBusyError struct {
+	// Line is the line of the daemon refusing the client, empty if
+	// nothing is received
+	Line string
+	// Err is the error of the connection, usually io.EOF, nil if
+	// the connection isn't closed yet
+	Err error
+}
+
+func (e *ManagementBusyError) Error() string {
+	msg := ErrManagementBusy.Error()
+	if e.Line != "" {
+		msg += fmt.Sprintf(": %q", e.Line)
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *ManagementBusyError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is ErrManagementBusy or its category ErrClosed.
+func (e *ManagementBusyError) Is(target error) bool {
+	return target == ErrManagementBusy || errors.Is(ErrManagementBusy, target)
+}
+
+// isBusyMessage reports whether the line is the one of the daemon refusing
+// the client, since another one is connected
+func isBusyMessage(line string) bool {
+	line = strings.ToLower(line)
+	if !strings.HasPrefix(line, ">info:") && !strings.HasPrefix(line, ">fatal:") && !strings.HasPrefix(line, "error:") {
+		return false
+	}
+	for _, msg := range busyMessages {
+		if strings.Contains(line, msg) {
+			return true
+		}
+	}
+	return false
+}
+
+// busyError returns ManagementBusyError if the connection is closed
+// with err right after it's established: nothing is received, or only
+// the busy message, which is busyLine. Otherwise it returns err.
+func busyError(err error, linesRead uint64, busyLine string) error {
+	if err != io.EOF {
+		return err
+	}
+	if linesRead == 0 || busyLine != "" {
+		return &ManagementBusyError{Line: busyLine, Err: err}
+	}
+	return err
+}
+
+// isGreeting reports whether the first line received is of the OpenVPN
+// management interface: the greeting or the password prompt, which
+// precedes it
+func isGreeting(line string) bool {
+	return strings.HasPrefix(line, managementGreeting) || line == managementPasswordPrompt
+}
+
+// checkHandshake waits for the first line up to the timeout, and aborts
+// the client unless it's the greeting. The result is reported by
+// awaitHandshake.
+func (c *MgmtClient) checkHandshake(timeout time.Duration) {
+	defer c.generatorsWG.Done()
+	defer close(c.handshakeDone)
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case line := <-c.firstLine:
+		c.handshakeErr = handshakeError(line)
+	case <-timer.C:
+		c.handshakeErr = &NotOpenVPNError{Err: newCategoryError(ErrTimeout, fmt.Sprintf("nothing received in %s", timeout), nil)}
+	case <-c.ctx.Done():
+		if err := c.terminalErr(); errors.Is(err, ErrManagementBusy) {
+			// the daemon has closed the connection right away
+			c.handshakeErr = err
+			return
+		}
+		select {
+		case line := <-c.firstLine:
+			// the daemon has closed the connection right after the line
+			c.handshakeErr = handshakeError(line)
+			return
+		default:
+		}
+		err := c.terminatedError()
+		if err == nil {
+			err = ErrClientClosed
+		}
+		c.handshakeErr = &NotOpenVPNError{Err: err}
+		return
+	}
+	if c.handshakeErr != nil {
+		logErrorf("Handshake: %s", c.handshakeErr)
+		c.abort(c.handshakeErr)
+	}
+}
+
+// handshakeError returns the error of the first line received, nil if
+// it's the greeting
+func handshakeError(line string) error {
+	switch {
+	case isGreeting(line):
+		return nil
+	case isBusyMessage(line):
+		return &ManagementBusyError{Line: line}
+	}
+	return &NotOpenVPNError{FirstLine: line}
+}
+
+// awaitHandshake waits for the result of the check of WithHandshakeCheck,
+// or for the context to be done; it returns nil if the check is disabled
+func (c *MgmtClient) awaitHandshake(ctx context.Context) error {
+	if c.handshakeDone == nil {
+		return nil
+	}
+	select {
+	case <-c.handshakeDone:
+		return c.handshakeErr
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,266 @@
+package ovmgmt
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestHandshake(t *testing.T) {
+	defer checkGoroutineLeaks(t)()
+
+	type TestCase struct {
+		// written by the server once the client connects, nil for silence
+		Greeting  []string
+		FirstLine string
+		Timeout   bool
+	}
+
+	testCases := []TestCase{
+		{[]string{testGreeting + "\n", ">HOLD:Waiting for hold release\n"}, "", false},
+		{[]string{testGreeting + "\r\n"}, "", false},
+		{[]string{managementPasswordPrompt}, "", false},
+		{
+			[]string{"HTTP/1.1 400 Bad Request\r\n", "Content-Type: text/plain\r\n", "\r\n"},
+			"HTTP/1.1 400 Bad Request",
+			false,
+		},
+		{[]string{"SSH-2.0-OpenSSH_8.2p1\r\n"}, "SSH-2.0-OpenSSH_8.2p1", false},
+		// the greeting isn't the first line
+		{[]string{">HOLD:Waiting for hold release\n", testGreeting + "\n"}, ">HOLD:Waiting for hold release", false},
+		{nil, "", true},
+	}
+
+	for i, tc := range testCases {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		go func(greeting []string) {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			for _, line := range greeting {
+				io.WriteString(conn, line)
+			}
+			// until the client goes away
+			io.Copy(ioutil.Discard, conn)
+		}(tc.Greeting)
+
+		eventCh := make(chan Event, 10)
+		start := time.Now()
+		c, err := DialWithOptions(context.Background(), l.Addr().String(), eventCh, WithHandshakeCheck(100*time.Millisecond))
+		l.Close()
+		if tc.FirstLine == "" && !tc.Timeout {
+			if err != nil {
+				t.Errorf("test %d Dial returned %v", i, err)
+				continue
+			}
+			c.Close()
+			continue
+		}
+
+		if c != nil {
+			c.Close()
+			t.Errorf("test %d Dial returned the client", i)
+		}
+		var notOpenVPN *NotOpenVPNError
+		if !errors.Is(err, ErrNotOpenVPN) || !errors.As(err, &notOpenVPN) {
+			t.Errorf("test %d Dial returned %v; want ErrNotOpenVPN", i, err)
+			continue
+		}
+		if notOpenVPN.FirstLine != tc.FirstLine {
+			t.Errorf("test %d got first line %q; want %q", i, notOpenVPN.FirstLine, tc.FirstLine)
+		}
+		if got := errors.Is(err, ErrTimeout); got != tc.Timeout {
+			t.Errorf("test %d error %v matches ErrTimeout %v; want %v", i, err, got, tc.Timeout)
+		}
+		if tc.Timeout && time.Since(start) < 100*time.Millisecond {
+			t.Errorf("test %d Dial returned after %s; want the timeout", i, time.Since(start))
+		}
+	}
+}
+
+func TestHandshakeDisabled(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go servePid(l)
+
+	// the greeting is checked by default, but the client doesn't wait
+	// for it without the check
+	c, err := DialWithOptions(context.Background(), l.Addr().String(), make(chan Event, 10), WithHandshakeCheck(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if c.handshakeDone != nil {
+		t.Errorf("the handshake is checked")
+	}
+	if pid, err := c.Pid(); err != nil || pid != 42 {
+		t.Errorf("Pid returned %d, %v; want 42", pid, err)
+	}
+}
+
+func TestHandshakeContext(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		// silent
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		io.Copy(ioutil.Discard, conn)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if c, err := DialContext(ctx, l.Addr().String(), make(chan Event, 10)); !errors.Is(err, context.DeadlineExceeded) {
+		if c != nil {
+			c.Close()
+		}
+		t.Errorf("DialContext returned %v; want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestHandshakeClient(t *testing.T) {
+	defer checkGoroutineLeaks(t)()
+
+	// the client of the connection which is not the management interface
+	// terminates with the error
+	daemonConn, clientConn := net.Pipe()
+	go func() {
+		io.WriteString(daemonConn, "HTTP/1.1 400 Bad Request\r\n\r\n")
+		io.Copy(ioutil.Discard, daemonConn)
+	}()
+	eventCh := make(chan Event, 10)
+	c := NewMgmtClientWithOptions(clientConn, eventCh, WithHandshakeCheck(time.Second))
+	var events []Event
+	for evt := range eventCh {
+		events = append(events, evt)
+	}
+	fatal, ok := events[len(events)-1].(FatalEvent)
+	if !ok || !errors.Is(fatal.Err(), ErrNotOpenVPN) {
+		t.Errorf("got events %v; want FatalEvent of ErrNotOpenVPN", events)
+	}
+	if err := c.Err(); !errors.Is(err, ErrNotOpenVPN) {
+		t.Errorf("Err returned %v; want ErrNotOpenVPN", err)
+	}
+	c.Close()
+	daemonConn.Close()
+}
+
+func TestManagementBusy(t *testing.T) {
+	defer checkGoroutineLeaks(t)()
+
+	type TestCase struct {
+		// written by the server once the client connects
+		Lines []string
+		// the connection is closed after the lines
+		Close bool
+		Line  string
+	}
+
+	busyInfo := ">INFO:Management interface: only one management client allowed"
+	busyErr := "ERROR: another management client is already connected"
+	testCases := []TestCase{
+		// closed right away
+		{nil, true, ""},
+		{[]string{busyInfo}, true, busyInfo},
+		{[]string{busyErr}, true, busyErr},
+		// the client is refused before the connection is closed
+		{[]string{busyErr}, false, busyErr},
+	}
+
+	for i, tc := range testCases {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		go func(tc TestCase) {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			for _, line := range tc.Lines {
+				io.WriteString(conn, line+"\n")
+			}
+			if !tc.Close {
+				io.Copy(ioutil.Discard, conn)
+			}
+		}(tc)
+
+		c, err := DialWithOptions(context.Background(), l.Addr().String(), make(chan Event, 10), WithHandshakeCheck(time.Second))
+		l.Close()
+		if c != nil {
+			c.Close()
+			t.Errorf("test %d Dial returned the client", i)
+		}
+		var busy *ManagementBusyError
+		if !errors.Is(err, ErrManagementBusy) || !errors.Is(err, ErrClosed) || !errors.As(err, &busy) {
+			t.Errorf("test %d Dial returned %v; want ErrManagementBusy", i, err)
+			continue
+		}
+		if busy.Line != tc.Line {
+			t.Errorf("test %d got line %q; want %q", i, busy.Line, tc.Line)
+		}
+		if errors.Is(err, ErrNotOpenVPN) {
+			t.Errorf("test %d error %v matches ErrNotOpenVPN", i, err)
+		}
+	}
+}
+
+func TestManagementBusyCommand(t *testing.T) {
+	defer checkGoroutineLeaks(t)()
+
+	type TestCase struct {
+		Lines []string
+		Busy  bool
+	}
+
+	testCases := []TestCase{
+		{nil, true},
+		{[]string{">INFO:only one management client allowed"}, true},
+		// the daemon has gone after the greeting
+		{[]string{testGreeting}, false},
+	}
+
+	for i, tc := range testCases {
+		daemonConn, clientConn := net.Pipe()
+		go func(lines []string) {
+			for _, line := range lines {
+				io.WriteString(daemonConn, line+"\n")
+			}
+			daemonConn.Close()
+		}(tc.Lines)
+		eventCh := make(chan Event, 10)
+		c := NewMgmtClient(clientConn, eventCh)
+		var fatal FatalEvent
+		for evt := range eventCh {
+			fatal, _ = evt.(FatalEvent)
+		}
+
+		_, err := c.Pid()
+		if got := errors.Is(err, ErrManagementBusy); got != tc.Busy || !errors.Is(err, io.EOF) {
+			t.Errorf("test %d Pid returned %v, which matches ErrManagementBusy %v; want %v", i, err, got, tc.Busy)
+		}
+		if got := errors.Is(fatal.Err(), ErrManagementBusy); got != tc.Busy {
+			t.Errorf("test %d got %s, which matches ErrManagementBusy %v; want %v", i, fatal, got, tc.Busy)
+		}
+		c.Close()
+	}
+}
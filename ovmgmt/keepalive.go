@@ -0,0 +1,118 @@
+package ovmgmt
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// ErrKeepaliveTimeout is the error of FatalEvent emitted by the client
+// created with WithKeepalive, when the daemon doesn't reply in time.
+var ErrKeepaliveTimeout = newCategoryError(ErrTimeout, "keepalive timed out", nil)
+
+// touchLine records that a line is received
+func (c *MgmtClient) touchLine() {
+	atomic.StoreInt64(&c.lastLineAt, time.Now().UnixNano())
+}
+
+// sinceLastLine returns the time since the last line is received
+func (c *MgmtClient) sinceLastLine() time.Duration {
+	return time.Since(time.Unix(0, atomic.LoadInt64(&c.lastLineAt)))
+}
+
+// keepalive checks the connection after the interval of inactivity,
+// until the client context is done
+func (c *MgmtClient) keepalive(interval, timeout time.Duration) {
+	defer c.generatorsWG.Done()
+
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+		case <-c.ctx.Done():
+			return
+		}
+		if idle := c.sinceLastLine(); idle < interval {
+			timer.Reset(interval - idle)
+			continue
+		}
+
+		if !c.checkAlive(timeout) {
+			return
+		}
+		timer.Reset(interval)
+	}
+}
+
+// checkAlive issues the keepalive command, the client is Degraded while
+// it isn't replied within the half of the timeout, and is aborted after
+// the timeout. It returns false then.
+func (c *MgmtClient) checkAlive(timeout time.Duration) bool {
+	ctx, cancel := context.WithTimeout(c.ctx, timeout)
+	defer cancel()
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := c.simpleCommandContext(ctx, "pid")
+		errCh <- err
+	}()
+
+	degraded := time.NewTimer(timeout / 2)
+	defer degraded.Stop()
+	var err error
+	select {
+	case err = <-errCh:
+	case <-degraded.C:
+		c.states.set(ClientStateDegraded)
+		err = <-errCh
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		logErrorf("Keepalive: no reply in %s", timeout)
+		c.abort(ErrKeepaliveTimeout)
+		return false
+	}
+	if err == nil {
+		c.states.set(ClientStateReady)
+	}
+	return true
+}
+
+// simpleCommandContext is simpleCommand which can be canceled with
+// the context, as LatestStatus3Context. The write is canceled as well,
+// it may block on a dead connection.
+func (c *MgmtClient) simpleCommandContext(ctx context.Context, cmd string) (string, error) {
+	start := time.Now()
+	result, err := c.issueSimpleCommandContext(ctx, cmd)
+	err = commandError(cmd, err)
+	c.commandDone(cmd, err, start)
+	return result, err
+}
+
+func (c *MgmtClient) issueSimpleCommandContext(ctx context.Context, cmd string) (string, error) {
+	if err := c.acquireCommand(ctx); err != nil {
+		return "", err
+	}
+
+	type reply struct {
+		result string
+		err    error
+	}
+	replyCh := make(chan reply, 1)
+	go func() {
+		defer c.releaseCommand()
+		if err := c.sendCommand(cmd); err != nil {
+			replyCh <- reply{"", err}
+			return
+		}
+		result, err := c.readCommandResult()
+		replyCh <- reply{result, err}
+	}()
+
+	select {
+	case r := <-replyCh:
+		return r.result, r.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
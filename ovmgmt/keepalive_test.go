@@ -0,0 +1,122 @@
+package ovmgmt
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestKeepalive(t *testing.T) {
+	defer checkGoroutineLeaks(t)()
+
+	type TestCase struct {
+		Name string
+		// Reply of the daemon to pid, nil means it stops responding
+		Reply []string
+		// interval of LOG lines sent by the daemon, zero means none
+		LogInterval time.Duration
+		WantDead    bool
+		WantPids    bool
+	}
+	testCases := []TestCase{
+		{"responsive", []string{"SUCCESS: pid=42"}, 0, false, true},
+		{"not responding", nil, 0, true, true},
+		{"busy", nil, 5 * time.Millisecond, false, false},
+	}
+
+	const interval = 30 * time.Millisecond
+	const timeout = 50 * time.Millisecond
+	for _, tc := range testCases {
+		tc := tc
+		daemonConn, clientConn := net.Pipe()
+		var pids int32
+		go fakeDaemon(daemonConn, func(cmd string) []string {
+			if cmd == "pid" {
+				atomic.AddInt32(&pids, 1)
+			}
+			return tc.Reply
+		})
+		stopLog := make(chan struct{})
+		if tc.LogInterval > 0 {
+			go func() {
+				ticker := time.NewTicker(tc.LogInterval)
+				defer ticker.Stop()
+				for {
+					select {
+					case <-ticker.C:
+						io.WriteString(daemonConn, ">LOG:1584536294,I,msg\n")
+					case <-stopLog:
+						return
+					}
+				}
+			}()
+		}
+
+		eventCh := make(chan Event, 100)
+		start := time.Now()
+		c := NewMgmtClientWithOptions(clientConn, eventCh, WithKeepalive(interval, timeout))
+
+		var fatal Event
+		select {
+		case <-c.Done():
+			for evt := range eventCh {
+				fatal = evt
+			}
+		case <-time.After(10 * interval):
+		}
+		close(stopLog)
+		elapsed := time.Since(start)
+
+		if dead := fatal != nil; dead != tc.WantDead {
+			t.Errorf("%s: client terminated %v; want %v", tc.Name, dead, tc.WantDead)
+		}
+		if tc.WantDead {
+			if f, ok := fatal.(FatalEvent); !ok || f.Err() != ErrKeepaliveTimeout {
+				t.Errorf("%s: got %#v; want FatalEvent of %v", tc.Name, fatal, ErrKeepaliveTimeout)
+			}
+			if c.Err() != ErrKeepaliveTimeout {
+				t.Errorf("%s: Err returned %v; want %v", tc.Name, c.Err(), ErrKeepaliveTimeout)
+			}
+			if max := interval + timeout + 100*time.Millisecond; elapsed > max {
+				t.Errorf("%s: detected after %s; want within %s", tc.Name, elapsed, max)
+			}
+			if _, err := c.Pid(); err == nil {
+				t.Errorf("%s: Pid of dead client returned no error", tc.Name)
+			}
+		}
+		if got := atomic.LoadInt32(&pids) > 0; got != tc.WantPids {
+			t.Errorf("%s: keepalive sent %v; want %v", tc.Name, got, tc.WantPids)
+		}
+
+		c.Close()
+		daemonConn.Close()
+		for range eventCh {
+		}
+	}
+}
+
+func TestKeepaliveNotCloser(t *testing.T) {
+	r, w := io.Pipe()
+	defer w.Close()
+
+	eventCh := make(chan Event, 10)
+	c := NewMgmtClientWithOptions(mockConn{r, ioutil.Discard}, eventCh, WithKeepalive(10*time.Millisecond, 10*time.Millisecond))
+	var events []Event
+	for evt := range eventCh {
+		events = append(events, evt)
+	}
+	if len(events) != 1 {
+		t.Fatalf("got %d events; want 1: %v", len(events), events)
+	}
+	want := fmt.Sprintf("FATAL: Error reading from OpenVPN: %s", ErrKeepaliveTimeout)
+	if got := events[0].String(); got != want {
+		t.Errorf("got %q; want %q", got, want)
+	}
+	if c.Err() != ErrKeepaliveTimeout {
+		t.Errorf("Err returned %v; want %v", c.Err(), ErrKeepaliveTimeout)
+	}
+}
@@ -0,0 +1,157 @@
+package ovmgmt
+
+import (
+	"bytes"
+	"io"
+)
+
+// DefaultMaxLineSize is the default limit of the size of a line read from
+// OpenVPN, see WithMaxLineSize.
+const DefaultMaxLineSize = 1 << 20
+
+const lineReaderBufferSize = 4096
+
+// the reader fails after this many reads returning no data and no error,
+// as bufio.Reader does
+const maxConsecutiveEmptyReads = 100
+
+// prompts of the daemon, which aren't terminated with the line ending
+var knownPrompts = []string{managementPasswordPrompt}
+
+type lineKind int
+
+const (
+	lineComplete lineKind = iota
+	// the line longer than the limit, truncated to it
+	lineTruncated
+	// the prompt, which isn't terminated
+	linePrompt
+)
+
+// lineReader reads the lines as bufio.ScanLines splits them, but the lines
+// longer than maxSize are truncated to it instead of failing the reading,
+// and the known prompts are returned once they are read, without waiting
+// for the line ending, which never comes
+type lineReader struct {
+	r io.Reader
+	// zero or negative disables the limit
+	maxSize int
+	// the data read is buf[start:end], start is at the beginning of a line
+	buf        []byte
+	start, end int
+	// the prefix of the line which exceeds the limit
+	prefix []byte
+	// the read error, returned once the data read is consumed
+	err error
+}
+
+func newLineReader(r io.Reader, maxSize int) *lineReader {
+	return &lineReader{r: r, maxSize: maxSize, buf: make([]byte, lineReaderBufferSize)}
+}
+
+// next returns the line without the line ending, which is valid up to
+// the next call, the size of the line with the ending and the kind of
+// the line. err is the read error, io.EOF at the end.
+func (lr *lineReader) next() (line []byte, size int, kind lineKind, err error) {
+	// the rest of the line which exceeds the limit is discarded
+	discarding := false
+	for {
+		data := lr.buf[lr.start:lr.end]
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			lr.start += i + 1
+			size += i + 1
+			if discarding {
+				return lr.prefix, size, lineTruncated, nil
+			}
+			line, kind = lr.limit(dropLineEnding(data[:i+1]))
+			return line, size, kind, nil
+		}
+
+		if lr.err != nil {
+			// the last line isn't terminated
+			lr.start = lr.end
+			size += len(data)
+			if discarding {
+				return lr.prefix, size, lineTruncated, nil
+			}
+			if len(data) == 0 {
+				return nil, 0, lineComplete, lr.err
+			}
+			line, kind = lr.limit(dropLineEnding(data))
+			return line, size, kind, nil
+		}
+
+		if !discarding && isPrompt(data) {
+			// the read would block, the daemon waits for the reply
+			lr.start = lr.end
+			return data, len(data), linePrompt, nil
+		}
+		if !discarding && lr.maxSize > 0 && len(data) >= lr.maxSize+2 {
+			// the line exceeds the limit even with the line ending
+			lr.prefix = append(lr.prefix[:0], data[:lr.maxSize]...)
+			discarding = true
+		}
+		if discarding {
+			size += len(data)
+			lr.start = lr.end
+		}
+		lr.fill()
+	}
+}
+
+// limit truncates the line to the limit
+func (lr *lineReader) limit(line []byte) ([]byte, lineKind) {
+	if lr.maxSize > 0 && len(line) > lr.maxSize {
+		return line[:lr.maxSize], lineTruncated
+	}
+	return line, lineComplete
+}
+
+// fill reads more data, the buffer is grown when it's full
+func (lr *lineReader) fill() {
+	if lr.start > 0 {
+		copy(lr.buf, lr.buf[lr.start:lr.end])
+		lr.end -= lr.start
+		lr.start = 0
+	}
+	if lr.end == len(lr.buf) {
+		buf := make([]byte, 2*len(lr.buf))
+		copy(buf, lr.buf[:lr.end])
+		lr.buf = buf
+	}
+
+	for i := 0; i < maxConsecutiveEmptyReads; i++ {
+		n, err := lr.r.Read(lr.buf[lr.end:])
+		lr.end += n
+		if err != nil {
+			lr.err = err
+			return
+		}
+		if n > 0 {
+			return
+		}
+	}
+	lr.err = io.ErrNoProgress
+}
+
+// isPrompt reports whether the data is one of the known prompts
+func isPrompt(data []byte) bool {
+	for _, prompt := range knownPrompts {
+		if string(data) == prompt {
+			return true
+		}
+	}
+	return false
+}
+
+// dropLineEnding drops the trailing "\n" or "\r\n" of the line,
+// as bufio.ScanLines does
+func dropLineEnding(line []byte) []byte {
+	if len(line) > 0 && line[len(line)-1] == '\n' {
+		line = line[:len(line)-1]
+	}
+	if len(line) > 0 && line[len(line)-1] == '\r' {
+		line = line[:len(line)-1]
+	}
+	return line
+}
@@ -0,0 +1,209 @@
+package ovmgmt
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type readLine struct {
+	Line string
+	Size int
+	Kind lineKind
+}
+
+func (l readLine) String() string {
+	return fmt.Sprintf("%.20q (%d bytes, kind %d)", l.Line, l.Size, l.Kind)
+}
+
+func readLines(r io.Reader, maxSize int) ([]readLine, error) {
+	lr := newLineReader(r, maxSize)
+	var lines []readLine
+	for {
+		line, size, kind, err := lr.next()
+		if err != nil {
+			return lines, err
+		}
+		lines = append(lines, readLine{string(line), size, kind})
+	}
+}
+
+func TestLineReader(t *testing.T) {
+	long := strings.Repeat("x", 5000)
+
+	type TestCase struct {
+		Input     string
+		MaxSize   int
+		WantLines []readLine
+	}
+	testCases := []TestCase{
+		{"", 10, nil},
+		{"a\nbc\r\n\n\rd\r", 10, []readLine{{"a", 2, lineComplete}, {"bc", 4, lineComplete}, {"", 1, lineComplete}, {"\rd", 3, lineComplete}}},
+		{"abcd\nabc\r\nabcde", 3, []readLine{{"abc", 5, lineTruncated}, {"abc", 5, lineComplete}, {"abc", 5, lineTruncated}}},
+		{long + "\n" + "a\n", 0, []readLine{{long, 5001, lineComplete}, {"a", 2, lineComplete}}},
+		{long + "\r\n" + "a\n", 5000, []readLine{{long, 5002, lineComplete}, {"a", 2, lineComplete}}},
+		{long + "\r\n" + "a\n", 4999, []readLine{{long[:4999], 5002, lineTruncated}, {"a", 2, lineComplete}}},
+		{long + "\n" + "a\n", 4500, []readLine{{long[:4500], 5001, lineTruncated}, {"a", 2, lineComplete}}},
+		{long + "\n" + "a\n", 100, []readLine{{long[:100], 5001, lineTruncated}, {"a", 2, lineComplete}}},
+		{long + long, 6000, []readLine{{long + long[:1000], 10000, lineTruncated}}},
+	}
+
+	for i, tc := range testCases {
+		lines, err := readLines(strings.NewReader(tc.Input), tc.MaxSize)
+		if err != io.EOF {
+			t.Errorf("test %d returned error %v; want %v", i, err, io.EOF)
+		}
+		if !reflect.DeepEqual(lines, tc.WantLines) {
+			t.Errorf("test %d got %d lines\n%s\nwant %d lines\n%s", i, len(lines), lines, len(tc.WantLines), tc.WantLines)
+		}
+		if tc.MaxSize > 0 {
+			continue
+		}
+
+		// the same lines as of bufio.ScanLines
+		var want []string
+		scanner := bufio.NewScanner(strings.NewReader(tc.Input))
+		for scanner.Scan() {
+			want = append(want, scanner.Text())
+		}
+		var got []string
+		for _, line := range lines {
+			got = append(got, line.Line)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("test %d got lines %.200q; want %.200q as of bufio.Scanner", i, got, want)
+		}
+	}
+}
+
+// chunkReader returns the chunks by the reads, as if they were received
+// by the network reads, then EOF
+type chunkReader struct {
+	chunks []string
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	if len(r.chunks) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, r.chunks[0])
+	if r.chunks[0] = r.chunks[0][n:]; r.chunks[0] == "" {
+		r.chunks = r.chunks[1:]
+	}
+	return n, nil
+}
+
+func TestLineReaderPrompt(t *testing.T) {
+	type TestCase struct {
+		Chunks    []string
+		WantLines []readLine
+	}
+	prompt := readLine{"ENTER PASSWORD:", 15, linePrompt}
+	testCases := []TestCase{
+		{[]string{"ENTER PASSWORD:"}, []readLine{prompt}},
+		// split reads
+		{[]string{"ENTER PASS", "WORD:", "SUCCESS: password is correct\n>INFO:OpenVPN\n"}, []readLine{
+			prompt,
+			{"SUCCESS: password is correct", 29, lineComplete},
+			{">INFO:OpenVPN", 14, lineComplete},
+		}},
+		{[]string{"ERROR: bad password\r\nENTER PASSWORD:", "ENTER PASSWORD:"}, []readLine{
+			{"ERROR: bad password", 21, lineComplete},
+			prompt,
+			prompt,
+		}},
+		{[]string{"SUCC", "ESS: a\nENTER", " PASSWORD:", "SUCCESS: b\n"}, []readLine{
+			{"SUCCESS: a", 11, lineComplete},
+			prompt,
+			{"SUCCESS: b", 11, lineComplete},
+		}},
+		// not prompts
+		{[]string{"ENTER PASSWORD: or not\n"}, []readLine{{"ENTER PASSWORD: or not", 23, lineComplete}}},
+		{[]string{"ENTER PASSWORD:\n"}, []readLine{{"ENTER PASSWORD:", 16, lineComplete}}},
+		{[]string{"ENTER PASSWORD"}, []readLine{{"ENTER PASSWORD", 14, lineComplete}}},
+		{[]string{">ENTER PASSWORD:", "\n"}, []readLine{{">ENTER PASSWORD:", 17, lineComplete}}},
+	}
+
+	for i, tc := range testCases {
+		lines, err := readLines(&chunkReader{append([]string{}, tc.Chunks...)}, 100)
+		if err != io.EOF {
+			t.Errorf("test %d returned error %v; want %v", i, err, io.EOF)
+		}
+		if !reflect.DeepEqual(lines, tc.WantLines) {
+			t.Errorf("test %d got lines\n%s\nwant\n%s", i, lines, tc.WantLines)
+		}
+	}
+}
+
+func TestLineReaderError(t *testing.T) {
+	readErr := errors.New("connection reset by peer")
+	r := io.MultiReader(strings.NewReader("a\nb"), failingReader{readErr})
+	lines, err := readLines(r, 10)
+	if want := []readLine{{"a", 2, lineComplete}, {"b", 1, lineComplete}}; !reflect.DeepEqual(lines, want) {
+		t.Errorf("got lines %s; want %s", lines, want)
+	}
+	if err != readErr {
+		t.Errorf("returned error %v; want %v", err, readErr)
+	}
+}
+
+func TestMaxLineSize(t *testing.T) {
+	defer checkGoroutineLeaks(t)()
+
+	huge := strings.Repeat("x", 2<<20)
+	daemonConn, clientConn := net.Pipe()
+	go fakeDaemon(daemonConn, func(cmd string) []string {
+		switch cmd {
+		case "huge":
+			return []string{"SUCCESS: " + huge}
+		case "pid":
+			return []string{"SUCCESS: pid=42"}
+		}
+		return nil
+	})
+	eventCh := make(chan Event, 10)
+	c := NewMgmtClient(clientConn, eventCh)
+	defer func() {
+		c.Close()
+		daemonConn.Close()
+		for range eventCh {
+		}
+	}()
+
+	checkTruncated := func(evt Event, prefix string, wantLen int) {
+		t.Helper()
+		m, ok := evt.(MalformedEvent)
+		if !ok || !m.Truncated() {
+			t.Fatalf("got %.200s; want truncated MalformedEvent", evt)
+		}
+		if len(m.Raw()) != wantLen || !strings.HasPrefix(m.Raw(), prefix) {
+			t.Errorf("got truncated line of %d bytes %.50q; want %d bytes %q...", len(m.Raw()), m.Raw(), wantLen, prefix)
+		}
+	}
+
+	// the event stream continues
+	go fmt.Fprintf(daemonConn, ">LOG:1584536294,I,%s\n>LOG:1584536294,I,after\n", huge)
+	// without the leading '>'
+	checkTruncated(nextEventOf(t, eventCh), "LOG:1584536294,I,x", DefaultMaxLineSize-1)
+	if log, ok := nextEventOf(t, eventCh).(LogEvent); !ok || log.Message() != "after" {
+		t.Errorf("got %s; want LOG after the huge line", log)
+	}
+
+	// so does the command flow
+	result, err := c.simpleCommand("huge")
+	if err != nil || len(result) != DefaultMaxLineSize-len(successPrefix) {
+		t.Errorf("huge command returned %d bytes, %v; want %d bytes", len(result), err, DefaultMaxLineSize-len(successPrefix))
+	}
+	checkTruncated(nextEventOf(t, eventCh), "SUCCESS: x", DefaultMaxLineSize)
+	if pid, err := c.Pid(); err != nil || pid != 42 {
+		t.Errorf("Pid after the huge reply returned %d, %v; want 42", pid, err)
+	}
+	if stats := c.Stats(); stats.MalformedEvents != 2 || stats.BytesRead < 2*uint64(len(huge)) {
+		t.Errorf("Stats returned %+v", stats)
+	}
+}
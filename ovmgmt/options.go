@@ -0,0 +1,385 @@
+package ovmgmt
+
+import (
+	"io"
+	"time"
+)
+
+// Default limits of a single multi-line event, see WithMaxEventSize.
+const (
+	DefaultMaxEventLines = 4096
+	DefaultMaxEventBytes = 1 << 20
+)
+
+// DefaultRawChannelBuffer is the default number of lines buffered between
+// the reader and the processing of replies and events, see
+// WithRawChannelBuffers.
+const DefaultRawChannelBuffer = 64
+
+// Option configures MgmtClient, see NewMgmtClientWithOptions.
+type Option func(*clientOptions)
+
+type clientOptions struct {
+	multilineTimeout time.Duration
+	maxEventLines    int
+	maxEventBytes    int
+	strictParsing    bool
+	rawLineHistory   int
+	messagePrealloc  int
+	maxLineSize      int
+	// buffers of the internal channels of the demultiplexer
+	rawReplyBuffer   int
+	rawEventBuffer   int
+	statusDiffEvents bool
+	status3Ch        chan<- *Status3Event
+	// the connection is closed when the client context is done
+	ownConn bool
+
+	keepaliveInterval time.Duration
+	keepaliveTimeout  time.Duration
+	readStallTimeout  time.Duration
+	handshakeTimeout  time.Duration
+	backpressure      BackpressurePolicy
+	commandHook       func(cmd string, err error, took time.Duration)
+	protocolTap       io.Writer
+	protocolTapUnsafe bool
+	commandRate       float64
+	commandBurst      int
+	tag               string
+
+	clockSkewDetection bool
+	clockSkewThreshold time.Duration
+
+	parse parseOptions
+}
+
+// parseOptions are the options of parsing events and status output, which
+// the events keep to apply in their accessors; nil means the defaults
+type parseOptions struct {
+	normalizeUndef    bool
+	sanitizeAccessors bool
+	statusLocation    *time.Location
+	redactedEnvKeySet map[string]bool
+}
+
+func defaultClientOptions() clientOptions {
+	return clientOptions{
+		multilineTimeout: DefaultMultilineEventTimeout,
+		maxEventLines:    DefaultMaxEventLines,
+		maxEventBytes:    DefaultMaxEventBytes,
+		messagePrealloc:  DefaultMessagePrealloc,
+		maxLineSize:      DefaultMaxLineSize,
+		rawReplyBuffer:   DefaultRawChannelBuffer,
+		rawEventBuffer:   DefaultRawChannelBuffer,
+	}
+}
+
+// WithMultilineEventTimeout sets the initial multi-line event timeout,
+// see MgmtClient.SetMultilineEventTimeout.
+func WithMultilineEventTimeout(timeout time.Duration) Option {
+	return func(o *clientOptions) {
+		o.multilineTimeout = timeout
+	}
+}
+
+// WithMaxEventSize limits the number of lines and the total size of bodies
+// of a single multi-line event. When the limit is exceeded, the lines
+// received so far are emitted as InvalidEvent with ErrEventTooLarge and
+// the rest of the event is dropped up to its end marker.
+//
+// Zero or negative value disables the corresponding limit. The defaults
+// are DefaultMaxEventLines and DefaultMaxEventBytes.
+func WithMaxEventSize(lines, bytes int) Option {
+	return func(o *clientOptions) {
+		o.maxEventLines = lines
+		o.maxEventBytes = bytes
+	}
+}
+
+// WithMaxLineSize limits the size of a line read from the daemon, without
+// the line ending. Longer lines, either events or replies, are truncated to
+// the size and emitted as MalformedEvent, which Truncated method returns
+// true, and the reading goes on. The truncated reply is processed as well,
+// so the command gets the complete reply, which may fail to parse.
+//
+// Zero or negative size disables the limit. The default is
+// DefaultMaxLineSize.
+func WithMaxLineSize(size int) Option {
+	return func(o *clientOptions) {
+		o.maxLineSize = size
+	}
+}
+
+// WithStrictParsing makes the client fail hard on malformed data instead of
+// the best-effort processing. Any event which would be emitted as
+// InvalidEvent or MalformedEvent makes the client terminate instead: it emits
+// FatalEvent, which Err is the failure, and closes the event channel. Also
+// LatestState and LatestStatus3 return an error without partially parsed
+// result.
+func WithStrictParsing() Option {
+	return func(o *clientOptions) {
+		o.strictParsing = true
+	}
+}
+
+// WithRawLineHistory makes the client keep the last n raw lines received
+// from OpenVPN, both replies and events, for diagnostics. The lines are
+// available via MgmtClient.RecentRawLines and are attached to the String()
+// output of FATAL events and MalformedEvent. Too long lines are kept
+// truncated. Secrets are redacted: the values of the env variables of
+// WithRedactedEnvKeys, challenge responses and session tokens. It's off
+// by default.
+func WithRawLineHistory(n int) Option {
+	return func(o *clientOptions) {
+		o.rawLineHistory = n
+	}
+}
+
+// WithMessagePrealloc sets the number of lines preallocated for each
+// multi-line reply and event, e.g. to match the size of 'status 3' of
+// the big server. Zero or negative value disables the preallocation.
+// The default is DefaultMessagePrealloc.
+func WithMessagePrealloc(lines int) Option {
+	return func(o *clientOptions) {
+		o.messagePrealloc = lines
+		if lines < 0 {
+			o.messagePrealloc = 0
+		}
+	}
+}
+
+// WithRawChannelBuffers sets the number of raw lines buffered between
+// the connection reader and the processing of command replies and of
+// events respectively, so that the reader isn't handed off to the other
+// goroutine on each line, which dominates under LOG floods.
+//
+// The event lines are buffered before they are parsed and delivered to
+// eventCh, so the daemon gets ahead of the slow consumer by up to
+// the buffer of eventCh plus the one of events, before the backpressure
+// policy applies, see WithBackpressure. With BackpressureBlock, replies
+// are blocked only once both are full. Zero disables the buffering.
+// The default is DefaultRawChannelBuffer for both.
+func WithRawChannelBuffers(replies, events int) Option {
+	return func(o *clientOptions) {
+		o.rawReplyBuffer = replies
+		o.rawEventBuffer = events
+		if replies < 0 {
+			o.rawReplyBuffer = 0
+		}
+		if events < 0 {
+			o.rawEventBuffer = 0
+		}
+	}
+}
+
+// WithClockSkewDetection makes the client estimate the skew between
+// the daemon clock and the local one, see MgmtClient.ClockSkew and
+// ClockSkewEstimator. When the estimated skew exceeds the threshold in
+// either direction, ClockSkewEvent is emitted; it's emitted again only
+// after the skew gets back within the threshold. Zero threshold disables
+// the events.
+func WithClockSkewDetection(threshold time.Duration) Option {
+	return func(o *clientOptions) {
+		o.clockSkewDetection = true
+		o.clockSkewThreshold = threshold
+	}
+}
+
+// WithStatusDiffEvents makes the Status3 events generator, see
+// MgmtClient.SetStatus3Events, emit StatusDeltaEvent after each Status3Event
+// when clients connected, disconnected or roamed since the previous one.
+// The first snapshot after enabling the generator yields an Initial delta
+// with all the current clients. It's useful on servers running without
+// --management-client-auth, which don't send CLIENT notifications.
+func WithStatusDiffEvents() Option {
+	return func(o *clientOptions) {
+		o.statusDiffEvents = true
+	}
+}
+
+// WithStatus3Channel makes the Status3 events generator, see
+// MgmtClient.SetStatus3Events, deliver the snapshots to ch instead of
+// the event channel, so that the big snapshots and the frequent events
+// like BYTECOUNT don't share a buffer. Failed polls are still reported
+// as InvalidEvent on the event channel, as well as StatusDeltaEvent.
+//
+// ch is closed along with the event channel when the connection is closed,
+// disabling the generator doesn't close it. The caller must constantly read
+// from ch while the generator is enabled, just like from the event channel.
+func WithStatus3Channel(ch chan<- *Status3Event) Option {
+	return func(o *clientOptions) {
+		o.status3Ch = ch
+	}
+}
+
+// WithKeepalive makes the client check the connection after the interval
+// of inactivity, when no line is received from the daemon: it issues
+// the cheap pid command, and if there is no reply within the timeout,
+// the connection is declared dead. The client terminates then, as if
+// the connection was closed: it emits FatalEvent of ErrKeepaliveTimeout,
+// closes the connection if it's an io.Closer, and the event channel.
+// While the reply is late by half of the timeout, the client state is
+// ClientStateDegraded, see MgmtClient.State.
+//
+// The check is a command, it waits for the one in flight, which is
+// counted in the timeout. Zero interval disables the keepalive, which
+// is the default; zero timeout is taken as the interval.
+func WithKeepalive(interval, timeout time.Duration) Option {
+	return func(o *clientOptions) {
+		o.keepaliveInterval = interval
+		o.keepaliveTimeout = timeout
+		if timeout <= 0 {
+			o.keepaliveTimeout = interval
+		}
+	}
+}
+
+// WithReadStallTimeout makes the client terminate when nothing is received
+// from the daemon for the timeout, which is cheaper than WithKeepalive
+// when the periodic events are enabled (e.g. bytecount every 5s): the
+// timeout is the maximum silence expected then. The client emits
+// FatalEvent of the error matching ErrReadStall with errors.Is, closes
+// the connection if it's an io.Closer, and the event channel.
+//
+// The read deadline is used if the connection supports it (e.g. net.Conn),
+// the watchdog timer otherwise. Zero disables the detection, which is
+// the default.
+func WithReadStallTimeout(timeout time.Duration) Option {
+	return func(o *clientOptions) {
+		o.readStallTimeout = timeout
+	}
+}
+
+// WithHandshakeCheck makes the client check that it's connected to
+// the OpenVPN management interface, not to some other server by mistake:
+// the first line received within the timeout must be the greeting
+// ">INFO:OpenVPN Management Interface ...", or the prompt of the management
+// interface password, see PromptEvent. Otherwise the client terminates
+// with NotOpenVPNError, which holds the first line received, if any:
+// it emits FatalEvent of the error, closes the connection if it's
+// an io.Closer, and the event channel. The daemon refusing the client,
+// since another one is connected, is reported as ManagementBusyError,
+// which is detected without the check as well.
+//
+// Dial and its variants check the handshake with DefaultHandshakeTimeout,
+// they return the error instead of the client, see DialWithOptions.
+// Zero timeout disables the check, which is the default of NewMgmtClient.
+func WithHandshakeCheck(timeout time.Duration) Option {
+	return func(o *clientOptions) {
+		o.handshakeTimeout = timeout
+	}
+}
+
+// WithCommandHook sets the function called after each command completes,
+// e.g. to keep the audit trail, with the command, its error and duration.
+// Secrets are redacted from the command: arguments of password, username
+// and cr-response. Internal commands (e.g. of WithKeepalive or status
+// polling) are passed as well.
+//
+// The hook is called from the goroutine issuing the command, once
+// the command is done, so it may issue commands itself.
+func WithCommandHook(hook func(cmd string, err error, took time.Duration)) Option {
+	return func(o *clientOptions) {
+		o.commandHook = hook
+	}
+}
+
+// WithProtocolTap makes the client write every line read from the daemon
+// and written to it to w, for debugging: each line is prefixed with
+// the timestamp and "<" for the ones read, ">" for the ones written.
+// Secrets are redacted from the commands, as of WithCommandHook, and from
+// the lines read, as of WithRawLineHistory.
+//
+// The lines are written in the background, the ones which don't fit into
+// the queue of the slow writer are dropped, see TapDroppedLines.
+func WithProtocolTap(w io.Writer) Option {
+	return func(o *clientOptions) {
+		o.protocolTap = w
+		o.protocolTapUnsafe = false
+	}
+}
+
+// WithUnsafeProtocolTap is WithProtocolTap which doesn't redact secrets.
+func WithUnsafeProtocolTap(w io.Writer) Option {
+	return func(o *clientOptions) {
+		o.protocolTap = w
+		o.protocolTapUnsafe = true
+	}
+}
+
+// WithCommandRateLimit limits the rate of commands issued by the client
+// to perSecond, allowing bursts of up to burst commands, so a buggy
+// control loop can't flood the daemon. The limit is shared by all commands,
+// including the internal ones (e.g. of SetStatus3Events). The command
+// waiting for its turn fails when the context (e.g. of LatestStatus3Context)
+// is done or the client is closed. Zero rate disables the limit, which
+// is the default.
+func WithCommandRateLimit(perSecond float64, burst int) Option {
+	return func(o *clientOptions) {
+		o.commandRate = perSecond
+		o.commandBurst = burst
+	}
+}
+
+// WithTag makes the client deliver every event tagged with the name as
+// TaggedEvent, so the consumer of the events of several clients sent to
+// one channel can tell them apart: the ones wrapped into InvalidEvent,
+// OverflowEvent and the final FatalEvent included. The channel is closed
+// as usual once the client terminates. The empty name disables tagging,
+// which is the default.
+func WithTag(name string) Option {
+	return func(o *clientOptions) {
+		o.tag = name
+	}
+}
+
+// WithNormalizeUndef makes the client map UNDEF to the empty string in
+// CommonName and Username of Status3Client and in CommonName and Username
+// accessors of ClientEvent. Raw values stay available in CommonNameRaw,
+// UsernameRaw and Env. It's off by default.
+func WithNormalizeUndef() Option {
+	return func(o *clientOptions) {
+		o.parse.normalizeUndef = true
+	}
+}
+
+// WithSanitizeAccessors makes the client sanitize values returned by
+// accessors of peer-controlled data, see Sanitize: ClientEvent Env, RawEnv
+// and Envs (and hence CommonName, Username etc), UpDownEvent RawEnv,
+// PromptEvent Prompt, EchoEvent Directive and Message of LogEvent,
+// EchoEvent and HoldEvent. It's off by default.
+func WithSanitizeAccessors() Option {
+	return func(o *clientOptions) {
+		o.parse.sanitizeAccessors = true
+	}
+}
+
+// WithStatusTimeLocation sets the time zone of the daemon, used to parse
+// human-readable Connected Since and Last Ref columns of status output
+// when the numeric (time_t) column is missing or empty, and time_ascii of
+// CLIENT env when time_unix is missing (see ClientEvent.ConnectedAt). The
+// default is time.Local.
+func WithStatusTimeLocation(loc *time.Location) Option {
+	return func(o *clientOptions) {
+		o.parse.statusLocation = loc
+	}
+}
+
+// WithRedactedEnvKeys replaces the set of env variables, values of which
+// are replaced with "***" in String() and Raw() output of ClientEvent,
+// e.g. WithRedactedEnvKeys(append(DefaultRedactedEnvKeys(), "pin")...)
+// extends the default one, and no keys disable the redaction. The default
+// is DefaultRedactedEnvKeys.
+func WithRedactedEnvKeys(keys ...string) Option {
+	return func(o *clientOptions) {
+		o.parse.redactedEnvKeySet = envKeySet(keys)
+	}
+}
+
+// withOwnedConn makes the client close the connection once it's no longer
+// used, for the connections created by the package (Dial, Open).
+func withOwnedConn() Option {
+	return func(o *clientOptions) {
+		o.ownConn = true
+	}
+}
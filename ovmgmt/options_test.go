@@ -0,0 +1,273 @@
+package ovmgmt
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type optionTestCase struct {
+	Name   string
+	Option Option
+	// Check reports whether the option has taken effect
+	Check func(o clientOptions) bool
+}
+
+func optionTestCases() []optionTestCase {
+	status3Ch := make(chan *Status3Event)
+	tap := &bytes.Buffer{}
+	return []optionTestCase{
+		{"multiline timeout", WithMultilineEventTimeout(time.Minute), func(o clientOptions) bool {
+			return o.multilineTimeout == time.Minute
+		}},
+		{"max event size", WithMaxEventSize(10, 20), func(o clientOptions) bool {
+			return o.maxEventLines == 10 && o.maxEventBytes == 20
+		}},
+		{"strict parsing", WithStrictParsing(), func(o clientOptions) bool {
+			return o.strictParsing
+		}},
+		{"raw line history", WithRawLineHistory(5), func(o clientOptions) bool {
+			return o.rawLineHistory == 5
+		}},
+		{"message prealloc", WithMessagePrealloc(7), func(o clientOptions) bool {
+			return o.messagePrealloc == 7
+		}},
+		{"max line size", WithMaxLineSize(100), func(o clientOptions) bool {
+			return o.maxLineSize == 100
+		}},
+		{"raw channel buffers", WithRawChannelBuffers(3, 5), func(o clientOptions) bool {
+			return o.rawReplyBuffer == 3 && o.rawEventBuffer == 5
+		}},
+		{"clock skew", WithClockSkewDetection(time.Second), func(o clientOptions) bool {
+			return o.clockSkewDetection && o.clockSkewThreshold == time.Second
+		}},
+		{"status diff", WithStatusDiffEvents(), func(o clientOptions) bool {
+			return o.statusDiffEvents
+		}},
+		{"status3 channel", WithStatus3Channel(status3Ch), func(o clientOptions) bool {
+			return o.status3Ch == (chan<- *Status3Event)(status3Ch)
+		}},
+		{"keepalive", WithKeepalive(time.Hour, 0), func(o clientOptions) bool {
+			return o.keepaliveInterval == time.Hour && o.keepaliveTimeout == time.Hour
+		}},
+		{"read stall", WithReadStallTimeout(time.Hour), func(o clientOptions) bool {
+			return o.readStallTimeout == time.Hour
+		}},
+		{"handshake check", WithHandshakeCheck(time.Hour), func(o clientOptions) bool {
+			return o.handshakeTimeout == time.Hour
+		}},
+		{"backpressure", WithBackpressure(BackpressureDropNewest), func(o clientOptions) bool {
+			return o.backpressure == BackpressureDropNewest
+		}},
+		{"command hook", WithCommandHook(func(string, error, time.Duration) {}), func(o clientOptions) bool {
+			return o.commandHook != nil
+		}},
+		{"protocol tap", WithProtocolTap(tap), func(o clientOptions) bool {
+			return o.protocolTap == tap && !o.protocolTapUnsafe
+		}},
+		{"rate limit", WithCommandRateLimit(1000, 10), func(o clientOptions) bool {
+			return o.commandRate == 1000 && o.commandBurst == 10
+		}},
+		{"tag", WithTag("tun0"), func(o clientOptions) bool {
+			return o.tag == "tun0"
+		}},
+		{"normalize undef", WithNormalizeUndef(), func(o clientOptions) bool {
+			return o.parse.normalizeUndef
+		}},
+		{"sanitize accessors", WithSanitizeAccessors(), func(o clientOptions) bool {
+			return o.parse.sanitizeAccessors
+		}},
+		{"status time location", WithStatusTimeLocation(time.UTC), func(o clientOptions) bool {
+			return o.parse.statusLocation == time.UTC
+		}},
+		{"redacted env keys", WithRedactedEnvKeys("pin"), func(o clientOptions) bool {
+			return o.parse.redactedEnvKeySet["pin"] && !o.parse.redactedEnvKeySet["password"]
+		}},
+	}
+}
+
+func TestOptions(t *testing.T) {
+	testCases := optionTestCases()
+	for i, tc := range testCases {
+		o := defaultClientOptions()
+		if tc.Check(o) {
+			t.Fatalf("test %d (%s) is in effect by default", i, tc.Name)
+		}
+		tc.Option(&o)
+		if !tc.Check(o) {
+			t.Errorf("test %d (%s) option has no effect", i, tc.Name)
+		}
+		// the rest of the options is intact
+		for j, other := range testCases {
+			if j != i && other.Check(o) {
+				t.Errorf("test %d (%s) option changes %s", i, tc.Name, other.Name)
+			}
+		}
+	}
+
+	// combined in any order, the options don't override each other
+	forward, backward := defaultClientOptions(), defaultClientOptions()
+	for i := range testCases {
+		testCases[i].Option(&forward)
+		testCases[len(testCases)-1-i].Option(&backward)
+	}
+	for i, tc := range testCases {
+		if !tc.Check(forward) || !tc.Check(backward) {
+			t.Errorf("test %d (%s) option has no effect combined", i, tc.Name)
+		}
+	}
+}
+
+func TestOptionsOverride(t *testing.T) {
+	tap := &bytes.Buffer{}
+	o := defaultClientOptions()
+	WithUnsafeProtocolTap(tap)(&o)
+	WithProtocolTap(tap)(&o)
+	if o.protocolTapUnsafe {
+		t.Errorf("WithProtocolTap doesn't override WithUnsafeProtocolTap")
+	}
+	WithUnsafeProtocolTap(tap)(&o)
+	if !o.protocolTapUnsafe {
+		t.Errorf("WithUnsafeProtocolTap doesn't override WithProtocolTap")
+	}
+
+	WithMessagePrealloc(-1)(&o)
+	if o.messagePrealloc != 0 {
+		t.Errorf("WithMessagePrealloc(-1) set %d; want 0", o.messagePrealloc)
+	}
+}
+
+func TestRawChannelBuffers(t *testing.T) {
+	lines := []string{
+		">LOG:1584536294,I,a",
+		">CLIENT:CONNECT,0,1",
+		">CLIENT:ENV,common_name=alice",
+		">CLIENT:ENV,END",
+		">HOLD:Waiting for hold release",
+		">LOG:1584536294,I,b",
+	}
+	eventStrings := func(events []Event) []string {
+		strs := make([]string, 0, len(events))
+		for _, evt := range events {
+			strs = append(strs, evt.String())
+		}
+		return strs
+	}
+	want := eventStrings(replayEvents(lines, WithRawChannelBuffers(0, 0)))
+	for _, buffer := range []int{-1, 1, DefaultRawChannelBuffer} {
+		got := eventStrings(replayEvents(lines, WithRawChannelBuffers(buffer, buffer)))
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("buffer %d got events %q; want %q", buffer, got, want)
+		}
+	}
+
+	// the order of replies and events is kept, each command gets its reply
+	for _, buffer := range []int{0, 1, DefaultRawChannelBuffer} {
+		eventCh := make(chan Event, 100)
+		c := newReplyingClient(t, eventCh, func(cmd string) []string {
+			return []string{">LOG:1584536294,I," + cmd, "SUCCESS: " + cmd}
+		}, WithRawChannelBuffers(buffer, buffer))
+		for i := 0; i < 10; i++ {
+			cmd := fmt.Sprintf("echo %d", i)
+			if got, err := c.simpleCommand(cmd); err != nil || got != cmd {
+				t.Errorf("buffer %d command %q returned %q, %v", buffer, cmd, got, err)
+			}
+			if evt := nextEventOf(t, eventCh); evt.(LogEvent).Message() != cmd {
+				t.Errorf("buffer %d command %q got event %s", buffer, cmd, evt)
+			}
+		}
+	}
+}
+
+func TestMessagePrealloc(t *testing.T) {
+	payload := append(append([]string{}, status3PayloadIroute...), "END")
+	for _, lines := range []int{-1, 0, 1, DefaultMessagePrealloc, 10000} {
+		eventCh := make(chan Event, 10)
+		c := newReplyingClient(t, eventCh, func(string) []string { return payload }, WithMessagePrealloc(lines))
+		status, err := c.LatestStatus3()
+		if err != nil {
+			t.Fatalf("prealloc %d: LatestStatus3 returned error: %s", lines, err)
+		}
+		if n := len(status.Clients()); n != 4 {
+			t.Errorf("prealloc %d: got %d clients; want 4", lines, n)
+		}
+	}
+}
+
+// commandRecorder records the commands passed to the command hook
+type commandRecorder struct {
+	mu   sync.Mutex
+	cmds []string
+}
+
+func (s *commandRecorder) hook(cmd string, err error, took time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cmds = append(s.cmds, cmd)
+}
+
+func (s *commandRecorder) get() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.cmds...)
+}
+
+func TestOptionsCombined(t *testing.T) {
+	defer checkGoroutineLeaks(t)()
+
+	daemonConn, clientConn := net.Pipe()
+	go fakeDaemon(daemonConn, func(cmd string) []string {
+		if cmd == "pid" {
+			// the current timestamp, so the clock isn't skewed
+			return []string{"SUCCESS: pid=42", fmt.Sprintf(">LOG:%d,I,after pid", time.Now().Unix())}
+		}
+		return []string{"ERROR: unknown command"}
+	})
+
+	hook := &commandRecorder{}
+	tap := &syncBuffer{}
+	eventCh := make(chan Event, 10)
+	c := NewMgmtClientWithOptions(clientConn, eventCh,
+		WithMultilineEventTimeout(time.Minute),
+		WithMaxEventSize(100, 1<<16),
+		WithRawLineHistory(5),
+		WithMessagePrealloc(0),
+		WithClockSkewDetection(time.Hour),
+		WithStatusDiffEvents(),
+		WithKeepalive(time.Hour, 0),
+		WithReadStallTimeout(time.Hour),
+		WithBackpressure(BackpressureDropOldest),
+		WithCommandHook(hook.hook),
+		WithProtocolTap(tap),
+		WithCommandRateLimit(1000, 10),
+	)
+
+	for i := 0; i < 3; i++ {
+		if pid, err := c.Pid(); err != nil || pid != 42 {
+			t.Fatalf("Pid %d returned %d, %v; want 42", i, pid, err)
+		}
+		evt := nextEventOf(t, eventCh)
+		if log, ok := evt.(LogEvent); !ok || log.Message() != "after pid" {
+			t.Errorf("Pid %d got %s; want LOG", i, evt)
+		}
+	}
+	if got := hook.get(); len(got) != 3 {
+		t.Errorf("command hook got %q; want 3 commands", got)
+	}
+	if lines := c.RecentRawLines(); len(lines) != 5 {
+		t.Errorf("RecentRawLines returned %q; want 5 lines", lines)
+	}
+
+	c.Close()
+	daemonConn.Close()
+	for range eventCh {
+	}
+	if got := strings.Count(tap.String(), " > pid\n"); got != 3 {
+		t.Errorf("protocol tap got %d pid commands; want 3:\n%s", got, tap)
+	}
+}
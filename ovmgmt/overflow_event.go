@@ -0,0 +1,137 @@
+package ovmgmt
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const overflowEventKW = "OVERFLOW"
+
+// OverflowEvent is a synthetic event emitted by the client created with
+// a dropping WithBackpressure policy, when the consumer catches up after
+// events are dropped. It precedes the first event delivered after the gap,
+// there is one per gap however many events are dropped.
+type OverflowEvent struct {
+	receivedAt
+	dropped  uint64
+	since    time.Time
+	keywords map[string]uint64
+}
+
+func (e OverflowEvent) Keyword() string {
+	return overflowEventKW
+}
+
+func (e OverflowEvent) Raw() string {
+	return fmt.Sprintf("%s%s%d", overflowEventKW, eventSep, e.dropped)
+}
+
+// Dropped returns the number of events dropped in the gap.
+func (e OverflowEvent) Dropped() uint64 {
+	return e.dropped
+}
+
+// Since returns the time the first event of the gap is dropped at.
+func (e OverflowEvent) Since() time.Time {
+	return e.since
+}
+
+// DroppedKeywords returns the number of dropped events by keyword,
+// as of KeywordedEvent, the empty one stands for other events.
+func (e OverflowEvent) DroppedKeywords() map[string]uint64 {
+	keywords := make(map[string]uint64, len(e.keywords))
+	for kw, n := range e.keywords {
+		keywords[kw] = n
+	}
+	return keywords
+}
+
+func (e OverflowEvent) String() string {
+	kws := make([]string, 0, len(e.keywords))
+	for kw := range e.keywords {
+		kws = append(kws, kw)
+	}
+	sort.Strings(kws)
+	for i, kw := range kws {
+		kws[i] = fmt.Sprintf("%s=%d", kw, e.keywords[kw])
+	}
+	return Sanitize(fmt.Sprintf("%s: %d events dropped since %s (%s)",
+		overflowEventKW, e.dropped, e.since.Format(time.RFC3339Nano), strings.Join(kws, ", ")))
+}
+
+// eventGap accumulates the dropped events until OverflowEvent is sent
+type eventGap struct {
+	mu       sync.Mutex
+	dropped  uint64
+	since    time.Time
+	keywords map[string]uint64
+}
+
+func (g *eventGap) add(evt Event) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.dropped == 0 {
+		g.since = time.Now()
+		g.keywords = make(map[string]uint64)
+	}
+	g.dropped++
+	var kw string
+	if ke, ok := evt.(KeywordedEvent); ok {
+		kw = ke.Keyword()
+	}
+	g.keywords[kw]++
+}
+
+// take returns OverflowEvent of the gap, if any, and resets it
+func (g *eventGap) take() (OverflowEvent, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.dropped == 0 {
+		return OverflowEvent{}, false
+	}
+	evt := OverflowEvent{receivedAt{time.Now()}, g.dropped, g.since, g.keywords}
+	g.dropped, g.since, g.keywords = 0, time.Time{}, nil
+	return evt, true
+}
+
+// restore puts back the gap of unsent OverflowEvent, merging it with
+// the events dropped since
+func (g *eventGap) restore(evt OverflowEvent) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.dropped == 0 {
+		g.dropped, g.since, g.keywords = evt.dropped, evt.since, evt.keywords
+		return
+	}
+	g.dropped += evt.dropped
+	g.since = evt.since
+	for kw, n := range evt.keywords {
+		g.keywords[kw] += n
+	}
+}
+
+// sendOverflow sends OverflowEvent of the pending gap, if any. Unless block,
+// it doesn't wait for the consumer, the gap stays pending then. It reports
+// whether there is no pending gap anymore.
+func (c *MgmtClient) sendOverflow(block bool) bool {
+	evt, ok := c.gap.take()
+	if !ok {
+		return true
+	}
+	if block {
+		if c.send(evt) {
+			return true
+		}
+	} else {
+		select {
+		case c.eventSink <- c.tagged(evt):
+			return true
+		default:
+		}
+	}
+	c.gap.restore(evt)
+	return false
+}
@@ -0,0 +1,84 @@
+package ovmgmt
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestOverflowEvent(t *testing.T) {
+	defer checkGoroutineLeaks(t)()
+
+	daemonConn, clientConn := net.Pipe()
+	eventCh := make(chan Event, 4)
+	c := NewMgmtClientWithOptions(clientConn, eventCh, WithBackpressure(BackpressureDropNewest))
+	defer c.Close()
+
+	// the consumer is stalled, 4 events fit into the channel
+	before := time.Now()
+	for j := 1; j <= 8; j++ {
+		fmt.Fprintf(daemonConn, ">LOG:1584536294,I,%d\n", j)
+	}
+	fmt.Fprintf(daemonConn, ">BYTECOUNT:1,2\n>BYTECOUNT:3,4\n")
+	deadline := time.Now().Add(2 * time.Second)
+	for c.DroppedEvents() < 6 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	// then it catches up
+	for j := 1; j <= 4; j++ {
+		evt := <-eventCh
+		if le, ok := evt.(LogEvent); !ok || le.Message() != fmt.Sprint(j) {
+			t.Fatalf("event %d is %s; want LOG %d", j, evt, j)
+		}
+	}
+	fmt.Fprintf(daemonConn, ">LOG:1584536294,I,last\n")
+	daemonConn.Close()
+
+	var got []Event
+	for evt := range eventCh {
+		got = append(got, evt)
+	}
+	if len(got) != 3 {
+		t.Fatalf("got events %v; want OverflowEvent, LogEvent, FatalEvent", got)
+	}
+
+	overflow, ok := got[0].(OverflowEvent)
+	if !ok {
+		t.Fatalf("got %s; want OverflowEvent", got[0])
+	}
+	if overflow.Dropped() != 6 {
+		t.Errorf("OverflowEvent reports %d dropped; want 6", overflow.Dropped())
+	}
+	if since := overflow.Since(); since.Before(before) || since.After(overflow.ReceivedAt()) {
+		t.Errorf("OverflowEvent reports gap since %s, received at %s; want after %s", since, overflow.ReceivedAt(), before)
+	}
+	wantKeywords := map[string]uint64{logEventKW: 4, byteCountEventKW: 2}
+	if kws := overflow.DroppedKeywords(); !reflect.DeepEqual(kws, wantKeywords) {
+		t.Errorf("OverflowEvent reports dropped keywords %v; want %v", kws, wantKeywords)
+	}
+	if le, ok := got[1].(LogEvent); !ok || le.Message() != "last" {
+		t.Errorf("got %s; want the last LOG", got[1])
+	}
+	if _, ok := got[2].(FatalEvent); !ok {
+		t.Errorf("got %s; want FatalEvent", got[2])
+	}
+}
+
+func TestOverflowEventString(t *testing.T) {
+	since := time.Date(2020, 3, 18, 12, 58, 14, 0, time.UTC)
+	evt := OverflowEvent{
+		dropped:  3,
+		since:    since,
+		keywords: map[string]uint64{logEventKW: 2, byteCountEventKW: 1},
+	}
+	want := "OVERFLOW: 3 events dropped since 2020-03-18T12:58:14Z (BYTECOUNT=1, LOG=2)"
+	if got := evt.String(); got != want {
+		t.Errorf("String returned %q; want %q", got, want)
+	}
+	if got, want := evt.Raw(), "OVERFLOW:3"; got != want {
+		t.Errorf("Raw returned %q; want %q", got, want)
+	}
+}
@@ -1,11 +1,15 @@
 package ovmgmt
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -13,16 +17,128 @@ const newlineSep = "\n"
 const successPrefix = "SUCCESS: "
 const errorPrefix = "ERROR: "
 const endMessage = "END"
+const strictParsingFatalMsg = "Strict parsing"
+const strictParsingFatalPrefix = strictParsingFatalMsg + ": "
+const strictParsingFatalDesc = "Malformed data from OpenVPN"
 
-// preallocate buffer for big responses
-const bigMessageLines = 100
+// errStrictParsing is the category of the failures of WithStrictParsing
+var errStrictParsing = NewOVpnError("strict parsing failure")
+
+// strictParsingError is the failure of WithStrictParsing on the malformed
+// data, the client is terminated with it
+func strictParsingError(err error) error {
+	return newCategoryError(errStrictParsing, strictParsingFatalMsg, err)
+}
+
+// the number of stray reply lines buffered for the event scanner
+const strayReplyBuffer = 16
+
+// DefaultMessagePrealloc is the default number of lines preallocated
+// for multi-line replies and events, see WithMessagePrealloc.
+const DefaultMessagePrealloc = 100
+
+// DefaultMultilineEventTimeout is the default time to wait for the end
+// of multi-line event, see SetMultilineEventTimeout.
+const DefaultMultilineEventTimeout = 10 * time.Second
+
+// ErrClientClosed is returned by commands of the client closed with Close.
+// ClientClosedError of the client terminated otherwise matches it with
+// errors.Is.
+var ErrClientClosed = newCategoryError(ErrClosed, "client is closed", nil)
+
+// ClientClosedError is returned by commands of the client terminated due to
+// the connection error, without issuing them. It wraps the error, see Err.
+type ClientClosedError struct {
+	Err error
+}
+
+func (e *ClientClosedError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrClientClosed, e.Err)
+}
+
+func (e *ClientClosedError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is ErrClientClosed or its category ErrClosed.
+func (e *ClientClosedError) Is(target error) bool {
+	return target == ErrClientClosed || errors.Is(ErrClientClosed, target)
+}
 
 type MgmtClient struct {
-	wr             io.Writer
-	rawReplyCh     chan string
-	rawEventCh     chan string
+	// accessed atomically, keep them first for 64-bit alignment
+	multilineTimeout    int64
+	status3SkippedTicks uint64
+	droppedEvents       uint64
+	// UnixNano of the last line received, tracked for keepalive and
+	// read stall detection
+	lastLineAt      int64
+	malformedEvents uint64
+	cmdStats        seqCounters
+	status3InFlight int32
+
+	conn       io.ReadWriter
+	wr         io.Writer
+	rawReplyCh chan string
+	rawEventCh chan rawEvent
+	demux      *Demultiplexer
+	// the stray reply lines, which are emitted as MalformedEvent by
+	// the event scanner; strayDone is closed when it stops reading them
+	strayCh   chan string
+	strayDone chan struct{}
+	// status3Mu guards doneStatus3Gen, which is nil when the generator
+	// is not running, and status3Closed, set when the event channel is
+	// about to be closed
+	status3Mu      sync.Mutex
 	doneStatus3Gen chan bool
-	eventSink      chan<- Event
+	status3Closed  bool
+	// generators and their polls, which write to the event channel
+	generatorsWG sync.WaitGroup
+	// held while a command is in flight, up to the end of its reply
+	cmdSem chan struct{}
+	// closed by Close
+	closed    chan struct{}
+	closeOnce sync.Once
+	// closed by abort, when the connection is declared dead
+	aborted   chan struct{}
+	abortOnce sync.Once
+	// the connection is closed once by Close, or when the client context
+	// is done if it's created by Dial
+	connCloseOnce sync.Once
+	closeErr      error
+	// the client context is canceled once the demultiplexer is done,
+	// the client terminates or it's closed; the background work stops then
+	ctx           context.Context
+	cancel        context.CancelFunc
+	lifecycleDone chan struct{}
+	// closed when the event channel is closed and when the demultiplexer
+	// is done
+	done      chan struct{}
+	demuxDone chan struct{}
+	// errMu guards err, the terminal error
+	errMu sync.Mutex
+	err   error
+	// the error of the demultiplexer, it's err unless the error is set
+	// otherwise before
+	readErr   error
+	eventSink chan<- Event
+	subs      subscriptions
+	// buffers the events with BackpressureDropOldest
+	queue     *eventQueue
+	gap       eventGap
+	opts      clientOptions
+	rawLines  *rawLineRing
+	tap       *protocolTap
+	states    stateMachine
+	limiter   *tokenBucket
+	clockSkew *ClockSkewEstimator
+	// the first line is sent to firstLine for the check of
+	// WithHandshakeCheck, handshakeErr is set once handshakeDone is closed
+	firstLine     chan string
+	handshakeDone chan struct{}
+	handshakeErr  error
+	// accessed by eventScanner only
+	clockSkewExceeded bool
 }
 
 // NewMgmtClient creates a new MgmtClient that communicates via the given
@@ -41,56 +157,302 @@ type MgmtClient struct {
 // caller *must* constantly read events from eventCh to avoid its buffer
 // becoming full. Events and replies are received on the same channel
 // from OpenVPN, so if writing to eventCh blocks then this will also block
-// responses from the client's various command methods.
+// responses from the client's various command methods, once the internal
+// buffer of event lines is full too, see WithRawChannelBuffers.
+//
+// eventCh may be nil if the events are received with the subscriptions
+// only, see SubscribeEvents.
 //
 // eventCh will be closed to signal the closing of the client connection,
 // whether due to graceful shutdown or to an error. In the case of error,
-// a FatalEvent will be emitted on the channel as the last event before it
-// is closed. Connection errors may also concurrently surface as error
-// responses from the client's various command methods, should an error
-// occur while we await a reply.
+// including the daemon closing the connection, a FatalEvent will be emitted
+// on the channel as the last event before it is closed. Connection errors
+// may also concurrently surface as error responses from the client's
+// various command methods, should an error occur while we await a reply:
+// they return the error of the FatalEvent.
+//
+// The client is shut down with Close, which also closes conn if it's
+// an io.Closer.
+//
+// Commands are safe to call concurrently. They are executed one at a time,
+// each one holds the connection from sending the command up to the end of
+// its reply, so replies are never delivered to the wrong caller. This
+// includes the polls of the Status3 generator.
+//
+// The daemon output is never dropped: the lines which can't be the reply,
+// e.g. the garbage received while a command waits for its SUCCESS or ERROR
+// result, and the reply lines left unread at the end of the connection, are
+// emitted as MalformedEvent, which Stray method returns true. The lines
+// received while no command is in flight are taken for the reply to
+// the next one, as are all lines before END of the multi-line replies.
 func NewMgmtClient(conn io.ReadWriter, eventCh chan<- Event) *MgmtClient {
+	return NewMgmtClientWithOptions(conn, eventCh)
+}
+
+// NewMgmtClientWithOptions is the same as NewMgmtClient, but the client
+// is configured with the given options.
+func NewMgmtClientWithOptions(conn io.ReadWriter, eventCh chan<- Event, opts ...Option) *MgmtClient {
 	c := &MgmtClient{
-		wr:         conn,
-		rawReplyCh: make(chan string),
-		rawEventCh: make(chan string), // not buffered because eventCh should be
-		eventSink:  eventCh,
+		conn:      conn,
+		wr:        conn,
+		eventSink: eventCh,
+		opts:      defaultClientOptions(),
+		cmdSem:    make(chan struct{}, 1),
+		closed:    make(chan struct{}),
+		aborted:   make(chan struct{}),
+		done:      make(chan struct{}),
+		demuxDone: make(chan struct{}),
+		strayCh:   make(chan string, strayReplyBuffer),
+		strayDone: make(chan struct{}),
+	}
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	c.lifecycleDone = make(chan struct{})
+	for _, opt := range opts {
+		opt(&c.opts)
+	}
+	c.rawReplyCh = make(chan string, c.opts.rawReplyBuffer)
+	c.rawEventCh = make(chan rawEvent, c.opts.rawEventBuffer)
+	c.multilineTimeout = int64(c.opts.multilineTimeout)
+
+	var onLine func([]byte)
+	if c.opts.rawLineHistory > 0 {
+		c.rawLines = newRawLineRing(c.opts.rawLineHistory, &c.opts.parse)
+		onLine = c.rawLines.add
+	}
+	if c.opts.handshakeTimeout > 0 {
+		c.firstLine = make(chan string, 1)
+		c.handshakeDone = make(chan struct{})
+	}
+	// the daemon is responsive once the first line is received, which is
+	// called by the demultiplexer only; unless it's the daemon refusing
+	// the client
+	ready := false
+	busyLine := ""
+	addLine := onLine
+	onLine = func(line []byte) {
+		if !ready {
+			ready = true
+			if c.firstLine != nil {
+				c.firstLine <- string(line)
+			}
+			if isBusyMessage(string(line)) {
+				busyLine = string(line)
+			} else {
+				c.states.set(ClientStateReady)
+			}
+		}
+		if addLine != nil {
+			addLine(line)
+		}
+	}
+
+	if c.opts.clockSkewDetection {
+		c.clockSkew = NewClockSkewEstimator(DefaultClockSkewWindow)
 	}
-	// initial status for 'done' channel (so we can safely close it and make new)
-	c.doneStatus3Gen = make(chan bool, 1)
 
-	go Demultiplex(conn, c.rawReplyCh, c.rawEventCh)
+	if c.opts.commandRate > 0 {
+		c.limiter = newTokenBucket(c.opts.commandRate, c.opts.commandBurst)
+	}
+
+	if c.opts.protocolTap != nil {
+		c.tap = newProtocolTap(c.opts.protocolTap, c.opts.protocolTapUnsafe)
+		// the lines are read up to the end, unless Close can't stop
+		// the reading
+		tapDone := c.ctx.Done()
+		if _, ok := conn.(io.Closer); ok {
+			tapDone = c.demuxDone
+		}
+		go c.tap.run(tapDone)
+		addLine := onLine
+		onLine = func(line []byte) {
+			if c.tap.unsafe {
+				c.tap.add("<", string(line))
+			} else {
+				c.tap.add("<", redactEventLine(string(line), &c.opts.parse))
+			}
+			if addLine != nil {
+				addLine(line)
+			}
+		}
+	}
+
+	if c.opts.backpressure == BackpressureDropOldest {
+		c.queue = newEventQueue(cap(eventCh))
+		go c.pumpEvents()
+	}
+
+	if c.opts.keepaliveInterval > 0 || c.opts.readStallTimeout > 0 {
+		c.touchLine()
+		addLine := onLine
+		onLine = func(line []byte) {
+			c.touchLine()
+			if addLine != nil {
+				addLine(line)
+			}
+		}
+	}
+	if c.opts.keepaliveInterval > 0 {
+		c.generatorsWG.Add(1)
+		go c.keepalive(c.opts.keepaliveInterval, c.opts.keepaliveTimeout)
+	}
+	if c.opts.handshakeTimeout > 0 {
+		c.generatorsWG.Add(1)
+		go c.checkHandshake(c.opts.handshakeTimeout)
+	}
+	var rd io.Reader = conn
+	if c.opts.readStallTimeout > 0 {
+		if sr, ok := newStallReader(conn, c.opts.readStallTimeout); ok {
+			rd = sr
+		} else {
+			c.generatorsWG.Add(1)
+			go c.readStallWatchdog(c.opts.readStallTimeout)
+		}
+	}
+
+	c.demux = newTimedDemultiplexer(rd, c.rawReplyCh, c.rawEventCh)
+	c.demux.onLine = onLine
+	c.demux.SetMaxLineSize(c.opts.maxLineSize)
+	go func() {
+		defer close(c.demuxDone)
+		// the demultiplexer runs until the end of the connection, which is
+		// closed by Close if it's an io.Closer, so the lines read are all
+		// processed
+		err := c.demux.run(context.Background())
+		// the error is set before the channels are closed, so the event
+		// scanner and the commands waiting for a reply can report it
+		c.setReadErr(busyError(err, c.demux.Stats().LinesRead, busyLine))
+		close(c.rawEventCh)
+		close(c.rawReplyCh)
+		c.cancel()
+	}()
 	go c.eventScanner()
+	go c.lifecycle()
 
 	return c
 }
 
+// SetMultilineEventTimeout sets the time to wait for the end of multi-line
+// event (e.g. ENV,END of CLIENT notification) after its first line.
+// If it doesn't arrive in time, the lines received so far are emitted
+// as InvalidEvent with ErrMultilineEventTimeout and the following lines
+// are processed as usual.
+//
+// The timeout applies to multi-line events started after the call,
+// zero disables it. The default is DefaultMultilineEventTimeout.
+func (c *MgmtClient) SetMultilineEventTimeout(timeout time.Duration) {
+	atomic.StoreInt64(&c.multilineTimeout, int64(timeout))
+}
+
 func (c *MgmtClient) eventScanner() {
-	buf := make([]string, 0, bigMessageLines)
+	buf := make([]string, 0, c.opts.messagePrealloc)
 	bufKW := ""
+	bufBytes := 0
+	var bufAt time.Time
+	// keyword of too large multi-line event, which lines are dropped
+	// up to the end marker
+	dropKW := ""
+	// set on malformed event in strict parsing mode
+	failed := false
+	var failedErr error
+	// FatalEvent of the failure, emitted once the generators are done
+	var failedFatal Event
 
+	sendEvent := func(evt Event, at time.Time) {
+		if failed {
+			return
+		}
+		if isParsingFailure(evt) {
+			atomic.AddUint64(&c.malformedEvents, 1)
+			if c.opts.strictParsing {
+				logErrorf("Strict parsing: %s", evt)
+				failed = true
+				failedErr = strictParsingError(errors.New(evt.String()))
+				failedFatal = stampEvent(c.attachRecentRawLines(newFatalEvent(failedErr)), at)
+				return
+			}
+		}
+		evt = stampEvent(c.attachRecentRawLines(withParseOptions(evt, &c.opts.parse)), at)
+		if !c.emit(evt) {
+			return
+		}
+		if skewEvt, ok := c.checkClockSkew(evt); ok {
+			c.emit(skewEvt)
+		}
+	}
+
+	// armed while multi-line event is buffered
+	var bufTimer *time.Timer
+	var bufTimeoutCh <-chan time.Time
+
+	resetMultilineBuf := func() {
+		bufKW = ""
+		buf = buf[:0]
+		bufBytes = 0
+		if bufTimer != nil {
+			bufTimer.Stop()
+			bufTimer = nil
+			bufTimeoutCh = nil
+		}
+	}
 	flushMultilineBuf := func() {
-		defer func() {
-			bufKW = ""
-			buf = buf[:0]
-		}()
-		c.eventSink <- upgradeMultilineEvent(bufKW, buf)
+		defer resetMultilineBuf()
+		sendEvent(upgradeMultilineEvent(bufKW, buf), bufAt)
+	}
+	// flush the buffer of multi-line event which has never got its end marker
+	flushTruncatedBuf := func(err error) {
+		defer resetMultilineBuf()
+		sendEvent(upgradeTruncatedEvent(bufKW, buf, err), bufAt)
 	}
 
 	// Get raw events and upgrade them into proper event types before
 	// passing them on to the caller's event channel.
 
-	for raw := range c.rawEventCh {
+	for !failed {
+		var rawEvt rawEvent
+		var ok bool
+		select {
+		case rawEvt, ok = <-c.rawEventCh:
+		case line := <-c.strayCh:
+			sendEvent(MalformedEvent{raw: line, stray: true}, time.Now())
+			continue
+		case <-c.closed:
+		case <-c.aborted:
+		case <-bufTimeoutCh:
+			logErrorf("Multi-line message is not finished in time!")
+			flushTruncatedBuf(ErrMultilineEventTimeout)
+			continue
+		}
+		if !ok {
+			break
+		}
+
+		// stamped by the demultiplexer, the line may have been queued
+		// in the channel for a while
+		raw, at := rawEvt.line, rawEvt.at
+		if line, ok := IsTruncatedLine(raw); ok {
+			// it's neither a part of multi-line event nor its end
+			sendEvent(MalformedEvent{raw: line, truncated: true}, at)
+			continue
+		}
 		endMarker, keyword, body := splitEvent(raw)
 		//logDebugf("raw: %s; endMarker: %s, kw: %s, body: %s; bufKW: %s; buf: %#v\n", raw, endMarker, keyword, body, bufKW, buf)
 
 		if endMarker == emSingleLine {
 			// fetched single-line event
-			c.eventSink <- upgradeEvent(keyword, body)
-			if len(buf) > 0 || bufKW != "" {
-				// should never-ever happen
-				logErrorf("It is a single-line message, but buffer or bufKeyword not empty!")
-				flushMultilineBuf()
+			//
+			// Real-time messages (e.g. LOG or BYTECOUNT) may be interleaved
+			// with lines of multi-line event, they are delivered immediately
+			// and the buffer is kept intact. But FATAL means the daemon
+			// (or our reader) is going away, so the buffered event is
+			// never finished.
+			if keyword == fatalEventKW && (len(buf) > 0 || bufKW != "") {
+				flushTruncatedBuf(ErrTruncatedEvent)
+			}
+			sendEvent(upgradeEvent(keyword, body), at)
+		} else if dropKW != "" && keyword == dropKW {
+			// the rest of too large multi-line event
+			if raw == string(endMarker) {
+				dropKW = ""
 			}
 		} else if raw == string(endMarker) {
 			// fetched multi-line event
@@ -99,18 +461,378 @@ func (c *MgmtClient) eventScanner() {
 			// multi-line event, save lines to buf until endMarker
 			if bufKW == "" {
 				bufKW = keyword
+				bufAt = at
+				dropKW = ""
+				if timeout := time.Duration(atomic.LoadInt64(&c.multilineTimeout)); timeout > 0 {
+					bufTimer = time.NewTimer(timeout)
+					bufTimeoutCh = bufTimer.C
+				}
 			} else if bufKW != keyword {
 				// all multi-line event lines must start with first fetched bufKW
 				// this should never happen
 				logErrorf("Current keyword != first keyword for a multi-line message!")
-				flushMultilineBuf()
-				c.eventSink <- upgradeEvent(keyword, body)
+				flushTruncatedBuf(ErrTruncatedEvent)
+				sendEvent(upgradeEvent(keyword, body), at)
+				continue
+			}
+			if c.isEventTooLarge(len(buf)+1, bufBytes+len(body)) {
+				logErrorf("Multi-line message is too large!")
+				dropKW = bufKW
+				flushTruncatedBuf(ErrEventTooLarge)
 				continue
 			}
 			buf = append(buf, body)
+			bufBytes += len(body)
+		}
+	}
+
+	if len(buf) > 0 || bufKW != "" {
+		// connection is closed in the middle of multi-line event
+		flushTruncatedBuf(ErrTruncatedEvent)
+	}
+	if !failed && !c.isClosed() && !c.isAborted() {
+		c.collectStrayReplies(sendEvent)
+	}
+	close(c.strayDone)
+
+	// after the strict parsing failure, keep reading so the demultiplexer
+	// doesn't get stuck, and replies to the in-flight polls get through
+	drained := make(chan struct{})
+	go func() {
+		for range c.rawEventCh {
+		}
+		close(drained)
+	}()
+	if c.isClosed() || c.isAborted() {
+		// nobody is going to read the replies
+		go func() {
+			for range c.rawReplyCh {
+			}
+		}()
+	}
+
+	var fatal Event
+	switch {
+	case failed:
+		c.setFailedErr(failedErr)
+		fatal = failedFatal
+	case c.isClosed():
+	default:
+		// the connection is gone, the demultiplexer has set the error
+		// by now, unless the client is closed concurrently
+		if err := c.terminalErr(); err != nil {
+			fatal = stampEvent(c.attachRecentRawLines(newFatalEvent(err)), time.Now())
+		}
+	}
+
+	// the client is terminated, the owned connection is closed along
+	// with it; generators write to the event channel, they must be done
+	// before it's closed, and before FatalEvent, which is the last one
+	c.states.set(ClientStateClosing)
+	c.cancel()
+	c.stopGenerators()
+	c.generatorsWG.Wait()
+	if fatal != nil {
+		c.emitTerminal(fatal)
+	}
+	if c.queue != nil {
+		c.queue.close()
+		<-c.queue.done
+	}
+	if c.eventSink != nil {
+		close(c.eventSink)
+	}
+	c.subs.closeAll()
+	if c.opts.status3Ch != nil {
+		close(c.opts.status3Ch)
+	}
+	c.states.set(ClientStateClosed)
+	close(c.done)
+	<-drained
+}
+
+// collectStrayReplies emits the stray reply lines up to the end of
+// the connection: the ones of the command in flight, and the ones left
+// unread once it's done
+func (c *MgmtClient) collectStrayReplies(sendEvent func(Event, time.Time)) {
+	for acquired := false; !acquired; {
+		select {
+		case line := <-c.strayCh:
+			sendEvent(MalformedEvent{raw: line, stray: true}, time.Now())
+		case c.cmdSem <- struct{}{}:
+			acquired = true
+		case <-c.closed:
+			return
+		case <-c.aborted:
+			return
+		}
+	}
+	defer c.releaseCommand()
+
+	// nobody else reads the replies now, the channel is closed after
+	// the event one
+	for {
+		select {
+		case line := <-c.strayCh:
+			sendEvent(MalformedEvent{raw: line, stray: true}, time.Now())
+		case line, ok := <-c.rawReplyCh:
+			if !ok {
+				return
+			}
+			sendEvent(MalformedEvent{raw: line, stray: true}, time.Now())
+		case <-c.closed:
+			return
+		case <-c.aborted:
+			return
+		}
+	}
+}
+
+// strayReply emits the reply line which is not a part of the reply
+// to the command in flight as MalformedEvent
+func (c *MgmtClient) strayReply(line string) {
+	logErrorf("Stray reply line: %q", line)
+	select {
+	case c.strayCh <- line:
+	case <-c.strayDone:
+	case <-c.closed:
+	case <-c.aborted:
+	}
+}
+
+// setErr sets the terminal error, unless it's set already or the client
+// is closed with Close
+func (c *MgmtClient) setErr(err error) {
+	c.errMu.Lock()
+	defer c.errMu.Unlock()
+	if c.err == nil && !c.isClosed() {
+		c.err = err
+	}
+}
+
+// setReadErr sets the terminal error of the demultiplexer, as setErr
+func (c *MgmtClient) setReadErr(err error) {
+	c.errMu.Lock()
+	defer c.errMu.Unlock()
+	if c.err == nil && !c.isClosed() {
+		c.err = err
+		c.readErr = err
+	}
+}
+
+// setFailedErr sets the terminal error of the strict parsing failure,
+// which replaces the read error: the buffered lines up to the failed one
+// are read before the end of the connection
+func (c *MgmtClient) setFailedErr(err error) {
+	c.errMu.Lock()
+	defer c.errMu.Unlock()
+	if (c.err == nil || c.err == c.readErr) && !c.isClosed() {
+		c.err = err
+	}
+}
+
+func (c *MgmtClient) terminalErr() error {
+	c.errMu.Lock()
+	defer c.errMu.Unlock()
+	return c.err
+}
+
+// Done returns the channel which is closed when the client terminates,
+// either due to Close or to a connection error. The event channel is
+// closed by then.
+func (c *MgmtClient) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns the error the client is terminated with: io.EOF if the
+// daemon has closed the connection, the read error or the strict parsing
+// failure. It's nil for the client closed with Close and while the client
+// is running.
+func (c *MgmtClient) Err() error {
+	select {
+	case <-c.done:
+	default:
+		return nil
+	}
+	return c.terminalErr()
+}
+
+// emit sends the event to the subscriptions and to the event channel,
+// unless the client is closed or the event is dropped according to
+// the backpressure policy. It reports whether the event is sent, or queued
+// to be sent.
+func (c *MgmtClient) emit(evt Event) bool {
+	c.subs.dispatch(evt)
+	if c.eventSink == nil {
+		return !c.isClosed()
+	}
+	return c.emitSink(evt)
+}
+
+// emitSink is emit to the event channel only
+func (c *MgmtClient) emitSink(evt Event) bool {
+	switch c.opts.backpressure {
+	case BackpressureDropNewest:
+		if !c.sendOverflow(false) {
+			// the consumer hasn't caught up yet, the gap goes on
+			c.dropEvent(evt)
+			return false
 		}
+		select {
+		case c.eventSink <- c.tagged(evt):
+			return true
+		case <-c.closed:
+			return false
+		default:
+			c.dropEvent(evt)
+			return false
+		}
+	case BackpressureDropOldest:
+		if c.isClosed() {
+			return false
+		}
+		c.queue.push(evt, c.dropEvent)
+		return true
+	}
+	return c.send(evt)
+}
+
+// emitTerminal is emit of the last event, which is never dropped
+func (c *MgmtClient) emitTerminal(evt Event) bool {
+	c.subs.dispatch(evt)
+	if c.eventSink == nil {
+		return true
+	}
+	if c.opts.backpressure == BackpressureDropOldest {
+		// it's the newest one
+		return c.emitSink(evt)
+	}
+	return c.sendOverflow(true) && c.send(evt)
+}
+
+// send sends the event to the event channel, blocking, unless the client
+// is closed
+func (c *MgmtClient) send(evt Event) bool {
+	select {
+	case c.eventSink <- c.tagged(evt):
+		return true
+	case <-c.closed:
+		return false
+	}
+}
+
+// Close closes the client: it stops the generators, closes the connection
+// if it's an io.Closer (e.g. net.Conn of Dial) and waits for the internal
+// goroutines to finish. The event channel is closed before Close returns,
+// events not read by then are dropped. Commands in flight and the ones
+// issued after Close fail with ErrClientClosed. Once the client is
+// terminated due to the connection error, they fail with ClientClosedError.
+//
+// If the connection is not an io.Closer, the goroutine reading it runs
+// until the connection is closed by other means.
+//
+// It's safe to call Close multiple times and concurrently, it returns
+// the error of closing the connection.
+func (c *MgmtClient) Close() error {
+	c.closeOnce.Do(func() {
+		c.states.set(ClientStateClosing)
+		close(c.closed)
+		c.cancel()
+	})
+	err := c.closeConn()
+
+	<-c.done
+	<-c.lifecycleDone
+	if c.tap != nil {
+		<-c.tap.done
+	}
+	if _, ok := c.conn.(io.Closer); ok {
+		<-c.demuxDone
+	}
+	return err
+}
+
+// closeConn closes the connection if it's an io.Closer, once, and returns
+// the error of closing it
+func (c *MgmtClient) closeConn() error {
+	c.connCloseOnce.Do(func() {
+		if closer, ok := c.conn.(io.Closer); ok {
+			c.closeErr = closer.Close()
+		}
+	})
+	return c.closeErr
+}
+
+// lifecycle stops the background work once the client context is done,
+// and closes the connection if it's owned by the client, so nothing
+// lingers after the daemon has closed the connection
+func (c *MgmtClient) lifecycle() {
+	defer close(c.lifecycleDone)
+	<-c.ctx.Done()
+	c.stopGenerators()
+	if c.opts.ownConn {
+		c.closeConn()
+	}
+}
+
+// abort declares the connection dead: it sets the terminal error, closes
+// the connection if it's an io.Closer and makes the client terminate
+// as if the connection was closed by the daemon
+func (c *MgmtClient) abort(err error) {
+	c.setErr(err)
+	c.abortOnce.Do(func() {
+		c.states.set(ClientStateClosing)
+		close(c.aborted)
+		c.closeConn()
+	})
+}
+
+func (c *MgmtClient) isAborted() bool {
+	select {
+	case <-c.aborted:
+		return true
+	default:
+		return false
 	}
-	close(c.eventSink)
+}
+
+func (c *MgmtClient) isClosed() bool {
+	select {
+	case <-c.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// stopGenerators stops the Status3 generator for good, it can't be
+// enabled after that
+func (c *MgmtClient) stopGenerators() {
+	c.status3Mu.Lock()
+	defer c.status3Mu.Unlock()
+
+	c.status3Closed = true
+	if c.doneStatus3Gen != nil {
+		close(c.doneStatus3Gen)
+		c.doneStatus3Gen = nil
+	}
+}
+
+// isParsingFailure reports whether the event is emitted in place
+// of malformed data
+func isParsingFailure(evt Event) bool {
+	switch evt.(type) {
+	case InvalidEvent, MalformedEvent:
+		return true
+	}
+	return false
+}
+
+func (c *MgmtClient) isEventTooLarge(lines, bytes int) bool {
+	if c.opts.maxEventLines > 0 && lines > c.opts.maxEventLines {
+		return true
+	}
+	return c.opts.maxEventBytes > 0 && bytes > c.opts.maxEventBytes
 }
 
 // Dial is a convenience wrapper around NewMgmtClient that handles the common
@@ -124,8 +846,9 @@ func (c *MgmtClient) eventScanner() {
 //
 //    --management <ipaddr> <port>
 //
-// Address may an IPv4 address, an IPv6 address, or a hostname that resolves
-// to either of these, followed by a colon and then a port number.
+// Address may an IPv4 address, an IPv6 address in square brackets
+// (e.g. [::1]:7505), or a hostname that resolves to either of these,
+// followed by a colon and then a port number.
 //
 // When running on Unix systems it's possible to instead connect to a Unix
 // domain socket. To do this, pass an absolute path to the socket as
@@ -133,17 +856,113 @@ func (c *MgmtClient) eventScanner() {
 //
 //    --management /path/to/socket unix
 //
+// Any address containing a slash, but not starting with a bracket, is taken
+// as a socket path. Use DialNetwork to specify the network explicitly,
+// e.g. for a relative socket path without a slash.
+//
+// On Linux, the address starting with '@' or a NUL byte is taken as
+// a socket in the abstract namespace, e.g. @openvpn-mgmt, which has no
+// file to secure.
+//
+// On Windows, the address starting with \\.\pipe\ is taken as a named pipe,
+// e.g. \\.\pipe\openvpn-mgmt. Other systems return ErrNamedPipeUnsupported
+// for such addresses.
+//
+// The connection is owned by the client: it's closed by Close, and also
+// when the daemon closes its end or the client terminates otherwise.
+//
+// Dial waits for the greeting of the daemon up to DefaultHandshakeTimeout,
+// and returns NotOpenVPNError if something else or nothing is received,
+// see WithHandshakeCheck. It returns ManagementBusyError if the daemon
+// refuses the client, since another one is connected.
 func Dial(addr string, eventCh chan<- Event) (*MgmtClient, error) {
-	proto := "tcp"
-	if len(addr) > 0 && strings.Contains(addr, "/") {
-		proto = "unix"
+	return DialContext(context.Background(), addr, eventCh)
+}
+
+// DialContext is Dial which connects using the context: once it's done
+// before the connection is established, DialContext fails and no
+// connection is left open. The context doesn't affect the client after
+// that.
+func DialContext(ctx context.Context, addr string, eventCh chan<- Event) (*MgmtClient, error) {
+	return DialWithOptions(ctx, addr, eventCh)
+}
+
+// DialWithOptions is DialContext which configures the client with
+// the given options, as NewMgmtClientWithOptions. The handshake check
+// of Dial can be overridden with WithHandshakeCheck, zero timeout
+// disables it. The context applies to the check as well.
+func DialWithOptions(ctx context.Context, addr string, eventCh chan<- Event, opts ...Option) (*MgmtClient, error) {
+	network := guessNetwork(addr)
+	if network == "unix" && strings.HasPrefix(addr, "\x00") {
+		// net.Dial expects abstract socket address starting with '@'
+		addr = "@" + addr[1:]
+	}
+	return dialContext(ctx, &net.Dialer{}, network, addr, eventCh, opts...)
+}
+
+// DialNetwork is Dial which connects to the given network, any one
+// net.Dial accepts (e.g. "tcp4", "unix", "unixpacket") or "pipe" for
+// Windows named pipe, instead of guessing it from the address.
+func DialNetwork(network, addr string, eventCh chan<- Event) (*MgmtClient, error) {
+	return DialWith(nil, network, addr, eventCh)
+}
+
+// guessNetwork returns the network of the address of Dial
+func guessNetwork(addr string) string {
+	switch {
+	case isNamedPipe(addr):
+		return namedPipeNetwork
+	case strings.HasPrefix(addr, "@"), strings.HasPrefix(addr, "\x00"):
+		// abstract socket
+		return "unix"
+	case strings.HasPrefix(addr, "["), !strings.Contains(addr, "/"):
+		return "tcp"
+	}
+	return "unix"
+}
+
+// DialWith is Dial which connects with the given dialer, e.g. to bind
+// the local address or to set the timeout and keep-alive. The network is
+// any one net.Dial accepts, unlike Dial it isn't guessed from the address.
+// A nil dialer is the zero net.Dialer.
+func DialWith(dialer *net.Dialer, network, addr string, eventCh chan<- Event) (*MgmtClient, error) {
+	if dialer == nil {
+		dialer = &net.Dialer{}
+	}
+	return dialContext(context.Background(), dialer, network, addr, eventCh)
+}
+
+func dialContext(ctx context.Context, dialer *net.Dialer, network, addr string, eventCh chan<- Event, opts ...Option) (*MgmtClient, error) {
+	var conn net.Conn
+	var err error
+	if network == namedPipeNetwork {
+		conn, err = dialPipe(ctx, addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, network, addr)
 	}
-	conn, err := net.Dial(proto, addr)
 	if err != nil {
 		return nil, err
 	}
+	// canceled right after the connection is established, nobody is
+	// going to close it
+	if err := ctx.Err(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return newDialedClient(ctx, conn, eventCh, opts...)
+}
 
-	return NewMgmtClient(conn, eventCh), nil
+// newDialedClient creates the client which owns the connection, and checks
+// the handshake with DefaultHandshakeTimeout, unless it's overridden
+func newDialedClient(ctx context.Context, conn io.ReadWriter, eventCh chan<- Event, opts ...Option) (*MgmtClient, error) {
+	opts = append([]Option{withOwnedConn(), WithHandshakeCheck(DefaultHandshakeTimeout)}, opts...)
+	c := NewMgmtClientWithOptions(conn, eventCh, opts...)
+	if err := c.awaitHandshake(ctx); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
 }
 
 // HoldRelease instructs OpenVPN to release any management hold preventing
@@ -272,21 +1091,20 @@ func (c *MgmtClient) SendSignal(name string) error {
 // initial state after calling SetStateEvents(true) but before the first
 // state event is delivered.
 func (c *MgmtClient) LatestState() (*StateEvent, error) {
-	err := c.sendCommand("state")
-	if err != nil {
-		return nil, err
-	}
-
-	payload, err := c.readCommandResponsePayload()
+	payload, err := c.payloadCommand("state")
 	if err != nil {
 		return nil, err
 	}
 
 	if len(payload) != 1 {
-		return nil, fmt.Errorf("Malformed OpenVPN 'state' response")
+		return nil, commandError("state", newCategoryError(ErrMalformedReply, "Malformed OpenVPN 'state' response", nil))
 	}
 
 	s, err := NewStateEvent(payload[0])
+	if err != nil && c.opts.strictParsing {
+		return nil, commandError("state", err)
+	}
+	s.receivedAt = receivedAt{time.Now()}
 	return &s, err
 }
 
@@ -298,22 +1116,118 @@ func (c *MgmtClient) Pid() (int, error) {
 	}
 
 	if !strings.HasPrefix(raw, "pid=") {
-		return 0, fmt.Errorf("malformed response from OpenVPN")
+		return 0, commandError("pid", newCategoryError(ErrMalformedReply, "malformed response from OpenVPN", nil))
 	}
 
 	pid, err := strconv.Atoi(raw[4:])
 	if err != nil {
-		return 0, fmt.Errorf("error parsing pid from OpenVPN: %s", err)
+		return 0, commandError("pid", newCategoryError(ErrMalformedReply, "error parsing pid from OpenVPN", err))
 	}
 
 	return pid, nil
 }
 
+// acquireCommand waits for the turn of WithCommandRateLimit, then until
+// no other command is in flight, or the context is done. releaseCommand
+// must be called once the reply is read. Every command must hold it,
+// see sendCommand.
+func (c *MgmtClient) acquireCommand(ctx context.Context) error {
+	if err := c.terminatedError(); err != nil {
+		return err
+	}
+	if err := c.waitRateLimit(ctx); err != nil {
+		return err
+	}
+	select {
+	case c.cmdSem <- struct{}{}:
+		// the command in flight could be cut short
+		if err := c.terminatedError(); err != nil {
+			<-c.cmdSem
+			return err
+		}
+		return nil
+	case <-c.closed:
+		return ErrClientClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *MgmtClient) releaseCommand() {
+	<-c.cmdSem
+}
+
+// sendCommand writes the command, the caller must hold it with
+// acquireCommand up to the end of the reply. Secrets are redacted from
+// the command shown by the protocol tap, see redactCommand.
 func (c *MgmtClient) sendCommand(cmd string) error {
-	_, err := c.wr.Write([]byte(cmd + newlineSep))
+	return c.sendSecret(cmd, redactCommand(cmd))
+}
+
+// sendSecret is sendCommand of the line, which is shown as redacted
+// by the protocol tap, unless it's unsafe
+func (c *MgmtClient) sendSecret(cmd, redacted string) error {
+	if err := c.terminatedError(); err != nil {
+		return err
+	}
+	if c.tap != nil {
+		if c.tap.unsafe {
+			c.tap.add(">", cmd)
+		} else {
+			c.tap.add(">", redacted)
+		}
+	}
+	n, err := c.wr.Write([]byte(cmd + newlineSep))
+	// commands are sent one at a time
+	c.cmdStats.begin()
+	if err == nil {
+		c.cmdStats.add(statCommands, 1)
+	}
+	c.cmdStats.add(statBytesWritten, uint64(n))
+	c.cmdStats.end()
+	if err != nil {
+		if termErr := c.terminatedError(); termErr != nil {
+			return termErr
+		}
+	}
 	return err
 }
 
+// readReply returns the next reply line, ok is false once the connection
+// or the client is closed
+func (c *MgmtClient) readReply() (string, bool) {
+	select {
+	case line, ok := <-c.rawReplyCh:
+		return line, ok
+	case <-c.closed:
+		return "", false
+	case <-c.aborted:
+		return "", false
+	}
+}
+
+// terminatedError returns ErrClientClosed if the client is closed,
+// ClientClosedError if it's terminated due to the connection error,
+// and nil while it's running
+func (c *MgmtClient) terminatedError() error {
+	if c.isClosed() {
+		return ErrClientClosed
+	}
+	if err := c.terminalErr(); err != nil {
+		return &ClientClosedError{err}
+	}
+	return nil
+}
+
+// closedError returns the error of the reply cut short, which is
+// terminatedError if the client is terminated by now
+func (c *MgmtClient) closedError(msg string) error {
+	if err := c.terminatedError(); err != nil {
+		return err
+	}
+	return newCategoryError(ErrClosed, msg, nil)
+}
+
 // sendMultilineCommand can be called for commands that expect
 // a multi-line input payload.
 // func (c *MgmtClient) sendMultilineCommand(payload []string) error {
@@ -327,34 +1241,39 @@ func (c *MgmtClient) sendCommand(cmd string) error {
 // 	return err
 // }
 
+// readCommandResult reads the SUCCESS or ERROR result of the command,
+// the other lines received before it are stray
 func (c *MgmtClient) readCommandResult() (string, error) {
-	reply, ok := <-c.rawReplyCh
-	if !ok {
-		return "", fmt.Errorf("connection closed while awaiting result")
-	}
+	for {
+		reply, ok := c.readReply()
+		if !ok {
+			return "", c.closedError("connection closed while awaiting result")
+		}
 
-	if strings.HasPrefix(reply, successPrefix) {
-		result := reply[len(successPrefix):]
-		return result, nil
-	}
+		if strings.HasPrefix(reply, successPrefix) {
+			result := reply[len(successPrefix):]
+			return result, nil
+		}
 
-	if strings.HasPrefix(reply, errorPrefix) {
-		message := reply[len(errorPrefix):]
-		return "", NewOVpnError(message)
-	}
+		if strings.HasPrefix(reply, errorPrefix) {
+			message := reply[len(errorPrefix):]
+			return "", newDaemonError(message)
+		}
 
-	return "", fmt.Errorf("malformed result message")
+		// it can't be the result, which is the single line
+		c.strayReply(reply)
+	}
 }
 
 func (c *MgmtClient) readCommandResponsePayload() ([]string, error) {
-	lines := make([]string, 0, bigMessageLines)
+	lines := make([]string, 0, c.opts.messagePrealloc)
 
 	for {
-		line, ok := <-c.rawReplyCh
+		line, ok := c.readReply()
 		if !ok {
 			// We'll give the caller whatever we got before the connection
 			// closed, in case it's useful for debugging.
-			return lines, fmt.Errorf("connection closed before END recieved")
+			return lines, c.closedError("connection closed before END recieved")
 		}
 
 		if line == endMessage {
@@ -367,10 +1286,48 @@ func (c *MgmtClient) readCommandResponsePayload() ([]string, error) {
 	return lines, nil
 }
 
+// simpleCommand issues the command, the reply of which is a single
+// SUCCESS or ERROR line. The error is CommandError.
 func (c *MgmtClient) simpleCommand(cmd string) (string, error) {
+	start := time.Now()
+	result, err := c.issueSimpleCommand(cmd)
+	err = commandError(cmd, err)
+	c.commandDone(cmd, err, start)
+	return result, err
+}
+
+func (c *MgmtClient) issueSimpleCommand(cmd string) (string, error) {
+	if err := c.acquireCommand(context.Background()); err != nil {
+		return "", err
+	}
+	defer c.releaseCommand()
+
 	err := c.sendCommand(cmd)
 	if err != nil {
 		return "", err
 	}
 	return c.readCommandResult()
 }
+
+// payloadCommand issues the command, the reply of which is the lines
+// up to END. The error is CommandError.
+func (c *MgmtClient) payloadCommand(cmd string) ([]string, error) {
+	start := time.Now()
+	payload, err := c.issuePayloadCommand(cmd)
+	err = commandError(cmd, err)
+	c.commandDone(cmd, err, start)
+	return payload, err
+}
+
+func (c *MgmtClient) issuePayloadCommand(cmd string) ([]string, error) {
+	if err := c.acquireCommand(context.Background()); err != nil {
+		return nil, err
+	}
+	defer c.releaseCommand()
+
+	err := c.sendCommand(cmd)
+	if err != nil {
+		return nil, err
+	}
+	return c.readCommandResponsePayload()
+}
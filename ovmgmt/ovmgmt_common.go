@@ -4,20 +4,53 @@ import (
 	"errors"
 	"net"
 	"strconv"
+	"strings"
 )
 
+// OVpnError is the error of the client, or the ERROR reply of the daemon,
+// which text is returned by Error as is, classified by Kind.
 type OVpnError struct {
 	msg string
+	// the category matched with errors.Is, nil if none
+	category *OVpnError
+	// the wrapped cause, nil if none
+	err error
+	// the class of the daemon ERROR reply
+	kind ErrorKind
 }
 
 func (e *OVpnError) Error() string {
+	if e.err != nil {
+		return e.msg + ": " + e.err.Error()
+	}
 	return e.msg
 }
 
+func (e *OVpnError) Unwrap() error {
+	return e.err
+}
+
+// Is reports whether target is the category of the error, e.g. ErrClosed
+// or ErrTimeout, or the category of the category.
+func (e *OVpnError) Is(target error) bool {
+	for k := e.category; k != nil; k = k.category {
+		if target == error(k) {
+			return true
+		}
+	}
+	return false
+}
+
 func NewOVpnError(m string) *OVpnError {
 	return &OVpnError{msg: m}
 }
 
+// newCategoryError returns the error of the category, wrapping err if it's
+// not nil
+func newCategoryError(category *OVpnError, m string, err error) *OVpnError {
+	return &OVpnError{msg: m, category: category, err: err}
+}
+
 type IPAddrPort struct {
 	IP   net.IP
 	Port int
@@ -42,7 +75,25 @@ func ParseIPAddrPort(s string) (*IPAddrPort, error) {
 	return &IPAddrPort{ip, port}, err
 }
 
+// parseRealAddr parses the real address of a status line. OpenVPN prints
+// native IPv6 addresses without the port, "v6addr:port" being ambiguous,
+// the port is 0 then.
+func parseRealAddr(s string) (*IPAddrPort, error) {
+	if strings.Count(s, ":") > 1 && !strings.HasPrefix(s, "[") {
+		ip, err := ParseIPAddr(s)
+		if err != nil {
+			return nil, err
+		}
+		return &IPAddrPort{ip, 0}, nil
+	}
+	return ParseIPAddrPort(s)
+}
+
+// String returns host:port, or the bare address if the port is unknown.
 func (ia *IPAddrPort) String() string {
+	if ia.Port == 0 {
+		return ia.IP.String()
+	}
 	return net.JoinHostPort(ia.IP.String(), strconv.Itoa(ia.Port))
 }
 
@@ -54,6 +105,75 @@ func ParseIPAddr(s string) (net.IP, error) {
 	return ip, nil
 }
 
+// ParseIPNet parses a host address or a subnet in one of the forms used
+// by OpenVPN: 1.2.3.4, 1.2.3.0/255.255.255.0, 1.2.3.0/24, 2001:db8::1
+// or 2001:db8::/64. Host addresses get the full-length mask.
+func ParseIPNet(s string) (*net.IPNet, error) {
+	slashIdx := strings.IndexByte(s, '/')
+	if slashIdx == -1 {
+		ip, err := ParseIPAddr(s)
+		if err != nil {
+			return nil, err
+		}
+		if ip4 := ip.To4(); ip4 != nil {
+			return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}, nil
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+	}
+
+	ip, err := ParseIPAddr(s[:slashIdx])
+	if err != nil {
+		return nil, err
+	}
+	maskStr := s[slashIdx+1:]
+
+	if bits, err := strconv.Atoi(maskStr); err == nil {
+		_, ipNet, err := net.ParseCIDR(ip.String() + "/" + strconv.Itoa(bits))
+		return ipNet, err
+	}
+
+	// 1.2.3.0/255.255.255.0 form
+	maskIP := net.ParseIP(maskStr).To4()
+	ip4 := ip.To4()
+	if maskIP == nil || ip4 == nil {
+		return nil, errors.New("can't parse subnet mask from " + s)
+	}
+	mask := net.IPMask(maskIP)
+	if ones, bits := mask.Size(); ones == 0 && bits == 0 {
+		return nil, errors.New("non-canonical subnet mask in " + s)
+	}
+	return &net.IPNet{IP: ip4.Mask(mask), Mask: mask}, nil
+}
+
+// virtualAddrCachedSuffix marks learned (cached) addresses in the Virtual
+// Address column of status output, e.g. 10.8.0.6C
+const virtualAddrCachedSuffix = "C"
+
+// ParseVirtualAddr parses the Virtual Address column of status output,
+// which is a host address, a subnet of an iroute, or either of them with
+// the C suffix of a cached address. cached reports whether the suffix
+// was present.
+func ParseVirtualAddr(s string) (ipNet *net.IPNet, cached bool, err error) {
+	ipNet, err = ParseIPNet(s)
+	if err == nil {
+		return ipNet, false, nil
+	}
+	if !strings.HasSuffix(s, virtualAddrCachedSuffix) {
+		return nil, false, err
+	}
+	ipNet, err = ParseIPNet(strings.TrimSuffix(s, virtualAddrCachedSuffix))
+	if err != nil {
+		return nil, false, err
+	}
+	return ipNet, true, nil
+}
+
+// isHostIPNet reports whether n has the full-length mask
+func isHostIPNet(n *net.IPNet) bool {
+	ones, bits := n.Mask.Size()
+	return bits > 0 && ones == bits
+}
+
 func SafeParseIP4Addr(s string) net.IP {
 	ip := net.ParseIP(s)
 	if ip == nil {
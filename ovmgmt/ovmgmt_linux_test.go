@@ -0,0 +1,105 @@
+//go:build linux
+// +build linux
+
+package ovmgmt
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// stalledListener returns the address of a TCP listener which never accepts
+// and which accept queue is full, so connecting to it hangs
+func stalledListener(t *testing.T) (addr string, cleanup func()) {
+	t.Helper()
+	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var conns []net.Conn
+	cleanup = func() {
+		for _, conn := range conns {
+			conn.Close()
+		}
+		syscall.Close(fd)
+	}
+	if err := syscall.Bind(fd, &syscall.SockaddrInet4{Addr: [4]byte{127, 0, 0, 1}}); err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	if err := syscall.Listen(fd, 0); err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	sa, err := syscall.Getsockname(fd)
+	if err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	addr = fmt.Sprintf("127.0.0.1:%d", sa.(*syscall.SockaddrInet4).Port)
+
+	// fill the accept queue
+	for i := 0; i < 10; i++ {
+		conn, err := net.DialTimeout("tcp", addr, 100*time.Millisecond)
+		if err != nil {
+			return addr, cleanup
+		}
+		conns = append(conns, conn)
+	}
+	cleanup()
+	t.Skip("can't fill the accept queue")
+	return "", nil
+}
+
+func TestDialContextCanceled(t *testing.T) {
+	addr, cleanup := stalledListener(t)
+	defer cleanup()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	c, err := DialContext(ctx, addr, make(chan Event))
+	if err == nil {
+		c.Close()
+		t.Fatalf("DialContext returned no error")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("DialContext returned after %s", elapsed)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := DialContext(ctx, addr, make(chan Event)); err == nil {
+		t.Fatalf("DialContext returned no error")
+	} else if ne, ok := err.(net.Error); !ok || !ne.Timeout() {
+		t.Errorf("DialContext returned %v; want timeout", err)
+	}
+}
+
+func TestDialAbstractSocket(t *testing.T) {
+	name := fmt.Sprintf("ovmgmt-test-%d", os.Getpid())
+	l, err := net.Listen("unix", "@"+name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go servePid(l)
+
+	for _, addr := range []string{"@" + name, "\x00" + name} {
+		eventCh := make(chan Event, 10)
+		c, err := Dial(addr, eventCh)
+		if err != nil {
+			t.Errorf("Dial of %q returned %v", addr, err)
+			continue
+		}
+		if pid, err := c.Pid(); err != nil || pid != 42 {
+			t.Errorf("Pid over %q returned %d, %v; want 42", addr, pid, err)
+		}
+		c.Close()
+	}
+}
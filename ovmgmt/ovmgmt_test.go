@@ -0,0 +1,1276 @@
+package ovmgmt
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type mockConn struct {
+	io.Reader
+	io.Writer
+}
+
+// replayEvents feeds raw protocol lines to a new MgmtClient and returns
+// all events it emits until the event channel is closed, except for
+// the FatalEvent of the end of the lines.
+func replayEvents(lines []string, opts ...Option) []Event {
+	eventCh := make(chan Event, len(lines)+1)
+	NewMgmtClientWithOptions(mockConn{mockReader(lines), ioutil.Discard}, eventCh, opts...)
+
+	events := make([]Event, 0, len(lines))
+	for evt := range eventCh {
+		events = append(events, evt)
+	}
+	if n := len(events); n > 0 {
+		if fatal, ok := events[n-1].(FatalEvent); ok && fatal.Err() == io.EOF {
+			events = events[:n-1]
+		}
+	}
+	return events
+}
+
+func TestEventReceivedAt(t *testing.T) {
+	lines := []string{
+		">INFO:OpenVPN Management Interface Version 1 -- type 'help' for more info",
+		">HOLD:Waiting for hold release",
+		">LOG:bad,I,msg",
+		">CLIENT:ESTABLISHED,1",
+		">CLIENT:ENV,common_name=alice",
+		">CLIENT:ENV,END",
+		">BYTECOUNT_CLI:1,100,200",
+		">STATE:1584536294,CONNECTED,SUCCESS,10.8.0.6,192.168.4.1",
+		">UNKNOWN_KW:foo",
+		">garbage",
+	}
+	for i := 0; i < 100; i++ {
+		lines = append(lines, ">BYTECOUNT:1,2")
+	}
+
+	before := time.Now()
+	events := replayEvents(lines)
+	after := time.Now()
+
+	if len(events) != 108 {
+		t.Fatalf("got %d events; want 108", len(events))
+	}
+
+	var prev time.Time
+	for i, evt := range events {
+		re, ok := evt.(ReceivedEvent)
+		if !ok {
+			t.Errorf("event %d %T does not implement ReceivedEvent", i, evt)
+			continue
+		}
+		at := re.ReceivedAt()
+		if at.Before(before) || at.After(after) {
+			t.Errorf("event %d ReceivedAt returned %s; want between %s and %s", i, at, before, after)
+		}
+		if at.Before(prev) {
+			t.Errorf("event %d ReceivedAt returned %s; want not before %s", i, at, prev)
+		}
+		prev = at
+
+		if inv, ok := evt.(InvalidEvent); ok {
+			if got := inv.Origin().(ReceivedEvent).ReceivedAt(); !got.Equal(at) {
+				t.Errorf("event %d origin ReceivedAt returned %s; want %s", i, got, at)
+			}
+		}
+	}
+}
+
+func TestEventReceivedAtQueued(t *testing.T) {
+	defer checkGoroutineLeaks(t)()
+
+	daemonConn, clientConn := net.Pipe()
+	eventCh := make(chan Event)
+	c := NewMgmtClient(clientConn, eventCh)
+	defer c.Close()
+	written := make(chan time.Time, 1)
+	go func() {
+		io.WriteString(daemonConn, ">LOG:1584536294,I,1\n>LOG:1584536294,I,2\n")
+		written <- time.Now()
+		daemonConn.Close()
+	}()
+
+	// the second line waits in the channel of the demultiplexer, while
+	// the first event isn't read
+	at := <-written
+	time.Sleep(200 * time.Millisecond)
+	nextEventOf(t, eventCh)
+	evt := nextEventOf(t, eventCh).(LogEvent)
+	if got := evt.ReceivedAt(); got.Sub(at) > 100*time.Millisecond {
+		t.Errorf("ReceivedAt returned %s; want the time the line is read, about %s", got, at)
+	}
+	for range eventCh {
+	}
+}
+
+func TestMultilineEventTimeout(t *testing.T) {
+	r, w := io.Pipe()
+	eventCh := make(chan Event, 10)
+	c := NewMgmtClient(mockConn{r, ioutil.Discard}, eventCh)
+	c.SetMultilineEventTimeout(200 * time.Millisecond)
+
+	writeLines := func(lines ...string) {
+		for _, line := range lines {
+			if _, err := io.WriteString(w, line+"\n"); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	nextEvent := func() Event {
+		select {
+		case evt := <-eventCh:
+			return evt
+		case <-time.After(5 * time.Second):
+			t.Fatal("no event received")
+			return nil
+		}
+	}
+
+	// stalled daemon never sends ENV,END
+	start := time.Now()
+	writeLines(
+		">CLIENT:CONNECT,5,1",
+		">CLIENT:ENV,common_name=alice",
+	)
+	evt := nextEvent()
+	if d := time.Since(start); d < 200*time.Millisecond {
+		t.Errorf("event received after %s; want at least 200ms", d)
+	}
+	inv, ok := evt.(InvalidEvent)
+	if !ok {
+		t.Fatalf("got %T; want InvalidEvent", evt)
+	}
+	if inv.FirstError() != ErrMultilineEventTimeout {
+		t.Errorf("FirstError returned %v; want %v", inv.FirstError(), ErrMultilineEventTimeout)
+	}
+	if ce, ok := inv.Origin().(ClientEvent); !ok || ce.Complete() || ce.RawEnv("common_name") != "alice" {
+		t.Errorf("origin got %#v; want incomplete ClientEvent", inv.Origin())
+	}
+
+	// processing resumes
+	writeLines(
+		">BYTECOUNT_CLI:5,100,200",
+		">CLIENT:ESTABLISHED,6",
+	)
+	if evt := nextEvent(); evt.(KeywordedEvent).Keyword() != byteCountCliEventKW {
+		t.Errorf("got %s; want BYTECOUNT_CLI event", evt)
+	}
+	// slow, but in time
+	time.Sleep(20 * time.Millisecond)
+	writeLines(">CLIENT:ENV,common_name=bob")
+	time.Sleep(20 * time.Millisecond)
+	writeLines(">CLIENT:ENV,END")
+	if ce, ok := nextEvent().(ClientEvent); !ok || ce.ClientId() != 6 || !ce.Complete() {
+		t.Errorf("got %#v; want complete ClientEvent", ce)
+	}
+
+	// disabled timeout
+	c.SetMultilineEventTimeout(0)
+	writeLines(">CLIENT:ESTABLISHED,7")
+	select {
+	case evt := <-eventCh:
+		t.Errorf("got unexpected %s", evt)
+	case <-time.After(100 * time.Millisecond):
+	}
+	writeLines(">CLIENT:ENV,END")
+	if ce, ok := nextEvent().(ClientEvent); !ok || ce.ClientId() != 7 {
+		t.Errorf("got %#v; want ClientEvent", ce)
+	}
+
+	w.Close()
+	if fatal, ok := (<-eventCh).(FatalEvent); !ok || fatal.Err() != io.EOF {
+		t.Errorf("got %#v; want FatalEvent of EOF", fatal)
+	}
+	if _, ok := <-eventCh; ok {
+		t.Errorf("event channel is not closed")
+	}
+}
+
+func TestMaxEventSize(t *testing.T) {
+	checkTooLarge := func(evt Event, wantEnvs int) {
+		t.Helper()
+		inv, ok := evt.(InvalidEvent)
+		if !ok {
+			t.Fatalf("got %T; want InvalidEvent", evt)
+		}
+		if inv.FirstError() != ErrEventTooLarge {
+			t.Errorf("FirstError returned %v; want %v", inv.FirstError(), ErrEventTooLarge)
+		}
+		ce, ok := inv.Origin().(ClientEvent)
+		if !ok {
+			t.Fatalf("origin got %T; want ClientEvent", inv.Origin())
+		}
+		if ce.Complete() || ce.ClientId() != 5 || len(ce.EnvKeys()) != wantEnvs {
+			t.Errorf("origin got cid %d, %d envs, complete %t; want cid 5, %d envs, incomplete",
+				ce.ClientId(), len(ce.EnvKeys()), ce.Complete(), wantEnvs)
+		}
+	}
+
+	// endless env block
+	lines := make([]string, 0, 100004)
+	lines = append(lines, ">CLIENT:CONNECT,5,1")
+	for i := 0; i < 100000; i++ {
+		lines = append(lines, fmt.Sprintf(">CLIENT:ENV,var_%d=%d", i, i))
+	}
+	lines = append(lines,
+		">CLIENT:ENV,END",
+		">CLIENT:ESTABLISHED,6",
+		">CLIENT:ENV,END",
+	)
+
+	events := replayEvents(lines)
+	if len(events) != 2 {
+		t.Fatalf("got %d events; want 2", len(events))
+	}
+	checkTooLarge(events[0], DefaultMaxEventLines-1)
+	if ce, ok := events[1].(ClientEvent); !ok || ce.ClientId() != 6 || !ce.Complete() {
+		t.Errorf("event 1 got %s; want complete ClientEvent", events[1])
+	}
+
+	// interleaved single-line events are not dropped
+	lines = []string{
+		">CLIENT:CONNECT,5,1",
+		">CLIENT:ENV,common_name=alice",
+		">CLIENT:ENV,username=alice",
+		">BYTECOUNT_CLI:4,100,200",
+		">CLIENT:ENV,untrusted_ip=198.51.100.7",
+		">CLIENT:ENV,END",
+	}
+	events = replayEvents(lines, WithMaxEventSize(2, 0))
+	if len(events) != 2 {
+		t.Fatalf("got %d events; want 2: %v", len(events), events)
+	}
+	checkTooLarge(events[0], 1)
+	if _, ok := events[1].(ByteCountClientEvent); !ok {
+		t.Errorf("event 1 got %T; want ByteCountClientEvent", events[1])
+	}
+
+	// size limit
+	events = replayEvents(lines, WithMaxEventSize(0, len("CONNECT,5,1ENV,common_name=alice")))
+	if len(events) != 2 {
+		t.Fatalf("got %d events; want 2: %v", len(events), events)
+	}
+	checkTooLarge(events[0], 1)
+
+	// no limits
+	events = replayEvents(lines, WithMaxEventSize(0, 0))
+	if len(events) != 2 {
+		t.Fatalf("got %d events; want 2: %v", len(events), events)
+	}
+	if ce, ok := events[1].(ClientEvent); !ok || len(ce.EnvKeys()) != 3 {
+		t.Errorf("event 1 got %s; want ClientEvent with 3 envs", events[1])
+	}
+}
+
+func TestStrictParsingEvents(t *testing.T) {
+	type TestCase struct {
+		Input []string
+	}
+
+	testCases := []TestCase{
+		{[]string{">STATE:now,CONNECTED,SUCCESS,10.8.0.6,192.168.4.1"}},
+		{[]string{">garbage"}},
+		{[]string{">CLIENT:CONNECT,5,1", ">CLIENT:ENV,common_name=alice"}},
+		{[]string{">CLIENT:FOO,5", ">CLIENT:ENV,END"}},
+	}
+
+	for i, testCase := range testCases {
+		lines := []string{">INFO:OpenVPN Management Interface Version 1"}
+		lines = append(lines, testCase.Input...)
+		if len(testCase.Input) == 1 {
+			// nothing after truncated event
+			lines = append(lines, ">BYTECOUNT:1,2")
+		}
+
+		events := replayEvents(lines)
+		if len(events) < 2 || !isParsingFailure(events[1]) {
+			t.Errorf("test %d lenient mode got %v; want parsing failure as event 1", i, events)
+		}
+
+		events = replayEvents(lines, WithStrictParsing())
+		if len(events) != 2 {
+			t.Errorf("test %d strict mode got %d events; want 2: %v", i, len(events), events)
+			continue
+		}
+		fatal, ok := events[1].(FatalEvent)
+		if !ok || !strings.HasPrefix(fatal.Err().Error(), strictParsingFatalPrefix) || fatal.ReceivedAt().IsZero() {
+			t.Errorf("test %d strict mode event 1 got %s; want FATAL", i, events[1])
+		}
+	}
+}
+
+func TestStrictParsingCommands(t *testing.T) {
+	stateReply := []string{"now,CONNECTED,SUCCESS,10.8.0.6,192.168.4.1", "END"}
+	status3Reply := []string{
+		"TITLE\tOpenVPN 2.4.8 x86_64-pc-linux-gnu",
+		"TIME\tMon Mar 23 17:53:22 2020\t1584986002",
+		"CLIENT_LIST\talice\t198.51.100.7:52331\t10.8.0.6\t\tlots\t7391\tMon Mar 23 17:51:49 2020\t1584985909\tUNDEF\t5\t0\tAES-256-GCM",
+		"END",
+	}
+
+	newClient := func(reply []string, opts ...Option) *MgmtClient {
+		eventCh := make(chan Event, 1)
+		return NewMgmtClientWithOptions(mockConn{mockReader(reply), ioutil.Discard}, eventCh, opts...)
+	}
+
+	// lenient
+	if s, err := newClient(stateReply).LatestState(); err == nil || s == nil || s.Name() != "CONNECTED" {
+		t.Errorf("LatestState returned %v, %v; want partial result and error", s, err)
+	}
+	s3, err := newClient(status3Reply).LatestStatus3()
+	if err != nil || s3 == nil || len(s3.InvalidClients()) != 1 {
+		t.Errorf("LatestStatus3 returned %v, %v; want result with invalid client", s3, err)
+	}
+
+	// strict
+	if s, err := newClient(stateReply, WithStrictParsing()).LatestState(); err == nil || s != nil {
+		t.Errorf("LatestState returned %v, %v; want error only", s, err)
+	}
+	if s3, err := newClient(status3Reply, WithStrictParsing()).LatestStatus3(); err == nil || s3 != nil {
+		t.Errorf("LatestStatus3 returned %v, %v; want error only", s3, err)
+	}
+}
+
+// checkGoroutineLeaks returns the function which fails the test if there
+// are more goroutines than at the time of the call, after a grace period
+func checkGoroutineLeaks(t *testing.T) func() {
+	t.Helper()
+	before := runtime.NumGoroutine()
+	return func() {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for runtime.NumGoroutine() > before {
+			if time.Now().After(deadline) {
+				buf := make([]byte, 1<<20)
+				t.Errorf("%d goroutines leaked:\n%s", runtime.NumGoroutine()-before, buf[:runtime.Stack(buf, true)])
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
+
+// testGreeting is the first line OpenVPN sends to the management client
+const testGreeting = ">INFO:OpenVPN Management Interface Version 5 -- type 'help' for more info"
+
+// greetingDaemon is fakeDaemon which greets the client first, as OpenVPN
+// does, for the handshake check of Dial
+func greetingDaemon(conn net.Conn, reply func(cmd string) []string) {
+	if _, err := io.WriteString(conn, testGreeting+"\n"); err != nil {
+		return
+	}
+	fakeDaemon(conn, reply)
+}
+
+// fakeDaemon serves the daemon end of net.Pipe, the commands are passed
+// to reply, nil means no reply. It returns when the connection is closed.
+func fakeDaemon(conn net.Conn, reply func(cmd string) []string) {
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		for _, line := range reply(scanner.Text()) {
+			if _, err := io.WriteString(conn, line+"\n"); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func TestClose(t *testing.T) {
+	defer checkGoroutineLeaks(t)()
+
+	daemonConn, clientConn := net.Pipe()
+	defer daemonConn.Close()
+
+	pending := make(chan string, 2)
+	daemonDone := make(chan struct{})
+	go func() {
+		defer close(daemonDone)
+		fakeDaemon(daemonConn, func(cmd string) []string {
+			switch cmd {
+			case "status 3", "pid":
+				// never replies
+				select {
+				case pending <- cmd:
+				default:
+				}
+				return nil
+			}
+			return []string{"SUCCESS: " + cmd}
+		})
+	}()
+
+	eventCh := make(chan Event, 1)
+	c := NewMgmtClient(clientConn, eventCh)
+	if err := c.HoldRelease(); err != nil {
+		t.Fatalf("HoldRelease returned error: %s", err)
+	}
+
+	// the generator is stuck on its first poll
+	c.SetStatus3Events(time.Millisecond)
+	<-pending
+	// queued behind the poll
+	pidErr := make(chan error, 1)
+	go func() {
+		_, err := c.Pid()
+		pidErr <- err
+	}()
+	// the event channel gets full, the events are not read
+	go io.WriteString(daemonConn, ">LOG:1,I,a\n>LOG:2,I,b\n>LOG:3,I,c\n")
+
+	// concurrent calls
+	var wg sync.WaitGroup
+	errs := make([]error, 5)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = c.Close()
+		}(i)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("Close %d returned error: %s", i, err)
+		}
+	}
+
+	if err := <-pidErr; !errors.Is(err, ErrClientClosed) {
+		t.Errorf("in-flight Pid returned %v; want %v", err, ErrClientClosed)
+	}
+	if err := c.HoldRelease(); !errors.Is(err, ErrClientClosed) {
+		t.Errorf("HoldRelease after Close returned %v; want %v", err, ErrClientClosed)
+	}
+	if _, err := c.LatestStatus3(); !errors.Is(err, ErrClientClosed) {
+		t.Errorf("LatestStatus3 after Close returned %v; want %v", err, ErrClientClosed)
+	}
+	if c.SetStatus3Events(time.Millisecond) {
+		t.Errorf("SetStatus3Events enabled the generator after Close")
+	}
+	if err := c.Close(); err != nil {
+		t.Errorf("repeated Close returned error: %s", err)
+	}
+
+	// the channel is closed, possibly after the events sent before Close
+	for evt := range eventCh {
+		if _, ok := evt.(InvalidEvent); ok {
+			t.Errorf("got %s", evt)
+		}
+	}
+	<-daemonDone
+}
+
+func TestCloseNotCloser(t *testing.T) {
+	defer checkGoroutineLeaks(t)()
+
+	r, w := io.Pipe()
+	// the reader runs until the connection is closed by other means
+	defer w.Close()
+	eventCh := make(chan Event)
+	c := NewMgmtClient(mockConn{r, ioutil.Discard}, eventCh)
+
+	go io.WriteString(w, ">LOG:1,I,a\n")
+	if err := c.Close(); err != nil {
+		t.Errorf("Close returned error: %s", err)
+	}
+	for range eventCh {
+	}
+	if err := c.HoldRelease(); !errors.Is(err, ErrClientClosed) {
+		t.Errorf("HoldRelease after Close returned %v; want %v", err, ErrClientClosed)
+	}
+}
+
+func TestCloseAfterEOF(t *testing.T) {
+	defer checkGoroutineLeaks(t)()
+
+	eventCh := make(chan Event, 10)
+	daemonConn, clientConn := net.Pipe()
+	c := NewMgmtClient(clientConn, eventCh)
+	daemonConn.Close()
+	for range eventCh {
+	}
+
+	if err := c.Close(); err != nil {
+		t.Errorf("Close returned error: %s", err)
+	}
+	if err := c.HoldRelease(); !errors.Is(err, ErrClientClosed) {
+		t.Errorf("HoldRelease after Close returned %v; want %v", err, ErrClientClosed)
+	}
+}
+
+// countingWriter counts writes to the underlying writer
+type countingWriter struct {
+	io.Writer
+	n *int64
+}
+
+func (w countingWriter) Write(p []byte) (int, error) {
+	atomic.AddInt64(w.n, 1)
+	return w.Writer.Write(p)
+}
+
+func TestCommandsFailFast(t *testing.T) {
+	defer checkGoroutineLeaks(t)()
+
+	daemonConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+	var writes int64
+	c := NewMgmtClient(mockConn{clientConn, countingWriter{clientConn, &writes}}, make(chan Event, 10))
+	defer c.Close()
+
+	const served = 20
+	var cmds int32
+	go fakeDaemon(daemonConn, func(cmd string) []string {
+		if atomic.AddInt32(&cmds, 1) == served {
+			daemonConn.Close()
+			return nil
+		}
+		return []string{"SUCCESS: pid=1"}
+	})
+
+	// commands during the disconnect, the one in flight and the waiting
+	// ones fail with the cause
+	const workers, calls = 8, 50
+	errs := make(chan error, workers*calls)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < calls; j++ {
+				_, err := c.Pid()
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	var succeeded int
+	for err := range errs {
+		if err == nil {
+			succeeded++
+		} else if !errors.Is(err, ErrClientClosed) || !errors.Is(err, io.EOF) {
+			t.Errorf("Pid returned %v; want ClientClosedError of %v", err, io.EOF)
+		}
+	}
+	if succeeded != served-1 {
+		t.Errorf("%d commands succeeded; want %d", succeeded, served-1)
+	}
+
+	// commands after the disconnect aren't written
+	<-c.Done()
+	before := atomic.LoadInt64(&writes)
+	for i := 0; i < 100; i++ {
+		_, err := c.Pid()
+		var closedErr *ClientClosedError
+		if !errors.As(err, &closedErr) || closedErr.Err != io.EOF {
+			t.Fatalf("Pid after the disconnect returned %v; want ClientClosedError of %v", err, io.EOF)
+		}
+	}
+	if n := atomic.LoadInt64(&writes) - before; n != 0 {
+		t.Errorf("%d commands written after the disconnect", n)
+	}
+	if n := atomic.LoadInt64(&writes); n != served {
+		t.Errorf("%d commands written; want %d", n, served)
+	}
+}
+
+type failingReader struct {
+	err error
+}
+
+func (r failingReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
+
+func TestDoneErr(t *testing.T) {
+	readErr := fmt.Errorf("connection reset by peer")
+
+	type TestCase struct {
+		Reader  io.Reader
+		Opts    []Option
+		WantErr func(error) bool
+	}
+
+	testCases := []TestCase{
+		// EOF
+		{
+			mockReader([]string{">LOG:1,I,a", ">HOLD:Waiting for hold release"}),
+			nil,
+			func(err error) bool { return err == io.EOF },
+		},
+		// mid-stream read error
+		{
+			io.MultiReader(mockReader([]string{">LOG:1,I,a", ">CLIENT:CONNECT,0,1"}), failingReader{readErr}),
+			nil,
+			func(err error) bool { return err == readErr },
+		},
+		{
+			mockReader([]string{">LOG:1,I,a", ">STATE:bad,CONNECTED", ">LOG:2,I,b"}),
+			[]Option{WithStrictParsing()},
+			func(err error) bool { return err != nil && strings.HasPrefix(err.Error(), strictParsingFatalPrefix) },
+		},
+	}
+
+	for i, tc := range testCases {
+		eventCh := make(chan Event, 10)
+		c := NewMgmtClientWithOptions(mockConn{tc.Reader, ioutil.Discard}, eventCh, tc.Opts...)
+		select {
+		case <-c.Done():
+		case <-time.After(time.Second):
+			t.Fatalf("test %d Done is not closed", i)
+		}
+
+		if err := c.Err(); !tc.WantErr(err) {
+			t.Errorf("test %d Err returned %v", i, err)
+		}
+		// the event channel is closed by then
+		n := len(eventCh)
+		for range eventCh {
+			n--
+		}
+		if n != 0 {
+			t.Errorf("test %d event channel is not closed", i)
+		}
+		// the error is kept after Close
+		if err := c.Close(); err != nil || !tc.WantErr(c.Err()) {
+			t.Errorf("test %d Err after Close returned %v", i, c.Err())
+		}
+	}
+}
+
+func TestStrayReplies(t *testing.T) {
+	defer checkGoroutineLeaks(t)()
+
+	daemonConn, clientConn := net.Pipe()
+	go func() {
+		// the line left unread after the last reply is emitted once
+		// the connection is closed
+		defer daemonConn.Close()
+		scanner := bufio.NewScanner(daemonConn)
+		scanner.Scan()
+		io.WriteString(daemonConn, "garbage 1\n>LOG:1584536294,I,msg\ngarbage 2\nSUCCESS: pid=42\n")
+		scanner.Scan()
+		io.WriteString(daemonConn, "SUCCESS: hold release succeeded\ngarbage 3\n")
+	}()
+	eventCh := make(chan Event, 10)
+	c := NewMgmtClient(clientConn, eventCh)
+
+	if pid, err := c.Pid(); err != nil || pid != 42 {
+		t.Errorf("Pid returned %d, %v; want 42", pid, err)
+	}
+	if err := c.HoldRelease(); err != nil {
+		t.Errorf("HoldRelease returned %v", err)
+	}
+
+	var stray []string
+	logs := 0
+	for evt := range eventCh {
+		switch evt := evt.(type) {
+		case MalformedEvent:
+			if !evt.Stray() {
+				t.Errorf("got %s; want stray reply line", evt)
+			}
+			stray = append(stray, evt.Raw())
+		case LogEvent:
+			logs++
+		case FatalEvent:
+		default:
+			t.Errorf("unexpected event %s", evt)
+		}
+	}
+	sort.Strings(stray)
+	if want := []string{"garbage 1", "garbage 2", "garbage 3"}; !reflect.DeepEqual(stray, want) {
+		t.Errorf("got stray lines %q; want %q", stray, want)
+	}
+	if logs != 1 {
+		t.Errorf("got %d LOG events; want 1", logs)
+	}
+	if stats := c.Stats(); stats.MalformedEvents != 3 {
+		t.Errorf("got %d malformed events; want 3", stats.MalformedEvents)
+	}
+	c.Close()
+}
+
+func TestStrayRepliesStrict(t *testing.T) {
+	eventCh := make(chan Event, 10)
+	c := newReplyingClient(t, eventCh, func(string) []string {
+		return []string{"garbage", "SUCCESS: pid=42"}
+	}, WithStrictParsing())
+	defer c.Close()
+	fatalCh, cancel := c.SubscribeFatal()
+	defer cancel()
+
+	c.Pid()
+	evt, ok := nextEventOf(t, eventCh).(FatalEvent)
+	if !ok || !strings.Contains(evt.Body(), "stray reply line") {
+		t.Errorf("got event %v; want strict parsing FATAL of the stray line", evt)
+	}
+	if _, ok := <-fatalCh; !ok {
+		t.Errorf("the subscription got no FatalEvent")
+	}
+	select {
+	case <-c.Done():
+	case <-time.After(time.Second):
+		t.Fatalf("the client is not terminated")
+	}
+	if err := c.Err(); err == nil || !strings.HasPrefix(err.Error(), strictParsingFatalPrefix) {
+		t.Errorf("Err returned %v; want strict parsing failure", err)
+	}
+}
+
+func TestDoneErrClose(t *testing.T) {
+	defer checkGoroutineLeaks(t)()
+
+	daemonConn, clientConn := net.Pipe()
+	defer daemonConn.Close()
+
+	eventCh := make(chan Event, 10)
+	c := NewMgmtClient(clientConn, eventCh)
+	select {
+	case <-c.Done():
+		t.Fatalf("Done is closed while the client is running")
+	default:
+	}
+	if err := c.Err(); err != nil {
+		t.Errorf("Err of running client returned %v", err)
+	}
+
+	if err := c.Close(); err != nil {
+		t.Fatalf("Close returned error: %s", err)
+	}
+	select {
+	case <-c.Done():
+	default:
+		t.Errorf("Done is not closed after Close")
+	}
+	if err := c.Err(); err != nil {
+		t.Errorf("Err after Close returned %v", err)
+	}
+}
+
+func TestConcurrentCommands(t *testing.T) {
+	defer checkGoroutineLeaks(t)()
+
+	daemonConn, clientConn := net.Pipe()
+	defer daemonConn.Close()
+	go fakeDaemon(daemonConn, func(cmd string) []string {
+		switch {
+		case cmd == "pid":
+			return []string{"SUCCESS: pid=4242"}
+		case cmd == "verb":
+			return []string{"SUCCESS: verb=7"}
+		case cmd == "state":
+			return []string{"1584536294,CONNECTED,SUCCESS,10.8.0.6,192.168.4.1", "END"}
+		case cmd == "status 3":
+			return append(append([]string{}, status3Payload24...), "END")
+		case strings.HasPrefix(cmd, "signal "):
+			return []string{"ERROR: signal " + cmd[len("signal "):] + " is not allowed"}
+		}
+		return []string{"ERROR: unknown command"}
+	})
+
+	eventCh := make(chan Event, 10)
+	c := NewMgmtClient(clientConn, eventCh)
+	c.SetStatus3Events(time.Millisecond)
+	go func() {
+		for range eventCh {
+		}
+	}()
+
+	commands := []func(i int) error{
+		func(int) error {
+			pid, err := c.Pid()
+			if err == nil && pid != 4242 {
+				err = fmt.Errorf("got pid %d", pid)
+			}
+			return err
+		},
+		func(int) error {
+			verb, err := c.VerbosityLevel()
+			if err == nil && verb != 7 {
+				err = fmt.Errorf("got verb %d", verb)
+			}
+			return err
+		},
+		func(int) error {
+			state, err := c.LatestState()
+			if err == nil && state.State() != StateConnected {
+				err = fmt.Errorf("got state %s", state)
+			}
+			return err
+		},
+		func(int) error {
+			se, err := c.LatestStatus3()
+			if err == nil && (len(se.Clients()) != 1 || se.Clients()[0].CommonName != "alice") {
+				err = fmt.Errorf("got status %s", se)
+			}
+			return err
+		},
+		func(i int) error {
+			name := fmt.Sprintf("SIG%d", i)
+			err := c.SendSignal(name)
+			if err == nil || err.Error() != `command "signal": signal "`+name+`" is not allowed` {
+				return fmt.Errorf("got %v", err)
+			}
+			return nil
+		},
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 1000)
+	for g := 0; g < 20; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				n := g*50 + i
+				if err := commands[n%len(commands)](n); err != nil {
+					errs <- fmt.Errorf("command %d: %w", n, err)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	if err := c.Close(); err != nil {
+		t.Errorf("Close returned error: %s", err)
+	}
+}
+
+func TestNoGoroutineLeaks(t *testing.T) {
+	defer checkGoroutineLeaks(t)()
+
+	type TestCase struct {
+		Name string
+		// Run drives the daemon end of the connection; the client end is
+		// owned by the client, as the ones of Dial
+		Run  func(t *testing.T, daemonConn net.Conn, c *MgmtClient)
+		Opts []Option
+	}
+
+	status3Reply := func(cmd string) []string {
+		if cmd == "status 3" {
+			return append(append([]string{}, status3Payload24...), "END")
+		}
+		return nil
+	}
+
+	testCases := []TestCase{
+		{
+			Name: "daemon closes",
+			Run: func(t *testing.T, daemonConn net.Conn, c *MgmtClient) {
+				go fakeDaemon(daemonConn, status3Reply)
+				time.Sleep(5 * time.Millisecond)
+				daemonConn.Close()
+			},
+		},
+		{
+			Name: "daemon closes with command pending",
+			Run: func(t *testing.T, daemonConn net.Conn, c *MgmtClient) {
+				cmdErr := make(chan error, 1)
+				go func() {
+					_, err := c.Pid()
+					cmdErr <- err
+				}()
+				go fakeDaemon(daemonConn, func(cmd string) []string {
+					if cmd == "pid" {
+						daemonConn.Close()
+					}
+					return status3Reply(cmd)
+				})
+				if err := <-cmdErr; err == nil {
+					t.Errorf("Pid returned no error")
+				}
+			},
+		},
+		{
+			Name: "daemon sends garbage",
+			Run: func(t *testing.T, daemonConn net.Conn, c *MgmtClient) {
+				// the client terminates on its own and closes the
+				// connection, the daemon sees EOF
+				go fakeDaemon(daemonConn, status3Reply)
+				io.WriteString(daemonConn, ">STATE:bad,CONNECTED\n")
+			},
+			Opts: []Option{WithStrictParsing()},
+		},
+		{
+			Name: "client closes",
+			Run: func(t *testing.T, daemonConn net.Conn, c *MgmtClient) {
+				go fakeDaemon(daemonConn, status3Reply)
+				time.Sleep(5 * time.Millisecond)
+				c.Close()
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		for i := 0; i < 20; i++ {
+			daemonConn, clientConn := net.Pipe()
+			eventCh := make(chan Event, 10)
+			opts := append([]Option{withOwnedConn()}, tc.Opts...)
+			c := NewMgmtClientWithOptions(clientConn, eventCh, opts...)
+			c.SetStatus3Events(time.Millisecond)
+
+			drained := make(chan struct{})
+			go func() {
+				for range eventCh {
+				}
+				close(drained)
+			}()
+			tc.Run(t, daemonConn, c)
+
+			select {
+			case <-c.Done():
+			case <-time.After(2 * time.Second):
+				t.Fatalf("%s: client is not done", tc.Name)
+			}
+			<-drained
+			<-c.lifecycleDone
+			if err := clientConn.SetDeadline(time.Now()); err != io.ErrClosedPipe {
+				t.Errorf("%s: the connection is not closed: %v", tc.Name, err)
+			}
+			daemonConn.Close()
+		}
+	}
+
+	// read errors of a connection not owned by the client
+	for i := 0; i < 20; i++ {
+		r := io.MultiReader(mockReader([]string{">HOLD:Waiting for hold release"}), failingReader{fmt.Errorf("read error")})
+		eventCh := make(chan Event, 10)
+		c := NewMgmtClient(mockConn{r, ioutil.Discard}, eventCh)
+		c.SetStatus3Events(time.Millisecond)
+		for range eventCh {
+		}
+	}
+}
+
+func TestDialClosesConn(t *testing.T) {
+	defer checkGoroutineLeaks(t)()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		io.WriteString(conn, testGreeting+"\n>HOLD:Waiting for hold release\n")
+		conn.Close()
+	}()
+
+	eventCh := make(chan Event, 10)
+	c, err := Dial(l.Addr().String(), eventCh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var events []Event
+	for evt := range eventCh {
+		events = append(events, evt)
+	}
+	if len(events) != 3 {
+		t.Fatalf("got %d events; want 3: %v", len(events), events)
+	}
+	if fatal, ok := events[2].(FatalEvent); !ok || fatal.Err() != io.EOF {
+		t.Errorf("got %#v; want FatalEvent of EOF", events[2])
+	}
+
+	<-c.lifecycleDone
+	if err := c.conn.(net.Conn).SetDeadline(time.Now()); err == nil {
+		t.Errorf("the connection is not closed")
+	}
+}
+
+func TestDialContextDone(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if c, err := DialContext(ctx, l.Addr().String(), make(chan Event)); err == nil {
+		c.Close()
+		t.Errorf("DialContext with canceled context returned no error")
+	}
+}
+
+func TestDialWith(t *testing.T) {
+	defer checkGoroutineLeaks(t)()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	remoteAddr := make(chan string, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		remoteAddr <- conn.RemoteAddr().String()
+		io.WriteString(conn, testGreeting+"\n")
+		conn.Close()
+	}()
+
+	// a free local port
+	free, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	localAddr := free.Addr().(*net.TCPAddr)
+	free.Close()
+
+	eventCh := make(chan Event, 10)
+	dialer := &net.Dialer{LocalAddr: localAddr, Timeout: time.Second}
+	c, err := DialWith(dialer, "tcp4", l.Addr().String(), eventCh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if got := <-remoteAddr; got != localAddr.String() {
+		t.Errorf("connected from %s; want %s", got, localAddr)
+	}
+
+	// the network isn't guessed from the address
+	if _, err := DialWith(nil, "tcp", "/nonexistent/socket", eventCh); err == nil {
+		t.Errorf("DialWith of tcp to socket path returned no error")
+	} else if oe, ok := err.(*net.OpError); !ok || oe.Net != "tcp" {
+		t.Errorf("DialWith returned %#v; want tcp error", err)
+	}
+}
+
+func TestGuessNetwork(t *testing.T) {
+	type TestCase struct {
+		Addr     string
+		Expected string
+	}
+	testCases := []TestCase{
+		{"127.0.0.1:7505", "tcp"},
+		{"[::1]:7505", "tcp"},
+		{"[fe80::1%eth0]:7505", "tcp"},
+		{"localhost:7505", "tcp"},
+		{"/run/openvpn/mgmt.sock", "unix"},
+		{"./mgmt.sock", "unix"},
+		// no slash, use DialNetwork
+		{"mgmt.sock", "tcp"},
+		{"@openvpn-mgmt", "unix"},
+		{"\x00openvpn-mgmt", "unix"},
+		{"", "tcp"},
+	}
+	for i, tc := range testCases {
+		if got := guessNetwork(tc.Addr); got != tc.Expected {
+			t.Errorf("test %d guessNetwork(%q) returned %q; want %q", i, tc.Addr, got, tc.Expected)
+		}
+	}
+}
+
+// servePid serves the connections of the listener, replying to pid
+func servePid(l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			greetingDaemon(conn, func(cmd string) []string {
+				if cmd == "pid" {
+					return []string{"SUCCESS: pid=42"}
+				}
+				return nil
+			})
+		}()
+	}
+}
+
+func TestDialNetwork(t *testing.T) {
+	type TestCase struct {
+		ListenNet string
+		Listen    string
+		// Dial the address of the listener with DialNetwork, with Dial
+		// unless Network is empty
+		Network  string
+		Relative bool
+	}
+
+	dir, err := ioutil.TempDir("", "ovmgmt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []TestCase{
+		{"tcp4", "127.0.0.1:0", "tcp4", false},
+		{"tcp4", "127.0.0.1:0", "", false},
+		{"tcp6", "[::1]:0", "tcp6", false},
+		{"tcp6", "[::1]:0", "", false},
+		{"unix", filepath.Join(dir, "abs.sock"), "unix", false},
+		{"unix", filepath.Join(dir, "dial.sock"), "", false},
+		{"unix", filepath.Join(dir, "rel.sock"), "unix", true},
+	}
+
+	for i, tc := range testCases {
+		l, err := net.Listen(tc.ListenNet, tc.Listen)
+		if err != nil {
+			if tc.ListenNet == "tcp6" {
+				t.Logf("test %d skipped: %v", i, err)
+				continue
+			}
+			t.Fatal(err)
+		}
+		go servePid(l)
+
+		addr := l.Addr().String()
+		if tc.Relative {
+			if addr, err = filepath.Rel(wd, addr); err != nil {
+				t.Fatal(err)
+			}
+		}
+		eventCh := make(chan Event, 10)
+		var c *MgmtClient
+		if tc.Network != "" {
+			c, err = DialNetwork(tc.Network, addr, eventCh)
+		} else {
+			c, err = Dial(addr, eventCh)
+		}
+		if err != nil {
+			t.Errorf("test %d dial of %s returned %v", i, addr, err)
+			l.Close()
+			continue
+		}
+		if pid, err := c.Pid(); err != nil || pid != 42 {
+			t.Errorf("test %d Pid returned %d, %v; want 42", i, pid, err)
+		}
+		c.Close()
+		l.Close()
+	}
+}
+
+// BenchmarkLogFlood pushes a million LOG lines through the client with
+// the raw channels unbuffered and buffered by default, see
+// WithRawChannelBuffers.
+func BenchmarkLogFlood(b *testing.B) {
+	const n = 1000000
+	var data strings.Builder
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&data, ">LOG:1584536294,I,message %d\n", i)
+	}
+	for _, buffer := range []int{0, DefaultRawChannelBuffer} {
+		buffer := buffer
+		b.Run(fmt.Sprintf("buffer-%d", buffer), func(b *testing.B) {
+			b.SetBytes(int64(data.Len()))
+			b.ReportAllocs()
+			start := time.Now()
+			for i := 0; i < b.N; i++ {
+				eventCh := make(chan Event, 64)
+				NewMgmtClientWithOptions(mockConn{strings.NewReader(data.String()), ioutil.Discard}, eventCh, WithRawChannelBuffers(buffer, buffer))
+				for range eventCh {
+				}
+			}
+			b.ReportMetric(float64(n*b.N)/time.Since(start).Seconds(), "lines/s")
+		})
+	}
+}
+
+func TestCRLF(t *testing.T) {
+	defer checkGoroutineLeaks(t)()
+
+	// the whole transcript is terminated with \r\n
+	crlf := func(lines ...string) []string {
+		for i := range lines {
+			lines[i] += "\r"
+		}
+		return lines
+	}
+	daemonConn, clientConn := net.Pipe()
+	go fakeDaemon(daemonConn, func(cmd string) []string {
+		switch cmd {
+		case "pid":
+			return crlf("SUCCESS: pid=42")
+		case "status 3":
+			return crlf(append(append([]string{}, status3PayloadIroute...), "END")...)
+		case "state":
+			return crlf("1584536294,CONNECTED,SUCCESS,10.8.0.6,1.2.3.4,1194,,", "END")
+		}
+		return crlf("ERROR: unknown command")
+	})
+	eventCh := make(chan Event, 10)
+	c := NewMgmtClient(clientConn, eventCh)
+	defer func() {
+		c.Close()
+		daemonConn.Close()
+		for range eventCh {
+		}
+	}()
+
+	go io.WriteString(daemonConn, strings.Join(crlf(
+		">CLIENT:CONNECT,0,1",
+		">CLIENT:ENV,common_name=alice",
+		">LOG:1584536294,I,interleaved",
+		">CLIENT:ENV,untrusted_ip=1.2.3.4",
+		">CLIENT:ENV,END",
+		">HOLD:Waiting for hold release",
+	), "\n")+"\n")
+	if log, ok := nextEventOf(t, eventCh).(LogEvent); !ok || log.Message() != "interleaved" {
+		t.Errorf("got %#v; want LOG", log)
+	}
+	ce, ok := nextEventOf(t, eventCh).(ClientEvent)
+	if !ok {
+		t.Fatalf("got no ClientEvent")
+	}
+	if cn, ip := ce.RawEnv("common_name"), ce.RawEnv("untrusted_ip"); cn != "alice" || ip != "1.2.3.4" {
+		t.Errorf("ClientEvent has common_name %q, untrusted_ip %q", cn, ip)
+	}
+	if hold, ok := nextEventOf(t, eventCh).(HoldEvent); !ok || hold.Message() != "Waiting for hold release" {
+		t.Errorf("got %#v; want HOLD", hold)
+	}
+
+	if pid, err := c.Pid(); err != nil || pid != 42 {
+		t.Errorf("Pid returned %d, %v; want 42", pid, err)
+	}
+	status, err := c.LatestStatus3()
+	if err != nil {
+		t.Fatalf("LatestStatus3 returned error: %s", err)
+	}
+	if n, invalid := len(status.Clients()), len(status.InvalidClients()); n != 4 || invalid != 0 {
+		t.Errorf("LatestStatus3 returned %d clients, %d invalid; want 4", n, invalid)
+	}
+	if state, err := c.LatestState(); err != nil || !state.IsConnected() {
+		t.Errorf("LatestState returned %v, %v; want CONNECTED", state, err)
+	}
+	var cmdErr *CommandError
+	if _, err := c.simpleCommand("bogus"); !errors.As(err, &cmdErr) || strings.Contains(err.Error(), "\r") || ErrorKindOf(err) != ErrorKindUnsupported {
+		t.Errorf("bogus command returned %q; want unsupported CommandError", err)
+	}
+}
@@ -0,0 +1,162 @@
+package ovmgmt
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// Dynamic challenge/response protocol:
+//
+// When the server wants the client to answer a challenge, the auth failure
+// notification carries a CRV1 blob:
+//
+//     >PASSWORD:Verification Failed: 'Auth' ['CRV1:{flags}:{state_id}:{username_base64}:{challenge_text}']
+//
+// flags --          a comma-separated list of options:
+//                   E -- echo the response when the user types it,
+//                   R -- a response is required.
+// state_id --       an opaque string that should be returned to the server
+//                   along with the response.
+// username_base64 - the username formatted as base64.
+// challenge_text -- the challenge text to be shown to the user, it may
+//                   contain colons.
+
+const crv1Marker = "CRV1" + eventSep
+const crv1Trailer = "']"
+const crv1FlagEcho = "E"
+const crv1FlagResponseRequired = "R"
+
+// >PASSWORD:Auth-Token:{token}
+const authTokenPrefix = "Auth-Token" + eventSep
+
+// redactedValue replaces secrets in String() output
+const redactedValue = "***"
+
+var ErrMalformedChallenge = NewOVpnError("malformed CRV1 dynamic challenge")
+
+// DynamicChallenge is a parsed CRV1 dynamic challenge.
+type DynamicChallenge struct {
+	RawFlags         string
+	Echo             bool
+	ResponseRequired bool
+	StateId          string
+	Username         string
+	Text             string
+}
+
+// ParseDynamicChallenge parses a "CRV1:flags:state_id:b64user:challenge"
+// blob. The error of the malformed one matches ErrMalformedChallenge with
+// errors.Is, the bad base64 of the username included.
+func ParseDynamicChallenge(blob string) (DynamicChallenge, error) {
+	dc := DynamicChallenge{}
+	if !strings.HasPrefix(blob, crv1Marker) {
+		return dc, ErrMalformedChallenge
+	}
+
+	parts := strings.SplitN(blob[len(crv1Marker):], eventSep, 4)
+	if len(parts) != 4 {
+		return dc, ErrMalformedChallenge
+	}
+
+	dc.RawFlags = parts[0]
+	for _, f := range strings.Split(dc.RawFlags, fieldSep) {
+		switch f {
+		case crv1FlagEcho:
+			dc.Echo = true
+		case crv1FlagResponseRequired:
+			dc.ResponseRequired = true
+		}
+	}
+
+	dc.StateId = parts[1]
+	if dc.StateId == "" {
+		return dc, ErrMalformedChallenge
+	}
+	dc.Text = parts[3]
+
+	username, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return dc, fmt.Errorf("%w: %v", ErrMalformedChallenge, err)
+	}
+	dc.Username = string(username)
+
+	return dc, nil
+}
+
+// PasswordEvent is a notification that OpenVPN needs a password or that
+// a previously supplied password was rejected, e.g.:
+//
+//     >PASSWORD:Need 'Auth' username/password
+//     >PASSWORD:Verification Failed: 'Auth'
+//     >PASSWORD:Auth-Token:{token}
+//
+// If the server issued a dynamic challenge, it is parsed and available
+// via Challenge(). If the server pushed a session token, it is available
+// via Token() and is redacted from String() output.
+type PasswordEvent struct {
+	receivedAt
+	body         string
+	challenge    DynamicChallenge
+	hasChallenge bool
+	token        string
+	isAuthToken  bool
+}
+
+func NewPasswordEvent(body string) (PasswordEvent, error) {
+	e := PasswordEvent{body: body}
+
+	if strings.HasPrefix(body, authTokenPrefix) {
+		e.isAuthToken = true
+		e.token = body[len(authTokenPrefix):]
+		return e, nil
+	}
+
+	idx := strings.Index(body, crv1Marker)
+	if idx == -1 {
+		return e, nil
+	}
+
+	e.hasChallenge = true
+	blob := strings.TrimSuffix(body[idx:], crv1Trailer)
+
+	var err error
+	e.challenge, err = ParseDynamicChallenge(blob)
+	return e, err
+}
+
+func (e PasswordEvent) Keyword() string {
+	return passwordEventKW
+}
+
+func (e PasswordEvent) Raw() string {
+	return e.body
+}
+
+func (e PasswordEvent) Body() string {
+	return e.body
+}
+
+// Challenge returns the dynamic challenge sent by the server, if any.
+func (e PasswordEvent) Challenge() (DynamicChallenge, bool) {
+	return e.challenge, e.hasChallenge
+}
+
+// IsAuthToken reports whether the event carries a session token pushed
+// by the server.
+func (e PasswordEvent) IsAuthToken() bool {
+	return e.isAuthToken
+}
+
+// Token returns the session token, or the empty string if the event
+// is not an Auth-Token notification.
+func (e PasswordEvent) Token() string {
+	return e.token
+}
+
+func (e PasswordEvent) String() string {
+	if e.isAuthToken {
+		return Sanitize(fmt.Sprintf("%s: %s%s", passwordEventKW, authTokenPrefix, redactedValue))
+	}
+	return Sanitize(fmt.Sprintf("%s: %s", passwordEventKW, e.body))
+}
@@ -0,0 +1,247 @@
+package ovmgmt
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestPasswordEvent(t *testing.T) {
+	type TestCase struct {
+		Input         string
+		WantErr       bool
+		WantChallenge bool
+		Want          DynamicChallenge
+	}
+	_, b64Err := base64.StdEncoding.DecodeString("!!!")
+	testCases := []TestCase{
+		{
+			Input:         "PASSWORD:Need 'Auth' username/password",
+			WantErr:       false,
+			WantChallenge: false,
+		},
+		{
+			Input:         "PASSWORD:Verification Failed: 'Auth'",
+			WantErr:       false,
+			WantChallenge: false,
+		},
+		{
+			Input:         "PASSWORD:Verification Failed: 'Auth' ['CRV1:R,E:Om01u7Fh4LrGBS7uh0SWmzwabUiGiW6l:Y3Ix:Please enter token PIN']",
+			WantErr:       false,
+			WantChallenge: true,
+			Want: DynamicChallenge{
+				RawFlags:         "R,E",
+				Echo:             true,
+				ResponseRequired: true,
+				StateId:          "Om01u7Fh4LrGBS7uh0SWmzwabUiGiW6l",
+				Username:         "cr1",
+				Text:             "Please enter token PIN",
+			},
+		},
+		{
+			// colons inside the challenge text
+			Input:         "PASSWORD:Verification Failed: 'Auth' ['CRV1:R:abc:Y3Ix:Enter code: 6 digits: now']",
+			WantErr:       false,
+			WantChallenge: true,
+			Want: DynamicChallenge{
+				RawFlags:         "R",
+				Echo:             false,
+				ResponseRequired: true,
+				StateId:          "abc",
+				Username:         "cr1",
+				Text:             "Enter code: 6 digits: now",
+			},
+		},
+		{
+			// unknown flags are ignored, empty username is valid
+			Input:         "PASSWORD:Verification Failed: 'Auth' ['CRV1:X:abc::PIN']",
+			WantErr:       false,
+			WantChallenge: true,
+			Want: DynamicChallenge{
+				RawFlags: "X",
+				StateId:  "abc",
+				Text:     "PIN",
+			},
+		},
+		{
+			// missing challenge text segment
+			Input:         "PASSWORD:Verification Failed: 'Auth' ['CRV1:R:abc:Y3Ix']",
+			WantErr:       true,
+			WantChallenge: true,
+		},
+		{
+			// missing everything
+			Input:         "PASSWORD:Verification Failed: 'Auth' ['CRV1:']",
+			WantErr:       true,
+			WantChallenge: true,
+		},
+		{
+			// empty state id
+			Input:         "PASSWORD:Verification Failed: 'Auth' ['CRV1:R::Y3Ix:PIN']",
+			WantErr:       true,
+			WantChallenge: true,
+		},
+		{
+			// bad base64 username
+			Input:         "PASSWORD:Verification Failed: 'Auth' ['CRV1:R:abc:!!!:PIN']",
+			WantErr:       true,
+			WantChallenge: true,
+		},
+	}
+
+	for i, testCase := range testCases {
+		_, kw, body := splitEvent(testCase.Input)
+		event := upgradeEvent(kw, body)
+
+		var pe PasswordEvent
+		var ok bool
+		if testCase.WantErr {
+			evt, ok := event.(InvalidEvent)
+			if !ok {
+				t.Errorf("test %d got %T; want %T", i, event, evt)
+				continue
+			}
+
+			pe, ok = evt.Origin().(PasswordEvent)
+			if !ok {
+				t.Errorf("test %d got %T; want %T", i, evt.Origin(), pe)
+				continue
+			}
+		} else if pe, ok = event.(PasswordEvent); !ok {
+			t.Errorf("test %d got %T; want %T", i, event, pe)
+			continue
+		}
+
+		if got, want := pe.Raw(), body; got != want {
+			t.Errorf("test %d Raw returned %q; want %q", i, got, want)
+		}
+
+		dc, hasChallenge := pe.Challenge()
+		if hasChallenge != testCase.WantChallenge {
+			t.Errorf("test %d Challenge returned ok=%t; want %t", i, hasChallenge, testCase.WantChallenge)
+			continue
+		}
+		if testCase.WantErr {
+			continue
+		}
+		if dc != testCase.Want {
+			t.Errorf("test %d Challenge returned %#v; want %#v", i, dc, testCase.Want)
+		}
+	}
+
+	_, err := ParseDynamicChallenge("CRV1:R:abc:!!!:PIN")
+	if !errors.Is(err, ErrMalformedChallenge) || !strings.HasSuffix(err.Error(), b64Err.Error()) {
+		t.Errorf("ParseDynamicChallenge returned %v; want %v wrapping %v", err, ErrMalformedChallenge, b64Err)
+	}
+	_, err = ParseDynamicChallenge("CRV1:R:abc:Y3Ix")
+	if err != ErrMalformedChallenge {
+		t.Errorf("ParseDynamicChallenge returned %v; want %v", err, ErrMalformedChallenge)
+	}
+}
+
+func TestPasswordEventAuthToken(t *testing.T) {
+	type TestCase struct {
+		Input      string
+		WantToken  string
+		WantIsAT   bool
+		WantString string
+	}
+	testCases := []TestCase{
+		{
+			Input:      "PASSWORD:Auth-Token:SESS_ID_AT_0123456789",
+			WantToken:  "SESS_ID_AT_0123456789",
+			WantIsAT:   true,
+			WantString: "PASSWORD: Auth-Token:***",
+		},
+		{
+			Input:      "PASSWORD:Auth-Token:",
+			WantToken:  "",
+			WantIsAT:   true,
+			WantString: "PASSWORD: Auth-Token:***",
+		},
+		{
+			Input:      "PASSWORD:Need 'Auth' username/password",
+			WantToken:  "",
+			WantIsAT:   false,
+			WantString: "PASSWORD: Need 'Auth' username/password",
+		},
+	}
+
+	for i, testCase := range testCases {
+		_, kw, body := splitEvent(testCase.Input)
+		event := upgradeEvent(kw, body)
+
+		pe, ok := event.(PasswordEvent)
+		if !ok {
+			t.Errorf("test %d got %T; want %T", i, event, pe)
+			continue
+		}
+
+		if got, want := pe.IsAuthToken(), testCase.WantIsAT; got != want {
+			t.Errorf("test %d IsAuthToken returned %t; want %t", i, got, want)
+		}
+		if got, want := pe.Token(), testCase.WantToken; got != want {
+			t.Errorf("test %d Token returned %q; want %q", i, got, want)
+		}
+		if got, want := pe.String(), testCase.WantString; got != want {
+			t.Errorf("test %d String returned %q; want %q", i, got, want)
+		}
+		if pe.Token() != "" && strings.Contains(pe.String(), pe.Token()) {
+			t.Errorf("test %d String leaks the token: %q", i, pe.String())
+		}
+	}
+}
+
+func TestEchoEventAuthToken(t *testing.T) {
+	type TestCase struct {
+		Input           string
+		WantToken       string
+		WantIsAT        bool
+		WantForgetToken bool
+		WantString      string
+	}
+	testCases := []TestCase{
+		{
+			Input:      "ECHO:123,auth-token SESS_ID_AT_0123456789",
+			WantToken:  "SESS_ID_AT_0123456789",
+			WantIsAT:   true,
+			WantString: "ECHO: auth-token ***",
+		},
+		{
+			Input:           "ECHO:123,forget-token",
+			WantForgetToken: true,
+			WantString:      "ECHO: forget-token",
+		},
+		{
+			Input:      "ECHO:123,forget-passwords",
+			WantString: "ECHO: forget-passwords",
+		},
+		{
+			Input:      "ECHO:123,auth-tokens are great",
+			WantString: "ECHO: auth-tokens are great",
+		},
+	}
+
+	for i, testCase := range testCases {
+		_, kw, body := splitEvent(testCase.Input)
+		event := upgradeEvent(kw, body)
+
+		echo, ok := event.(EchoEvent)
+		if !ok {
+			t.Errorf("test %d got %T; want %T", i, event, echo)
+			continue
+		}
+
+		token, isAT := echo.AuthToken()
+		if token != testCase.WantToken || isAT != testCase.WantIsAT {
+			t.Errorf("test %d AuthToken returned %q, %t; want %q, %t", i, token, isAT, testCase.WantToken, testCase.WantIsAT)
+		}
+		if got, want := echo.IsForgetToken(), testCase.WantForgetToken; got != want {
+			t.Errorf("test %d IsForgetToken returned %t; want %t", i, got, want)
+		}
+		if got, want := echo.String(), testCase.WantString; got != want {
+			t.Errorf("test %d String returned %q; want %q", i, got, want)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package ovmgmt
+
+import (
+	"strconv"
+	"strings"
+)
+
+// IV_* variables are peer-info sent by clients with --push-peer-info
+// (some of them are always sent), see the OpenVPN man page.
+const peerInfoPrefix = "IV_"
+const peerInfoCipherSep = ":"
+
+// PeerProtoFlag is a bit of IV_PROTO peer-info variable, announcing
+// the protocol features supported by the client.
+type PeerProtoFlag uint
+
+const (
+	ProtoDataV2          PeerProtoFlag = 1 << 1
+	ProtoRequestPush     PeerProtoFlag = 1 << 2
+	ProtoTLSKeyExport    PeerProtoFlag = 1 << 3
+	ProtoAuthPendingKW   PeerProtoFlag = 1 << 4
+	ProtoNCPP2P          PeerProtoFlag = 1 << 5
+	ProtoDNSOption       PeerProtoFlag = 1 << 6
+	ProtoCCExitNotify    PeerProtoFlag = 1 << 7
+	ProtoAuthFailTemp    PeerProtoFlag = 1 << 8
+	ProtoDynamicTLSCrypt PeerProtoFlag = 1 << 9
+)
+
+// PeerInfo is the client peer-info from IV_* env variables.
+type PeerInfo struct {
+	// Version is the client OpenVPN version (IV_VER), e.g. "2.5.1"
+	Version string
+	// Platform is the client OS (IV_PLAT), e.g. "linux" or "win"
+	Platform string
+	// SupportedCiphers are the data channel ciphers (IV_CIPHERS)
+	SupportedCiphers []string
+	// ProtoFlags is the IV_PROTO bitfield, see PeerProtoFlag
+	ProtoFlags uint
+	// Extra keeps other IV_* variables, as well as IV_PROTO if it can't
+	// be parsed
+	Extra map[string]string
+}
+
+// HasProto reports whether the client announces the protocol feature.
+func (p PeerInfo) HasProto(flag PeerProtoFlag) bool {
+	return p.ProtoFlags&uint(flag) != 0
+}
+
+// PeerInfo returns the client peer-info from IV_* env variables of CONNECT
+// and REAUTH notifications.
+func (c ClientEvent) PeerInfo() PeerInfo {
+	p := PeerInfo{Extra: make(map[string]string)}
+	for _, env := range c.Envs() {
+		if !strings.HasPrefix(env.Name, peerInfoPrefix) {
+			continue
+		}
+
+		switch env.Name {
+		case EnvIVVer:
+			p.Version = env.Value
+		case EnvIVPlat:
+			p.Platform = env.Value
+		case EnvIVCiphers:
+			if env.Value != "" {
+				p.SupportedCiphers = strings.Split(env.Value, peerInfoCipherSep)
+			}
+		case EnvIVProto:
+			flags, err := strconv.ParseUint(env.Value, 10, 0)
+			if err != nil {
+				p.Extra[env.Name] = env.Value
+				continue
+			}
+			p.ProtoFlags = uint(flags)
+		default:
+			p.Extra[env.Name] = env.Value
+		}
+	}
+	return p
+}
@@ -0,0 +1,104 @@
+package ovmgmt
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestClientEventPeerInfo(t *testing.T) {
+	// from 2.4 server fixture
+	p := mustClientEvent(t, connectEnvPayload...).PeerInfo()
+	want := PeerInfo{
+		Version:    "2.4.7",
+		Platform:   "linux",
+		ProtoFlags: 2,
+		Extra: map[string]string{
+			"IV_COMP_STUB":   "1",
+			"IV_COMP_STUBv2": "1",
+			"IV_LZ4":         "1",
+			"IV_LZ4v2":       "1",
+			"IV_LZO":         "1",
+			"IV_NCP":         "2",
+			"IV_TCPNL":       "1",
+		},
+	}
+	if !reflect.DeepEqual(p, want) {
+		t.Errorf("PeerInfo returned %#v; want %#v", p, want)
+	}
+
+	// 2.6 client
+	p = mustClientEvent(t, "CONNECT,7,1",
+		"ENV,common_name=bob",
+		"ENV,IV_VER=2.6.8",
+		"ENV,IV_PLAT=win",
+		"ENV,IV_TCPNL=1",
+		"ENV,IV_MTU=1600",
+		"ENV,IV_NCP=2",
+		"ENV,IV_CIPHERS=AES-256-GCM:AES-128-GCM:CHACHA20-POLY1305",
+		"ENV,IV_PROTO=990",
+		"ENV,IV_LZO_STUB=1",
+		"ENV,IV_COMP_STUB=1",
+		"ENV,IV_COMP_STUBv2=1",
+		"ENV,IV_GUI_VER=OpenVPN_GUI_11.46.0.0",
+		"ENV,IV_SSO=openurl,webauth,crtext",
+	).PeerInfo()
+	if p.Version != "2.6.8" || p.Platform != "win" {
+		t.Errorf("PeerInfo returned version %q, platform %q", p.Version, p.Platform)
+	}
+	if want := []string{"AES-256-GCM", "AES-128-GCM", "CHACHA20-POLY1305"}; !reflect.DeepEqual(p.SupportedCiphers, want) {
+		t.Errorf("SupportedCiphers got %q; want %q", p.SupportedCiphers, want)
+	}
+	if got, want := p.Extra["IV_SSO"], "openurl,webauth,crtext"; got != want {
+		t.Errorf("Extra[IV_SSO] got %q; want %q", got, want)
+	}
+	if len(p.Extra) != 8 {
+		t.Errorf("Extra got %d keys; want 8: %v", len(p.Extra), p.Extra)
+	}
+
+	type TestCase struct {
+		Proto   string
+		Flags   uint
+		Has     []PeerProtoFlag
+		HasNot  []PeerProtoFlag
+		InExtra bool
+	}
+
+	testCases := []TestCase{
+		// 2.4
+		{"2", 2, []PeerProtoFlag{ProtoDataV2}, []PeerProtoFlag{ProtoRequestPush, ProtoAuthPendingKW}, false},
+		// 2.5
+		{"30", 30,
+			[]PeerProtoFlag{ProtoDataV2, ProtoRequestPush, ProtoTLSKeyExport, ProtoAuthPendingKW},
+			[]PeerProtoFlag{ProtoNCPP2P, ProtoDNSOption, ProtoCCExitNotify, ProtoAuthFailTemp, ProtoDynamicTLSCrypt},
+			false},
+		// 2.6
+		{"990", 990,
+			[]PeerProtoFlag{ProtoDataV2, ProtoRequestPush, ProtoTLSKeyExport, ProtoAuthPendingKW,
+				ProtoDNSOption, ProtoCCExitNotify, ProtoAuthFailTemp, ProtoDynamicTLSCrypt},
+			[]PeerProtoFlag{ProtoNCPP2P},
+			false},
+		{"", 0, nil, []PeerProtoFlag{ProtoDataV2}, true},
+		{"0x1e", 0, nil, []PeerProtoFlag{ProtoDataV2}, true},
+		{"-2", 0, nil, []PeerProtoFlag{ProtoDataV2}, true},
+	}
+
+	for i, testCase := range testCases {
+		p := mustClientEvent(t, "CONNECT,7,1", "ENV,IV_PROTO="+testCase.Proto).PeerInfo()
+		if p.ProtoFlags != testCase.Flags {
+			t.Errorf("test %d ProtoFlags got %d; want %d", i, p.ProtoFlags, testCase.Flags)
+		}
+		for _, f := range testCase.Has {
+			if !p.HasProto(f) {
+				t.Errorf("test %d HasProto(%d) returned false", i, f)
+			}
+		}
+		for _, f := range testCase.HasNot {
+			if p.HasProto(f) {
+				t.Errorf("test %d HasProto(%d) returned true", i, f)
+			}
+		}
+		if _, ok := p.Extra[EnvIVProto]; ok != testCase.InExtra {
+			t.Errorf("test %d IV_PROTO in Extra is %t; want %t", i, ok, testCase.InExtra)
+		}
+	}
+}
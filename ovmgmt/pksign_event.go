@@ -0,0 +1,84 @@
+package ovmgmt
+
+import (
+	"encoding/base64"
+	"fmt"
+)
+
+// PkSignEvent is a request to sign the data with an external private key,
+// emitted when OpenVPN runs with --management-external-key:
+//
+//     >PK_SIGN:{base64_data}
+//     >PK_SIGN:{base64_data},{algorithm}
+//     >RSA_SIGN:{base64_data}
+//
+// RSA_SIGN is the legacy form used by OpenVPN before 2.5. The optional
+// algorithm field (e.g. RSA_PKCS1_PADDING, ECDSA or
+// "RSA_PKCS1_PSS_PADDING,hashalg=SHA256,saltlen=digest") is sent by newer
+// daemons and may itself contain commas.
+//
+// The answer is expected to be sent back with the "pk-sig" (or "rsa-sig")
+// command.
+type PkSignEvent struct {
+	receivedAt
+	keyword string
+	body    string
+	rawData string
+	data    []byte
+	alg     string
+}
+
+func NewPkSignEvent(keyword, body string) (PkSignEvent, error) {
+	e := PkSignEvent{keyword: keyword, body: body}
+	parts := stringsSplitNK(body, fieldSep, 2, 2)
+	e.rawData = parts[0]
+	e.alg = parts[1]
+
+	var err error
+	e.data, err = base64.StdEncoding.DecodeString(e.rawData)
+	if err != nil {
+		return e, err
+	}
+
+	return e, nil
+}
+
+func (e PkSignEvent) Keyword() string {
+	return e.keyword
+}
+
+func (e PkSignEvent) Raw() string {
+	return e.body
+}
+
+func (e PkSignEvent) Type() string {
+	return e.keyword
+}
+
+// IsLegacy reports whether the event came as legacy RSA_SIGN notification.
+func (e PkSignEvent) IsLegacy() bool {
+	return e.keyword == rsaSignEventKW
+}
+
+// Data returns decoded data to sign.
+func (e PkSignEvent) Data() []byte {
+	return e.data
+}
+
+// RawData returns data to sign as it was received, base64 encoded.
+func (e PkSignEvent) RawData() string {
+	return e.rawData
+}
+
+// Algorithm returns the padding/algorithm hint, or the empty string
+// if the daemon did not send it.
+func (e PkSignEvent) Algorithm() string {
+	return e.alg
+}
+
+func (e PkSignEvent) String() string {
+	if e.alg == "" {
+		return fmt.Sprintf("%s: %d bytes", e.keyword, len(e.data))
+	}
+	return fmt.Sprintf("%s: %d bytes, alg:%s", e.keyword, len(e.data), e.alg)
+}
@@ -0,0 +1,102 @@
+package ovmgmt
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPkSignEvent(t *testing.T) {
+	type TestCase struct {
+		Input       string
+		WantErr     bool
+		WantKeyword string
+		WantLegacy  bool
+		WantData    []byte
+		WantRawData string
+		WantAlg     string
+	}
+	testCases := []TestCase{
+		{
+			Input:       "PK_SIGN:aGVsbG8=",
+			WantKeyword: "PK_SIGN",
+			WantData:    []byte("hello"),
+			WantRawData: "aGVsbG8=",
+		},
+		{
+			Input:       "PK_SIGN:aGVsbG8=,RSA_PKCS1_PADDING",
+			WantKeyword: "PK_SIGN",
+			WantData:    []byte("hello"),
+			WantRawData: "aGVsbG8=",
+			WantAlg:     "RSA_PKCS1_PADDING",
+		},
+		{
+			Input:       "PK_SIGN:aGVsbG8=,RSA_PKCS1_PSS_PADDING,hashalg=SHA256,saltlen=digest",
+			WantKeyword: "PK_SIGN",
+			WantData:    []byte("hello"),
+			WantRawData: "aGVsbG8=",
+			WantAlg:     "RSA_PKCS1_PSS_PADDING,hashalg=SHA256,saltlen=digest",
+		},
+		{
+			Input:       "RSA_SIGN:aGVsbG8=",
+			WantKeyword: "RSA_SIGN",
+			WantLegacy:  true,
+			WantData:    []byte("hello"),
+			WantRawData: "aGVsbG8=",
+		},
+		{
+			Input:       "PK_SIGN:",
+			WantKeyword: "PK_SIGN",
+			WantData:    []byte{},
+		},
+		{
+			Input:       "PK_SIGN:not base64!,ECDSA",
+			WantErr:     true,
+			WantKeyword: "PK_SIGN",
+			WantRawData: "not base64!",
+			WantAlg:     "ECDSA",
+		},
+	}
+
+	for i, testCase := range testCases {
+		_, kw, body := splitEvent(testCase.Input)
+		event := upgradeEvent(kw, body)
+
+		var ps PkSignEvent
+		var ok bool
+		if testCase.WantErr {
+			evt, ok := event.(InvalidEvent)
+			if !ok {
+				t.Errorf("test %d got %T; want %T", i, event, evt)
+				continue
+			}
+
+			ps, ok = evt.Origin().(PkSignEvent)
+			if !ok {
+				t.Errorf("test %d got %T; want %T", i, evt.Origin(), ps)
+				continue
+			}
+		} else if ps, ok = event.(PkSignEvent); !ok {
+			t.Errorf("test %d got %T; want %T", i, event, ps)
+			continue
+		}
+
+		if got, want := ps.Raw(), body; got != want {
+			t.Errorf("test %d Raw returned %q; want %q", i, got, want)
+		}
+		if got, want := ps.Type(), testCase.WantKeyword; got != want {
+			t.Errorf("test %d Type returned %q; want %q", i, got, want)
+		}
+		if got, want := ps.IsLegacy(), testCase.WantLegacy; got != want {
+			t.Errorf("test %d IsLegacy returned %t; want %t", i, got, want)
+		}
+		if got, want := ps.RawData(), testCase.WantRawData; got != want {
+			t.Errorf("test %d RawData returned %q; want %q", i, got, want)
+		}
+		if got, want := ps.Algorithm(), testCase.WantAlg; got != want {
+			t.Errorf("test %d Algorithm returned %q; want %q", i, got, want)
+		}
+		if !testCase.WantErr && !bytes.Equal(ps.Data(), testCase.WantData) {
+			t.Errorf("test %d Data returned %q; want %q", i, ps.Data(), testCase.WantData)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package ovmgmt
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// poolEventBuffer is the buffer depth of the event channel of each client
+// of MgmtPool, their events are forwarded to the pool's one
+const poolEventBuffer = 64
+
+// Errors of MgmtPool, ErrPoolClosed matches ErrClosed.
+var (
+	ErrPoolClosed           = newCategoryError(ErrClosed, "pool is closed", nil)
+	ErrPoolInstanceExists   = NewOVpnError("pool instance already exists")
+	ErrPoolInstanceNotFound = NewOVpnError("pool instance not found")
+)
+
+// MgmtPool owns the clients of multiple OpenVPN processes, e.g. one per
+// tenant or tunnel, keyed by the instance name, and merges their events
+// into a single channel as TaggedEvent.
+//
+// Each client has its own event buffer, forwarded to the pool's channel
+// by its own goroutine, so a busy instance takes its turn with the others
+// instead of starving them, and a stalled consumer stalls all of them
+// alike. The clients terminated by themselves, e.g. when the daemon exits,
+// stay in the pool after their FatalEvent, until they are removed.
+type MgmtPool struct {
+	eventCh chan<- TaggedEvent
+
+	// mu guards instances, where the names being added are reserved
+	// with nil, and closed
+	mu        sync.Mutex
+	instances map[string]*poolInstance
+	closed    bool
+	// the forwarders, the event channel is closed once they are done
+	wg sync.WaitGroup
+}
+
+type poolInstance struct {
+	c *MgmtClient
+	// closed by Remove, the events are dropped then
+	removed chan struct{}
+	// closed once the events of the client are all forwarded
+	done chan struct{}
+}
+
+// NewMgmtPool returns the empty pool, which emits the events of its
+// clients on eventCh. See the NewMgmtClient docs for discussion about
+// the requirements for eventCh, which is shared by all the instances.
+// eventCh is closed by Close only.
+func NewMgmtPool(eventCh chan<- TaggedEvent) *MgmtPool {
+	return &MgmtPool{eventCh: eventCh, instances: make(map[string]*poolInstance)}
+}
+
+// Add connects the client of the instance with the given dial function,
+// e.g. a wrapper of DialContext, and adds it to the pool. It returns
+// ErrPoolInstanceExists if the name is taken, and ErrPoolClosed once
+// the pool is closed.
+func (p *MgmtPool) Add(ctx context.Context, name string, dial DialFunc) (*MgmtClient, error) {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil, ErrPoolClosed
+	}
+	if _, ok := p.instances[name]; ok {
+		p.mu.Unlock()
+		return nil, fmt.Errorf("%w: %q", ErrPoolInstanceExists, name)
+	}
+	p.instances[name] = nil
+	p.mu.Unlock()
+
+	eventCh := make(chan Event, poolEventBuffer)
+	c, err := dial(ctx, eventCh)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err != nil {
+		delete(p.instances, name)
+		return nil, err
+	}
+	if p.closed {
+		// Close hasn't waited for the reserved name
+		delete(p.instances, name)
+		c.Close()
+		return nil, ErrPoolClosed
+	}
+	inst := &poolInstance{c: c, removed: make(chan struct{}), done: make(chan struct{})}
+	p.instances[name] = inst
+	p.wg.Add(1)
+	go p.forward(name, inst, eventCh)
+	return c, nil
+}
+
+// forward sends the events of the instance to the pool's channel, until
+// the client closes its channel
+func (p *MgmtPool) forward(name string, inst *poolInstance, eventCh <-chan Event) {
+	defer p.wg.Done()
+	defer close(inst.done)
+	for evt := range eventCh {
+		select {
+		case p.eventCh <- TaggedEvent{Instance: name, Event: evt}:
+		case <-inst.removed:
+		}
+	}
+}
+
+// Remove closes the client of the instance and removes it from the pool,
+// once its events emitted so far are forwarded or dropped: the ones not
+// yet read by the consumer are dropped. It returns the error of closing
+// the client, ErrPoolInstanceNotFound if there is no such instance.
+func (p *MgmtPool) Remove(name string) error {
+	p.mu.Lock()
+	inst := p.instances[name]
+	if inst == nil {
+		p.mu.Unlock()
+		return fmt.Errorf("%w: %q", ErrPoolInstanceNotFound, name)
+	}
+	delete(p.instances, name)
+	p.mu.Unlock()
+
+	return inst.close()
+}
+
+func (inst *poolInstance) close() error {
+	close(inst.removed)
+	err := inst.c.Close()
+	<-inst.done
+	return err
+}
+
+// Client returns the client of the instance, to issue commands to it.
+func (p *MgmtPool) Client(name string) (*MgmtClient, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	inst := p.instances[name]
+	if inst == nil {
+		return nil, false
+	}
+	return inst.c, true
+}
+
+// Instances returns the names of the instances in the pool, sorted.
+func (p *MgmtPool) Instances() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	names := make([]string, 0, len(p.instances))
+	for name, inst := range p.instances {
+		if inst != nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// BroadcastSignal sends the signal to all the instances concurrently, see
+// MgmtClient.SendSignal. It returns the errors of the instances which have
+// failed, keyed by the name, nil if none.
+func (p *MgmtPool) BroadcastSignal(name string) map[string]error {
+	p.mu.Lock()
+	clients := make(map[string]*MgmtClient, len(p.instances))
+	for instance, inst := range p.instances {
+		if inst != nil {
+			clients[instance] = inst.c
+		}
+	}
+	p.mu.Unlock()
+
+	type result struct {
+		instance string
+		err      error
+	}
+	results := make(chan result, len(clients))
+	for instance, c := range clients {
+		go func(instance string, c *MgmtClient) {
+			results <- result{instance, c.SendSignal(name)}
+		}(instance, c)
+	}
+
+	var errs map[string]error
+	for range clients {
+		res := <-results
+		if res.err != nil {
+			if errs == nil {
+				errs = make(map[string]error)
+			}
+			errs[res.instance] = res.err
+		}
+	}
+	return errs
+}
+
+// Close closes the clients of all the instances, as Remove does, and then
+// closes the event channel. Instances can't be added after that. It returns
+// the first error of closing the clients. It's safe to call Close multiple
+// times.
+func (p *MgmtPool) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	instances := p.instances
+	p.instances = make(map[string]*poolInstance)
+	p.mu.Unlock()
+
+	var firstErr error
+	for _, inst := range instances {
+		if inst == nil {
+			continue
+		}
+		if err := inst.close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	p.wg.Wait()
+	close(p.eventCh)
+	return firstErr
+}
@@ -0,0 +1,208 @@
+package ovmgmt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// poolDaemon is greetingDaemon of the instance, which emits the given
+// number of log lines "<instance> <n>" concurrently with replying to
+// the commands, forever if logs is negative. It accepts signals, unless
+// failSignal. The returned DialFunc connects the client to it.
+func poolDaemon(instance string, logs int, failSignal bool) (DialFunc, net.Conn) {
+	daemonConn, clientConn := net.Pipe()
+	go func() {
+		if _, err := io.WriteString(daemonConn, testGreeting+"\n"); err != nil {
+			return
+		}
+		go func() {
+			for i := 0; logs < 0 || i < logs; i++ {
+				if _, err := fmt.Fprintf(daemonConn, ">LOG:1584536294,I,%s %d\n", instance, i); err != nil {
+					return
+				}
+			}
+		}()
+		fakeDaemon(daemonConn, func(cmd string) []string {
+			if !strings.HasPrefix(cmd, "signal ") {
+				return []string{"ERROR: unknown command"}
+			}
+			if failSignal {
+				return []string{"ERROR: signal failed"}
+			}
+			return []string{"SUCCESS: signal " + strings.Trim(cmd[len("signal "):], `"`) + " thrown"}
+		})
+	}()
+	dial := func(ctx context.Context, eventCh chan<- Event) (*MgmtClient, error) {
+		return NewMgmtClient(clientConn, eventCh), nil
+	}
+	return dial, daemonConn
+}
+
+// nextTaggedEvent reads the event of the pool, skipping the greetings
+func nextTaggedEvent(t *testing.T, eventCh <-chan TaggedEvent) TaggedEvent {
+	t.Helper()
+	for {
+		select {
+		case evt, ok := <-eventCh:
+			if !ok {
+				t.Fatalf("event channel is closed")
+			}
+			if simple, ok := evt.Event.(SimpleEvent); ok && simple.Keyword() == infoEventKW {
+				continue
+			}
+			return evt
+		case <-time.After(2 * time.Second):
+			t.Fatalf("no event")
+		}
+	}
+}
+
+func TestMgmtPool(t *testing.T) {
+	defer checkGoroutineLeaks(t)()
+
+	const logs = 100
+	eventCh := make(chan TaggedEvent)
+	pool := NewMgmtPool(eventCh)
+	defer pool.Close()
+
+	daemons := make(map[string]net.Conn)
+	for _, instance := range []string{"a", "b", "c"} {
+		dial, daemonConn := poolDaemon(instance, logs, instance == "c")
+		defer daemonConn.Close()
+		daemons[instance] = daemonConn
+		if _, err := pool.Add(context.Background(), instance, dial); err != nil {
+			t.Fatalf("Add %s returned %v", instance, err)
+		}
+	}
+	if got := pool.Instances(); !reflect.DeepEqual(got, []string{"a", "b", "c"}) {
+		t.Errorf("Instances returned %v", got)
+	}
+	dial, daemonConn := poolDaemon("a", 0, false)
+	defer daemonConn.Close()
+	if _, err := pool.Add(context.Background(), "a", dial); !errors.Is(err, ErrPoolInstanceExists) {
+		t.Errorf("Add of the existing instance returned %v; want %v", err, ErrPoolInstanceExists)
+	}
+
+	// the events of the instances are merged in their order
+	next := map[string]int{}
+	for received := 0; received < 3*logs; received++ {
+		evt := nextTaggedEvent(t, eventCh)
+		log, ok := evt.Event.(LogEvent)
+		if !ok {
+			t.Fatalf("got %s; want log event", evt)
+		}
+		if want := fmt.Sprintf("%s %d", evt.Instance, next[evt.Instance]); log.Message() != want {
+			t.Fatalf("got %s; want message %q", evt, want)
+		}
+		next[evt.Instance]++
+	}
+
+	errs := pool.BroadcastSignal("SIGUSR2")
+	if len(errs) != 1 || errs["c"] == nil {
+		t.Errorf("BroadcastSignal returned %v; want the error of c", errs)
+	}
+	if c, ok := pool.Client("b"); !ok || c.SendSignal("SIGHUP") != nil {
+		t.Errorf("Client b returned %v, %v", c, ok)
+	}
+	if c, ok := pool.Client("d"); ok {
+		t.Errorf("Client d returned %v", c)
+	}
+
+	// removing the instance doesn't close the channel
+	if err := pool.Remove("b"); err != nil {
+		t.Errorf("Remove returned %v", err)
+	}
+	if err := pool.Remove("b"); !errors.Is(err, ErrPoolInstanceNotFound) {
+		t.Errorf("Remove of the removed instance returned %v; want %v", err, ErrPoolInstanceNotFound)
+	}
+	if got := pool.Instances(); !reflect.DeepEqual(got, []string{"a", "c"}) {
+		t.Errorf("Instances returned %v", got)
+	}
+
+	// the instance terminated by itself stays in the pool
+	daemons["c"].Close()
+	evt := nextTaggedEvent(t, eventCh)
+	if _, ok := evt.Event.(FatalEvent); !ok || evt.Instance != "c" {
+		t.Errorf("got %s; want FatalEvent of c", evt)
+	}
+	if got := pool.Instances(); !reflect.DeepEqual(got, []string{"a", "c"}) {
+		t.Errorf("Instances returned %v", got)
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for range eventCh {
+		}
+	}()
+	if err := pool.Close(); err != nil {
+		t.Errorf("Close returned %v", err)
+	}
+	<-closed
+	if len(pool.Instances()) != 0 {
+		t.Errorf("Instances returned %v after Close", pool.Instances())
+	}
+	if _, err := pool.Add(context.Background(), "d", dial); !errors.Is(err, ErrPoolClosed) || !errors.Is(err, ErrClosed) {
+		t.Errorf("Add after Close returned %v; want %v", err, ErrPoolClosed)
+	}
+	if err := pool.Close(); err != nil {
+		t.Errorf("second Close returned %v", err)
+	}
+}
+
+func TestMgmtPoolFairness(t *testing.T) {
+	defer checkGoroutineLeaks(t)()
+
+	const quietLogs = 10
+	eventCh := make(chan TaggedEvent)
+	pool := NewMgmtPool(eventCh)
+	for _, instance := range []string{"flood1", "flood2", "quiet"} {
+		logs := -1
+		if instance == "quiet" {
+			logs = quietLogs
+		}
+		dial, daemonConn := poolDaemon(instance, logs, false)
+		defer daemonConn.Close()
+		if _, err := pool.Add(context.Background(), instance, dial); err != nil {
+			t.Fatalf("Add %s returned %v", instance, err)
+		}
+	}
+
+	// the flooding instances take turns with the quiet one
+	quiet := 0
+	for received := 0; quiet < quietLogs; received++ {
+		if received > 20*quietLogs {
+			t.Fatalf("got %d events of the quiet instance out of %d", quiet, received)
+		}
+		if evt := nextTaggedEvent(t, eventCh); evt.Instance == "quiet" {
+			quiet++
+		}
+	}
+
+	// nobody reads the channel, the flooding instance is removed anyway
+	removed := make(chan error, 1)
+	go func() {
+		removed <- pool.Remove("flood1")
+	}()
+	select {
+	case err := <-removed:
+		if err != nil {
+			t.Errorf("Remove returned %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Remove is blocked by the event channel")
+	}
+	if err := pool.Close(); err != nil {
+		t.Errorf("Close returned %v", err)
+	}
+	// the events are dropped by Close as well
+	for range eventCh {
+	}
+}
@@ -0,0 +1,97 @@
+package ovmgmt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const promptEventKW = "PROMPT"
+
+// managementPasswordPrompt is the prompt of the management interface
+// password, when the daemon runs with --management ... pw-file
+const managementPasswordPrompt = "ENTER PASSWORD:"
+
+// the reply to the correct management interface password
+const managementPasswordCorrect = "password is correct"
+
+// PromptEvent is a synthetic event emitted when the daemon prompts for
+// the input with the line which isn't terminated, e.g. "ENTER PASSWORD:"
+// of the management interface password. The daemon doesn't process
+// commands until the prompt is answered, see SendManagementPassword.
+//
+// Prompts are recognized when nothing else is received after them, so
+// the line starting with the prompt, which is split by the reads exactly
+// after the prompt, is taken for the prompt as well.
+type PromptEvent struct {
+	receivedAt
+	prompt string
+	// options of the client which received the event
+	opts *parseOptions
+}
+
+func NewPromptEvent(prompt string) PromptEvent {
+	return PromptEvent{prompt: prompt}
+}
+
+func (e PromptEvent) Keyword() string {
+	return promptEventKW
+}
+
+func (e PromptEvent) Raw() string {
+	return e.prompt
+}
+
+// Prompt returns the prompt as it's received.
+func (e PromptEvent) Prompt() string {
+	return e.opts.sanitize(e.prompt)
+}
+
+// IsManagementPassword reports whether it's the prompt of the management
+// interface password, see SendManagementPassword.
+func (e PromptEvent) IsManagementPassword() bool {
+	return e.prompt == managementPasswordPrompt
+}
+
+func (e PromptEvent) String() string {
+	return Sanitize(fmt.Sprintf("Prompt %q", e.prompt))
+}
+
+// SendManagementPassword answers the prompt of the management interface
+// password, see PromptEvent. It returns the error of the wrong password,
+// the daemon prompts again then, unless it closes the connection after
+// too many failures.
+//
+// The password is redacted from WithCommandHook and WithProtocolTap as
+// "[REDACTED]" command.
+func (c *MgmtClient) SendManagementPassword(password string) error {
+	start := time.Now()
+	err := c.issueManagementPassword(password)
+	err = commandError(redactedArgument, err)
+	c.commandDone(redactedArgument, err, start)
+	return err
+}
+
+func (c *MgmtClient) issueManagementPassword(password string) error {
+	if strings.ContainsAny(password, "\r\n") {
+		return errors.New("the password contains the line ending")
+	}
+	if err := c.acquireCommand(context.Background()); err != nil {
+		return err
+	}
+	defer c.releaseCommand()
+
+	if err := c.sendSecret(password, redactedArgument); err != nil {
+		return err
+	}
+	result, err := c.readCommandResult()
+	if err != nil {
+		return err
+	}
+	if result != managementPasswordCorrect {
+		return newCategoryError(ErrMalformedReply, "unexpected reply to the password: "+result, nil)
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package ovmgmt
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// passwordDaemon prompts for the management interface password as OpenVPN
+// does, then replies to pid
+func passwordDaemon(conn net.Conn, password string) {
+	defer conn.Close()
+	if _, err := io.WriteString(conn, managementPasswordPrompt); err != nil {
+		return
+	}
+	scanner := bufio.NewScanner(conn)
+	authorized := false
+	for scanner.Scan() {
+		var reply string
+		switch {
+		case authorized && scanner.Text() == "pid":
+			reply = "SUCCESS: pid=42\n"
+		case authorized:
+			reply = "ERROR: unknown command, enter 'help' for more options\n"
+		case scanner.Text() == password:
+			authorized = true
+			reply = "SUCCESS: password is correct\n>INFO:OpenVPN Management Interface Version 3 -- type 'help' for more info\n"
+		default:
+			reply = "ERROR: bad password\n" + managementPasswordPrompt
+		}
+		if _, err := io.WriteString(conn, reply); err != nil {
+			return
+		}
+	}
+}
+
+func TestPromptEvent(t *testing.T) {
+	defer checkGoroutineLeaks(t)()
+
+	daemonConn, clientConn := net.Pipe()
+	go passwordDaemon(daemonConn, "s3cret")
+
+	var hook commandRecorder
+	var tap syncBuffer
+	eventCh := make(chan Event, 10)
+	c := NewMgmtClientWithOptions(clientConn, eventCh, WithCommandHook(hook.hook), WithProtocolTap(&tap))
+	defer c.Close()
+
+	for i, password := range []string{"wrong", "s3cret"} {
+		evt, ok := nextEventOf(t, eventCh).(PromptEvent)
+		if !ok || !evt.IsManagementPassword() || evt.Prompt() != managementPasswordPrompt {
+			t.Fatalf("test %d got event %v; want the password prompt", i, evt)
+		}
+		if evt.ReceivedAt().IsZero() {
+			t.Errorf("test %d got event %v without the receive time", i, evt)
+		}
+		err := c.SendManagementPassword(password)
+		if password == "wrong" {
+			if err == nil || !strings.Contains(err.Error(), "bad password") {
+				t.Errorf("test %d returned error %v; want bad password", i, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("test %d returned error %v", i, err)
+		}
+	}
+
+	if evt, ok := nextEventOf(t, eventCh).(SimpleEvent); !ok || evt.Keyword() != infoEventKW {
+		t.Errorf("got event %v; want INFO", evt)
+	}
+	if pid, err := c.Pid(); err != nil || pid != 42 {
+		t.Errorf("Pid returned %d, %v; want 42", pid, err)
+	}
+
+	want := []string{redactedArgument, redactedArgument, "pid"}
+	if got := hook.get(); !reflect.DeepEqual(got, want) {
+		t.Errorf("hook got commands %q; want %q", got, want)
+	}
+	c.Close()
+	if strings.Contains(tap.String(), "s3cret") || strings.Contains(tap.String(), "wrong") {
+		t.Errorf("the password isn't redacted from the tap:\n%s", tap.String())
+	}
+}
+
+func TestSendManagementPasswordLineEnding(t *testing.T) {
+	c := newReplyingClient(t, make(chan Event, 10), func(string) []string {
+		return []string{"SUCCESS: password is correct"}
+	})
+	defer c.Close()
+
+	if err := c.SendManagementPassword("s3cret\npid"); err == nil {
+		t.Errorf("the password with the line ending is sent")
+	}
+	if err := c.SendManagementPassword("s3cret"); err != nil {
+		t.Errorf("returned error %v", err)
+	}
+}
@@ -0,0 +1,79 @@
+package ovmgmt
+
+import (
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// protocolTapBuffer is the number of lines queued for the slow tap writer,
+// the lines which don't fit are dropped
+const protocolTapBuffer = 256
+
+const protocolTapTimeFormat = "2006-01-02T15:04:05.000000Z07:00"
+
+// protocolTap writes the lines of the protocol to the writer
+// in the background
+type protocolTap struct {
+	// accessed atomically, keep it first for 64-bit alignment
+	dropped uint64
+	w       io.Writer
+	unsafe  bool
+	lines   chan string
+	done    chan struct{}
+}
+
+func newProtocolTap(w io.Writer, unsafe bool) *protocolTap {
+	return &protocolTap{
+		w:      w,
+		unsafe: unsafe,
+		lines:  make(chan string, protocolTapBuffer),
+		done:   make(chan struct{}),
+	}
+}
+
+// add queues the line, dir is "<" for the lines read, ">" for the ones
+// written; secrets of both are redacted by the caller
+func (t *protocolTap) add(dir string, line string) {
+	line = time.Now().Format(protocolTapTimeFormat) + " " + dir + " " + line + newlineSep
+	select {
+	case t.lines <- line:
+	default:
+		atomic.AddUint64(&t.dropped, 1)
+	}
+}
+
+// run writes the queued lines until done is closed, then the rest of them
+func (t *protocolTap) run(done <-chan struct{}) {
+	defer close(t.done)
+	for {
+		select {
+		case line := <-t.lines:
+			t.write(line)
+		case <-done:
+			for {
+				select {
+				case line := <-t.lines:
+					t.write(line)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (t *protocolTap) write(line string) {
+	if _, err := io.WriteString(t.w, line); err != nil {
+		logErrorf("Protocol tap: %s", err)
+	}
+}
+
+// TapDroppedLines returns the number of lines not written to the protocol
+// tap of WithProtocolTap, because the writer is too slow.
+func (c *MgmtClient) TapDroppedLines() uint64 {
+	if c.tap == nil {
+		return 0
+	}
+	return atomic.LoadUint64(&c.tap.dropped)
+}
@@ -0,0 +1,208 @@
+package ovmgmt
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// syncBuffer is bytes.Buffer safe for concurrent use
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestProtocolTap(t *testing.T) {
+	type TestCase struct {
+		Opt  func(io.Writer) Option
+		Want []string
+	}
+
+	testCases := []TestCase{
+		{WithProtocolTap, []string{
+			"> pid",
+			"< SUCCESS: pid=42",
+			"> password Auth [REDACTED]",
+			"< SUCCESS: ok",
+			"> username \"Private Key\" [REDACTED]",
+			"< SUCCESS: ok",
+			"> cr-response [REDACTED]",
+			"< SUCCESS: ok",
+		}},
+		{WithUnsafeProtocolTap, []string{
+			"> pid",
+			"< SUCCESS: pid=42",
+			"> password Auth s3cret",
+			"< SUCCESS: ok",
+			"> username \"Private Key\" alice",
+			"< SUCCESS: ok",
+			"> cr-response c2VjcmV0",
+			"< SUCCESS: ok",
+		}},
+	}
+
+	for i, tc := range testCases {
+		var buf syncBuffer
+		before := time.Now().Truncate(time.Microsecond)
+		c := newReplyingClient(t, make(chan Event, 10), func(cmd string) []string {
+			if cmd == "pid" {
+				return []string{"SUCCESS: pid=42"}
+			}
+			return []string{"SUCCESS: ok"}
+		}, tc.Opt(&buf))
+
+		c.Pid()
+		c.simpleCommand("password Auth s3cret")
+		c.simpleCommand(`username "Private Key" alice`)
+		c.simpleCommand("cr-response c2VjcmV0")
+		c.Close()
+
+		var got []string
+		for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n") {
+			fields := strings.SplitN(line, " ", 2)
+			at, err := time.Parse(protocolTapTimeFormat, fields[0])
+			if err != nil || at.Before(before) || at.After(time.Now()) {
+				t.Errorf("test %d got line %q with bad timestamp: %v", i, line, err)
+			}
+			if len(fields) > 1 {
+				got = append(got, fields[1])
+			}
+		}
+		if !reflect.DeepEqual(got, tc.Want) {
+			t.Errorf("test %d got tap lines\n%q\nwant\n%q", i, got, tc.Want)
+		}
+		if dropped := c.TapDroppedLines(); dropped != 0 {
+			t.Errorf("test %d dropped %d lines", i, dropped)
+		}
+	}
+}
+
+func TestProtocolTapSecrets(t *testing.T) {
+	type TestCase struct {
+		Send   func(c *MgmtClient) (string, error)
+		Secret string
+		Want   string
+	}
+
+	testCases := []TestCase{
+		{func(c *MgmtClient) (string, error) { return c.simpleCommand(`password "Auth" hunter2`) }, "hunter2", `> password "Auth" [REDACTED]`},
+		{func(c *MgmtClient) (string, error) { return c.simpleCommand("username Auth alice@example.com") }, "alice@example.com", "> username Auth [REDACTED]"},
+		{func(c *MgmtClient) (string, error) { return c.simpleCommand("cr-response bXlvdHA=") }, "bXlvdHA=", "> cr-response [REDACTED]"},
+		{func(c *MgmtClient) (string, error) { return "", c.SendManagementPassword("hunter2") }, "hunter2", "> [REDACTED]"},
+	}
+
+	for i, tc := range testCases {
+		var buf syncBuffer
+		c := newReplyingClient(t, make(chan Event, 10), func(cmd string) []string {
+			if cmd == "hunter2" {
+				return []string{"SUCCESS: " + managementPasswordCorrect}
+			}
+			return []string{"SUCCESS: ok"}
+		}, WithProtocolTap(&buf))
+
+		if _, err := tc.Send(c); err != nil {
+			t.Errorf("test %d returned %v", i, err)
+		}
+		c.Close()
+
+		if out := buf.String(); strings.Contains(out, tc.Secret) || !strings.Contains(out, " "+tc.Want+"\n") {
+			t.Errorf("test %d got tap output\n%s\nwant %q without the secret", i, out, tc.Want)
+		}
+	}
+}
+
+func TestProtocolTapInboundSecrets(t *testing.T) {
+	type TestCase struct {
+		Opt    func(io.Writer) Option
+		Secret bool
+	}
+
+	testCases := []TestCase{
+		{WithProtocolTap, false},
+		{WithUnsafeProtocolTap, true},
+	}
+
+	secrets := []string{"hunter2", "tok3n", "bXlvdHA="}
+	for i, tc := range testCases {
+		var buf syncBuffer
+		c := newReplyingClient(t, make(chan Event, 10), func(cmd string) []string {
+			return []string{
+				">CLIENT:CONNECT,5,1",
+				">CLIENT:ENV,password=hunter2",
+				">CLIENT:ENV,END",
+				">PASSWORD:Auth-Token:tok3n",
+				">CLIENT:CR_RESPONSE,5,1,bXlvdHA=",
+				"SUCCESS: pid=42",
+			}
+		}, tc.Opt(&buf))
+		if _, err := c.Pid(); err != nil {
+			t.Errorf("test %d Pid returned %v", i, err)
+		}
+		c.Close()
+
+		out := buf.String()
+		for _, secret := range secrets {
+			if strings.Contains(out, secret) != tc.Secret {
+				t.Errorf("test %d got tap output\n%s\nwant %q: %t", i, out, secret, tc.Secret)
+			}
+		}
+		if !tc.Secret && !strings.Contains(out, " < >CLIENT:ENV,password=***\n") {
+			t.Errorf("test %d got tap output\n%s\nwant the redacted env line", i, out)
+		}
+	}
+}
+
+// blockingWriter blocks writes until it's released
+type blockingWriter struct {
+	release chan struct{}
+	n       int
+}
+
+func (w *blockingWriter) Write(p []byte) (int, error) {
+	<-w.release
+	w.n++
+	return len(p), nil
+}
+
+func TestProtocolTapSlowWriter(t *testing.T) {
+	defer checkGoroutineLeaks(t)()
+
+	w := &blockingWriter{release: make(chan struct{})}
+	daemonConn, clientConn := net.Pipe()
+	c := NewMgmtClientWithOptions(clientConn, make(chan Event, 1000), WithProtocolTap(w))
+
+	// the protocol isn't stalled by the tap
+	const lines = 2 * protocolTapBuffer
+	for i := 0; i < lines; i++ {
+		fmt.Fprintf(daemonConn, ">LOG:1584536294,I,%d\n", i)
+	}
+	dropped := c.TapDroppedLines()
+	if dropped == 0 || dropped > lines-protocolTapBuffer {
+		t.Errorf("dropped %d lines; want up to %d", dropped, lines-protocolTapBuffer)
+	}
+
+	close(w.release)
+	daemonConn.Close()
+	c.Close()
+	if dropped = c.TapDroppedLines(); uint64(w.n)+dropped != lines {
+		t.Errorf("written %d lines and dropped %d; want %d in total", w.n, dropped, lines)
+	}
+}
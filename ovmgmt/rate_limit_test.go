@@ -0,0 +1,98 @@
+package ovmgmt
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	type TestCase struct {
+		Rate  float64
+		Burst int
+		// the pause before each command, which is issued after
+		// its delay
+		Pauses []time.Duration
+		Want   []time.Duration
+	}
+
+	ms := time.Millisecond
+	testCases := []TestCase{
+		// tight loop: the burst, then spaced by the rate
+		{10, 3, make([]time.Duration, 6), []time.Duration{0, 0, 0, 100 * ms, 100 * ms, 100 * ms}},
+		{4, 1, make([]time.Duration, 4), []time.Duration{0, 250 * ms, 250 * ms, 250 * ms}},
+		// the bucket is refilled during the pause, up to the burst
+		{10, 2, []time.Duration{0, 0, 0, time.Second, 0, 0}, []time.Duration{0, 0, 100 * ms, 0, 0, 100 * ms}},
+		{10, 2, []time.Duration{0, 0, 50 * ms, 0}, []time.Duration{0, 0, 50 * ms, 100 * ms}},
+		// zero burst is one
+		{10, 0, make([]time.Duration, 2), []time.Duration{0, 100 * ms}},
+	}
+
+	for i, tc := range testCases {
+		clock := time.Date(2020, 3, 18, 12, 58, 14, 0, time.UTC)
+		b := newTokenBucket(tc.Rate, tc.Burst)
+		b.now = func() time.Time { return clock }
+
+		var got []time.Duration
+		for _, pause := range tc.Pauses {
+			clock = clock.Add(pause)
+			start := clock
+			clock = clock.Add(b.reserve())
+			// the spacing between the commands, not counting the pause
+			got = append(got, clock.Sub(start))
+		}
+		if !reflect.DeepEqual(got, tc.Want) {
+			t.Errorf("test %d got delays %v; want %v", i, got, tc.Want)
+		}
+	}
+}
+
+func TestCommandRateLimit(t *testing.T) {
+	c := newReplyingClient(t, make(chan Event, 10), func(string) []string { return []string{"SUCCESS: pid=42"} },
+		WithCommandRateLimit(50, 1))
+	defer c.Close()
+
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		if _, err := c.Pid(); err != nil {
+			t.Fatalf("Pid returned error: %s", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Errorf("5 commands at 50/s took %s; want at least 80ms", elapsed)
+	}
+
+	// the waiting command respects the deadline
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	c.Pid()
+	if _, err := c.LatestStatus3Context(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("rate limited LatestStatus3Context returned %v; want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestCommandRateLimitClose(t *testing.T) {
+	c := newReplyingClient(t, make(chan Event, 10), func(string) []string { return []string{"SUCCESS: pid=42"} },
+		WithCommandRateLimit(0.1, 1))
+	if _, err := c.Pid(); err != nil {
+		t.Fatalf("Pid returned error: %s", err)
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := c.Pid()
+		errCh <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	c.Close()
+	select {
+	case err := <-errCh:
+		if !errors.Is(err, ErrClientClosed) {
+			t.Errorf("rate limited Pid returned %v; want %v", err, ErrClientClosed)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("rate limited Pid isn't interrupted by Close")
+	}
+}
@@ -0,0 +1,134 @@
+package ovmgmt
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// longer lines are truncated in the history, so the history doesn't
+// keep a lot of memory
+const rawLineHistoryMaxLen = 512
+const rawLineTruncatedSuffix = "..."
+
+// rawLineRing is a ring buffer of the last raw lines.
+type rawLineRing struct {
+	mu    sync.Mutex
+	lines []string
+	next  int
+	full  bool
+	// options of the client, secrets are redacted from the lines
+	opts *parseOptions
+}
+
+func newRawLineRing(n int, o *parseOptions) *rawLineRing {
+	return &rawLineRing{lines: make([]string, n), opts: o}
+}
+
+// add copies the line into the buffer with secrets redacted, it's safe
+// to reuse line after the call
+func (r *rawLineRing) add(line []byte) {
+	s := redactEventLine(string(line), r.opts)
+	if len(s) > rawLineHistoryMaxLen {
+		s = s[:rawLineHistoryMaxLen] + rawLineTruncatedSuffix
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lines[r.next] = s
+	r.next++
+	if r.next == len(r.lines) {
+		r.next = 0
+		r.full = true
+	}
+}
+
+// recent returns a copy of buffered lines, the oldest first
+func (r *rawLineRing) recent() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.full {
+		lines := make([]string, r.next)
+		copy(lines, r.lines[:r.next])
+		return lines
+	}
+	lines := make([]string, 0, len(r.lines))
+	lines = append(lines, r.lines[r.next:]...)
+	return append(lines, r.lines[:r.next]...)
+}
+
+// RecentRawLines returns the last raw lines received from OpenVPN, the oldest
+// first. It returns nil unless the client is created with WithRawLineHistory.
+func (c *MgmtClient) RecentRawLines() []string {
+	if c.rawLines == nil {
+		return nil
+	}
+	return c.rawLines.recent()
+}
+
+// attachRecentRawLines attaches the recent raw lines to FATAL
+// and malformed events
+func (c *MgmtClient) attachRecentRawLines(evt Event) Event {
+	if c.rawLines == nil {
+		return evt
+	}
+	switch e := evt.(type) {
+	case MalformedEvent:
+		e.recentLines = c.rawLines.recent()
+		return e
+	case FatalEvent:
+		e.recentLines = c.rawLines.recent()
+		return e
+	case SimpleEvent:
+		if e.keyword == fatalEventKW {
+			e.recentLines = c.rawLines.recent()
+			return e
+		}
+	}
+	return evt
+}
+
+const (
+	clientEnvLinePrefix        = ">" + clientEventKW + eventSep + "ENV" + fieldSep
+	clientCRResponseLinePrefix = ">" + clientEventKW + eventSep + string(CECRResponse) + fieldSep
+	authTokenLinePrefix        = ">" + passwordEventKW + eventSep + authTokenPrefix
+	echoLinePrefix             = ">" + echoEventKW + eventSep
+)
+
+// redactEventLine returns the raw line received from the daemon with
+// secrets replaced: values of the redacted env variables of CLIENT
+// notifications (see WithRedactedEnvKeys), the challenge response, and
+// the session tokens of PASSWORD and ECHO notifications
+func redactEventLine(line string, o *parseOptions) string {
+	switch {
+	case strings.HasPrefix(line, clientEnvLinePrefix):
+		kv := line[len(clientEnvLinePrefix):]
+		if i := strings.IndexByte(kv, '='); i >= 0 && o.redactedEnvKeys()[kv[:i]] {
+			return line[:len(clientEnvLinePrefix)+i+1] + redactedValue
+		}
+	case strings.HasPrefix(line, clientCRResponseLinePrefix):
+		// {CID},{KID},{response_base64}
+		if parts := strings.SplitN(line[len(clientCRResponseLinePrefix):], fieldSep, 3); len(parts) == 3 {
+			return clientCRResponseLinePrefix + parts[0] + fieldSep + parts[1] + fieldSep + redactedValue
+		}
+	case strings.HasPrefix(line, authTokenLinePrefix):
+		return authTokenLinePrefix + redactedValue
+	case strings.HasPrefix(line, echoLinePrefix):
+		// {timestamp},auth-token {token}
+		body := line[len(echoLinePrefix):]
+		if i := strings.Index(body, fieldSep); i >= 0 {
+			if name, _ := splitEchoDirective(body[i+1:]); name == echoAuthToken {
+				return line[:len(echoLinePrefix)+i+1] + echoAuthToken + echoArgsSep + redactedValue
+			}
+		}
+	}
+	return line
+}
+
+func recentLinesSuffix(lines []string) string {
+	if len(lines) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("; recent lines: %q", lines)
+}
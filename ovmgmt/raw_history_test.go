@@ -0,0 +1,177 @@
+package ovmgmt
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRawLineRing(t *testing.T) {
+	r := newRawLineRing(3, nil)
+	if got := r.recent(); len(got) != 0 {
+		t.Errorf("recent returned %q; want empty", got)
+	}
+
+	buf := []byte("line 1")
+	r.add(buf)
+	// the ring must keep its own copy
+	copy(buf, "LINE X")
+	r.add([]byte("line 2"))
+	if got, want := r.recent(), []string{"line 1", "line 2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("recent returned %q; want %q", got, want)
+	}
+
+	for i := 3; i <= 7; i++ {
+		r.add([]byte(fmt.Sprintf("line %d", i)))
+	}
+	got := r.recent()
+	if want := []string{"line 5", "line 6", "line 7"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("recent returned %q; want %q", got, want)
+	}
+	got[0] = "modified"
+	if r.recent()[0] != "line 5" {
+		t.Errorf("recent returned slice aliasing the ring")
+	}
+
+	long := strings.Repeat("x", 100000)
+	r.add([]byte(long))
+	got = r.recent()
+	if want := strings.Repeat("x", rawLineHistoryMaxLen) + rawLineTruncatedSuffix; got[2] != want {
+		t.Errorf("recent returned line of %d bytes; want %d", len(got[2]), len(want))
+	}
+}
+
+func TestRecentRawLines(t *testing.T) {
+	lines := []string{
+		">INFO:OpenVPN Management Interface Version 1",
+		">STATE:1584536294,CONNECTED,SUCCESS,10.8.0.6,192.168.4.1",
+		">garbage",
+		">BYTECOUNT:1,2",
+	}
+
+	events := replayEvents(lines)
+	if got := events[2].String(); strings.Contains(got, "recent lines") {
+		t.Errorf("MalformedEvent String returned %q; want no recent lines", got)
+	}
+
+	eventCh := make(chan Event, 10)
+	c := NewMgmtClientWithOptions(mockConn{mockReader(lines), ioutil.Discard}, eventCh, WithRawLineHistory(2))
+	events = events[:0]
+	for evt := range eventCh {
+		events = append(events, evt)
+	}
+	if len(events) != 5 {
+		t.Fatalf("got %d events; want 5: %v", len(events), events)
+	}
+	// demultiplexer may read ahead, so the tail may include the next line
+	want := `Malformed Event "garbage"; recent lines: [`
+	if got := events[2].String(); !strings.HasPrefix(got, want) || !strings.Contains(got, `">garbage"`) {
+		t.Errorf("MalformedEvent String returned %q; want recent lines", got)
+	}
+	if got, want := c.RecentRawLines(), lines[2:]; !reflect.DeepEqual(got, want) {
+		t.Errorf("RecentRawLines returned %q; want %q", got, want)
+	}
+
+	// FATAL
+	eventCh = make(chan Event, 10)
+	r := io.MultiReader(mockReader([]string{">LOG:1584536294,I,msg", "SUCCESS: pid=1"}), &alwaysErroringReader{})
+	c = NewMgmtClientWithOptions(mockConn{r, ioutil.Discard}, eventCh, WithRawLineHistory(5))
+	if _, err := c.Pid(); err != nil {
+		t.Fatal(err)
+	}
+	var fatal Event
+	for evt := range eventCh {
+		fatal = evt
+	}
+	want = `FATAL: Error reading from OpenVPN: mock error; recent lines: [">LOG:1584536294,I,msg" "SUCCESS: pid=1"]`
+	if got := fatal.String(); got != want {
+		t.Errorf("FATAL String returned %q; want %q", got, want)
+	}
+
+	if got := NewMgmtClient(mockConn{mockReader(nil), ioutil.Discard}, make(chan Event)).RecentRawLines(); got != nil {
+		t.Errorf("RecentRawLines returned %q; want nil", got)
+	}
+}
+
+func TestRecentRawLinesConcurrent(t *testing.T) {
+	lines := make([]string, 1000)
+	for i := range lines {
+		lines[i] = fmt.Sprintf(">BYTECOUNT:%d,%d", i, i)
+	}
+
+	eventCh := make(chan Event, len(lines))
+	c := NewMgmtClientWithOptions(mockConn{mockReader(lines), ioutil.Discard}, eventCh, WithRawLineHistory(10))
+	for range eventCh {
+		if n := len(c.RecentRawLines()); n > 10 {
+			t.Fatalf("RecentRawLines returned %d lines; want at most 10", n)
+		}
+	}
+	if got, want := c.RecentRawLines(), lines[990:]; !reflect.DeepEqual(got, want) {
+		t.Errorf("RecentRawLines returned %q; want %q", got, want)
+	}
+}
+
+func TestRedactEventLine(t *testing.T) {
+	type TestCase struct {
+		Line string
+		Want string
+	}
+
+	testCases := []TestCase{
+		{">CLIENT:ENV,password=s3cret", ">CLIENT:ENV,password=***"},
+		{">CLIENT:ENV,auth_token=s3cret=", ">CLIENT:ENV,auth_token=***"},
+		{">CLIENT:ENV,common_name=alice", ">CLIENT:ENV,common_name=alice"},
+		{">CLIENT:ENV,END", ">CLIENT:ENV,END"},
+		{">CLIENT:CR_RESPONSE,5,1,c2VjcmV0", ">CLIENT:CR_RESPONSE,5,1,***"},
+		{">CLIENT:CONNECT,5,1", ">CLIENT:CONNECT,5,1"},
+		{">PASSWORD:Auth-Token:s3cret", ">PASSWORD:Auth-Token:***"},
+		{">PASSWORD:Need 'Auth' username/password", ">PASSWORD:Need 'Auth' username/password"},
+		{">ECHO:1584536294,auth-token s3cret", ">ECHO:1584536294,auth-token ***"},
+		{">ECHO:1584536294,msg-window hello", ">ECHO:1584536294,msg-window hello"},
+		{"SUCCESS: password is correct", "SUCCESS: password is correct"},
+	}
+
+	for i, tc := range testCases {
+		if got := redactEventLine(tc.Line, nil); got != tc.Want {
+			t.Errorf("test %d got %q; want %q", i, got, tc.Want)
+		}
+	}
+
+	// the keys of the client
+	o := &parseOptions{redactedEnvKeySet: envKeySet([]string{"pin"})}
+	if got, want := redactEventLine(">CLIENT:ENV,pin=1234", o), ">CLIENT:ENV,pin=***"; got != want {
+		t.Errorf("got %q; want %q", got, want)
+	}
+	if got, want := redactEventLine(">CLIENT:ENV,password=s3cret", o), ">CLIENT:ENV,password=s3cret"; got != want {
+		t.Errorf("got %q; want %q", got, want)
+	}
+}
+
+func TestRecentRawLinesRedacted(t *testing.T) {
+	const secret = "s3cret"
+	eventCh := make(chan Event, 10)
+	r := io.MultiReader(mockReader([]string{
+		">CLIENT:CONNECT,5,1",
+		">CLIENT:ENV,password=" + secret,
+		">PASSWORD:Auth-Token:" + secret,
+	}), &alwaysErroringReader{})
+	c := NewMgmtClientWithOptions(mockConn{r, ioutil.Discard}, eventCh, WithRawLineHistory(5))
+	var fatal Event
+	for evt := range eventCh {
+		fatal = evt
+	}
+	if _, ok := fatal.(FatalEvent); !ok {
+		t.Fatalf("got %v; want FatalEvent", fatal)
+	}
+	if got := fatal.String(); strings.Contains(got, secret) || !strings.Contains(got, "password=***") {
+		t.Errorf("FatalEvent String returned %q; want the secret redacted", got)
+	}
+	for _, line := range c.RecentRawLines() {
+		if strings.Contains(line, secret) {
+			t.Errorf("RecentRawLines returned %q", line)
+		}
+	}
+}
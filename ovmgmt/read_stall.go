@@ -0,0 +1,72 @@
+package ovmgmt
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// ErrReadStall is matched by the error of FatalEvent emitted by the client
+// created with WithReadStallTimeout, when nothing is received in time.
+var ErrReadStall = newCategoryError(ErrTimeout, "read stalled", nil)
+
+func readStallError(timeout time.Duration) error {
+	return fmt.Errorf("%w: nothing received from OpenVPN in %s", ErrReadStall, timeout)
+}
+
+type readDeadliner interface {
+	SetReadDeadline(t time.Time) error
+}
+
+// stallReader arms the read deadline before each read of the connection
+type stallReader struct {
+	r       io.Reader
+	dl      readDeadliner
+	timeout time.Duration
+}
+
+// newStallReader returns the stallReader of the connection, ok is false
+// if it doesn't support read deadlines
+func newStallReader(conn io.Reader, timeout time.Duration) (r *stallReader, ok bool) {
+	dl, ok := conn.(readDeadliner)
+	if !ok || dl.SetReadDeadline(time.Time{}) != nil {
+		return nil, false
+	}
+	return &stallReader{r: conn, dl: dl, timeout: timeout}, true
+}
+
+func (r *stallReader) Read(p []byte) (int, error) {
+	if err := r.dl.SetReadDeadline(time.Now().Add(r.timeout)); err != nil {
+		return 0, err
+	}
+	n, err := r.r.Read(p)
+	if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		logErrorf("Read stall: nothing received in %s", r.timeout)
+		err = readStallError(r.timeout)
+	}
+	return n, err
+}
+
+// readStallWatchdog terminates the client once nothing is received for
+// the timeout, for the connections without read deadlines
+func (c *MgmtClient) readStallWatchdog(timeout time.Duration) {
+	defer c.generatorsWG.Done()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+		case <-c.ctx.Done():
+			return
+		}
+		if idle := c.sinceLastLine(); idle < timeout {
+			timer.Reset(timeout - idle)
+			continue
+		}
+		logErrorf("Read stall: nothing received in %s", timeout)
+		c.abort(readStallError(timeout))
+		return
+	}
+}
@@ -0,0 +1,81 @@
+package ovmgmt
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestReadStallTimeout(t *testing.T) {
+	defer checkGoroutineLeaks(t)()
+
+	type TestCase struct {
+		Name string
+		// returns the client end and the daemon one
+		Conns func() (io.ReadWriter, io.WriteCloser)
+	}
+	testCases := []TestCase{
+		{"read deadline", func() (io.ReadWriter, io.WriteCloser) {
+			daemonConn, clientConn := net.Pipe()
+			go io.Copy(ioutil.Discard, daemonConn)
+			return clientConn, daemonConn
+		}},
+		{"watchdog", func() (io.ReadWriter, io.WriteCloser) {
+			r, w := io.Pipe()
+			return mockConn{r, ioutil.Discard}, w
+		}},
+	}
+
+	const timeout = 50 * time.Millisecond
+	const logLines = 5
+	for _, tc := range testCases {
+		clientConn, daemonConn := tc.Conns()
+		eventCh := make(chan Event, 10)
+		c := NewMgmtClientWithOptions(clientConn, eventCh, WithReadStallTimeout(timeout))
+
+		// the daemon is alive for a while, longer than the timeout
+		for i := 0; i < logLines; i++ {
+			time.Sleep(timeout / 2)
+			io.WriteString(daemonConn, ">LOG:1584536294,I,msg\n")
+		}
+		stalled := time.Now()
+
+		var events []Event
+		for evt := range eventCh {
+			events = append(events, evt)
+		}
+		if elapsed := time.Since(stalled); elapsed > timeout+100*time.Millisecond {
+			t.Errorf("%s: detected after %s", tc.Name, elapsed)
+		}
+		if len(events) != logLines+1 {
+			t.Fatalf("%s: got %d events; want %d: %v", tc.Name, len(events), logLines+1, events)
+		}
+		fatal, ok := events[logLines].(FatalEvent)
+		if !ok || !errors.Is(fatal.Err(), ErrReadStall) || !errors.Is(c.Err(), ErrReadStall) {
+			t.Errorf("%s: got %#v, Err %v; want FatalEvent of %v", tc.Name, events[logLines], c.Err(), ErrReadStall)
+		}
+		want := "FATAL: Error reading from OpenVPN: read stalled: nothing received from OpenVPN in 50ms"
+		if got := fatal.String(); got != want {
+			t.Errorf("%s: got %q; want %q", tc.Name, got, want)
+		}
+		c.Close()
+		daemonConn.Close()
+	}
+}
+
+func TestNewStallReader(t *testing.T) {
+	daemonConn, clientConn := net.Pipe()
+	defer daemonConn.Close()
+	defer clientConn.Close()
+	if _, ok := newStallReader(clientConn, time.Second); !ok {
+		t.Errorf("newStallReader of net.Conn returned false")
+	}
+	r, w := io.Pipe()
+	defer w.Close()
+	if _, ok := newStallReader(r, time.Second); ok {
+		t.Errorf("newStallReader of io.PipeReader returned true")
+	}
+}
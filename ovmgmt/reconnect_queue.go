@@ -0,0 +1,156 @@
+package ovmgmt
+
+import (
+	"context"
+	"time"
+)
+
+// ReconnectOption configures ReconnectingClient, see DialReconnecting.
+type ReconnectOption func(*reconnectOptions)
+
+type reconnectOptions struct {
+	queue        bool
+	maxQueued    int
+	maxQueueWait time.Duration
+}
+
+// WithCommandQueue makes the commands of ReconnectingClient issued while
+// the connection is being re-established wait for it, instead of failing
+// with ErrNotConnected, which is the default. The queued commands are
+// issued in order once the connection is re-established and the settings
+// are applied.
+//
+// Up to maxDepth commands are queued, the others fail with ErrNotConnected
+// right away, as the ones which aren't issued within maxWait. The context
+// of the command (e.g. of LatestStatus3Context) limits the wait as well.
+// The queued commands fail with ErrClientClosed once the client is closed.
+// Zero maxDepth or maxWait means no limit.
+func WithCommandQueue(maxDepth int, maxWait time.Duration) ReconnectOption {
+	return func(o *reconnectOptions) {
+		o.queue = true
+		o.maxQueued = maxDepth
+		o.maxQueueWait = maxWait
+	}
+}
+
+// queuedCommand is the command waiting for the connection
+type queuedCommand struct {
+	fn  func(c *MgmtClient) error
+	err error
+	// closed once the command is done, err is set by then
+	done chan struct{}
+}
+
+// do runs the command on the connected client, or queues it while
+// disconnected, with WithCommandQueue
+func (r *ReconnectingClient) do(ctx context.Context, fn func(c *MgmtClient) error) error {
+	r.mu.Lock()
+	c, err := r.currentLocked()
+	if err != ErrNotConnected || !r.opts.queue {
+		r.mu.Unlock()
+		if err != nil {
+			return err
+		}
+		return fn(c)
+	}
+	if r.opts.maxQueued > 0 && len(r.queue) >= r.opts.maxQueued {
+		r.mu.Unlock()
+		return ErrNotConnected
+	}
+	q := &queuedCommand{fn: fn, done: make(chan struct{})}
+	r.queue = append(r.queue, q)
+	r.mu.Unlock()
+
+	var timeout <-chan time.Time
+	if r.opts.maxQueueWait > 0 {
+		timer := time.NewTimer(r.opts.maxQueueWait)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case <-q.done:
+		return q.err
+	case <-timeout:
+		err = ErrNotConnected
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-r.ctx.Done():
+		err = ErrClientClosed
+	}
+	if r.dequeue(q) {
+		return err
+	}
+	// it's being issued, fn honors the context if it takes one
+	<-q.done
+	return q.err
+}
+
+// dequeue removes the command from the queue, unless it's taken already
+func (r *ReconnectingClient) dequeue(q *queuedCommand) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, queued := range r.queue {
+		if queued == q {
+			r.queue = append(r.queue[:i], r.queue[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// PendingCommands returns the number of commands waiting for
+// the connection, see WithCommandQueue.
+func (r *ReconnectingClient) PendingCommands() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.queue)
+}
+
+// publish makes the reconnected client current once the queued commands
+// are issued on it, in order. It returns the channel closed when it's
+// done, nil if it's published right away. The commands are left queued
+// if the client dies or the ReconnectingClient is closed in the meantime.
+func (r *ReconnectingClient) publish(c *MgmtClient) <-chan struct{} {
+	r.mu.Lock()
+	if len(r.queue) == 0 {
+		r.client = c
+		r.mu.Unlock()
+		return nil
+	}
+	r.mu.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		for {
+			r.mu.Lock()
+			if r.ctx.Err() != nil || c.terminatedError() != nil {
+				r.mu.Unlock()
+				return
+			}
+			if len(r.queue) == 0 {
+				r.client = c
+				r.mu.Unlock()
+				return
+			}
+			q := r.queue[0]
+			r.queue = r.queue[1:]
+			r.mu.Unlock()
+
+			q.err = q.fn(c)
+			close(q.done)
+		}
+	}()
+	return drained
+}
+
+// failQueued fails the queued commands with the error
+func (r *ReconnectingClient) failQueued(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, q := range r.queue {
+		q.err = err
+		close(q.done)
+	}
+	r.queue = nil
+}
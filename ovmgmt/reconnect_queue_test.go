@@ -0,0 +1,244 @@
+package ovmgmt
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// disconnect restarts the daemon of the flapping server, which is stopped
+// until it's started again
+func disconnect(t *testing.T, srv *flappingServer, eventCh <-chan Event) {
+	t.Helper()
+	srv.stop()
+	(<-srv.conns).Close()
+	if _, ok := nextEventOf(t, eventCh).(DisconnectedEvent); !ok {
+		t.Fatalf("got no DisconnectedEvent")
+	}
+}
+
+// waitPending waits until n commands are queued
+func waitPending(t *testing.T, r *ReconnectingClient, n int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for r.PendingCommands() != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d commands are queued; want %d", r.PendingCommands(), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestCommandQueue(t *testing.T) {
+	defer checkGoroutineLeaks(t)()
+
+	srv := newFlappingServer(t)
+	defer srv.stop()
+	eventCh := make(chan Event, 10)
+	r, err := DialReconnecting(context.Background(), srv.dial, eventCh, RetryOptions{InitialDelay: 5 * time.Millisecond, MaxDelay: 20 * time.Millisecond},
+		WithCommandQueue(10, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	disconnect(t, srv, eventCh)
+
+	// queued in order
+	errs := make(chan error, 3)
+	var pid int
+	go func() { errs <- r.SendSignal("SIGUSR1") }()
+	waitPending(t, r, 1)
+	go func() {
+		var err error
+		pid, err = r.Pid()
+		errs <- err
+	}()
+	waitPending(t, r, 2)
+	go func() { errs <- r.HoldRelease() }()
+	waitPending(t, r, 3)
+
+	srv.start(srv.addr)
+	srv.expectCmds(`signal "SIGUSR1"`, "pid", "hold release")
+	for i := 0; i < 3; i++ {
+		if err := <-errs; err != nil {
+			t.Errorf("queued command returned %v", err)
+		}
+	}
+	if pid != 42 {
+		t.Errorf("queued Pid returned %d; want 42", pid)
+	}
+	if _, ok := nextEventOf(t, eventCh).(ReconnectedEvent); !ok {
+		t.Errorf("got no ReconnectedEvent")
+	}
+	if n := r.PendingCommands(); n != 0 {
+		t.Errorf("%d commands are queued after the reconnection", n)
+	}
+	if _, err := r.Pid(); err != nil {
+		t.Errorf("Pid after the reconnection returned %v", err)
+	}
+	(<-srv.conns).Close()
+}
+
+func TestCommandQueueLimits(t *testing.T) {
+	defer checkGoroutineLeaks(t)()
+
+	srv := newFlappingServer(t)
+	eventCh := make(chan Event, 10)
+	r, err := DialReconnecting(context.Background(), srv.dial, eventCh, RetryOptions{InitialDelay: time.Hour},
+		WithCommandQueue(1, 100*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	disconnect(t, srv, eventCh)
+
+	start := time.Now()
+	errs := make(chan error, 1)
+	go func() {
+		_, err := r.Pid()
+		errs <- err
+	}()
+	waitPending(t, r, 1)
+
+	// the queue is full
+	if _, err := r.Pid(); err != ErrNotConnected {
+		t.Errorf("Pid with the full queue returned %v; want %v", err, ErrNotConnected)
+	}
+	// not issued in time
+	if err := <-errs; err != ErrNotConnected {
+		t.Errorf("queued Pid returned %v; want %v", err, ErrNotConnected)
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("queued Pid returned after %s; want the max wait", elapsed)
+	}
+
+	// the own deadline is shorter
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := r.LatestStatus3Context(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("queued LatestStatus3Context returned %v; want %v", err, context.DeadlineExceeded)
+	}
+	if n := r.PendingCommands(); n != 0 {
+		t.Errorf("%d commands are queued after their timeouts", n)
+	}
+}
+
+func TestCommandQueueClose(t *testing.T) {
+	defer checkGoroutineLeaks(t)()
+
+	srv := newFlappingServer(t)
+	eventCh := make(chan Event, 10)
+	r, err := DialReconnecting(context.Background(), srv.dial, eventCh, RetryOptions{InitialDelay: time.Hour},
+		WithCommandQueue(0, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	disconnect(t, srv, eventCh)
+
+	const n = 5
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		go func() { errs <- r.HoldRelease() }()
+	}
+	waitPending(t, r, n)
+
+	r.Close()
+	for i := 0; i < n; i++ {
+		select {
+		case err := <-errs:
+			if err != ErrClientClosed {
+				t.Errorf("queued HoldRelease returned %v; want %v", err, ErrClientClosed)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("queued commands aren't failed by Close")
+		}
+	}
+	if n := r.PendingCommands(); n != 0 {
+		t.Errorf("%d commands are queued after Close", n)
+	}
+}
+
+func TestCommandQueueFlapping(t *testing.T) {
+	defer checkGoroutineLeaks(t)()
+
+	srv := newFlappingServer(t)
+	defer srv.stop()
+	// the commands aren't checked
+	cmdsDone := make(chan struct{})
+	defer close(cmdsDone)
+	go func() {
+		for {
+			select {
+			case <-srv.cmds:
+			case <-cmdsDone:
+				return
+			}
+		}
+	}()
+	eventCh := make(chan Event, 10)
+	r, err := DialReconnecting(context.Background(), srv.dial, eventCh, RetryOptions{InitialDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond},
+		WithCommandQueue(0, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for range eventCh {
+		}
+	}()
+
+	stop := make(chan struct{})
+	flapped := make(chan struct{})
+	go func() {
+		defer close(flapped)
+		for {
+			select {
+			case conn := <-srv.conns:
+				time.Sleep(5 * time.Millisecond)
+				srv.stop()
+				conn.Close()
+				time.Sleep(5 * time.Millisecond)
+				srv.start(srv.addr)
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	const workers, calls = 8, 20
+	var wg sync.WaitGroup
+	errs := make(chan error, workers*calls)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < calls; j++ {
+				if pid, err := r.Pid(); err == nil && pid != 42 {
+					t.Errorf("Pid returned %d; want 42", pid)
+				} else {
+					errs <- err
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(stop)
+	<-flapped
+	close(errs)
+
+	// the ones in flight on the dying connection fail, the queued ones
+	// don't
+	for err := range errs {
+		if err != nil && !errors.Is(err, ErrClosed) {
+			t.Errorf("Pid returned %v", err)
+		}
+	}
+	if n := r.PendingCommands(); n != 0 {
+		t.Errorf("%d commands are queued", n)
+	}
+	r.Close()
+	if c := r.Client(); c != nil {
+		c.Close()
+	}
+}
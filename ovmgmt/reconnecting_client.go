@@ -0,0 +1,504 @@
+package ovmgmt
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const disconnectedEventKW = "DISCONNECTED"
+const reconnectedEventKW = "RECONNECTED"
+
+// reconnectEventBuffer is the buffer depth of the event channel of
+// the underlying clients, their events are forwarded to the caller's one
+const reconnectEventBuffer = 64
+
+// ErrNotConnected is returned by commands of ReconnectingClient issued
+// while the connection is being re-established.
+var ErrNotConnected = NewOVpnError("not connected")
+
+// DialFunc connects a new client emitting events on the given channel,
+// e.g. a wrapper of DialContext or DialTLS. The context limits
+// the connection establishment only.
+type DialFunc func(ctx context.Context, eventCh chan<- Event) (*MgmtClient, error)
+
+// DisconnectedEvent is a synthetic event emitted by ReconnectingClient
+// when the connection dies, in place of FatalEvent. The reconnection
+// starts right after it.
+type DisconnectedEvent struct {
+	receivedAt
+	err error
+}
+
+func (e DisconnectedEvent) Keyword() string {
+	return disconnectedEventKW
+}
+
+func (e DisconnectedEvent) Raw() string {
+	return fmt.Sprintf("%s%s%v", disconnectedEventKW, eventSep, e.err)
+}
+
+// Err returns the error the connection is terminated with, see
+// MgmtClient.Err.
+func (e DisconnectedEvent) Err() error {
+	return e.err
+}
+
+func (e DisconnectedEvent) String() string {
+	return Sanitize(fmt.Sprintf("%s: %v", disconnectedEventKW, e.err))
+}
+
+// ReconnectedEvent is a synthetic event emitted by ReconnectingClient when
+// the connection is re-established and the recorded settings are applied.
+type ReconnectedEvent struct {
+	receivedAt
+	attempts int
+}
+
+func (e ReconnectedEvent) Keyword() string {
+	return reconnectedEventKW
+}
+
+func (e ReconnectedEvent) Raw() string {
+	return fmt.Sprintf("%s%s%d", reconnectedEventKW, eventSep, e.attempts)
+}
+
+// Attempts returns the number of dial attempts it has taken.
+func (e ReconnectedEvent) Attempts() int {
+	return e.attempts
+}
+
+func (e ReconnectedEvent) String() string {
+	return fmt.Sprintf("%s: after %d attempts", reconnectedEventKW, e.attempts)
+}
+
+// reconnectSettings are the event-enabling settings replayed on
+// reconnection, nil ones are not set by the caller
+type reconnectSettings struct {
+	log       *bool
+	state     *bool
+	echo      *bool
+	byteCount *time.Duration
+	verbosity *int
+	status3   *status3Setting
+}
+
+type status3Setting struct {
+	interval time.Duration
+	opts     []Status3Option
+}
+
+// ReconnectingClient is a client which survives OpenVPN restarts. When
+// the connection dies, it emits DisconnectedEvent, redials with
+// exponential backoff, applies the event-enabling settings made so far
+// (SetLogEvents, SetStateEvents, SetEchoEvents, SetByteCountEvents,
+// SetVerbosityLevel and SetStatus3Events) and emits ReconnectedEvent.
+//
+// The event channel stays open across reconnections. It's closed once
+// the client is closed with Close, or when the redial gives up after
+// RetryOptions.MaxAttempts; FatalEvent of the last dial error is emitted
+// before it then.
+//
+// Commands issued while the connection is being re-established fail with
+// ErrNotConnected, unless they are queued, see WithCommandQueue.
+type ReconnectingClient struct {
+	dial    DialFunc
+	eventCh chan<- Event
+	retry   RetryOptions
+	opts    reconnectOptions
+
+	// mu guards client, which is nil while disconnected, settings
+	// and queue
+	mu       sync.Mutex
+	client   *MgmtClient
+	settings reconnectSettings
+	queue    []*queuedCommand
+
+	// ctx is canceled by Close, it interrupts the backoff; it's canceled
+	// as well once the client terminates
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+	// set before done is closed
+	err error
+}
+
+// DialReconnecting connects the ReconnectingClient with the given dial
+// function. The first connection is retried as DialRetry does, until
+// the context is done; the reconnections are retried on any error.
+// The options configure the client, e.g. WithCommandQueue.
+//
+// See the NewMgmtClient docs for discussion about the requirements for
+// eventCh.
+func DialReconnecting(ctx context.Context, dial DialFunc, eventCh chan<- Event, retry RetryOptions, opts ...ReconnectOption) (*ReconnectingClient, error) {
+	r := &ReconnectingClient{
+		dial:    dial,
+		eventCh: eventCh,
+		retry:   retry.withDefaults(),
+		done:    make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(&r.opts)
+	}
+
+	// the channel of the failed attempt may be closed, e.g. by the client
+	// which has failed the handshake check, each attempt has its own one
+	var innerCh chan Event
+	b := newBackoff(r.retry)
+	for attempt := 1; ; attempt++ {
+		innerCh = make(chan Event, reconnectEventBuffer)
+		c, err := dial(ctx, innerCh)
+		if err == nil {
+			r.client = c
+			break
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, fmt.Errorf("%w, last error: %v", ctxErr, err)
+		}
+		if !isRetryableDialError(err) || (r.retry.MaxAttempts > 0 && attempt >= r.retry.MaxAttempts) {
+			return nil, err
+		}
+		if !sleepContext(ctx, b.next()) {
+			return nil, fmt.Errorf("%w, last error: %v", ctx.Err(), err)
+		}
+	}
+
+	r.ctx, r.cancel = context.WithCancel(context.Background())
+	go r.supervise(r.client, innerCh)
+	return r, nil
+}
+
+// supervise forwards the events of the connected client and reconnects
+// when it dies, until the client is closed or the redial gives up
+func (r *ReconnectingClient) supervise(c *MgmtClient, innerCh chan Event) {
+	defer close(r.done)
+	defer close(r.eventCh)
+	defer r.failQueued(ErrClientClosed)
+	defer r.cancel()
+
+	var replayed chan error
+	attempts := 0
+	for {
+		if drained := r.forward(c, innerCh, replayed, attempts); drained != nil {
+			<-drained
+		}
+
+		r.mu.Lock()
+		r.client = nil
+		r.mu.Unlock()
+		if r.ctx.Err() != nil {
+			return
+		}
+		if !r.emit(DisconnectedEvent{receivedAt{time.Now()}, c.Err()}) {
+			return
+		}
+
+		var err error
+		c, innerCh, attempts, err = r.redial()
+		if err != nil {
+			if r.ctx.Err() == nil {
+				r.err = err
+				evt := FatalEvent{err: err, desc: "Error reconnecting to OpenVPN"}
+				r.emit(stampEvent(evt, time.Now()))
+			}
+			return
+		}
+
+		// the events are forwarded while the settings are applied,
+		// the replies may be queued behind them
+		replayed = make(chan error, 1)
+		go func(c *MgmtClient, replayed chan<- error) {
+			replayed <- r.replay(c)
+		}(c, replayed)
+	}
+}
+
+// forward copies the events of the client until its channel is closed,
+// except for FatalEvent, which is replaced by DisconnectedEvent. If
+// replayed is not nil, the client is published and ReconnectedEvent
+// is emitted once the settings are applied successfully. The client
+// is closed once the ReconnectingClient is. It returns the channel
+// of publish, if any.
+func (r *ReconnectingClient) forward(c *MgmtClient, innerCh chan Event, replayed chan error, attempts int) <-chan struct{} {
+	var drained <-chan struct{}
+	ctxDone := r.ctx.Done()
+	for {
+		select {
+		case evt, ok := <-innerCh:
+			if !ok {
+				return drained
+			}
+			if _, fatal := untagEvent(evt).(FatalEvent); !fatal {
+				r.emit(evt)
+			}
+		case err := <-replayed:
+			replayed = nil
+			if err != nil {
+				// the connection is dying, the channel is closed soon
+				continue
+			}
+			drained = r.publish(c)
+			r.emit(ReconnectedEvent{receivedAt{time.Now()}, attempts})
+		case <-ctxDone:
+			ctxDone = nil
+			// its event channel is closed by then
+			c.Close()
+		}
+	}
+}
+
+// redial connects a new client with backoff, until it's closed. It
+// returns the event channel of the client, which is a new one for each
+// attempt, and the number of attempts it has taken.
+func (r *ReconnectingClient) redial() (*MgmtClient, chan Event, int, error) {
+	b := newBackoff(r.retry)
+	for attempt := 1; ; attempt++ {
+		innerCh := make(chan Event, reconnectEventBuffer)
+		c, err := r.dial(r.ctx, innerCh)
+		if err == nil {
+			return c, innerCh, attempt, nil
+		}
+		if r.ctx.Err() != nil {
+			return nil, nil, attempt, r.ctx.Err()
+		}
+		if r.retry.MaxAttempts > 0 && attempt >= r.retry.MaxAttempts {
+			return nil, nil, attempt, err
+		}
+		if !sleepContext(r.ctx, b.next()) {
+			return nil, nil, attempt, r.ctx.Err()
+		}
+	}
+}
+
+// replay applies the recorded settings to the new client
+func (r *ReconnectingClient) replay(c *MgmtClient) error {
+	r.mu.Lock()
+	s := r.settings
+	r.mu.Unlock()
+
+	if s.verbosity != nil {
+		if err := c.SetVerbosityLevel(*s.verbosity); err != nil {
+			return err
+		}
+	}
+	if s.log != nil {
+		if err := c.SetLogEvents(*s.log); err != nil {
+			return err
+		}
+	}
+	if s.state != nil {
+		if err := c.SetStateEvents(*s.state); err != nil {
+			return err
+		}
+	}
+	if s.echo != nil {
+		if err := c.SetEchoEvents(*s.echo); err != nil {
+			return err
+		}
+	}
+	if s.byteCount != nil {
+		if err := c.SetByteCountEvents(*s.byteCount); err != nil {
+			return err
+		}
+	}
+	if s.status3 != nil {
+		c.SetStatus3Events(s.status3.interval, s.status3.opts...)
+	}
+	return nil
+}
+
+// emit sends the event to the caller's channel, unless the client
+// is closed. It reports whether the event is sent.
+func (r *ReconnectingClient) emit(evt Event) bool {
+	select {
+	case r.eventCh <- evt:
+		return true
+	case <-r.ctx.Done():
+		return false
+	}
+}
+
+// current returns the connected client
+func (r *ReconnectingClient) current() (*MgmtClient, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.currentLocked()
+}
+
+func (r *ReconnectingClient) currentLocked() (*MgmtClient, error) {
+	if r.ctx.Err() != nil {
+		return nil, ErrClientClosed
+	}
+	if r.client == nil {
+		return nil, ErrNotConnected
+	}
+	return r.client, nil
+}
+
+// record updates the settings and returns the connected client
+func (r *ReconnectingClient) record(update func(s *reconnectSettings)) (*MgmtClient, error) {
+	r.mu.Lock()
+	update(&r.settings)
+	r.mu.Unlock()
+	return r.current()
+}
+
+// Close closes the client and the current connection, interrupting
+// the reconnection if it's in progress. The event channel is closed
+// before Close returns. It's safe to call Close multiple times and
+// concurrently.
+func (r *ReconnectingClient) Close() error {
+	r.cancel()
+	<-r.done
+	return nil
+}
+
+// Done returns the channel which is closed when the client terminates,
+// either due to Close or to giving up the reconnection.
+func (r *ReconnectingClient) Done() <-chan struct{} {
+	return r.done
+}
+
+// Err returns the last dial error if the client has given up
+// the reconnection, nil otherwise.
+func (r *ReconnectingClient) Err() error {
+	select {
+	case <-r.done:
+		return r.err
+	default:
+		return nil
+	}
+}
+
+// Client returns the current connection, nil while it's being
+// re-established.
+func (r *ReconnectingClient) Client() *MgmtClient {
+	c, _ := r.current()
+	return c
+}
+
+// SetLogEvents is MgmtClient.SetLogEvents, the setting is recorded
+// and applied on reconnection even if ErrNotConnected is returned.
+func (r *ReconnectingClient) SetLogEvents(on bool) error {
+	c, err := r.record(func(s *reconnectSettings) { s.log = &on })
+	if err != nil {
+		return err
+	}
+	return c.SetLogEvents(on)
+}
+
+// SetStateEvents is MgmtClient.SetStateEvents, the setting is recorded
+// and applied on reconnection even if ErrNotConnected is returned.
+func (r *ReconnectingClient) SetStateEvents(on bool) error {
+	c, err := r.record(func(s *reconnectSettings) { s.state = &on })
+	if err != nil {
+		return err
+	}
+	return c.SetStateEvents(on)
+}
+
+// SetEchoEvents is MgmtClient.SetEchoEvents, the setting is recorded
+// and applied on reconnection even if ErrNotConnected is returned.
+func (r *ReconnectingClient) SetEchoEvents(on bool) error {
+	c, err := r.record(func(s *reconnectSettings) { s.echo = &on })
+	if err != nil {
+		return err
+	}
+	return c.SetEchoEvents(on)
+}
+
+// SetByteCountEvents is MgmtClient.SetByteCountEvents, the setting is
+// recorded and applied on reconnection even if ErrNotConnected is returned.
+func (r *ReconnectingClient) SetByteCountEvents(interval time.Duration) error {
+	c, err := r.record(func(s *reconnectSettings) { s.byteCount = &interval })
+	if err != nil {
+		return err
+	}
+	return c.SetByteCountEvents(interval)
+}
+
+// SetVerbosityLevel is MgmtClient.SetVerbosityLevel, the setting is
+// recorded and applied on reconnection even if ErrNotConnected is returned.
+func (r *ReconnectingClient) SetVerbosityLevel(level int) error {
+	c, err := r.record(func(s *reconnectSettings) { s.verbosity = &level })
+	if err != nil {
+		return err
+	}
+	return c.SetVerbosityLevel(level)
+}
+
+// SetStatus3Events is MgmtClient.SetStatus3Events, the setting is recorded
+// and applied on reconnection. It returns false once the client is closed.
+func (r *ReconnectingClient) SetStatus3Events(interval time.Duration, opts ...Status3Option) bool {
+	c, err := r.record(func(s *reconnectSettings) {
+		s.status3 = &status3Setting{interval, opts}
+	})
+	switch err {
+	case nil:
+		return c.SetStatus3Events(interval, opts...)
+	case ErrNotConnected:
+		return true
+	default:
+		return false
+	}
+}
+
+// HoldRelease is MgmtClient.HoldRelease.
+func (r *ReconnectingClient) HoldRelease() error {
+	return r.do(context.Background(), func(c *MgmtClient) error {
+		return c.HoldRelease()
+	})
+}
+
+// SendSignal is MgmtClient.SendSignal.
+func (r *ReconnectingClient) SendSignal(name string) error {
+	return r.do(context.Background(), func(c *MgmtClient) error {
+		return c.SendSignal(name)
+	})
+}
+
+// VerbosityLevel is MgmtClient.VerbosityLevel.
+func (r *ReconnectingClient) VerbosityLevel() (int, error) {
+	var level int
+	err := r.do(context.Background(), func(c *MgmtClient) (err error) {
+		level, err = c.VerbosityLevel()
+		return err
+	})
+	return level, err
+}
+
+// LatestState is MgmtClient.LatestState.
+func (r *ReconnectingClient) LatestState() (*StateEvent, error) {
+	var s *StateEvent
+	err := r.do(context.Background(), func(c *MgmtClient) (err error) {
+		s, err = c.LatestState()
+		return err
+	})
+	return s, err
+}
+
+// Pid is MgmtClient.Pid.
+func (r *ReconnectingClient) Pid() (int, error) {
+	var pid int
+	err := r.do(context.Background(), func(c *MgmtClient) (err error) {
+		pid, err = c.Pid()
+		return err
+	})
+	return pid, err
+}
+
+// LatestStatus3Context is MgmtClient.LatestStatus3Context.
+func (r *ReconnectingClient) LatestStatus3Context(ctx context.Context) (*Status3Event, error) {
+	var s *Status3Event
+	err := r.do(ctx, func(c *MgmtClient) (err error) {
+		s, err = c.LatestStatus3Context(ctx)
+		return err
+	})
+	return s, err
+}
+
+// LatestStatus3 is MgmtClient.LatestStatus3.
+func (r *ReconnectingClient) LatestStatus3() (*Status3Event, error) {
+	return r.LatestStatus3Context(context.Background())
+}
@@ -0,0 +1,303 @@
+package ovmgmt
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// flappingServer accepts management connections at a fixed address,
+// which can be stopped and restarted
+type flappingServer struct {
+	t     *testing.T
+	addr  string
+	l     net.Listener
+	conns chan net.Conn
+	cmds  chan string
+}
+
+func newFlappingServer(t *testing.T) *flappingServer {
+	s := &flappingServer{t: t, conns: make(chan net.Conn, 10), cmds: make(chan string, 100)}
+	s.start("127.0.0.1:0")
+	s.addr = s.l.Addr().String()
+	return s
+}
+
+func (s *flappingServer) start(addr string) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	s.l = l
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			s.conns <- conn
+			go fakeDaemon(conn, func(cmd string) []string {
+				s.cmds <- cmd
+				if cmd == "pid" {
+					return []string{"SUCCESS: pid=42"}
+				}
+				return []string{"SUCCESS: " + cmd}
+			})
+		}
+	}()
+}
+
+func (s *flappingServer) stop() {
+	s.l.Close()
+}
+
+func (s *flappingServer) dial(ctx context.Context, eventCh chan<- Event) (*MgmtClient, error) {
+	// the server doesn't greet the client, so the events are the ones
+	// the tests send
+	return DialWithOptions(ctx, s.addr, eventCh, WithHandshakeCheck(0))
+}
+
+func (s *flappingServer) expectCmds(cmds ...string) {
+	s.t.Helper()
+	for _, want := range cmds {
+		select {
+		case got := <-s.cmds:
+			if got != want {
+				s.t.Errorf("server got %q; want %q", got, want)
+			}
+		case <-time.After(2 * time.Second):
+			s.t.Fatalf("server didn't get %q", want)
+		}
+	}
+}
+
+func nextEventOf(t *testing.T, eventCh <-chan Event) Event {
+	t.Helper()
+	select {
+	case evt, ok := <-eventCh:
+		if !ok {
+			t.Fatalf("event channel is closed")
+		}
+		return evt
+	case <-time.After(2 * time.Second):
+		t.Fatalf("no event")
+	}
+	return nil
+}
+
+func TestReconnectingClient(t *testing.T) {
+	defer checkGoroutineLeaks(t)()
+
+	srv := newFlappingServer(t)
+	defer srv.stop()
+	eventCh := make(chan Event, 10)
+	r, err := DialReconnecting(context.Background(), srv.dial, eventCh, RetryOptions{InitialDelay: 5 * time.Millisecond, MaxDelay: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := <-srv.conns
+
+	if err := r.SetStateEvents(true); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.SetByteCountEvents(5 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+	srv.expectCmds("state on", "bytecount 5")
+	io.WriteString(conn, ">HOLD:Waiting for hold release\n")
+	if evt := nextEventOf(t, eventCh); evt.(KeywordedEvent).Keyword() != holdEventKW {
+		t.Errorf("got %s; want HOLD", evt)
+	}
+
+	for i := 0; i < 3; i++ {
+		// the daemon restarts
+		srv.stop()
+		conn.Close()
+		if evt, ok := nextEventOf(t, eventCh).(DisconnectedEvent); !ok || evt.Err() != io.EOF {
+			t.Fatalf("round %d got %#v; want DisconnectedEvent of EOF", i, evt)
+		}
+		if _, err := r.Pid(); err != ErrNotConnected {
+			t.Errorf("round %d Pid while disconnected returned %v; want %v", i, err, ErrNotConnected)
+		}
+		// recorded while disconnected
+		if err := r.SetEchoEvents(true); err != ErrNotConnected {
+			t.Errorf("round %d SetEchoEvents returned %v; want %v", i, err, ErrNotConnected)
+		}
+		srv.start(srv.addr)
+		conn = <-srv.conns
+
+		srv.expectCmds("state on", "echo on", "bytecount 5")
+		if evt, ok := nextEventOf(t, eventCh).(ReconnectedEvent); !ok || evt.Attempts() < 1 {
+			t.Fatalf("round %d got %#v; want ReconnectedEvent", i, evt)
+		}
+		if pid, err := r.Pid(); err != nil || pid != 42 {
+			t.Errorf("round %d Pid returned %d, %v; want 42", i, pid, err)
+		}
+		srv.expectCmds("pid")
+	}
+
+	if err := r.Close(); err != nil {
+		t.Errorf("Close returned %v", err)
+	}
+	r.Close()
+	for evt := range eventCh {
+		t.Errorf("got %s after Close", evt)
+	}
+	if _, err := r.Pid(); err != ErrClientClosed {
+		t.Errorf("Pid after Close returned %v; want %v", err, ErrClientClosed)
+	}
+	if r.Err() != nil {
+		t.Errorf("Err after Close returned %v", r.Err())
+	}
+	conn.Close()
+}
+
+func TestReconnectingClientCloseDuringBackoff(t *testing.T) {
+	defer checkGoroutineLeaks(t)()
+
+	srv := newFlappingServer(t)
+	eventCh := make(chan Event, 10)
+	r, err := DialReconnecting(context.Background(), srv.dial, eventCh, RetryOptions{InitialDelay: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.stop()
+	(<-srv.conns).Close()
+	if _, ok := nextEventOf(t, eventCh).(DisconnectedEvent); !ok {
+		t.Fatalf("got no DisconnectedEvent")
+	}
+
+	// the first redial fails and the backoff sleeps
+	time.Sleep(50 * time.Millisecond)
+	start := time.Now()
+	r.Close()
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Close returned after %s", elapsed)
+	}
+	if _, ok := <-eventCh; ok {
+		t.Errorf("event channel is not closed")
+	}
+}
+
+func TestReconnectingClientGiveUp(t *testing.T) {
+	defer checkGoroutineLeaks(t)()
+
+	srv := newFlappingServer(t)
+	eventCh := make(chan Event, 10)
+	r, err := DialReconnecting(context.Background(), srv.dial, eventCh, RetryOptions{InitialDelay: time.Millisecond, MaxAttempts: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.stop()
+	(<-srv.conns).Close()
+
+	var events []Event
+	for evt := range eventCh {
+		events = append(events, evt)
+	}
+	if len(events) != 2 {
+		t.Fatalf("got %d events; want 2: %v", len(events), events)
+	}
+	if _, ok := events[0].(DisconnectedEvent); !ok {
+		t.Errorf("event 0 got %#v; want DisconnectedEvent", events[0])
+	}
+	fatal, ok := events[1].(FatalEvent)
+	if !ok || !errors.Is(fatal.Err(), r.Err()) || r.Err() == nil {
+		t.Fatalf("event 1 got %#v; want FatalEvent of %v", events[1], r.Err())
+	}
+	var opErr *net.OpError
+	if !errors.As(r.Err(), &opErr) || opErr.Op != "dial" {
+		t.Errorf("Err returned %v; want dial error", r.Err())
+	}
+	<-r.Done()
+	if r.SetStatus3Events(time.Hour) {
+		t.Errorf("SetStatus3Events after giving up returned true")
+	}
+	if _, err := r.Pid(); err != ErrClientClosed {
+		t.Errorf("Pid after giving up returned %v; want %v", err, ErrClientClosed)
+	}
+	r.Close()
+}
+
+func TestDialReconnectingFailure(t *testing.T) {
+	srv := newFlappingServer(t)
+	srv.stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := DialReconnecting(ctx, srv.dial, make(chan Event), RetryOptions{InitialDelay: time.Millisecond}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("DialReconnecting returned %v; want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestReconnectingClientHandshakeFailure(t *testing.T) {
+	defer checkGoroutineLeaks(t)()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	conns := make(chan net.Conn, 3)
+	go func() {
+		for i := 0; ; i++ {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conns <- conn
+			if i == 1 {
+				// the redial fails the handshake check, and closes
+				// the event channel of its attempt
+				io.WriteString(conn, "HTTP/1.1 400 Bad Request\r\n\r\n")
+				continue
+			}
+			go greetingDaemon(conn, func(cmd string) []string {
+				if cmd == "pid" {
+					return []string{"SUCCESS: pid=42"}
+				}
+				return nil
+			})
+		}
+	}()
+	dial := func(ctx context.Context, eventCh chan<- Event) (*MgmtClient, error) {
+		return DialWithOptions(ctx, l.Addr().String(), eventCh, WithHandshakeCheck(time.Second))
+	}
+
+	eventCh := make(chan Event, 10)
+	r, err := DialReconnecting(context.Background(), dial, eventCh, RetryOptions{InitialDelay: 5 * time.Millisecond, MaxDelay: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	conn := <-conns
+	defer conn.Close()
+	nextEventOf(t, eventCh) // the greeting
+
+	conn.Close()
+	if _, ok := nextEventOf(t, eventCh).(DisconnectedEvent); !ok {
+		t.Fatalf("want DisconnectedEvent")
+	}
+	refused := <-conns
+	defer refused.Close()
+	conn = <-conns
+	defer conn.Close()
+	for {
+		evt := nextEventOf(t, eventCh)
+		if reconnected, ok := evt.(ReconnectedEvent); ok {
+			if reconnected.Attempts() != 2 {
+				t.Errorf("got %d attempts; want 2", reconnected.Attempts())
+			}
+			break
+		}
+	}
+	if pid, err := r.Pid(); err != nil || pid != 42 {
+		t.Errorf("Pid returned %d, %v; want 42", pid, err)
+	}
+	r.Close()
+	for range eventCh {
+	}
+}
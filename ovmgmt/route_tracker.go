@@ -0,0 +1,279 @@
+package ovmgmt
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// RouteEntry is a virtual address (or an iroute subnet) routed to a client.
+type RouteEntry struct {
+	// VirtualAddr is the normalized address, e.g. 10.8.0.6/32,
+	// 192.168.10.0/24 or a MAC address of TAP servers
+	VirtualAddr string
+	CommonName  string
+	// ClientId is -1 if unknown
+	ClientId  int64
+	RealAddr  *IPAddrPort
+	FirstSeen time.Time
+	LastSeen  time.Time
+}
+
+type RouteChangeType int
+
+const (
+	RouteAdded RouteChangeType = iota
+	RouteRemoved
+	// RouteMoved is the address taken over by another common name
+	RouteMoved
+)
+
+func (t RouteChangeType) String() string {
+	switch t {
+	case RouteAdded:
+		return "added"
+	case RouteRemoved:
+		return "removed"
+	case RouteMoved:
+		return "moved"
+	}
+	return "unknown"
+}
+
+// RouteChange is a single routing table change. Prev is the replaced entry
+// of RouteMoved, Entry is the removed one of RouteRemoved.
+type RouteChange struct {
+	Type  RouteChangeType
+	Entry RouteEntry
+	Prev  RouteEntry
+}
+
+// RouteTracker maintains the routing table of the server and reports its
+// changes, e.g. to detect clients hijacking addresses or flapping iroutes.
+//
+// It ingests Status3Event snapshots, which replace the whole table, as well
+// as CLIENT notifications: ADDRESS adds the address of the client, and
+// DISCONNECT removes all of its addresses. Entries learned from ADDRESS
+// notifications only can be expired with Expire.
+//
+// It is safe for concurrent use.
+type RouteTracker struct {
+	mu       sync.Mutex
+	now      func() time.Time
+	routes   map[string]*RouteEntry
+	cnByCID  map[int64]string
+	onChange func(RouteChange)
+}
+
+func NewRouteTracker() *RouteTracker {
+	return &RouteTracker{
+		now:     time.Now,
+		routes:  make(map[string]*RouteEntry),
+		cnByCID: make(map[int64]string),
+	}
+}
+
+// OnChange sets the callback called for each change.
+// The callback is called without holding internal locks.
+func (t *RouteTracker) OnChange(fn func(RouteChange)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.onChange = fn
+}
+
+// Add consumes Status3Event or ClientEvent received just now and returns
+// the changes, other events are ignored and false is returned.
+func (t *RouteTracker) Add(evt Event) ([]RouteChange, bool) {
+	var changes []RouteChange
+
+	switch e := evt.(type) {
+	case *Status3Event:
+		if e == nil {
+			return nil, false
+		}
+		changes = t.addStatus3(*e)
+	case Status3Event:
+		changes = t.addStatus3(e)
+	case ClientEvent:
+		changes = t.addClientEvent(e)
+	default:
+		return nil, false
+	}
+
+	t.notify(changes)
+	return changes, true
+}
+
+func (t *RouteTracker) addStatus3(se Status3Event) []RouteChange {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var changes []RouteChange
+	seen := make(map[string]bool, len(se.routes))
+	for _, r := range se.routes {
+		addr := routeKey(r.VirtualAddrFlags)
+		seen[addr] = true
+		cid := int64(-1)
+		for _, c := range se.ClientsByCommonName(r.CommonName) {
+			if c.hasClientId && compareIPAddrPort(c.RealAddr, r.RealAddr) == 0 {
+				cid = c.ClientId
+				break
+			}
+		}
+		if ch, ok := t.set(addr, r.CommonName, cid, r.RealAddr); ok {
+			changes = append(changes, ch)
+		}
+	}
+
+	// the clients are gone
+	for addr, entry := range t.routes {
+		if !seen[addr] {
+			delete(t.routes, addr)
+			changes = append(changes, RouteChange{Type: RouteRemoved, Entry: *entry})
+		}
+	}
+	sortRouteChanges(changes)
+	return changes
+}
+
+func (t *RouteTracker) addClientEvent(e ClientEvent) []RouteChange {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var changes []RouteChange
+	cid := e.ClientId()
+
+	switch e.Type() {
+	case CEConnect, CEReauth, CEEstablished:
+		if cn := e.RawEnv(EnvCommonName); cn != "" {
+			t.cnByCID[cid] = cn
+		}
+	case CEAddress:
+		ipNet, err := e.AddrNet()
+		if err != nil {
+			return nil
+		}
+		cn, ok := t.cnByCID[cid]
+		if !ok {
+			// not known yet, keep the name of the current owner, if any
+			if entry, exists := t.routes[ipNet.String()]; exists && entry.ClientId == cid {
+				cn = entry.CommonName
+			}
+		}
+		if ch, ok := t.set(ipNet.String(), cn, cid, nil); ok {
+			changes = append(changes, ch)
+		}
+	case CEDisconnect:
+		delete(t.cnByCID, cid)
+		for addr, entry := range t.routes {
+			if entry.ClientId == cid {
+				delete(t.routes, addr)
+				changes = append(changes, RouteChange{Type: RouteRemoved, Entry: *entry})
+			}
+		}
+		sortRouteChanges(changes)
+	}
+	return changes
+}
+
+// set adds or updates the entry and returns the change, if any.
+// Must be called with t.mu held.
+func (t *RouteTracker) set(addr, cn string, cid int64, realAddr *IPAddrPort) (RouteChange, bool) {
+	now := t.now()
+	entry, ok := t.routes[addr]
+	if !ok {
+		entry = &RouteEntry{VirtualAddr: addr, CommonName: cn, ClientId: cid, RealAddr: realAddr, FirstSeen: now, LastSeen: now}
+		t.routes[addr] = entry
+		return RouteChange{Type: RouteAdded, Entry: *entry}, true
+	}
+
+	if entry.CommonName != cn {
+		prev := *entry
+		*entry = RouteEntry{VirtualAddr: addr, CommonName: cn, ClientId: cid, RealAddr: realAddr, FirstSeen: now, LastSeen: now}
+		return RouteChange{Type: RouteMoved, Entry: *entry, Prev: prev}, true
+	}
+
+	entry.LastSeen = now
+	if cid >= 0 {
+		entry.ClientId = cid
+	}
+	if realAddr != nil {
+		entry.RealAddr = realAddr
+	}
+	return RouteChange{}, false
+}
+
+// Expire removes the entries not seen since the given time and returns
+// the changes.
+func (t *RouteTracker) Expire(notSeenSince time.Time) []RouteChange {
+	t.mu.Lock()
+	var changes []RouteChange
+	for addr, entry := range t.routes {
+		if entry.LastSeen.Before(notSeenSince) {
+			delete(t.routes, addr)
+			changes = append(changes, RouteChange{Type: RouteRemoved, Entry: *entry})
+		}
+	}
+	t.mu.Unlock()
+
+	sortRouteChanges(changes)
+	t.notify(changes)
+	return changes
+}
+
+// Snapshot returns a copy of the current routing table, sorted by
+// the virtual address.
+func (t *RouteTracker) Snapshot() []RouteEntry {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	snap := make([]RouteEntry, 0, len(t.routes))
+	for _, entry := range t.routes {
+		e := *entry
+		if e.RealAddr != nil {
+			realAddr := *e.RealAddr
+			e.RealAddr = &realAddr
+		}
+		snap = append(snap, e)
+	}
+	sort.Slice(snap, func(i, j int) bool {
+		return snap[i].VirtualAddr < snap[j].VirtualAddr
+	})
+	return snap
+}
+
+func (t *RouteTracker) notify(changes []RouteChange) {
+	if len(changes) == 0 {
+		return
+	}
+
+	t.mu.Lock()
+	fn := t.onChange
+	t.mu.Unlock()
+
+	if fn == nil {
+		return
+	}
+	for _, ch := range changes {
+		fn(ch)
+	}
+}
+
+// routeKey normalizes the virtual address of the routing table, so that
+// the same address is tracked regardless of its form or the C suffix
+func routeKey(vaddr string) string {
+	r := Status3Route{VirtualAddrFlags: vaddr}
+	if mac, ok := r.MACAddr(); ok {
+		return mac.String()
+	}
+	if ipNet, ok := r.VirtualAddr(); ok {
+		return ipNet.String()
+	}
+	return vaddr
+}
+
+func sortRouteChanges(changes []RouteChange) {
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Entry.VirtualAddr < changes[j].Entry.VirtualAddr
+	})
+}
@@ -0,0 +1,145 @@
+package ovmgmt
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+const status3RouteHeader = "HEADER\tROUTING_TABLE\tVirtual Address\tCommon Name\tReal Address\tLast Ref\tLast Ref (time_t)"
+
+func routeChangeSummary(changes []RouteChange) []string {
+	s := make([]string, len(changes))
+	for i, ch := range changes {
+		s[i] = ch.Type.String() + " " + ch.Entry.VirtualAddr + " " + ch.Entry.CommonName
+		if ch.Type == RouteMoved {
+			s[i] += " from " + ch.Prev.CommonName
+		}
+	}
+	return s
+}
+
+func TestRouteTrackerSnapshots(t *testing.T) {
+	tr := NewRouteTracker()
+	start := time.Unix(1584986002, 0)
+	at := start
+	tr.now = func() time.Time { return at }
+
+	var got []RouteChange
+	tr.OnChange(func(ch RouteChange) {
+		got = append(got, ch)
+	})
+
+	alice := "CLIENT_LIST\talice\t1.2.3.4:1194\t10.8.0.6\t\t100\t200\tMon Mar 23 17:53:22 2020\t1584986002\tUNDEF\t1\t0"
+	bob := "CLIENT_LIST\tbob\t5.6.7.8:1194\t10.8.0.10\t\t100\t200\tMon Mar 23 17:53:22 2020\t1584986002\tUNDEF\t2\t0"
+	aliceRoute := "ROUTING_TABLE\t10.8.0.6\talice\t1.2.3.4:1194\tMon Mar 23 17:53:22 2020\t1584986002"
+	aliceIroute := "ROUTING_TABLE\t192.168.10.0/24\talice\t1.2.3.4:1194\tMon Mar 23 17:53:22 2020\t1584986002"
+	bobRoute := "ROUTING_TABLE\t10.8.0.10C\tbob\t5.6.7.8:1194\tMon Mar 23 17:53:22 2020\t1584986002"
+	// bob took over the iroute of alice
+	bobIroute := "ROUTING_TABLE\t192.168.10.0/24\tbob\t5.6.7.8:1194\tMon Mar 23 17:53:22 2020\t1584986002"
+
+	type TestCase struct {
+		lines []string
+		want  []string
+	}
+	testCases := []TestCase{
+		{
+			[]string{status3ClientHeader, alice, bob, status3RouteHeader, aliceRoute, aliceIroute, bobRoute},
+			[]string{"added 10.8.0.10/32 bob", "added 10.8.0.6/32 alice", "added 192.168.10.0/24 alice"},
+		},
+		// the same table, the C suffix doesn't matter
+		{
+			[]string{status3ClientHeader, alice, bob, status3RouteHeader, aliceRoute, aliceIroute, "ROUTING_TABLE\t10.8.0.10\tbob\t5.6.7.8:1194\tMon Mar 23 17:53:22 2020\t1584986002"},
+			nil,
+		},
+		{
+			[]string{status3ClientHeader, alice, bob, status3RouteHeader, aliceRoute, bobIroute, bobRoute},
+			[]string{"moved 192.168.10.0/24 bob from alice"},
+		},
+		// alice is gone
+		{
+			[]string{status3ClientHeader, bob, status3RouteHeader, bobIroute, bobRoute},
+			[]string{"removed 10.8.0.6/32 alice"},
+		},
+		{
+			[]string{"END"},
+			[]string{"removed 10.8.0.10/32 bob", "removed 192.168.10.0/24 bob"},
+		},
+	}
+
+	for i, tc := range testCases {
+		got = nil
+		at = at.Add(time.Second)
+		changes, ok := tr.Add(mustStatus3Event(t, tc.lines...))
+		if !ok {
+			t.Fatalf("test %d Add ignored Status3Event", i)
+		}
+		if s := routeChangeSummary(changes); !reflect.DeepEqual(s, tc.want) && (len(s) != 0 || len(tc.want) != 0) {
+			t.Errorf("test %d Add returned %q; want %q", i, s, tc.want)
+		}
+		if !reflect.DeepEqual(got, changes) {
+			t.Errorf("test %d OnChange got %+v; want %+v", i, got, changes)
+		}
+
+		if i == 2 {
+			snap := tr.Snapshot()
+			want := []RouteEntry{
+				{VirtualAddr: "10.8.0.10/32", CommonName: "bob", ClientId: 2, RealAddr: &IPAddrPort{IP: SafeParseIP4Addr("5.6.7.8"), Port: 1194}, FirstSeen: start.Add(time.Second), LastSeen: at},
+				{VirtualAddr: "10.8.0.6/32", CommonName: "alice", ClientId: 1, RealAddr: &IPAddrPort{IP: SafeParseIP4Addr("1.2.3.4"), Port: 1194}, FirstSeen: start.Add(time.Second), LastSeen: at},
+				{VirtualAddr: "192.168.10.0/24", CommonName: "bob", ClientId: 2, RealAddr: &IPAddrPort{IP: SafeParseIP4Addr("5.6.7.8"), Port: 1194}, FirstSeen: at, LastSeen: at},
+			}
+			if !reflect.DeepEqual(snap, want) {
+				t.Errorf("test %d Snapshot returned\n%+v\nwant\n%+v", i, snap, want)
+			}
+			// snapshot is a copy
+			snap[0].RealAddr.Port = 0
+			snap[0].CommonName = ""
+			if s := tr.Snapshot()[0]; s.RealAddr.Port != 1194 || s.CommonName != "bob" {
+				t.Errorf("test %d Snapshot is not a copy", i)
+			}
+		}
+	}
+
+	if _, ok := tr.Add(NewHoldEvent("")); ok {
+		t.Errorf("Add accepted HoldEvent")
+	}
+}
+
+func TestRouteTrackerClientEvents(t *testing.T) {
+	tr := NewRouteTracker()
+	start := time.Unix(1584986002, 0)
+	at := start
+	tr.now = func() time.Time { return at }
+
+	type TestCase struct {
+		evt  ClientEvent
+		want []string
+	}
+	testCases := []TestCase{
+		{mustClientEvent(t, "CONNECT,1,0", "ENV,common_name=alice"), nil},
+		{mustClientEvent(t, "ADDRESS,1,10.8.0.6,1"), []string{"added 10.8.0.6/32 alice"}},
+		{mustClientEvent(t, "ADDRESS,1,192.168.10.7/255.255.255.0,0"), []string{"added 192.168.10.0/24 alice"}},
+		{mustClientEvent(t, "ADDRESS,1,10.8.0.6,1"), nil},
+		{mustClientEvent(t, "CONNECT,2,0", "ENV,common_name=bob"), nil},
+		{mustClientEvent(t, "ADDRESS,2,192.168.10.0/24,0"), []string{"moved 192.168.10.0/24 bob from alice"}},
+		{mustClientEvent(t, "DISCONNECT,1", "ENV,common_name=alice"), []string{"removed 10.8.0.6/32 alice"}},
+	}
+	for i, tc := range testCases {
+		changes, ok := tr.Add(tc.evt)
+		if !ok {
+			t.Fatalf("test %d Add ignored ClientEvent", i)
+		}
+		if s := routeChangeSummary(changes); !reflect.DeepEqual(s, tc.want) && (len(s) != 0 || len(tc.want) != 0) {
+			t.Errorf("test %d Add returned %q; want %q", i, s, tc.want)
+		}
+	}
+
+	// bob is still there, but not seen since start
+	at = at.Add(time.Minute)
+	if s := routeChangeSummary(tr.Expire(at)); !reflect.DeepEqual(s, []string{"removed 192.168.10.0/24 bob"}) {
+		t.Errorf("Expire returned %q", s)
+	}
+	if snap := tr.Snapshot(); len(snap) != 0 {
+		t.Errorf("Snapshot after Expire returned %+v", snap)
+	}
+}
@@ -0,0 +1,63 @@
+package ovmgmt
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Common names, usernames, echo and log messages are controlled by remote
+// peers, so they may contain terminal escape sequences or invalid UTF-8.
+// String() of events replaces such characters with Go-style escapes
+// (e.g. "\x1b", "\u0085" or "\xff"), while Raw() keeps the original data.
+
+// Sanitize replaces C0 and C1 control characters and invalid UTF-8
+// sequences in s with Go-style escapes.
+func Sanitize(s string) string {
+	i := 0
+	for i < len(s) {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if needsEscape(r, size) {
+			break
+		}
+		i += size
+	}
+	if i == len(s) {
+		// nothing to escape
+		return s
+	}
+
+	var b strings.Builder
+	b.Grow(len(s) + 8)
+	b.WriteString(s[:i])
+	for i < len(s) {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case r == utf8.RuneError && size == 1:
+			b.WriteString(`\x`)
+			b.WriteString(strconv.FormatUint(uint64(s[i])>>4, 16))
+			b.WriteString(strconv.FormatUint(uint64(s[i])&0xf, 16))
+		case unicode.IsControl(r):
+			q := strconv.QuoteRune(r)
+			b.WriteString(q[1 : len(q)-1])
+		default:
+			b.WriteString(s[i : i+size])
+		}
+		i += size
+	}
+	return b.String()
+}
+
+func needsEscape(r rune, size int) bool {
+	return (r == utf8.RuneError && size == 1) || unicode.IsControl(r)
+}
+
+// sanitize sanitizes the value returned by the accessor if it's turned
+// on by WithSanitizeAccessors
+func (o *parseOptions) sanitize(s string) string {
+	if o == nil || !o.sanitizeAccessors {
+		return s
+	}
+	return Sanitize(s)
+}
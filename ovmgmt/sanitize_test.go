@@ -0,0 +1,134 @@
+package ovmgmt
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSanitize(t *testing.T) {
+	type TestCase struct {
+		Input    string
+		Expected string
+	}
+
+	testCases := []TestCase{
+		{"", ""},
+		{"alice", "alice"},
+		{"алиса 🔑", "алиса 🔑"},
+		{"\x1b[31malice\x1b[0m", `\x1b[31malice\x1b[0m`},
+		{"a\tb\r\nc\x00", `a\tb\r\nc\x00`},
+		{"del\x7f", `del\x7f`},
+		{"c1\u0085\u009b", `c1\u0085\u009b`},
+		{"bad\xff\xfeutf8", `bad\xff\xfeutf8`},
+		{"cut\xd0", `cut\xd0`},
+		{`already\x1b`, `already\x1b`},
+	}
+
+	for i, testCase := range testCases {
+		if got := Sanitize(testCase.Input); got != testCase.Expected {
+			t.Errorf("test %d Sanitize returned %q; want %q", i, got, testCase.Expected)
+		}
+	}
+}
+
+func TestEventStringSanitized(t *testing.T) {
+	type TestCase struct {
+		Input    string
+		Expected string
+	}
+
+	testCases := []TestCase{
+		{
+			"LOG:1584536294,I,\x1b]0;pwned\x07alice",
+			`LOG[I]: \x1b]0;pwned\aalice`,
+		},
+		{
+			"ECHO:1584536294,msg \x1b[2J\xff",
+			`ECHO: msg \x1b[2J\xff`,
+		},
+		{
+			"HOLD:Waiting \x9b for hold release",
+			`Waiting \x9b for hold release`,
+		},
+		{
+			"INFO:OpenVPN\x1b[0m",
+			`INFO: OpenVPN\x1b[0m`,
+		},
+		{
+			"FOO_KW:\x1b[0m",
+			`Unknown event FOO_KW: \x1b[0m`,
+		},
+	}
+
+	for i, testCase := range testCases {
+		_, keyword, body := splitEvent(testCase.Input)
+		evt := upgradeEvent(keyword, body)
+		if got := evt.String(); got != testCase.Expected {
+			t.Errorf("test %d String returned %q; want %q", i, got, testCase.Expected)
+		}
+		if got := evt.Raw(); !strings.HasSuffix(testCase.Input, got) {
+			t.Errorf("test %d Raw returned %q; want the original", i, got)
+		}
+	}
+
+	ce := mustClientEvent(t, "CONNECT,5,1",
+		"ENV,common_name=\x1b[1malice\xff",
+		"ENV,password=\x1b",
+	)
+	if got, want := ce.String(), `[CONNECT]cid:5,kid:1,env:map[common_name:\x1b[1malice\xff password:***]`; got != want {
+		t.Errorf("ClientEvent String returned %q; want %q", got, want)
+	}
+	if got, want := ce.RawEnv("common_name"), "\x1b[1malice\xff"; got != want {
+		t.Errorf("RawEnv returned %q; want %q", got, want)
+	}
+}
+
+func TestSanitizeAccessors(t *testing.T) {
+	lines := []string{
+		">CLIENT:CONNECT,5,1",
+		">CLIENT:ENV,common_name=\x1b[1malice",
+		">CLIENT:ENV,END",
+		">ECHO:1584536294,\x1b[2J",
+		">LOG:1584536294,I,\x1b[2J",
+		">HOLD:\x1b[2J",
+		">UPDOWN:UP",
+		">UPDOWN:ENV,dev=\x1b[2J",
+		">UPDOWN:ENV,END",
+	}
+	accessors := func(events []Event) []string {
+		var got []string
+		for _, evt := range events {
+			switch e := evt.(type) {
+			case ClientEvent:
+				cn, _ := e.CommonName()
+				got = append(got, cn, e.RawEnv("common_name"), e.Envs()[0].Value)
+			case EchoEvent:
+				got = append(got, e.Message())
+			case LogEvent:
+				got = append(got, e.Message())
+			case HoldEvent:
+				got = append(got, e.Message())
+			case UpDownEvent:
+				got = append(got, e.RawEnv("dev"))
+			}
+		}
+		return got
+	}
+
+	events := replayEvents(lines, WithSanitizeAccessors())
+	want := []string{`\x1b[1malice`, `\x1b[1malice`, `\x1b[1malice`, `\x1b[2J`, `\x1b[2J`, `\x1b[2J`, `\x1b[2J`}
+	if got := accessors(events); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q; want %q", got, want)
+	}
+	ce := events[0].(ClientEvent)
+	if got, want := ce.RawUnredacted(), "CONNECT,5,1\tmap[common_name:\x1b[1malice]"; got != want {
+		t.Errorf("RawUnredacted returned %q; want %q", got, want)
+	}
+
+	// off by default
+	want = []string{"\x1b[1malice", "\x1b[1malice", "\x1b[1malice", "\x1b[2J", "\x1b[2J", "\x1b[2J", "\x1b[2J"}
+	if got := accessors(replayEvents(lines)); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q; want %q", got, want)
+	}
+}
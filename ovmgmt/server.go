@@ -1,23 +1,72 @@
 package ovmgmt
 
 import (
+	"context"
 	"net"
+	"sync"
 	"time"
 )
 
+// ErrListenerClosed is returned by MgmtListener.AcceptClient once
+// the listener is closed, it matches ErrClosed.
+var ErrListenerClosed = newCategoryError(ErrClosed, "listener is closed", nil)
+
 // MgmtListener accepts incoming connections from OpenVPN.
 //
 // The primary way to instantiate this type is via the function Listen.
 // See its documentation for more information.
 type MgmtListener struct {
-	l net.Listener
+	l    net.Listener
+	opts listenerOptions
+	// holds a slot per client of AcceptClient, up to the end of it
+	active chan struct{}
+	// closed by Close, ctx is canceled then
+	closed    chan struct{}
+	closeOnce sync.Once
+	ctx       context.Context
+	cancel    context.CancelFunc
+}
+
+// ListenOption configures MgmtListener, see Listen.
+type ListenOption func(*listenerOptions)
+
+type listenerOptions struct {
+	maxActiveClients int
+	clientOptions    []Option
+}
+
+// WithMaxActiveClients makes AcceptClient accept up to n connections,
+// whose clients are running at a time, instead of one, e.g. to serve
+// several OpenVPN processes on the same port. Values below 1 are taken
+// as 1.
+func WithMaxActiveClients(n int) ListenOption {
+	return func(o *listenerOptions) {
+		o.maxActiveClients = n
+		if n < 1 {
+			o.maxActiveClients = 1
+		}
+	}
+}
+
+// WithClientOptions sets the options of the clients of AcceptClient, which
+// are applied after the defaults, see AcceptClient.
+func WithClientOptions(opts ...Option) ListenOption {
+	return func(o *listenerOptions) {
+		o.clientOptions = append(o.clientOptions, opts...)
+	}
 }
 
 // NewMgmtListener constructs a MgmtListener from an already-established
 // net.Listener. In most cases it will be more convenient to use
 // the function Listen.
-func NewMgmtListener(l net.Listener) *MgmtListener {
-	return &MgmtListener{l}
+func NewMgmtListener(l net.Listener, opts ...ListenOption) *MgmtListener {
+	ml := &MgmtListener{l: l, opts: listenerOptions{maxActiveClients: 1}, closed: make(chan struct{})}
+	for _, opt := range opts {
+		opt(&ml.opts)
+	}
+	ml.active = make(chan struct{}, ml.opts.maxActiveClients)
+	ml.ctx, ml.cancel = context.WithCancel(context.Background())
+	return ml
 }
 
 // Listen opens a listen port and awaits incoming connections from OpenVPN
@@ -40,17 +89,82 @@ func NewMgmtListener(l net.Listener) *MgmtListener {
 //
 //    --management /path/to/socket unix --management-client
 //
-func Listen(laddr string) (*MgmtListener, error) {
+// The connections are either accepted with Accept, and the client of each
+// one is created with IncomingConn.Open, or with AcceptClient, which
+// returns the client checked to be connected to OpenVPN.
+func Listen(laddr string, opts ...ListenOption) (*MgmtListener, error) {
 	proto := "tcp"
 	if len(laddr) > 0 && laddr[0] == '/' {
 		proto = "unix"
 	}
-	listener, err := net.Listen(proto, laddr)
+	return ListenNetwork(proto, laddr, opts...)
+}
+
+// ListenNetwork is Listen on the given network, any one net.Listen accepts
+// (e.g. "tcp4", "unix"), instead of guessing it from the address.
+func ListenNetwork(network, laddr string, opts ...ListenOption) (*MgmtListener, error) {
+	listener, err := net.Listen(network, laddr)
 	if err != nil {
 		return nil, err
 	}
 
-	return NewMgmtListener(listener), nil
+	return NewMgmtListener(listener, opts...), nil
+}
+
+// AcceptClient waits for the next connection from OpenVPN and returns
+// its client, which delivers the events to the channel returned by
+// newEventCh, called once per client; see NewMgmtClient for discussion
+// about the requirements for the channel.
+//
+// The connection is owned by the client, as of Dial, and the greeting
+// of the daemon is checked in the same way, see WithHandshakeCheck; the
+// defaults are overridden with WithClientOptions. The error of the check,
+// matching ErrNotOpenVPN or ErrManagementBusy, is of the single connection,
+// which is closed, the listener remains usable.
+//
+// Only one client is running at a time, unless WithMaxActiveClients
+// is set: AcceptClient waits for the previous one to terminate before
+// accepting the next connection, so the daemons waiting to connect are
+// left in the backlog. Once the listener is closed, AcceptClient returns
+// ErrListenerClosed, the clients already returned keep running.
+func (l *MgmtListener) AcceptClient(newEventCh func() chan<- Event) (*MgmtClient, error) {
+	select {
+	case l.active <- struct{}{}:
+	case <-l.closed:
+		return nil, ErrListenerClosed
+	}
+
+	conn, err := l.l.Accept()
+	if err != nil {
+		<-l.active
+		if l.isClosed() {
+			return nil, ErrListenerClosed
+		}
+		return nil, err
+	}
+
+	c, err := newDialedClient(l.ctx, conn, newEventCh(), l.opts.clientOptions...)
+	if err != nil {
+		<-l.active
+		if l.isClosed() {
+			return nil, ErrListenerClosed
+		}
+		return nil, err
+	}
+	go func() {
+		<-c.Done()
+		<-l.active
+	}()
+	return c, nil
+}
+
+func (l *MgmtListener) isClosed() bool {
+	select {
+	case <-l.closed:
+		return true
+	default:
+		return false
+	}
 }
 
 // Accept waits for and returns the next connection.
@@ -63,9 +177,14 @@ func (l *MgmtListener) Accept() (*IncomingConn, error) {
 	return &IncomingConn{conn}, nil
 }
 
-// Close closes the listener. Any blocked Accept operations
-// will be blocked and each will return an error.
+// Close closes the listener. Any blocked Accept and AcceptClient operations
+// will be unblocked and each will return an error. The clients already
+// accepted are not closed.
 func (l *MgmtListener) Close() error {
+	l.closeOnce.Do(func() {
+		close(l.closed)
+		l.cancel()
+	})
 	return l.l.Close()
 }
 
@@ -122,9 +241,10 @@ type IncomingConn struct {
 // and establishes the channel on which events will be delivered.
 //
 // See the documentation for NewMgmtClient for discussion about the requirements
-// for eventCh.
+// for eventCh. As with Dial, the connection is closed once the client
+// terminates.
 func (ic IncomingConn) Open(eventCh chan<- Event) *MgmtClient {
-	return NewMgmtClient(ic.conn, eventCh)
+	return NewMgmtClientWithOptions(ic.conn, eventCh, withOwnedConn())
 }
 
 // Close abruptly closes the socket connected to the OpenVPN process.
@@ -0,0 +1,205 @@
+package ovmgmt
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// dialingDaemon connects to the listener as OpenVPN with
+// --management-client does, and replies to pid with its pid
+func dialingDaemon(t *testing.T, addr net.Addr, pid int) net.Conn {
+	t.Helper()
+	conn, err := net.Dial(addr.Network(), addr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	go greetingDaemon(conn, func(cmd string) []string {
+		if cmd == "pid" {
+			return []string{"SUCCESS: pid=" + strconv.Itoa(pid)}
+		}
+		return []string{"ERROR: unknown command"}
+	})
+	return conn
+}
+
+// acceptResult is the result of AcceptClient
+type acceptResult struct {
+	c   *MgmtClient
+	err error
+}
+
+func acceptAsync(l *MgmtListener, eventCh chan Event) <-chan acceptResult {
+	ch := make(chan acceptResult, 1)
+	go func() {
+		c, err := l.AcceptClient(func() chan<- Event { return eventCh })
+		ch <- acceptResult{c, err}
+	}()
+	return ch
+}
+
+func TestAcceptClient(t *testing.T) {
+	defer checkGoroutineLeaks(t)()
+
+	l, err := ListenNetwork("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	eventCh1 := make(chan Event, 10)
+	accepted := acceptAsync(l, eventCh1)
+	conn1 := dialingDaemon(t, l.Addr(), 41)
+	res := <-accepted
+	if res.err != nil {
+		t.Fatal(res.err)
+	}
+	c1 := res.c
+	if pid, err := c1.Pid(); err != nil || pid != 41 {
+		t.Errorf("Pid returned %d, %v; want 41", pid, err)
+	}
+	if evt, ok := nextEventOf(t, eventCh1).(SimpleEvent); !ok || evt.Keyword() != infoEventKW {
+		t.Errorf("got event %v; want the greeting", evt)
+	}
+
+	// the next daemon waits for the first one to go away
+	eventCh2 := make(chan Event, 10)
+	accepted = acceptAsync(l, eventCh2)
+	conn2 := dialingDaemon(t, l.Addr(), 42)
+	defer conn2.Close()
+	select {
+	case res := <-accepted:
+		t.Fatalf("AcceptClient returned %v, %v while the client is running", res.c, res.err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	conn1.Close()
+	for range eventCh1 {
+	}
+	res = <-accepted
+	if res.err != nil {
+		t.Fatal(res.err)
+	}
+	if pid, err := res.c.Pid(); err != nil || pid != 42 {
+		t.Errorf("Pid returned %d, %v; want 42", pid, err)
+	}
+	if evt, ok := nextEventOf(t, eventCh2).(SimpleEvent); !ok || evt.Keyword() != infoEventKW {
+		t.Errorf("got event %v; want the greeting", evt)
+	}
+	res.c.Close()
+	c1.Close()
+}
+
+func TestAcceptClientMaxActive(t *testing.T) {
+	defer checkGoroutineLeaks(t)()
+
+	l, err := ListenNetwork("tcp", "127.0.0.1:0", WithMaxActiveClients(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	for i := 0; i < 2; i++ {
+		conn := dialingDaemon(t, l.Addr(), 40+i)
+		defer conn.Close()
+	}
+	var clients []*MgmtClient
+	var eventChs []chan Event
+	for i := 0; i < 2; i++ {
+		eventCh := make(chan Event, 10)
+		c, err := l.AcceptClient(func() chan<- Event { return eventCh })
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+		clients = append(clients, c)
+		eventChs = append(eventChs, eventCh)
+	}
+
+	// each one has its own daemon and event channel
+	pids := make(map[int]bool)
+	for i, c := range clients {
+		pid, err := c.Pid()
+		if err != nil {
+			t.Errorf("client %d Pid returned %v", i, err)
+		}
+		pids[pid] = true
+		if evt, ok := nextEventOf(t, eventChs[i]).(SimpleEvent); !ok || evt.Keyword() != infoEventKW {
+			t.Errorf("client %d got event %v; want the greeting", i, evt)
+		}
+	}
+	if !pids[40] || !pids[41] {
+		t.Errorf("got pids %v; want 40 and 41", pids)
+	}
+
+	// the third one waits
+	accepted := acceptAsync(l, make(chan Event, 10))
+	select {
+	case res := <-accepted:
+		t.Fatalf("AcceptClient returned %v, %v while two clients are running", res.c, res.err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	l.Close()
+	if res := <-accepted; !errors.Is(res.err, ErrListenerClosed) || !errors.Is(res.err, ErrClosed) {
+		t.Errorf("AcceptClient returned %v; want %v", res.err, ErrListenerClosed)
+	}
+}
+
+func TestAcceptClientClose(t *testing.T) {
+	defer checkGoroutineLeaks(t)()
+
+	l, err := ListenNetwork("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// blocked in accept
+	accepted := acceptAsync(l, make(chan Event, 10))
+	time.Sleep(10 * time.Millisecond)
+	l.Close()
+	select {
+	case res := <-accepted:
+		if !errors.Is(res.err, ErrListenerClosed) {
+			t.Errorf("AcceptClient returned %v; want %v", res.err, ErrListenerClosed)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("AcceptClient is not unblocked by Close")
+	}
+	if _, err := l.AcceptClient(func() chan<- Event { return make(chan Event) }); !errors.Is(err, ErrListenerClosed) {
+		t.Errorf("AcceptClient after Close returned %v; want %v", err, ErrListenerClosed)
+	}
+}
+
+func TestAcceptClientNotOpenVPN(t *testing.T) {
+	defer checkGoroutineLeaks(t)()
+
+	l, err := ListenNetwork("tcp", "127.0.0.1:0", WithClientOptions(WithHandshakeCheck(time.Second)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("GET / HTTP/1.1\r\n\r\n"))
+	if _, err := l.AcceptClient(func() chan<- Event { return make(chan Event, 10) }); !errors.Is(err, ErrNotOpenVPN) {
+		t.Errorf("AcceptClient returned %v; want %v", err, ErrNotOpenVPN)
+	}
+
+	// the listener is still usable
+	accepted := acceptAsync(l, make(chan Event, 10))
+	daemon := dialingDaemon(t, l.Addr(), 42)
+	defer daemon.Close()
+	res := <-accepted
+	if res.err != nil {
+		t.Fatal(res.err)
+	}
+	if pid, err := res.c.Pid(); err != nil || pid != 42 {
+		t.Errorf("Pid returned %d, %v; want 42", pid, err)
+	}
+	res.c.Close()
+}
@@ -0,0 +1,109 @@
+package ovmgmt
+
+import (
+	"runtime"
+	"sync/atomic"
+)
+
+// DemuxStats is the snapshot of the counters of Demultiplexer, see
+// Demultiplexer.Stats.
+type DemuxStats struct {
+	// LinesRead is the number of lines read, ReplyLines and EventLines
+	// are the ones of replies and events; empty lines are counted in
+	// LinesRead only.
+	LinesRead  uint64
+	ReplyLines uint64
+	EventLines uint64
+	// BytesRead is the size of the lines read, with the line endings.
+	BytesRead uint64
+}
+
+// ClientStats is the snapshot of the I/O counters of MgmtClient, see
+// MgmtClient.Stats.
+type ClientStats struct {
+	DemuxStats
+	// CommandsSent is the number of commands written to the daemon,
+	// including the internal ones (e.g. of WithKeepalive), BytesWritten
+	// is their size.
+	CommandsSent uint64
+	BytesWritten uint64
+	// MalformedEvents is the number of events which failed to parse,
+	// emitted as MalformedEvent or InvalidEvent.
+	MalformedEvents uint64
+}
+
+// seqCounters is the set of counters updated with atomic adds by one
+// goroutine at a time, which are read consistently, as of a sequence lock
+type seqCounters struct {
+	// odd while the counters are updated
+	seq uint64
+	n   [4]uint64
+}
+
+func (s *seqCounters) begin() {
+	atomic.AddUint64(&s.seq, 1)
+}
+
+func (s *seqCounters) add(i int, delta uint64) {
+	atomic.AddUint64(&s.n[i], delta)
+}
+
+func (s *seqCounters) end() {
+	atomic.AddUint64(&s.seq, 1)
+}
+
+// load returns the counters updated by the last complete update
+func (s *seqCounters) load() (n [4]uint64) {
+	for {
+		seq := atomic.LoadUint64(&s.seq)
+		if seq&1 == 0 {
+			for i := range n {
+				n[i] = atomic.LoadUint64(&s.n[i])
+			}
+			if atomic.LoadUint64(&s.seq) == seq {
+				return n
+			}
+		}
+		runtime.Gosched()
+	}
+}
+
+// indices of the Demultiplexer counters
+const (
+	statLines = iota
+	statReplies
+	statEvents
+	statBytesRead
+)
+
+// indices of the command counters
+const (
+	statCommands = iota
+	statBytesWritten
+)
+
+// Stats returns the snapshot of the counters, which are consistent with
+// each other. It's safe to call concurrently with Run.
+func (d *Demultiplexer) Stats() DemuxStats {
+	n := d.stats.load()
+	return DemuxStats{
+		LinesRead:  n[statLines],
+		ReplyLines: n[statReplies],
+		EventLines: n[statEvents],
+		BytesRead:  n[statBytesRead],
+	}
+}
+
+// Stats returns the snapshot of the I/O counters of the client, e.g. to
+// size the event channel after the volume of events of the daemon.
+// The counters of reading and of commands are consistent within
+// the group.
+func (c *MgmtClient) Stats() ClientStats {
+	n := c.cmdStats.load()
+	return ClientStats{
+		DemuxStats:      c.demux.Stats(),
+		CommandsSent:    n[statCommands],
+		BytesWritten:    n[statBytesWritten],
+		MalformedEvents: atomic.LoadUint64(&c.malformedEvents),
+	}
+}
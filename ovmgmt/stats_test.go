@@ -0,0 +1,82 @@
+package ovmgmt
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	transcript := map[string][]string{
+		"pid":   {"", "SUCCESS: pid=42"},
+		"state": {">LOG:1584536294,I,a", "1584536294,CONNECTED,SUCCESS,10.8.0.6,1.2.3.4,1194,,", "END"},
+		"bogus": {"ERROR: unknown command\r", ">GARBAGE", ">STATE:bad"},
+	}
+	eventCh := make(chan Event, 10)
+	c := newReplyingClient(t, eventCh, func(cmd string) []string { return transcript[cmd] })
+	if got := c.Stats(); got != (ClientStats{}) {
+		t.Errorf("initial Stats returned %+v", got)
+	}
+
+	if _, err := c.Pid(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.LatestState(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.simpleCommand("bogus"); err == nil {
+		t.Fatalf("bogus command succeeded")
+	}
+	for i := 0; i < 3; i++ {
+		nextEventOf(t, eventCh)
+	}
+
+	want := ClientStats{
+		DemuxStats: DemuxStats{
+			LinesRead:  8,
+			ReplyLines: 4,
+			EventLines: 3,
+			BytesRead:  138,
+		},
+		CommandsSent:    3,
+		BytesWritten:    16,
+		MalformedEvents: 2,
+	}
+	if got := c.Stats(); got != want {
+		t.Errorf("Stats returned\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestStatsConsistent(t *testing.T) {
+	const n = 10000
+	line := ">LOG:1584536294,I,msg"
+	lines := strings.Repeat(line+"\n", n)
+	eventCh := make(chan Event, 10)
+	c := NewMgmtClient(mockConn{strings.NewReader(lines), ioutil.Discard}, eventCh)
+
+	check := func(stats ClientStats) error {
+		if stats.LinesRead != stats.EventLines || stats.ReplyLines != 0 {
+			return fmt.Errorf("%d lines read, %d events, %d replies", stats.LinesRead, stats.EventLines, stats.ReplyLines)
+		}
+		if want := stats.LinesRead * uint64(len(line)+1); stats.BytesRead != want {
+			return fmt.Errorf("%d bytes read of %d lines; want %d", stats.BytesRead, stats.LinesRead, want)
+		}
+		return nil
+	}
+	// snapshots are taken while the lines are read
+	var prev uint64
+	for range eventCh {
+		stats := c.Stats()
+		if err := check(stats); err != nil {
+			t.Fatalf("inconsistent stats: %s", err)
+		}
+		if stats.LinesRead < prev {
+			t.Fatalf("%d lines read after %d", stats.LinesRead, prev)
+		}
+		prev = stats.LinesRead
+	}
+	if stats := c.Stats(); stats.LinesRead != n || check(stats) != nil {
+		t.Errorf("Stats returned %+v; want %d lines", stats, n)
+	}
+}
@@ -0,0 +1,56 @@
+package ovmgmt
+
+// Aggregates over the clients of a snapshot. They only count valid
+// clients, use WithInvalidClients to include the invalid ones.
+
+// WithInvalidClients returns a copy of the event where the invalid clients
+// are merged into Clients, so that the aggregates and lookups take them
+// into account.
+func (se Status3Event) WithInvalidClients() Status3Event {
+	clients := make([]Status3Client, 0, len(se.clients)+len(se.invalidClients))
+	clients = append(clients, se.clients...)
+	se.clients = append(clients, se.invalidClients...)
+	se.invalidClients = nil
+	se.index = &status3Index{}
+	return se
+}
+
+// ClientCount returns the number of connected clients.
+func (se Status3Event) ClientCount() int {
+	return len(se.clients)
+}
+
+// TotalBytesReceived returns the sum of bytes received from all clients.
+func (se Status3Event) TotalBytesReceived() int64 {
+	var total int64
+	for _, c := range se.clients {
+		total += c.BytesRecv
+	}
+	return total
+}
+
+// TotalBytesSent returns the sum of bytes sent to all clients.
+func (se Status3Event) TotalBytesSent() int64 {
+	var total int64
+	for _, c := range se.clients {
+		total += c.BytesSent
+	}
+	return total
+}
+
+// OldestSession returns the client connected for the longest time.
+// Clients with unknown connection time are skipped.
+func (se Status3Event) OldestSession() (Status3Client, bool) {
+	var oldest Status3Client
+	found := false
+	for _, c := range se.clients {
+		if c.ConnectedSinceTimestamp <= 0 {
+			continue
+		}
+		if !found || c.ConnectedSinceTimestamp < oldest.ConnectedSinceTimestamp {
+			oldest = c
+			found = true
+		}
+	}
+	return oldest, found
+}
@@ -0,0 +1,57 @@
+package ovmgmt
+
+import (
+	"testing"
+)
+
+var status3PayloadMixed = []string{
+	status3ClientHeader,
+	"CLIENT_LIST\talice\t198.51.100.7:52331\t10.8.0.6\t\t5523\t7391\tMon Mar 23 17:51:49 2020\t1584985909\tUNDEF\t5\t0",
+	"CLIENT_LIST\tbob\t198.51.100.8:1194\t10.8.0.10\t\t100\t200\tMon Mar 23 17:42:00 2020\t1584985320\tUNDEF\t6\t1",
+	// invalid: unparsable real address, but counters are fine
+	"CLIENT_LIST\tcarol\tsomewhere\t10.8.0.14\t\t1000\t2000\tMon Mar 23 16:00:00 2020\t1584979200\tUNDEF\t7\t2",
+	// invalid: unparsable counter
+	"CLIENT_LIST\tdave\t198.51.100.9:1194\t10.8.0.18\t\tlots\t4000\tMon Mar 23 17:00:00 2020\t1584982800\tUNDEF\t8\t3",
+}
+
+func TestStatus3EventAggregates(t *testing.T) {
+	type TestCase struct {
+		Event     Status3Event
+		Count     int
+		BytesRecv int64
+		BytesSent int64
+		Oldest    string
+	}
+
+	se := *mustStatus3Event(t, status3PayloadMixed...)
+	if len(se.InvalidClients()) != 2 {
+		t.Fatalf("got invalid clients %v; want 2", se.InvalidClients())
+	}
+
+	testCases := []TestCase{
+		{se, 2, 5623, 7591, "bob"},
+		{se.WithInvalidClients(), 4, 6623, 13591, "carol"},
+		{Status3Event{}, 0, 0, 0, ""},
+	}
+
+	for i, tc := range testCases {
+		if n := tc.Event.ClientCount(); n != tc.Count {
+			t.Errorf("test %d ClientCount returned %d; want %d", i, n, tc.Count)
+		}
+		if b := tc.Event.TotalBytesReceived(); b != tc.BytesRecv {
+			t.Errorf("test %d TotalBytesReceived returned %d; want %d", i, b, tc.BytesRecv)
+		}
+		if b := tc.Event.TotalBytesSent(); b != tc.BytesSent {
+			t.Errorf("test %d TotalBytesSent returned %d; want %d", i, b, tc.BytesSent)
+		}
+		c, ok := tc.Event.OldestSession()
+		if ok != (tc.Oldest != "") || c.CommonName != tc.Oldest {
+			t.Errorf("test %d OldestSession returned %s, %t; want %q", i, c, ok, tc.Oldest)
+		}
+	}
+
+	// the original event is not modified
+	if len(se.Clients()) != 2 || len(se.InvalidClients()) != 2 {
+		t.Errorf("WithInvalidClients modified the event: %s", se)
+	}
+}
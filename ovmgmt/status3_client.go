@@ -12,26 +12,32 @@ import (
 
 type Status3Client struct {
 	CommonName              string
+	CommonNameRaw           string
 	RealAddr                *IPAddrPort
 	VirtualAddr             net.IP
+	VirtualAddrRaw          string
+	VirtualAddrCached       bool
 	VirtualAddr6            net.IP
 	BytesRecv               int64
 	BytesSent               int64
 	ConnectedSinceRaw       string
 	ConnectedSinceTimestamp int64
 	Username                string
+	UsernameRaw             string
 	ClientId                int64
 	PeerId                  int64
 	DataChannelCipher       string
+	hasClientId             bool
 	errs                    []error
+	warnings                []error
 }
 
 func (s Status3Client) Raw() string {
-	return fmt.Sprintf("%s\t%s\t%s\t%s\t%d\t%d\t%s\t%d\t%s\t%d\t%d\t%s\t%s", s.CommonName, s.RealAddr, s.VirtualAddr, s.VirtualAddr6, s.BytesRecv, s.BytesSent, s.ConnectedSinceRaw, s.ConnectedSinceTimestamp, s.Username, s.ClientId, s.PeerId, s.DataChannelCipher, s.errs)
+	return fmt.Sprintf("%s\t%s\t%s\t%s\t%d\t%d\t%s\t%d\t%s\t%d\t%d\t%s\t%s", s.CommonNameRaw, s.RealAddr, s.VirtualAddr, s.VirtualAddr6, s.BytesRecv, s.BytesSent, s.ConnectedSinceRaw, s.ConnectedSinceTimestamp, s.UsernameRaw, s.ClientId, s.PeerId, s.DataChannelCipher, s.errs)
 }
 
 func (s Status3Client) String() string {
-	data := fmt.Sprintf("CN:%s\tRAddr:%s\tVAddr:%s\tVAddr6:%s\tBRecv:%d\tBSent:%d\tSince:[%s]%d\tUser:%s\tClientId:%d\tPeerId:%d\tDCCipher:%s", s.CommonName, s.RealAddr, s.VirtualAddr, s.VirtualAddr6, s.BytesRecv, s.BytesSent, s.ConnectedSinceRaw, s.ConnectedSinceTimestamp, s.Username, s.ClientId, s.PeerId, s.DataChannelCipher)
+	data := fmt.Sprintf("CN:%s\tRAddr:%s\tVAddr:%s\tVAddr6:%s\tBRecv:%d\tBSent:%d\tSince:[%s]%d\tUser:%s\tClientId:%d\tPeerId:%d\tDCCipher:%s", Sanitize(s.CommonName), s.RealAddr, s.VirtualAddr, s.VirtualAddr6, s.BytesRecv, s.BytesSent, s.ConnectedSinceRaw, s.ConnectedSinceTimestamp, Sanitize(s.Username), s.ClientId, s.PeerId, s.DataChannelCipher)
 	if len(s.errs) > 0 {
 		return fmt.Sprintf("InvalidClient(%s\tParsingErrors:%s)", data, s.Error())
 	}
@@ -42,10 +48,36 @@ func (s Status3Client) ConnectedSinceTime() time.Time {
 	return time.Unix(s.ConnectedSinceTimestamp, 0)
 }
 
+// IsAuthenticated reports whether the client has completed authentication,
+// i.e. its common name is known: not empty and not UNDEF.
+func (s Status3Client) IsAuthenticated() bool {
+	return isKnownCommonName(s.CommonNameRaw)
+}
+
+// VirtualNetworks returns the virtual addresses of the client, both IPv4
+// and IPv6, as networks. Host addresses have the full-length mask while
+// iroute subnets keep their own. Unparsable or empty addresses are skipped.
+func (s Status3Client) VirtualNetworks() []*net.IPNet {
+	nets := make([]*net.IPNet, 0, 2)
+	if n, _, err := ParseVirtualAddr(s.VirtualAddrRaw); err == nil {
+		nets = append(nets, n)
+	}
+	if s.VirtualAddr6 != nil && !s.VirtualAddr6.IsUnspecified() {
+		nets = append(nets, &net.IPNet{IP: s.VirtualAddr6, Mask: net.CIDRMask(128, 128)})
+	}
+	return nets
+}
+
 func (s Status3Client) ParsingErrors() []error {
 	return s.errs
 }
 
+// ParsingWarnings returns the problems the line was recovered from, e.g.
+// a common name containing tabs.
+func (s Status3Client) ParsingWarnings() []error {
+	return s.warnings
+}
+
 func (s Status3Client) Error() string {
 	if len(s.errs) == 0 {
 		return ""
@@ -76,51 +108,96 @@ const (
 	CLHeaderMax
 )
 
+// clientListColumnNames are the column names of CLIENT_LIST HEADER line
+var clientListColumnNames = map[string]int{
+	"Common Name":              int(CLCommonName),
+	"Real Address":             int(CLRealAddr),
+	"Virtual Address":          int(CLVirtualAddr),
+	"Virtual IPv6 Address":     int(CLVirtualAddr6),
+	"Bytes Received":           int(CLBytesRecv),
+	"Bytes Sent":               int(CLBytesSent),
+	"Connected Since":          int(CLConnectedSinceRaw),
+	"Connected Since (time_t)": int(CLConnectedSinceTimestamp),
+	"Username":                 int(CLUsername),
+	"Client ID":                int(CLClientId),
+	"Peer ID":                  int(CLPeerId),
+	"Data Channel Cipher":      int(CLDataChannelCipher),
+}
+
+// NewStatus3Client parses CLIENT_LIST fields in the order of OpenVPN 2.4+
+// output, see ClientListHeader.
 func NewStatus3Client(fields []string) Status3Client {
-	if len(fields) < int(CLHeaderMax) {
-		buf := make([]string, CLHeaderMax)
-		copy(buf, fields)
-		fields = buf
-	}
+	return newStatus3Client(fields, positionalColumns(int(CLHeaderMax)), nil)
+}
 
-	c := Status3Client{
-		CommonName: fields[CLCommonName],
-	}
+// NewStatus3ClientWithHeader parses CLIENT_LIST fields in the order given
+// by the column names of the HEADER line. Unknown columns are ignored
+// and missing ones are left zero.
+func NewStatus3ClientWithHeader(header, fields []string) Status3Client {
+	return newStatus3Client(fields, headerColumns(header, clientListColumnNames, int(CLHeaderMax)), nil)
+}
 
-	var err error
-	c.RealAddr, err = ParseIPAddrPort(fields[CLRealAddr])
-	if err != nil {
-		c.errs = append(c.errs, err)
+func newStatus3Client(fields []string, cols statusColumns, o *parseOptions) Status3Client {
+	c := Status3Client{}
+	// common names are controlled by the CA and may contain the separator
+	fields, warn := cols.mergeSurplus(fields, int(CLCommonName), "Common Name", status3FieldSep)
+	if warn != nil {
+		c.warnings = append(c.warnings, warn)
+	}
+	parseInt := func(col ClientListHeader) int64 {
+		v, ok := cols.field(fields, int(col))
+		if !ok {
+			return 0
+		}
+		i, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			c.errs = append(c.errs, err)
+		}
+		return i
 	}
-	c.VirtualAddr = SafeParseIP4Addr(fields[CLVirtualAddr])
-	c.VirtualAddr6 = SafeParseIP6Addr(fields[CLVirtualAddr6])
 
-	c.BytesRecv, err = strconv.ParseInt(fields[CLBytesRecv], 10, 64)
-	if err != nil {
-		c.errs = append(c.errs, err)
+	c.CommonNameRaw, _ = cols.field(fields, int(CLCommonName))
+	c.CommonName = o.undef(c.CommonNameRaw)
+	if v, ok := cols.field(fields, int(CLRealAddr)); ok {
+		var err error
+		c.RealAddr, err = parseRealAddr(v)
+		if err != nil {
+			c.errs = append(c.errs, err)
+		}
 	}
-	c.BytesSent, err = strconv.ParseInt(fields[CLBytesSent], 10, 64)
-	if err != nil {
-		c.errs = append(c.errs, err)
+	if v, ok := cols.field(fields, int(CLVirtualAddr)); ok {
+		c.VirtualAddrRaw = v
+		n, cached, err := ParseVirtualAddr(v)
+		if err == nil && isHostIPNet(n) {
+			c.VirtualAddr = n.IP
+		} else {
+			c.VirtualAddr = SafeParseIP4Addr("")
+		}
+		c.VirtualAddrCached = err == nil && cached
 	}
-
-	c.ConnectedSinceRaw = fields[CLConnectedSinceRaw]
-	c.ConnectedSinceTimestamp, err = strconv.ParseInt(fields[CLConnectedSinceTimestamp], 10, 64)
-	if err != nil {
-		c.errs = append(c.errs, err)
+	if v, ok := cols.field(fields, int(CLVirtualAddr6)); ok {
+		c.VirtualAddr6 = SafeParseIP6Addr(v)
 	}
 
-	c.Username = fields[CLUsername]
-	c.ClientId, err = strconv.ParseInt(fields[CLClientId], 10, 64)
+	c.BytesRecv = parseInt(CLBytesRecv)
+	c.BytesSent = parseInt(CLBytesSent)
+
+	c.ConnectedSinceRaw, _ = cols.field(fields, int(CLConnectedSinceRaw))
+	var err error
+	c.ConnectedSinceTimestamp, err = statusTimestamp(fields, cols, int(CLConnectedSinceTimestamp), int(CLConnectedSinceRaw), o.location())
 	if err != nil {
 		c.errs = append(c.errs, err)
 	}
-	c.PeerId, err = strconv.ParseInt(fields[CLPeerId], 10, 64)
-	if err != nil {
-		c.errs = append(c.errs, err)
+
+	c.UsernameRaw, _ = cols.field(fields, int(CLUsername))
+	c.Username = o.undef(c.UsernameRaw)
+	c.ClientId = parseInt(CLClientId)
+	if v, ok := cols.field(fields, int(CLClientId)); ok && v != "" {
+		c.hasClientId = true
 	}
+	c.PeerId = parseInt(CLPeerId)
 
-	c.DataChannelCipher = fields[CLDataChannelCipher]
+	c.DataChannelCipher, _ = cols.field(fields, int(CLDataChannelCipher))
 
 	return c
 }
@@ -0,0 +1,70 @@
+package ovmgmt
+
+import (
+	"fmt"
+	"strings"
+)
+
+// statusColumns maps columns of a status line (indexed by ClientListHeader
+// or RoutingTableHeader) to the positions of its fields, -1 for columns
+// missing in the line. width is the number of fields a line is expected
+// to have.
+type statusColumns struct {
+	pos   []int
+	width int
+}
+
+// positionalColumns is the mapping for status output without HEADER line,
+// fields are expected in the order of OpenVPN 2.4+ and short lines are
+// padded with empty fields
+func positionalColumns(n int) statusColumns {
+	cols := statusColumns{pos: make([]int, n), width: n}
+	for i := range cols.pos {
+		cols.pos[i] = i
+	}
+	return cols
+}
+
+// headerColumns builds the mapping from the column names of HEADER line,
+// unknown columns are ignored
+func headerColumns(header []string, names map[string]int, n int) statusColumns {
+	cols := statusColumns{pos: make([]int, n), width: len(header)}
+	for i := range cols.pos {
+		cols.pos[i] = -1
+	}
+	for pos, name := range header {
+		if col, ok := names[name]; ok && cols.pos[col] == -1 {
+			cols.pos[col] = pos
+		}
+	}
+	return cols
+}
+
+// field returns the field of the column and whether the column is present
+func (cols statusColumns) field(fields []string, col int) (string, bool) {
+	pos := cols.pos[col]
+	if pos < 0 {
+		return "", false
+	}
+	if pos >= len(fields) {
+		return "", true
+	}
+	return fields[pos], true
+}
+
+// mergeSurplus joins the fields exceeding the expected width back into
+// the free-text column, e.g. a common name containing the separator.
+// fields is not modified, the warning is nil if there is nothing to merge.
+func (cols statusColumns) mergeSurplus(fields []string, col int, name, sep string) ([]string, error) {
+	surplus := len(fields) - cols.width
+	pos := cols.pos[col]
+	if surplus <= 0 || pos < 0 || pos >= len(fields) {
+		return fields, nil
+	}
+
+	merged := make([]string, 0, cols.width)
+	merged = append(merged, fields[:pos]...)
+	merged = append(merged, strings.Join(fields[pos:pos+surplus+1], sep))
+	merged = append(merged, fields[pos+surplus+1:]...)
+	return merged, fmt.Errorf("%d surplus fields merged into %s", surplus, name)
+}
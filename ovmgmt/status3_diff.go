@@ -0,0 +1,154 @@
+package ovmgmt
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const statusDeltaEventKW = "STATUS_DELTA"
+
+// StatusRoam is a client whose real address changed between snapshots.
+type StatusRoam struct {
+	Prev Status3Client
+	Cur  Status3Client
+}
+
+// StatusDelta is the difference between two successive status snapshots,
+// see StatusDiff.
+type StatusDelta struct {
+	// Initial is true when there was no previous snapshot, all current
+	// clients are reported as connected then
+	Initial bool
+	// Connected are the clients which appeared in the current snapshot
+	Connected []Status3Client
+	// Disconnected are the clients which are gone from the current
+	// snapshot, with their last known byte counters
+	Disconnected []Status3Client
+	// Roamed are the clients whose real address changed
+	Roamed []StatusRoam
+}
+
+// Empty reports whether there are no changes.
+func (d StatusDelta) Empty() bool {
+	return len(d.Connected) == 0 && len(d.Disconnected) == 0 && len(d.Roamed) == 0
+}
+
+// StatusDiff compares two successive status snapshots. Clients are matched
+// by Client ID, or by Common Name and connection time if the snapshots have
+// no Client ID column. A reused Client ID of a different session (e.g. after
+// the daemon restart) is reported as a disconnect and a connect. Invalid
+// client rows take part in the matching as well, so that a client is not
+// reported as gone just because its row couldn't be parsed once.
+//
+// nil prev is the first snapshot: all current clients are reported as
+// connected and the delta is marked Initial. nil cur is treated as
+// a snapshot without clients.
+func StatusDiff(prev, cur *Status3Event) StatusDelta {
+	d := StatusDelta{Initial: prev == nil}
+
+	prevClients := snapshotClients(prev)
+	curClients := snapshotClients(cur)
+
+	prevByKey := make(map[string]Status3Client, len(prevClients))
+	for _, c := range prevClients {
+		prevByKey[statusClientKey(c)] = c
+	}
+
+	seen := make(map[string]bool, len(curClients))
+	for _, c := range curClients {
+		key := statusClientKey(c)
+		seen[key] = true
+
+		p, ok := prevByKey[key]
+		switch {
+		case !ok:
+			d.Connected = append(d.Connected, c)
+		case !sameSession(p, c):
+			// reused Client ID
+			d.Disconnected = append(d.Disconnected, p)
+			d.Connected = append(d.Connected, c)
+		case roamed(p, c):
+			d.Roamed = append(d.Roamed, StatusRoam{Prev: p, Cur: c})
+		}
+	}
+
+	for _, p := range prevClients {
+		if !seen[statusClientKey(p)] {
+			d.Disconnected = append(d.Disconnected, p)
+		}
+	}
+	return d
+}
+
+// snapshotClients returns both valid and invalid clients of the snapshot
+func snapshotClients(se *Status3Event) []Status3Client {
+	if se == nil {
+		return nil
+	}
+	clients := make([]Status3Client, 0, len(se.clients)+len(se.invalidClients))
+	clients = append(clients, se.clients...)
+	return append(clients, se.invalidClients...)
+}
+
+func statusClientKey(c Status3Client) string {
+	if c.hasClientId {
+		return "cid:" + strconv.FormatInt(c.ClientId, 10)
+	}
+	return "cn:" + strconv.FormatInt(c.ConnectedSinceTimestamp, 10) + ":" + c.CommonNameRaw
+}
+
+// sameSession reports whether the clients of the same key are the same
+// session. The connection time is compared only if both are known, it's 0
+// in the invalid rows.
+func sameSession(a, b Status3Client) bool {
+	if a.CommonNameRaw != b.CommonNameRaw {
+		return false
+	}
+	if a.ConnectedSinceTimestamp == 0 || b.ConnectedSinceTimestamp == 0 {
+		return true
+	}
+	return a.ConnectedSinceTimestamp == b.ConnectedSinceTimestamp
+}
+
+func roamed(a, b Status3Client) bool {
+	if a.RealAddr == nil || b.RealAddr == nil {
+		return false
+	}
+	return !a.RealAddr.IP.Equal(b.RealAddr.IP) || a.RealAddr.Port != b.RealAddr.Port
+}
+
+// StatusDeltaEvent is a synthetic event emitted after Status3Event by
+// the client created with WithStatusDiffEvents, when the client list
+// changed since the previous snapshot.
+type StatusDeltaEvent struct {
+	receivedAt
+	delta StatusDelta
+}
+
+func (e StatusDeltaEvent) Keyword() string {
+	return statusDeltaEventKW
+}
+
+func (e StatusDeltaEvent) Delta() StatusDelta {
+	return e.delta
+}
+
+func (e StatusDeltaEvent) Raw() string {
+	return fmt.Sprintf("%s%sinitial=%t,connected=%d,disconnected=%d,roamed=%d", statusDeltaEventKW, eventSep,
+		e.delta.Initial, len(e.delta.Connected), len(e.delta.Disconnected), len(e.delta.Roamed))
+}
+
+func (e StatusDeltaEvent) String() string {
+	parts := make([]string, 0, len(e.delta.Connected)+len(e.delta.Disconnected)+len(e.delta.Roamed))
+	for _, c := range e.delta.Connected {
+		parts = append(parts, fmt.Sprintf("+%s[%d]", Sanitize(c.CommonNameRaw), c.ClientId))
+	}
+	for _, c := range e.delta.Disconnected {
+		parts = append(parts, fmt.Sprintf("-%s[%d]", Sanitize(c.CommonNameRaw), c.ClientId))
+	}
+	for _, r := range e.delta.Roamed {
+		parts = append(parts, fmt.Sprintf("~%s[%d]:%s->%s", Sanitize(r.Cur.CommonNameRaw), r.Cur.ClientId, r.Prev.RealAddr, r.Cur.RealAddr))
+	}
+	return fmt.Sprintf("%s: %s", statusDeltaEventKW, strings.Join(parts, " "))
+}
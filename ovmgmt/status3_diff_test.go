@@ -0,0 +1,193 @@
+package ovmgmt
+
+import (
+	"io"
+	"io/ioutil"
+	"sort"
+	"testing"
+)
+
+const status3ClientHeader = "HEADER\tCLIENT_LIST\tCommon Name\tReal Address\tVirtual Address\tVirtual IPv6 Address\tBytes Received\tBytes Sent\tConnected Since\tConnected Since (time_t)\tUsername\tClient ID\tPeer ID"
+
+func mustStatus3Event(t *testing.T, lines ...string) *Status3Event {
+	t.Helper()
+	se, err := NewStatus3Event(lines)
+	if err != nil {
+		t.Fatalf("NewStatus3Event returned error: %s", err)
+	}
+	return &se
+}
+
+func deltaNames(clients []Status3Client) []string {
+	names := make([]string, len(clients))
+	for i, c := range clients {
+		names[i] = c.CommonNameRaw
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestStatusDiff(t *testing.T) {
+	type TestCase struct {
+		Prev         []string
+		Cur          []string
+		Connected    []string
+		Disconnected []string
+		Roamed       []string
+	}
+
+	alice := "CLIENT_LIST\talice\t198.51.100.7:52331\t10.8.0.6\t\t5523\t7391\tMon Mar 23 17:51:49 2020\t1584985909\tUNDEF\t5\t0"
+	aliceMore := "CLIENT_LIST\talice\t198.51.100.7:52331\t10.8.0.6\t\t9000\t9100\tMon Mar 23 17:51:49 2020\t1584985909\tUNDEF\t5\t0"
+	aliceRoamed := "CLIENT_LIST\talice\t203.0.113.9:40000\t10.8.0.6\t\t9000\t9100\tMon Mar 23 17:51:49 2020\t1584985909\tUNDEF\t5\t0"
+	aliceInvalid := "CLIENT_LIST\talice\t198.51.100.7:52331\t10.8.0.6\t\tmany\t9100\tMon Mar 23 17:51:49 2020\t1584985909\tUNDEF\t5\t0"
+	aliceNoTime := "CLIENT_LIST\talice\t198.51.100.7:52331\t10.8.0.6\t\t9000\t9100\tsometime\tlater\tUNDEF\t5\t0"
+	bob := "CLIENT_LIST\tbob\t198.51.100.8:1194\t10.8.0.10\t\t100\t200\tMon Mar 23 17:52:00 2020\t1584985920\tUNDEF\t6\t1"
+	// CID 5 reused by another session after the daemon restart
+	carol := "CLIENT_LIST\tcarol\t198.51.100.9:1194\t10.8.0.6\t\t10\t20\tMon Mar 23 18:00:00 2020\t1584986400\tUNDEF\t5\t0"
+
+	testCases := []TestCase{
+		{
+			Prev:      []string{status3ClientHeader, alice},
+			Cur:       []string{status3ClientHeader, aliceMore, bob},
+			Connected: []string{"bob"},
+		},
+		{
+			Prev:         []string{status3ClientHeader, alice, bob},
+			Cur:          []string{status3ClientHeader, bob},
+			Disconnected: []string{"alice"},
+		},
+		{
+			Prev:   []string{status3ClientHeader, alice},
+			Cur:    []string{status3ClientHeader, aliceRoamed},
+			Roamed: []string{"alice"},
+		},
+		{
+			Prev:         []string{status3ClientHeader, alice},
+			Cur:          []string{status3ClientHeader, carol},
+			Connected:    []string{"carol"},
+			Disconnected: []string{"alice"},
+		},
+		// invalid row is still present
+		{
+			Prev: []string{status3ClientHeader, alice},
+			Cur:  []string{status3ClientHeader, aliceInvalid},
+		},
+		// connection time of the invalid row is unknown
+		{
+			Prev: []string{status3ClientHeader, alice},
+			Cur:  []string{status3ClientHeader, aliceNoTime},
+		},
+		{
+			Prev: []string{status3ClientHeader, aliceNoTime},
+			Cur:  []string{status3ClientHeader, aliceMore},
+		},
+		// no Client ID column, positional 2.3 layout
+		{
+			Prev: []string{"CLIENT_LIST\talice\t198.51.100.7:52331\t10.8.0.6\t\t5523\t7391\tMon Mar 23 17:51:49 2020\t1584985909\tUNDEF"},
+			Cur: []string{
+				"CLIENT_LIST\talice\t198.51.100.7:52331\t10.8.0.6\t\t9000\t9100\tMon Mar 23 17:51:49 2020\t1584985909\tUNDEF",
+				"CLIENT_LIST\talice\t198.51.100.8:1194\t10.8.0.10\t\t1\t2\tMon Mar 23 17:55:00 2020\t1584986100\tUNDEF",
+			},
+			Connected: []string{"alice"},
+		},
+	}
+
+	for i, tc := range testCases {
+		d := StatusDiff(mustStatus3Event(t, tc.Prev...), mustStatus3Event(t, tc.Cur...))
+		if d.Initial {
+			t.Errorf("test %d delta is Initial", i)
+		}
+		if got := deltaNames(d.Connected); !equalStrings(got, tc.Connected) {
+			t.Errorf("test %d Connected got %q; want %q", i, got, tc.Connected)
+		}
+		if got := deltaNames(d.Disconnected); !equalStrings(got, tc.Disconnected) {
+			t.Errorf("test %d Disconnected got %q; want %q", i, got, tc.Disconnected)
+		}
+		roamed := make([]Status3Client, len(d.Roamed))
+		for j, r := range d.Roamed {
+			roamed[j] = r.Cur
+		}
+		if got := deltaNames(roamed); !equalStrings(got, tc.Roamed) {
+			t.Errorf("test %d Roamed got %q; want %q", i, got, tc.Roamed)
+		}
+		if d.Empty() != (len(tc.Connected)+len(tc.Disconnected)+len(tc.Roamed) == 0) {
+			t.Errorf("test %d Empty returned %t", i, d.Empty())
+		}
+	}
+
+	// last known counters of a disconnected client
+	d := StatusDiff(mustStatus3Event(t, status3ClientHeader, aliceMore), mustStatus3Event(t, status3ClientHeader))
+	if len(d.Disconnected) != 1 || d.Disconnected[0].BytesRecv != 9000 || d.Disconnected[0].BytesSent != 9100 {
+		t.Errorf("Disconnected got %v", d.Disconnected)
+	}
+
+	// first snapshot
+	d = StatusDiff(nil, mustStatus3Event(t, status3ClientHeader, alice, bob))
+	if !d.Initial || len(d.Connected) != 2 || len(d.Disconnected) != 0 {
+		t.Errorf("first snapshot delta got %+v", d)
+	}
+	if d = StatusDiff(nil, nil); !d.Initial || !d.Empty() {
+		t.Errorf("nil snapshots delta got %+v", d)
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestStatusDiffEvents(t *testing.T) {
+	r, w := io.Pipe()
+	defer w.Close()
+	eventCh := make(chan Event, 10)
+	c := NewMgmtClientWithOptions(mockConn{r, ioutil.Discard}, eventCh, WithStatusDiffEvents())
+
+	alice := "CLIENT_LIST\talice\t198.51.100.7:52331\t10.8.0.6\t\t5523\t7391\tMon Mar 23 17:51:49 2020\t1584985909\tUNDEF\t5\t0"
+	bob := "CLIENT_LIST\tbob\t198.51.100.8:1194\t10.8.0.10\t\t100\t200\tMon Mar 23 17:52:00 2020\t1584985920\tUNDEF\t6\t1"
+	snapshots := [][]string{
+		{status3ClientHeader, alice, "END"},
+		{status3ClientHeader, alice, "END"},
+		{status3ClientHeader, bob, "END"},
+	}
+	go func() {
+		for _, lines := range snapshots {
+			for _, line := range lines {
+				if _, err := io.WriteString(w, line+"\n"); err != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	var prev *Status3Event
+	for range snapshots {
+		prev = c.generateStatus3Event(prev)
+	}
+
+	deltas := make([]StatusDelta, 0)
+	for len(eventCh) > 0 {
+		if e, ok := (<-eventCh).(StatusDeltaEvent); ok {
+			if e.ReceivedAt().IsZero() {
+				t.Errorf("StatusDeltaEvent has no receive time")
+			}
+			deltas = append(deltas, e.Delta())
+		}
+	}
+	// no delta for the unchanged second snapshot
+	if len(deltas) != 2 {
+		t.Fatalf("got deltas %+v; want 2", deltas)
+	}
+	if !deltas[0].Initial || len(deltas[0].Connected) != 1 {
+		t.Errorf("first delta got %+v", deltas[0])
+	}
+	if deltas[1].Initial || len(deltas[1].Connected) != 1 || len(deltas[1].Disconnected) != 1 {
+		t.Errorf("second delta got %+v", deltas[1])
+	}
+}
@@ -1,6 +1,7 @@
 package ovmgmt
 
 import (
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
@@ -14,6 +15,7 @@ import (
 //GLOBAL_STATS	Max bcast/mcast queue length	1
 //END
 
+const status3EventKW = "STATUS3"
 const status3TitleKW = "TITLE"
 const status3TimeKW = "TIME"
 const status3HeaderKW = "HEADER"
@@ -22,6 +24,7 @@ const status3RoutingTableKW = "ROUTING_TABLE"
 const status3FieldSep = "\t"
 
 type Status3Event struct {
+	receivedAt
 	title          string
 	rawHumanTS     string
 	rawTS          string
@@ -31,77 +34,151 @@ type Status3Event struct {
 	routes         []Status3Route
 	invalidRoutes  []Status3Route
 	headers        map[string][]string
+	globalStats    GlobalStats
 	extra          map[string][]string
+	index          *status3Index
+	// lines are the payload lines as received, for Serialize
+	lines []string
 }
 
 func NewStatus3Event(payload []string) (Status3Event, error) {
+	return newStatus3Event(payload, nil)
+}
+
+// newStatus3Event is NewStatus3Event applying the parsing options of
+// the client
+func newStatus3Event(payload []string, o *parseOptions) (Status3Event, error) {
+	nClients, nRoutes := countStatus3Records(payload)
+
 	se := Status3Event{}
 	se.headers = make(map[string][]string)
 	se.extra = make(map[string][]string)
-	se.clients = make([]Status3Client, 0)
-	se.routes = make([]Status3Route, 0)
+	se.clients = make([]Status3Client, 0, nClients)
+	se.routes = make([]Status3Route, 0, nRoutes)
+	se.index = &status3Index{}
+	se.lines = copyFields(payload)
 
+	cols := newStatus3Layout()
+	// fields of the current line, the storage is reused across lines
+	var lineFields []string
 	var err error
 	for _, line := range payload {
-		lineFields := strings.Split(line, status3FieldSep)
+		lineFields = splitStatusFields(lineFields, line)
 		lineType := lineFields[0]
-		lineFields = lineFields[1:]
+		fields := lineFields[1:]
 
 		switch lineType {
 		case status3TitleKW:
-			se.title = strings.Join(lineFields, status3FieldSep)
+			se.title = strings.TrimPrefix(line[len(lineType):], status3FieldSep)
 		case status3TimeKW:
-			se.rawHumanTS = lineFields[0]
-			se.rawTS = lineFields[1]
+			if len(fields) < 2 {
+				return se, errors.New("malformed TIME line: " + line)
+			}
+			se.rawHumanTS = fields[0]
+			se.rawTS = fields[1]
 			se.ts, err = strconv.ParseInt(se.rawTS, 10, 64)
 			if err != nil {
 				return se, err
 			}
 		case status3HeaderKW:
-			headerType := lineFields[0]
-			se.headers[headerType] = lineFields[1:]
+			if len(fields) < 1 {
+				continue
+			}
+			se.headers[fields[0]] = copyFields(fields[1:])
+			cols.setHeader(fields[0], fields[1:])
 		case status3ClientListKW:
-			c := NewStatus3Client(lineFields)
+			c := newStatus3Client(fields, cols.client, o)
 			if len(c.ParsingErrors()) > 0 {
 				se.invalidClients = append(se.invalidClients, c)
 			} else {
 				se.clients = append(se.clients, c)
 			}
 		case status3RoutingTableKW:
-			c := NewStatus3Route(lineFields)
+			c := newStatus3Route(fields, cols.route, o)
 			if len(c.ParsingErrors()) > 0 {
 				se.invalidRoutes = append(se.invalidRoutes, c)
 			} else {
 				se.routes = append(se.routes, c)
 			}
+		case status3GlobalStatsKW:
+			se.globalStats.add(fields)
 		default:
-			se.extra[lineType] = lineFields
+			se.extra[lineType] = copyFields(fields)
 		}
 	}
 	return se, nil
 }
 
-func (se Status3Event) Raw() string {
-	cl := make([]string, len(se.clients))
-	for i, c := range se.clients {
-		cl[i] = c.Raw()
+// countStatus3Records counts client and route lines to pre-size the slices
+func countStatus3Records(payload []string) (clients, routes int) {
+	for _, line := range payload {
+		switch {
+		case strings.HasPrefix(line, status3ClientListKW+status3FieldSep):
+			clients++
+		case strings.HasPrefix(line, status3RoutingTableKW+status3FieldSep):
+			routes++
+		}
 	}
-	rl := make([]string, len(se.routes))
-	for i, r := range se.routes {
-		rl[i] = r.Raw()
+	return clients, routes
+}
+
+// splitStatusFields splits the line by tabs into buf, reusing its storage.
+// The fields are only valid until the next call with the same buf.
+func splitStatusFields(buf []string, line string) []string {
+	buf = buf[:0]
+	for {
+		i := strings.IndexByte(line, status3FieldSep[0])
+		if i < 0 {
+			return append(buf, line)
+		}
+		buf = append(buf, line[:i])
+		line = line[i+1:]
 	}
+}
 
-	icl := make([]string, len(se.invalidClients))
-	for i, c := range se.invalidClients {
-		icl[i] = c.Raw()
+func copyFields(fields []string) []string {
+	return append(make([]string, 0, len(fields)), fields...)
+}
+
+// status3Layout is the column mapping of client and route lines, which is
+// positional until the HEADER line of the type is seen
+type status3Layout struct {
+	client statusColumns
+	route  statusColumns
+}
+
+func newStatus3Layout() status3Layout {
+	return status3Layout{
+		client: positionalColumns(int(CLHeaderMax)),
+		route:  positionalColumns(int(RTHeaderMax)),
 	}
-	irl := make([]string, len(se.invalidRoutes))
-	for i, r := range se.invalidRoutes {
-		irl[i] = r.Raw()
+}
+
+func (l *status3Layout) setHeader(lineType string, names []string) {
+	switch lineType {
+	case status3ClientListKW:
+		l.client = headerColumns(names, clientListColumnNames, int(CLHeaderMax))
+	case status3RoutingTableKW:
+		l.route = headerColumns(names, routingTableColumnNames, int(RTHeaderMax))
 	}
+}
+
+// Keyword returns STATUS3, the event is generated from 'status 3' command
+// reply rather than received as a notification.
+func (se Status3Event) Keyword() string {
+	return status3EventKW
+}
 
-	return fmt.Sprintf("%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s", se.title, se.rawHumanTS, se.rawTS, cl, rl,
-		se.extra, icl, irl)
+// Raw returns the lines of Serialize joined by newlines.
+func (se Status3Event) Raw() string {
+	return strings.Join(se.lines, "\n")
+}
+
+// Serialize returns the lines of 'status 3' output the event is parsed
+// from, in their original order and without the trailing END, such that
+// NewStatus3Event or ParseStatus3 yield an equivalent event.
+func (se Status3Event) Serialize() []string {
+	return copyFields(se.lines)
 }
 
 func (se Status3Event) String() string {
@@ -122,8 +199,41 @@ func (se Status3Event) String() string {
 	for i, r := range se.invalidRoutes {
 		irl[i] = r.String()
 	}
-	return fmt.Sprintf("STATUS3:<%s\t%s\t%s\t%s\t%s\t%s>\t%s\t%s", se.title, se.rawHumanTS, se.rawTS, cl, rl,
-		se.extra, icl, irl)
+	// tabs are the field separators, sanitize fields only, clients and
+	// routes sanitize their own fields
+	return fmt.Sprintf("%s:<%s\t%s\t%s\t%s\t%s\t%s\t%s>\t%s\t%s", status3EventKW, Sanitize(se.title), se.rawHumanTS, se.rawTS, cl, rl,
+		se.globalStats.String(), Sanitize(fmt.Sprint(se.extra)), icl, irl)
+}
+
+// Title returns the TITLE banner, i.e. the version string of the daemon.
+func (se Status3Event) Title() string {
+	return se.title
+}
+
+// TimeRaw returns the human readable TIME field as sent by the daemon.
+func (se Status3Event) TimeRaw() string {
+	return se.rawHumanTS
+}
+
+// Headers returns a copy of the HEADER lines keyed by the record type
+// they describe, e.g. CLIENT_LIST.
+func (se Status3Event) Headers() map[string][]string {
+	return copyStatus3Records(se.headers)
+}
+
+// Extra returns a copy of the records of unrecognized types, keyed by
+// the record type. Only the last record of each type is kept.
+func (se Status3Event) Extra() map[string][]string {
+	return copyStatus3Records(se.extra)
+}
+
+// copyStatus3Records returns a deep copy of m, never nil
+func copyStatus3Records(m map[string][]string) map[string][]string {
+	c := make(map[string][]string, len(m))
+	for k, v := range m {
+		c[k] = append([]string(nil), v...)
+	}
+	return c
 }
 
 func (se Status3Event) Timestamp() int64 {
@@ -142,6 +252,34 @@ func (se Status3Event) Routes() []Status3Route {
 	return se.routes
 }
 
+// GlobalStats returns the server-wide statistics.
+func (se Status3Event) GlobalStats() GlobalStats {
+	gs := se.globalStats
+	if gs.Other != nil {
+		gs.Other = make(map[string]string, len(se.globalStats.Other))
+		for k, v := range se.globalStats.Other {
+			gs.Other[k] = v
+		}
+	}
+	return gs
+}
+
+// firstParsingError returns the error of the first invalid client or route
+func (se Status3Event) firstParsingError() error {
+	if len(se.invalidClients) > 0 {
+		c := se.invalidClients[0]
+		return fmt.Errorf("invalid client %q: %w", c.Raw(), c.ParsingErrors()[0])
+	}
+	if len(se.invalidRoutes) > 0 {
+		r := se.invalidRoutes[0]
+		return fmt.Errorf("invalid route %q: %w", r.Raw(), r.ParsingErrors()[0])
+	}
+	if errs := se.globalStats.ParsingErrors(); len(errs) > 0 {
+		return fmt.Errorf("invalid global stats: %w", errs[0])
+	}
+	return nil
+}
+
 func (se Status3Event) InvalidClients() []Status3Client {
 	return se.invalidClients
 }
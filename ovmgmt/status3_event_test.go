@@ -0,0 +1,478 @@
+package ovmgmt
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// captured from OpenVPN 2.4.8 server
+var status3Payload24 = []string{
+	"TITLE\tOpenVPN 2.4.8 x86_64-pc-linux-gnu [SSL (OpenSSL)] [LZO] [LZ4] [EPOLL] [PKCS11] [MH/PKTINFO] [AEAD] built on Oct 30 2019",
+	"TIME\tMon Mar 23 17:53:22 2020\t1584986002",
+	"HEADER\tCLIENT_LIST\tCommon Name\tReal Address\tVirtual Address\tVirtual IPv6 Address\tBytes Received\tBytes Sent\tConnected Since\tConnected Since (time_t)\tUsername\tClient ID\tPeer ID",
+	"CLIENT_LIST\talice\t198.51.100.7:52331\t10.8.0.6\t\t5523\t7391\tMon Mar 23 17:51:49 2020\t1584985909\tUNDEF\t5\t0",
+	"HEADER\tROUTING_TABLE\tVirtual Address\tCommon Name\tReal Address\tLast Ref\tLast Ref (time_t)",
+	"ROUTING_TABLE\t10.8.0.6\talice\t198.51.100.7:52331\tMon Mar 23 17:53:20 2020\t1584986000",
+	"GLOBAL_STATS\tMax bcast/mcast queue length\t1",
+}
+
+func TestStatus3ClientHeaderLayouts(t *testing.T) {
+	type TestCase struct {
+		Header     string
+		Row        string
+		WantCipher string
+	}
+
+	testCases := []TestCase{
+		// 2.4
+		{
+			"HEADER\tCLIENT_LIST\tCommon Name\tReal Address\tVirtual Address\tVirtual IPv6 Address\tBytes Received\tBytes Sent\tConnected Since\tConnected Since (time_t)\tUsername\tClient ID\tPeer ID",
+			"CLIENT_LIST\talice\t198.51.100.7:52331\t10.8.0.6\t\t5523\t7391\tMon Mar 23 17:51:49 2020\t1584985909\tUNDEF\t5\t0",
+			"",
+		},
+		// 2.5+
+		{
+			"HEADER\tCLIENT_LIST\tCommon Name\tReal Address\tVirtual Address\tVirtual IPv6 Address\tBytes Received\tBytes Sent\tConnected Since\tConnected Since (time_t)\tUsername\tClient ID\tPeer ID\tData Channel Cipher",
+			"CLIENT_LIST\talice\t198.51.100.7:52331\t10.8.0.6\t\t5523\t7391\tMon Mar 23 17:51:49 2020\t1584985909\tUNDEF\t5\t0\tAES-256-GCM",
+			"AES-256-GCM",
+		},
+		// hypothetical future version with reordered and new columns
+		{
+			"HEADER\tCLIENT_LIST\tClient ID\tCommon Name\tDCO Enabled\tReal Address\tVirtual Address\tVirtual IPv6 Address\tBytes Received\tBytes Sent\tConnected Since\tConnected Since (time_t)\tUsername\tPeer ID\tData Channel Cipher",
+			"CLIENT_LIST\t5\talice\t1\t198.51.100.7:52331\t10.8.0.6\t\t5523\t7391\tMon Mar 23 17:51:49 2020\t1584985909\tUNDEF\t0\tCHACHA20-POLY1305",
+			"CHACHA20-POLY1305",
+		},
+	}
+
+	for i, testCase := range testCases {
+		se, err := NewStatus3Event([]string{testCase.Header, testCase.Row})
+		if err != nil {
+			t.Errorf("test %d returned error: %s", i, err)
+			continue
+		}
+		if len(se.InvalidClients()) != 0 || len(se.Clients()) != 1 {
+			t.Errorf("test %d got clients %v, invalid %v", i, se.Clients(), se.InvalidClients())
+			continue
+		}
+
+		c := se.Clients()[0]
+		if c.CommonName != "alice" || c.ClientId != 5 || c.PeerId != 0 || c.Username != "UNDEF" {
+			t.Errorf("test %d got %s", i, c)
+		}
+		if c.RealAddr == nil || !c.RealAddr.IP.Equal(net.ParseIP("198.51.100.7")) || c.RealAddr.Port != 52331 {
+			t.Errorf("test %d got real address %v", i, c.RealAddr)
+		}
+		if !c.VirtualAddr.Equal(net.ParseIP("10.8.0.6")) || c.BytesRecv != 5523 || c.BytesSent != 7391 {
+			t.Errorf("test %d got %s", i, c)
+		}
+		if c.ConnectedSinceTimestamp != 1584985909 || c.ConnectedSinceRaw != "Mon Mar 23 17:51:49 2020" {
+			t.Errorf("test %d got connected since [%s]%d", i, c.ConnectedSinceRaw, c.ConnectedSinceTimestamp)
+		}
+		if c.DataChannelCipher != testCase.WantCipher {
+			t.Errorf("test %d got cipher %q; want %q", i, c.DataChannelCipher, testCase.WantCipher)
+		}
+	}
+}
+
+func TestStatus3EventNoHeader(t *testing.T) {
+	payload := make([]string, 0, len(status3Payload24))
+	for _, line := range status3Payload24 {
+		if !strings.HasPrefix(line, status3HeaderKW) {
+			payload = append(payload, line)
+		}
+	}
+
+	se, err := NewStatus3Event(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(se.Clients()) != 1 || se.Clients()[0].CommonName != "alice" || se.Clients()[0].PeerId != 0 {
+		t.Errorf("got clients %v, invalid %v", se.Clients(), se.InvalidClients())
+	}
+	if len(se.Routes()) != 1 || se.Routes()[0].LastRefTimestamp != 1584986000 {
+		t.Errorf("got routes %v, invalid %v", se.Routes(), se.InvalidRoutes())
+	}
+
+	// short line without header is invalid
+	se, _ = NewStatus3Event([]string{"CLIENT_LIST\talice\t198.51.100.7:52331"})
+	if len(se.InvalidClients()) != 1 {
+		t.Errorf("got clients %v, invalid %v; want 1 invalid", se.Clients(), se.InvalidClients())
+	}
+}
+
+func TestStatus3RouteHeader(t *testing.T) {
+	se, err := NewStatus3Event([]string{
+		"HEADER\tROUTING_TABLE\tCommon Name\tVirtual Address\tLast Ref (time_t)",
+		"ROUTING_TABLE\talice\t10.8.0.6\t1584986000",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(se.Routes()) != 1 {
+		t.Fatalf("got routes %v, invalid %v", se.Routes(), se.InvalidRoutes())
+	}
+	r := se.Routes()[0]
+	if r.CommonName != "alice" || r.VirtualAddrFlags != "10.8.0.6" || r.LastRefTimestamp != 1584986000 || r.RealAddr != nil {
+		t.Errorf("got %s", r)
+	}
+}
+
+func TestStatus3SeparatorInCommonName(t *testing.T) {
+	type TestCase struct {
+		Lines        []string
+		WantCN       string
+		WantWarnings int
+	}
+
+	clientHeader := status3Payload24[2]
+	routeHeader := status3Payload24[4]
+	testCases := []TestCase{
+		// commas don't affect tab separated output
+		{
+			[]string{
+				clientHeader,
+				"CLIENT_LIST\tDoe, John\t198.51.100.7:52331\t10.8.0.6\t\t5523\t7391\tMon Mar 23 17:51:49 2020\t1584985909\tUNDEF\t5\t0",
+				routeHeader,
+				"ROUTING_TABLE\t10.8.0.6\tDoe, John\t198.51.100.7:52331\tMon Mar 23 17:53:20 2020\t1584986000",
+			},
+			"Doe, John", 0,
+		},
+		{
+			[]string{
+				clientHeader,
+				"CLIENT_LIST\tDoe\tJohn\t198.51.100.7:52331\t10.8.0.6\t\t5523\t7391\tMon Mar 23 17:51:49 2020\t1584985909\tUNDEF\t5\t0",
+				routeHeader,
+				"ROUTING_TABLE\t10.8.0.6\tDoe\tJohn\t198.51.100.7:52331\tMon Mar 23 17:53:20 2020\t1584986000",
+			},
+			"Doe\tJohn", 1,
+		},
+		// without HEADER lines the 2.5+ layout is assumed
+		{
+			[]string{
+				"CLIENT_LIST\ta\tb\tc\t198.51.100.7:52331\t10.8.0.6\t\t5523\t7391\tMon Mar 23 17:51:49 2020\t1584985909\tUNDEF\t5\t0\tAES-256-GCM",
+				"ROUTING_TABLE\t10.8.0.6\ta\tb\tc\t198.51.100.7:52331\tMon Mar 23 17:53:20 2020\t1584986000",
+			},
+			"a\tb\tc", 1,
+		},
+	}
+
+	for i, testCase := range testCases {
+		se, err := NewStatus3Event(testCase.Lines)
+		if err != nil {
+			t.Errorf("test %d returned error: %s", i, err)
+			continue
+		}
+		if len(se.Clients()) != 1 || len(se.Routes()) != 1 {
+			t.Errorf("test %d got clients %v, invalid %v, routes %v, invalid %v", i, se.Clients(), se.InvalidClients(), se.Routes(), se.InvalidRoutes())
+			continue
+		}
+
+		c, r := se.Clients()[0], se.Routes()[0]
+		if c.CommonName != testCase.WantCN || r.CommonName != testCase.WantCN {
+			t.Errorf("test %d got common names %q, %q; want %q", i, c.CommonName, r.CommonName, testCase.WantCN)
+		}
+		if c.BytesRecv != 5523 || c.BytesSent != 7391 || c.ClientId != 5 || !c.VirtualAddr.Equal(net.ParseIP("10.8.0.6")) {
+			t.Errorf("test %d got %s", i, c)
+		}
+		if r.VirtualAddrFlags != "10.8.0.6" || r.LastRefTimestamp != 1584986000 {
+			t.Errorf("test %d got %s", i, r)
+		}
+		if len(c.ParsingWarnings()) != testCase.WantWarnings || len(r.ParsingWarnings()) != testCase.WantWarnings {
+			t.Errorf("test %d got warnings %v, %v; want %d", i, c.ParsingWarnings(), r.ParsingWarnings(), testCase.WantWarnings)
+		}
+	}
+}
+
+func TestStatus3GlobalStats(t *testing.T) {
+	se, err := NewStatus3Event(status3Payload24)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gs := se.GlobalStats()
+	if gs.MaxBcastMcastQueueLen != 1 || len(gs.Other) != 0 || len(gs.ParsingErrors()) != 0 {
+		t.Errorf("GlobalStats returned %s", gs)
+	}
+
+	se, err = NewStatus3Event([]string{
+		"GLOBAL_STATS\tMax bcast/mcast queue length\t7\tdco_enabled\t1\tSome future stat\tfoo bar",
+		"GLOBAL_STATS\tanother line stat\t42",
+		"GLOBAL_STATS\tdangling name",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gs = se.GlobalStats()
+	if gs.MaxBcastMcastQueueLen != 7 {
+		t.Errorf("MaxBcastMcastQueueLen got %d; want 7", gs.MaxBcastMcastQueueLen)
+	}
+	want := map[string]string{
+		"dco_enabled":       "1",
+		"Some future stat":  "foo bar",
+		"another line stat": "42",
+	}
+	if !reflect.DeepEqual(gs.Other, want) {
+		t.Errorf("Other got %v; want %v", gs.Other, want)
+	}
+	if len(gs.ParsingErrors()) != 1 {
+		t.Errorf("ParsingErrors returned %v; want 1 error", gs.ParsingErrors())
+	}
+
+	// returned stats are a copy
+	gs.Other["dco_enabled"] = "0"
+	if se.GlobalStats().Other["dco_enabled"] != "1" {
+		t.Errorf("GlobalStats returned map aliasing the event")
+	}
+
+	se, _ = NewStatus3Event([]string{"GLOBAL_STATS\tMax bcast/mcast queue length\tmany"})
+	if gs := se.GlobalStats(); gs.MaxBcastMcastQueueLen != 0 || len(gs.ParsingErrors()) != 1 {
+		t.Errorf("GlobalStats returned %s; want error", gs)
+	}
+}
+
+func TestStatus3EventAccessors(t *testing.T) {
+	payload := append([]string{"CUSTOM\tfoo\tbar"}, status3Payload24...)
+	se, err := NewStatus3Event(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantTitle := "OpenVPN 2.4.8 x86_64-pc-linux-gnu [SSL (OpenSSL)] [LZO] [LZ4] [EPOLL] [PKCS11] [MH/PKTINFO] [AEAD] built on Oct 30 2019"
+	if se.Title() != wantTitle {
+		t.Errorf("Title returned %q; want %q", se.Title(), wantTitle)
+	}
+	if se.TimeRaw() != "Mon Mar 23 17:53:22 2020" {
+		t.Errorf("TimeRaw returned %q", se.TimeRaw())
+	}
+
+	headers := se.Headers()
+	if h := headers[status3RoutingTableKW]; len(h) != 5 || h[0] != "Virtual Address" {
+		t.Errorf("Headers returned %q for ROUTING_TABLE", h)
+	}
+	extra := se.Extra()
+	if !reflect.DeepEqual(extra, map[string][]string{"CUSTOM": {"foo", "bar"}}) {
+		t.Errorf("Extra returned %q", extra)
+	}
+
+	// returned maps are copies
+	headers[status3RoutingTableKW][0] = "changed"
+	delete(headers, status3ClientListKW)
+	extra["CUSTOM"][0] = "changed"
+	if se.Headers()[status3RoutingTableKW][0] != "Virtual Address" || len(se.Headers()) != 2 {
+		t.Errorf("Headers returned map aliasing the event")
+	}
+	if se.Extra()["CUSTOM"][0] != "foo" {
+		t.Errorf("Extra returned map aliasing the event")
+	}
+
+	// partial payloads
+	for i, payload := range [][]string{nil, {"TIME"}, {"HEADER"}, {"END"}} {
+		se, _ := NewStatus3Event(payload)
+		if se.Title() != "" || se.Headers() == nil || se.Extra() == nil {
+			t.Errorf("test %d accessors returned %q, %v, %v", i, se.Title(), se.Headers(), se.Extra())
+		}
+	}
+	var zero Status3Event
+	if zero.Headers() == nil || zero.Extra() == nil || zero.TimeRaw() != "" {
+		t.Errorf("accessors of zero event returned %v, %v, %q", zero.Headers(), zero.Extra(), zero.TimeRaw())
+	}
+}
+
+// captured from OpenVPN 2.4 server with iroutes for the branch offices
+var status3PayloadIroute = []string{
+	"TITLE\tOpenVPN 2.4.7 x86_64-pc-linux-gnu [SSL (OpenSSL)] [LZO] [LZ4] [EPOLL] [PKCS11] [MH/PKTINFO] [AEAD] built on Feb 20 2019",
+	"TIME\tTue Mar 24 10:02:11 2020\t1585044131",
+	"HEADER\tCLIENT_LIST\tCommon Name\tReal Address\tVirtual Address\tVirtual IPv6 Address\tBytes Received\tBytes Sent\tConnected Since\tConnected Since (time_t)\tUsername\tClient ID\tPeer ID",
+	"CLIENT_LIST\tbranch1\t203.0.113.10:1194\t10.8.0.10\tfd00:8::1000\t884213\t1092112\tTue Mar 24 08:12:40 2020\t1585037560\tUNDEF\t3\t0",
+	"CLIENT_LIST\tbranch2\t203.0.113.20:1194\t192.168.20.0/24\t\t1200\t1100\tTue Mar 24 09:40:02 2020\t1585042802\tUNDEF\t4\t1",
+	"CLIENT_LIST\tbranch3\t203.0.113.30:1194\t192.168.30.7C\t\t1200\t1100\tTue Mar 24 09:41:02 2020\t1585042862\tUNDEF\t5\t2",
+	"CLIENT_LIST\ttap1\t203.0.113.40:1194\t2a:4c:0e:9f:10:01\t\t1200\t1100\tTue Mar 24 09:42:02 2020\t1585042922\tUNDEF\t6\t3",
+	"HEADER\tROUTING_TABLE\tVirtual Address\tCommon Name\tReal Address\tLast Ref\tLast Ref (time_t)",
+	"ROUTING_TABLE\t10.8.0.10\tbranch1\t203.0.113.10:1194\tTue Mar 24 10:02:10 2020\t1585044130",
+	"ROUTING_TABLE\t192.168.10.0/24\tbranch1\t203.0.113.10:1194\tTue Mar 24 10:02:10 2020\t1585044130",
+	"ROUTING_TABLE\t192.168.20.0/24\tbranch2\t203.0.113.20:1194\tTue Mar 24 10:01:55 2020\t1585044115",
+	"ROUTING_TABLE\t192.168.30.7C\tbranch3\t203.0.113.30:1194\tTue Mar 24 10:01:57 2020\t1585044117",
+	"GLOBAL_STATS\tMax bcast/mcast queue length\t0",
+}
+
+func TestStatus3ClientVirtualNetworks(t *testing.T) {
+	type TestCase struct {
+		Raw         string
+		VirtualAddr string
+		Cached      bool
+		Networks    []string
+	}
+
+	testCases := []TestCase{
+		{"10.8.0.10", "10.8.0.10", false, []string{"10.8.0.10/32", "fd00:8::1000/128"}},
+		{"192.168.20.0/24", "0.0.0.0", false, []string{"192.168.20.0/24"}},
+		{"192.168.30.7C", "192.168.30.7", true, []string{"192.168.30.7/32"}},
+		{"2a:4c:0e:9f:10:01", "0.0.0.0", false, []string{}},
+	}
+
+	se, err := NewStatus3Event(status3PayloadIroute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(se.InvalidClients()) != 0 || len(se.Clients()) != len(testCases) {
+		t.Fatalf("got clients %v, invalid %v", se.Clients(), se.InvalidClients())
+	}
+
+	for i, tc := range testCases {
+		c := se.Clients()[i]
+		if c.VirtualAddrRaw != tc.Raw {
+			t.Errorf("test %d VirtualAddrRaw got %q; want %q", i, c.VirtualAddrRaw, tc.Raw)
+		}
+		if !c.VirtualAddr.Equal(net.ParseIP(tc.VirtualAddr)) {
+			t.Errorf("test %d VirtualAddr got %s; want %s", i, c.VirtualAddr, tc.VirtualAddr)
+		}
+		if c.VirtualAddrCached != tc.Cached {
+			t.Errorf("test %d VirtualAddrCached got %t; want %t", i, c.VirtualAddrCached, tc.Cached)
+		}
+		nets := make([]string, 0)
+		for _, n := range c.VirtualNetworks() {
+			nets = append(nets, n.String())
+		}
+		if !reflect.DeepEqual(nets, tc.Networks) {
+			t.Errorf("test %d VirtualNetworks returned %q; want %q", i, nets, tc.Networks)
+		}
+	}
+}
+
+// newStatus3EventNaive is the straightforward parser NewStatus3Event is
+// measured against: a new []string per line, the HEADER mapping rebuilt
+// per line and no pre-sized slices. It handles client lines only.
+func newStatus3EventNaive(payload []string) []Status3Client {
+	var header []string
+	var clients []Status3Client
+	for _, line := range payload {
+		fields := strings.Split(line, status3FieldSep)
+		switch fields[0] {
+		case status3HeaderKW:
+			header = fields[2:]
+		case status3ClientListKW:
+			clients = append(clients, NewStatus3ClientWithHeader(header, fields[1:]))
+		}
+	}
+	return clients
+}
+
+func TestStatus3EventAllocs(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping allocation comparison in short mode")
+	}
+	payload := status3BenchPayload(50000)
+	payload = payload[:len(payload)-1]
+
+	naive := testing.Benchmark(func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			newStatus3EventNaive(payload)
+		}
+	})
+	optimized := testing.Benchmark(func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			NewStatus3Event(payload)
+		}
+	})
+
+	t.Logf("name                     old allocs/op  new allocs/op  delta")
+	t.Logf("NewStatus3Event/50k      %13d  %13d  %+.1f%%", naive.AllocsPerOp(), optimized.AllocsPerOp(),
+		100*float64(optimized.AllocsPerOp()-naive.AllocsPerOp())/float64(naive.AllocsPerOp()))
+	t.Logf("name                     old B/op       new B/op       delta")
+	t.Logf("NewStatus3Event/50k      %13d  %13d  %+.1f%%", naive.AllocedBytesPerOp(), optimized.AllocedBytesPerOp(),
+		100*float64(optimized.AllocedBytesPerOp()-naive.AllocedBytesPerOp())/float64(naive.AllocedBytesPerOp()))
+
+	// at least one allocation per line and half of the bytes saved
+	if optimized.AllocsPerOp() > naive.AllocsPerOp()-50000 {
+		t.Errorf("NewStatus3Event made %d allocs/op; want at most %d", optimized.AllocsPerOp(), naive.AllocsPerOp()-50000)
+	}
+	if optimized.AllocedBytesPerOp() > naive.AllocedBytesPerOp()/2 {
+		t.Errorf("NewStatus3Event allocated %d B/op; want at most %d", optimized.AllocedBytesPerOp(), naive.AllocedBytesPerOp()/2)
+	}
+}
+
+func BenchmarkNewStatus3Event50k(b *testing.B) {
+	payload := status3BenchPayload(50000)
+	payload = payload[:len(payload)-1]
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		se, err := NewStatus3Event(payload)
+		if err != nil || len(se.Clients()) != 50000 {
+			b.Fatalf("NewStatus3Event returned %v", err)
+		}
+	}
+}
+
+func TestStatus3EventSerialize(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/openvpn-status-v3.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payloads := [][]string{
+		status3Payload24,
+		status3PayloadIroute,
+		status3PayloadMixed,
+		strings.Split(strings.TrimSuffix(string(data), "\nEND\n"), "\n"),
+		// separators in common names, unknown records
+		{
+			status3Payload24[2],
+			"CLIENT_LIST\tDoe\tJohn\t198.51.100.7:52331\t10.8.0.6\t\t5523\t7391\tMon Mar 23 17:51:49 2020\t1584985909\tUNDEF\t5\t0",
+			"CLIENT_LIST\tDoe, John\t198.51.100.7:52331\t10.8.0.6\t\tnan\t7391\tMon Mar 23 17:51:49 2020\t1584985909\tUNDEF\t5\t0",
+			"FOO\tbar",
+			"ROUTING_TABLE\t10.8.0.6\tDoe\tJohn\tbad address\tMon Mar 23 17:53:20 2020\t1584986000",
+		},
+		{},
+	}
+
+	for i, payload := range payloads {
+		se, err := NewStatus3Event(payload)
+		if err != nil {
+			t.Errorf("test %d NewStatus3Event returned error: %s", i, err)
+			continue
+		}
+
+		lines := se.Serialize()
+		if !equalStrings(lines, payload) {
+			t.Errorf("test %d Serialize returned\n%q\nwant\n%q", i, lines, payload)
+		}
+		if raw := se.Raw(); raw != strings.Join(payload, "\n") {
+			t.Errorf("test %d Raw returned %q", i, raw)
+		}
+		// the result is a copy
+		if len(lines) > 0 {
+			lines[0] = "TITLE\tmodified"
+			if se.Serialize()[0] != payload[0] {
+				t.Errorf("test %d Serialize is not a copy", i)
+			}
+		}
+
+		// round trip
+		var text strings.Builder
+		for _, line := range se.Serialize() {
+			text.WriteString(line + "\n")
+		}
+		text.WriteString("END\n")
+		got, err := ParseStatus3(strings.NewReader(text.String()), nil)
+		if err != nil {
+			t.Errorf("test %d ParseStatus3 returned error: %s", i, err)
+			continue
+		}
+		if got.String() != se.String() || !equalStrings(got.Serialize(), se.Serialize()) {
+			t.Errorf("test %d round trip returned\n%s\nwant\n%s", i, got, se)
+		}
+		gotJSON, err1 := json.Marshal(got)
+		wantJSON, err2 := json.Marshal(se)
+		if err1 != nil || err2 != nil || !bytes.Equal(gotJSON, wantJSON) {
+			t.Errorf("test %d round trip returned JSON\n%s\nwant\n%s", i, gotJSON, wantJSON)
+		}
+	}
+}
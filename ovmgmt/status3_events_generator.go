@@ -1,71 +1,289 @@
 package ovmgmt
 
 import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync/atomic"
 	"time"
 )
 
+// Status3Option configures the Status3 events generator,
+// see MgmtClient.SetStatus3Events.
+type Status3Option func(*status3Options)
+
+type status3Options struct {
+	jitter float64
+	align  bool
+	// injectable for tests
+	now   func() time.Time
+	float func() float64
+}
+
+func defaultStatus3Options() status3Options {
+	return status3Options{
+		now:   time.Now,
+		float: rand.Float64,
+	}
+}
+
+// WithStatus3Jitter delays the first poll by a random duration up to
+// the given fraction of the interval, in range [0, 1], so that generators
+// of many clients started at once don't poll their daemons in lockstep.
+func WithStatus3Jitter(fraction float64) Status3Option {
+	return func(o *status3Options) {
+		switch {
+		case fraction < 0:
+			fraction = 0
+		case fraction > 1:
+			fraction = 1
+		}
+		o.jitter = fraction
+	}
+}
+
+// WithStatus3Alignment aligns the polls to the wall clock multiples of
+// the interval, e.g. to :00 and :30 seconds for 30s interval. The jitter,
+// if any, is added to the aligned time.
+func WithStatus3Alignment() Status3Option {
+	return func(o *status3Options) {
+		o.align = true
+	}
+}
+
+// firstDelay returns the delay of the first poll, after which the polls
+// follow at the interval
+func (o status3Options) firstDelay(interval time.Duration) time.Duration {
+	var d time.Duration
+	if o.align {
+		now := o.now()
+		d = now.Truncate(interval).Add(interval).Sub(now)
+		if d == interval {
+			// exactly aligned
+			d = 0
+		}
+	}
+	if o.jitter > 0 {
+		d += time.Duration(o.jitter * o.float() * float64(interval))
+	}
+	return d
+}
+
 // SetStatus3Events either enables or disables periodic generation
 // of Status3Event.
 //
-// When enabled, a 'status 3' command will be emitted at given time interval,
-// and subsequently Status3Event will be written to event channel.
+// When enabled, a 'status 3' command will be emitted immediately and then at
+// given time interval, and subsequently Status3Event will be written to event
+// channel. Enabling the running generator restarts it with the new interval.
+// The first command may be delayed with WithStatus3Jitter and
+// WithStatus3Alignment options.
 //
 // Set the time interval to zero in order to disable Status3 events.
-func (c *MgmtClient) SetStatus3Events(interval time.Duration) bool {
-	//logDebugf("stop old generator")
-	close(c.doneStatus3Gen)
-	if interval > 0 {
-		c.doneStatus3Gen = c.status3EventGenerator(interval)
+// It's safe to call concurrently and to disable the stopped generator.
+// The generator can't be enabled after the connection is closed, false is
+// returned then.
+func (c *MgmtClient) SetStatus3Events(interval time.Duration, opts ...Status3Option) bool {
+	c.status3Mu.Lock()
+	defer c.status3Mu.Unlock()
+
+	if c.doneStatus3Gen != nil {
+		//logDebugf("stop old generator")
+		close(c.doneStatus3Gen)
+		c.doneStatus3Gen = nil
+	}
+	if interval > 0 && !c.status3Closed {
+		o := defaultStatus3Options()
+		for _, opt := range opts {
+			opt(&o)
+		}
+		c.doneStatus3Gen = c.status3EventGenerator(interval, o.firstDelay(interval))
 		return true
-	} else {
-		// logDebugf("bad interval, making new empty chan (old was already closed)")
-		c.doneStatus3Gen = make(chan bool, 1)
 	}
 	return false
 }
 
 // LatestStatus3 retrieves generates current Status3Event from the server.
 func (c *MgmtClient) LatestStatus3() (*Status3Event, error) {
-	err := c.sendCommand("status 3")
-	if err != nil {
+	return c.LatestStatus3Context(context.Background())
+}
+
+// LatestStatus3Context is LatestStatus3 which can be canceled with
+// the context. When it's done while the reply is being received, the rest
+// of the reply is read and discarded in the background, and the next
+// command waits for that.
+func (c *MgmtClient) LatestStatus3Context(ctx context.Context) (*Status3Event, error) {
+	start := time.Now()
+	s, err := c.latestStatus3(ctx)
+	err = commandError("status", err)
+	c.commandDone("status 3", err, start)
+	return s, err
+}
+
+func (c *MgmtClient) latestStatus3(ctx context.Context) (*Status3Event, error) {
+	if err := c.acquireCommand(ctx); err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		c.releaseCommand()
 		return nil, err
 	}
 
-	payload, err := c.readCommandResponsePayload()
+	err := c.sendCommand("status 3")
 	if err != nil {
+		c.releaseCommand()
 		return nil, err
 	}
 
-	s, err := NewStatus3Event(payload)
+	type reply struct {
+		payload []string
+		err     error
+	}
+	replyCh := make(chan reply, 1)
+	go func() {
+		defer c.releaseCommand()
+		payload, err := c.readCommandResponsePayload()
+		replyCh <- reply{payload, err}
+	}()
+
+	select {
+	case r := <-replyCh:
+		if r.err != nil {
+			return nil, r.err
+		}
+		return c.parseStatus3(r.payload)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (c *MgmtClient) parseStatus3(payload []string) (*Status3Event, error) {
+	s, err := newStatus3Event(payload, &c.opts.parse)
+	if c.opts.strictParsing {
+		if err == nil {
+			err = s.firstParsingError()
+		}
+		if err != nil {
+			return nil, newCategoryError(ErrMalformedReply, "invalid 'status 3' response", err)
+		}
+	}
+	s.receivedAt = receivedAt{time.Now()}
 	return &s, err
 }
 
-func (c *MgmtClient) generateStatus3Event() {
+// generateStatus3Event emits the current Status3Event, followed by
+// StatusDeltaEvent against prev if it's enabled. It returns the snapshot
+// to diff the next one against.
+func (c *MgmtClient) generateStatus3Event(prev *Status3Event) *Status3Event {
 	evt, err := c.LatestStatus3()
-	if evt != nil && err == nil {
-		c.eventSink <- evt
-	} else {
-		c.eventSink <- NewInvalidEvent(evt, err)
+	if c.opts.strictParsing && errors.Is(err, ErrMalformedReply) {
+		// terminates the client as the malformed event does, see
+		// eventScanner
+		logErrorf("Strict parsing: %s", err)
+		c.abort(strictParsingError(err))
+		return prev
+	}
+	if evt == nil {
+		// not a typed nil, which methods would panic
+		if !errors.Is(err, ErrClientClosed) {
+			c.emit(stampEvent(NewInvalidEvent(nil, err), time.Now()))
+		}
+		return prev
+	}
+	if err != nil {
+		c.emit(stampEvent(NewInvalidEvent(evt, err), time.Now()))
+		return prev
+	}
+
+	if c.opts.status3Ch != nil {
+		select {
+		case c.opts.status3Ch <- evt:
+		case <-c.closed:
+			return prev
+		}
+	} else if !c.emit(evt) {
+		return prev
+	}
+	if c.opts.statusDiffEvents {
+		if delta := StatusDiff(prev, evt); !delta.Empty() || prev == nil {
+			c.emit(StatusDeltaEvent{receivedAt: evt.receivedAt, delta: delta})
+		}
 	}
+	return evt
 }
 
-func (c *MgmtClient) status3EventGenerator(interval time.Duration) chan bool {
+func (c *MgmtClient) status3EventGenerator(interval, firstDelay time.Duration) chan bool {
 	done := make(chan bool, 1)
 	//logDebugf("entering to gen with int %v", interval)
 
+	c.generatorsWG.Add(1)
 	go func() {
-		ticker := time.NewTicker(interval)
-		defer ticker.Stop()
+		defer c.generatorsWG.Done()
 
+		// the ticker is started with the first poll
+		var ticker *time.Ticker
+		var tickC <-chan time.Time
+		defer func() {
+			if ticker != nil {
+				ticker.Stop()
+			}
+		}()
+		first := time.NewTimer(firstDelay)
+		defer first.Stop()
+
+		var prev *Status3Event
+		polled := make(chan *Status3Event, 1)
+		poll := func() {
+			// a slow daemon may not have replied to the previous poll yet,
+			// possibly of the generator we replaced, skip the tick then
+			if !atomic.CompareAndSwapInt32(&c.status3InFlight, 0, 1) {
+				atomic.AddUint64(&c.status3SkippedTicks, 1)
+				return
+			}
+			// the previous poll has put its result before finishing
+			select {
+			case prev = <-polled:
+			default:
+			}
+			c.generatorsWG.Add(1)
+			go func(prev *Status3Event) {
+				defer c.generatorsWG.Done()
+				defer atomic.StoreInt32(&c.status3InFlight, 0)
+				polled <- c.generateStatus3Event(prev)
+			}(prev)
+		}
+
+		// the first snapshot is taken right away rather than after
+		// the interval, unless it's delayed by the options
+		firstC := first.C
 		for {
 			select {
-			case <-ticker.C:
-				c.generateStatus3Event()
+			case <-firstC:
+				select {
+				case <-done:
+					// stopped before the first poll
+					return
+				default:
+				}
+				firstC = nil
+				ticker = time.NewTicker(interval)
+				tickC = ticker.C
+				poll()
+			case <-tickC:
+				poll()
+			case prev = <-polled:
 			case <-done:
 				//logDebugf("exiting from gen with int %v", interval)
 				return
+			case <-c.ctx.Done():
+				return
 			}
 		}
 	}()
 	return done
 }
+
+// Status3SkippedTicks returns the number of Status3 generator ticks skipped
+// because the previous 'status 3' command was still in progress.
+func (c *MgmtClient) Status3SkippedTicks() uint64 {
+	return atomic.LoadUint64(&c.status3SkippedTicks)
+}
@@ -0,0 +1,371 @@
+package ovmgmt
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// stopStatus3Events disables the generator and waits for its last poll
+// to finish, so that the connection can be closed
+func stopStatus3Events(c *MgmtClient) {
+	c.SetStatus3Events(0)
+	for atomic.LoadInt32(&c.status3InFlight) != 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestStatus3EventsImmediateFirstSnapshot(t *testing.T) {
+	payload := append(append([]string{}, status3Payload24...), "END")
+	eventCh := make(chan Event, 10)
+	c := newReplyingClient(t, eventCh, func(string) []string { return payload })
+
+	const interval = 10 * time.Second
+	start := time.Now()
+	c.SetStatus3Events(interval)
+	defer stopStatus3Events(c)
+
+	select {
+	case evt := <-eventCh:
+		if _, ok := evt.(*Status3Event); !ok {
+			t.Fatalf("got %s; want Status3Event", evt)
+		}
+		if elapsed := time.Since(start); elapsed > interval/4 {
+			t.Errorf("first Status3Event arrived after %s", elapsed)
+		}
+	case <-time.After(interval / 2):
+		t.Fatal("no Status3Event received")
+	}
+}
+
+func TestStatus3EventsSkipOverlappingPolls(t *testing.T) {
+	payload := append(append([]string{}, status3Payload24...), "END")
+	eventCh := make(chan Event, 100)
+	// the daemon takes longer to reply than the interval
+	c := newReplyingClient(t, eventCh, func(string) []string {
+		time.Sleep(150 * time.Millisecond)
+		return payload
+	})
+
+	c.SetStatus3Events(20 * time.Millisecond)
+	time.Sleep(500 * time.Millisecond)
+	// let the last poll finish before the connection is closed
+	stopStatus3Events(c)
+
+	if n := c.Status3SkippedTicks(); n == 0 {
+		t.Errorf("Status3SkippedTicks returned 0")
+	}
+
+	deadline := time.After(time.Second)
+	for received := 0; received < 2; {
+		select {
+		case evt := <-eventCh:
+			se, ok := evt.(*Status3Event)
+			if !ok {
+				t.Fatalf("got %s; want Status3Event", evt)
+			}
+			if len(se.Clients()) != 1 || len(se.InvalidClients()) != 0 || len(se.Extra()) != 0 {
+				t.Errorf("got garbled %s", se)
+			}
+			received++
+		case <-deadline:
+			t.Fatalf("got %d Status3Events; want at least 2", received)
+		}
+	}
+}
+
+func TestStatus3EventsInvalidReceivedAt(t *testing.T) {
+	payload := []string{"TIME\tgarbage", "END"}
+	eventCh := make(chan Event, 10)
+	c := newReplyingClient(t, eventCh, func(string) []string { return payload })
+	start := time.Now()
+	c.SetStatus3Events(time.Hour)
+	defer stopStatus3Events(c)
+
+	select {
+	case evt := <-eventCh:
+		ie, ok := evt.(InvalidEvent)
+		if !ok {
+			t.Fatalf("got %s; want InvalidEvent", evt)
+		}
+		if at := ie.ReceivedAt(); at.Before(start) {
+			t.Errorf("ReceivedAt returned %s; want after %s", at, start)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no InvalidEvent received")
+	}
+}
+
+func TestStatus3EventsStrict(t *testing.T) {
+	payload := append(append([]string{}, status3Payload24...),
+		"CLIENT_LIST\tbob\tnowhere\t10.8.0.10\t\t1\t2\tMon Mar 23 17:51:49 2020\t1584985909\tUNDEF\t6\t1", "END")
+	eventCh := make(chan Event, 10)
+	c := newReplyingClient(t, eventCh, func(string) []string { return payload }, WithStrictParsing())
+	c.SetStatus3Events(time.Millisecond)
+
+	var last Event
+	for evt := range eventCh {
+		if _, ok := evt.(InvalidEvent); ok {
+			t.Errorf("got %s; want the client terminated", evt)
+		}
+		last = evt
+	}
+	fatal, ok := last.(FatalEvent)
+	if !ok {
+		t.Fatalf("got %v; want FatalEvent", last)
+	}
+	if err := fatal.Err(); !strings.HasPrefix(err.Error(), strictParsingFatalPrefix) || !errors.Is(err, ErrMalformedReply) {
+		t.Errorf("FatalEvent returned %v; want the malformed 'status 3' response", err)
+	}
+	if err := c.Err(); err == nil || !strings.HasPrefix(err.Error(), strictParsingFatalPrefix) {
+		t.Errorf("Err returned %v", err)
+	}
+}
+
+func TestSetStatus3EventsIdempotent(t *testing.T) {
+	payload := append(append([]string{}, status3Payload24...), "END")
+	eventCh := make(chan Event, 1000)
+	c := newReplyingClient(t, eventCh, func(string) []string { return payload })
+
+	// disable before enabling and twice in a row
+	if c.SetStatus3Events(0) || c.SetStatus3Events(0) {
+		t.Errorf("SetStatus3Events(0) returned true")
+	}
+	if !c.SetStatus3Events(time.Hour) || !c.SetStatus3Events(time.Hour) {
+		t.Errorf("SetStatus3Events(1h) returned false")
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				if (i+j)%2 == 0 {
+					c.SetStatus3Events(time.Hour)
+				} else {
+					c.SetStatus3Events(0)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	c.SetStatus3Events(0)
+	c.SetStatus3Events(0)
+
+	// let the stopped generators finish their polls
+	time.Sleep(50 * time.Millisecond)
+	for atomic.LoadInt32(&c.status3InFlight) != 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestStatus3Channel(t *testing.T) {
+	payload := append(append([]string{}, status3Payload24...), "END")
+	r, w := io.Pipe()
+	eventCh := make(chan Event, 10)
+	status3Ch := make(chan *Status3Event, 10)
+	c := NewMgmtClientWithOptions(mockConn{r, replyWriter{w, func(string) []string { return payload }}}, eventCh,
+		WithStatus3Channel(status3Ch))
+
+	c.SetStatus3Events(time.Hour)
+	select {
+	case se := <-status3Ch:
+		if se == nil || len(se.Clients()) != 1 {
+			t.Errorf("got %v; want Status3Event", se)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no Status3Event received")
+	}
+	stopStatus3Events(c)
+
+	select {
+	case evt := <-eventCh:
+		t.Errorf("got %s on the event channel", evt)
+	case se, ok := <-status3Ch:
+		t.Errorf("got %v, %t after disabling the generator", se, ok)
+	default:
+	}
+
+	// both channels are closed with the connection
+	w.Close()
+	for range eventCh {
+	}
+	select {
+	case _, ok := <-status3Ch:
+		if ok {
+			t.Errorf("Status3 channel is not closed")
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("Status3 channel is not closed")
+	}
+}
+
+func TestStatus3FirstDelay(t *testing.T) {
+	type TestCase struct {
+		Now      string
+		Interval time.Duration
+		Random   float64
+		Opts     []Status3Option
+		Expected time.Duration
+	}
+
+	testCases := []TestCase{
+		{"17:53:22", 30 * time.Second, 0.5, nil, 0},
+		{"17:53:22", 30 * time.Second, 0.5, []Status3Option{WithStatus3Alignment()}, 8 * time.Second},
+		{"17:53:30", 30 * time.Second, 0.5, []Status3Option{WithStatus3Alignment()}, 0},
+		{"17:53:22", time.Minute, 0.5, []Status3Option{WithStatus3Alignment()}, 38 * time.Second},
+		{"17:53:22", time.Minute, 0.5, []Status3Option{WithStatus3Jitter(0.2)}, 6 * time.Second},
+		{"17:53:22", time.Minute, 0.99, []Status3Option{WithStatus3Jitter(2)}, 59400 * time.Millisecond},
+		{"17:53:22", time.Minute, 0.5, []Status3Option{WithStatus3Jitter(-1)}, 0},
+		{"17:53:22", 30 * time.Second, 0.5, []Status3Option{WithStatus3Alignment(), WithStatus3Jitter(0.1)}, 9500 * time.Millisecond},
+	}
+
+	for i, tc := range testCases {
+		now, err := time.Parse("15:04:05", tc.Now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		o := defaultStatus3Options()
+		o.now = func() time.Time { return now }
+		o.float = func() float64 { return tc.Random }
+		for _, opt := range tc.Opts {
+			opt(&o)
+		}
+		if d := o.firstDelay(tc.Interval); d != tc.Expected {
+			t.Errorf("test %d firstDelay returned %s; want %s", i, d, tc.Expected)
+		}
+	}
+}
+
+func TestStatus3EventsDelayedFirstSnapshot(t *testing.T) {
+	payload := append(append([]string{}, status3Payload24...), "END")
+	eventCh := make(chan Event, 10)
+	c := newReplyingClient(t, eventCh, func(string) []string { return payload })
+
+	start := time.Now()
+	// up to the whole interval
+	c.SetStatus3Events(200*time.Millisecond, WithStatus3Jitter(1))
+	defer stopStatus3Events(c)
+
+	select {
+	case <-eventCh:
+		if elapsed := time.Since(start); elapsed > 400*time.Millisecond {
+			t.Errorf("first Status3Event arrived after %s", elapsed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no Status3Event received")
+	}
+}
+
+func TestStatus3EventsConnectionClosedDuringPoll(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		r, w := io.Pipe()
+		eventCh := make(chan Event, 10)
+		// the daemon dies in the middle of the reply
+		delay := time.Duration(i) * time.Millisecond
+		reply := func(string) []string {
+			go func() {
+				time.Sleep(delay)
+				w.Close()
+			}()
+			return status3Payload24[:3]
+		}
+		c := NewMgmtClientWithOptions(mockConn{r, replyWriter{w, reply}}, eventCh, WithStatusDiffEvents())
+		c.SetStatus3Events(time.Millisecond)
+
+		for evt := range eventCh {
+			if ie, ok := evt.(InvalidEvent); ok {
+				// must not panic
+				_ = ie.String()
+			}
+		}
+		if c.SetStatus3Events(time.Millisecond) {
+			t.Errorf("test %d SetStatus3Events enabled the generator after the connection is closed", i)
+		}
+	}
+}
+
+// slowReplyWriter replies to each command with the lines, pausing for
+// the delay in the middle of the reply
+type slowReplyWriter struct {
+	w     *io.PipeWriter
+	lines []string
+	delay time.Duration
+	// closes the connection instead of finishing the first reply
+	die bool
+}
+
+func (rw *slowReplyWriter) Write(p []byte) (int, error) {
+	lines, delay, die := rw.lines, rw.delay, rw.die
+	rw.die = false
+	go func() {
+		for i, line := range lines {
+			if i == len(lines)/2 {
+				time.Sleep(delay)
+				if die {
+					rw.w.Close()
+					return
+				}
+			}
+			if _, err := io.WriteString(rw.w, line+"\n"); err != nil {
+				return
+			}
+		}
+	}()
+	return len(p), nil
+}
+
+func TestLatestStatus3Context(t *testing.T) {
+	r, w := io.Pipe()
+	defer w.Close()
+	rw := &slowReplyWriter{w: w, lines: append(append([]string{}, status3Payload24...), "END"), delay: 300 * time.Millisecond}
+	c := NewMgmtClient(mockConn{r, rw}, make(chan Event, 10))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	se, err := c.LatestStatus3Context(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) || se != nil {
+		t.Errorf("LatestStatus3Context returned %v, %v; want %v", se, err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > 250*time.Millisecond {
+		t.Errorf("LatestStatus3Context returned after %s", elapsed)
+	}
+
+	// the rest of the canceled reply doesn't leak into the next one
+	se, err = c.LatestStatus3()
+	if err != nil || len(se.Clients()) != 1 || se.Title() == "" {
+		t.Errorf("LatestStatus3 after the canceled one returned %v, %v", se, err)
+	}
+
+	// already canceled
+	canceled, cancelNow := context.WithCancel(context.Background())
+	cancelNow()
+	if _, err := c.LatestStatus3Context(canceled); !errors.Is(err, context.Canceled) {
+		t.Errorf("LatestStatus3Context returned %v; want %v", err, context.Canceled)
+	}
+}
+
+func TestLatestStatus3ContextConnectionClosed(t *testing.T) {
+	r, w := io.Pipe()
+	defer w.Close()
+	rw := &slowReplyWriter{w: w, lines: append(append([]string{}, status3Payload24...), "END"), delay: 200 * time.Millisecond, die: true}
+	c := NewMgmtClient(mockConn{r, rw}, make(chan Event, 10))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := c.LatestStatus3Context(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("LatestStatus3Context returned %v; want %v", err, context.DeadlineExceeded)
+	}
+
+	se, err := c.LatestStatus3()
+	if !errors.Is(err, io.EOF) || !errors.Is(err, ErrClientClosed) {
+		t.Errorf("LatestStatus3 on the closed connection returned %v, %v", se, err)
+	}
+}
@@ -0,0 +1,39 @@
+package ovmgmt
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"time"
+)
+
+// ParseStatus3 parses the version 3 status format from r, e.g. the file
+// written by the daemon with --status and --status-version 3. Both \n and
+// \r\n line endings are accepted, reading stops at the END line, which
+// may be omitted.
+//
+// The result is the same as of NewStatus3Event, parsing errors of clients
+// and routes are kept in the event. ReceivedAt of the event is zero.
+// loc is the time zone of the daemon, see WithStatusTimeLocation; nil
+// means time.Local.
+func ParseStatus3(r io.Reader, loc *time.Location) (*Status3Event, error) {
+	var payload []string
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if line == endMessage {
+			break
+		}
+		payload = append(payload, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	se, err := newStatus3Event(payload, &parseOptions{statusLocation: loc})
+	if err != nil {
+		return nil, err
+	}
+	return &se, nil
+}
@@ -0,0 +1,96 @@
+package ovmgmt
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestParseStatus3(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/openvpn-status-v3.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	se, err := ParseStatus3(bytes.NewReader(data), nil)
+	if err != nil {
+		t.Fatalf("ParseStatus3 returned error: %s", err)
+	}
+	if len(se.InvalidClients()) != 0 || len(se.InvalidRoutes()) != 0 || len(se.Extra()) != 0 {
+		t.Errorf("got invalid clients %v, routes %v, extra %v", se.InvalidClients(), se.InvalidRoutes(), se.Extra())
+	}
+	if se.Title() != "OpenVPN 2.5.1 x86_64-pc-linux-gnu [SSL (OpenSSL)] [LZO] [LZ4] [EPOLL] [PKCS11] [MH/PKTINFO] [AEAD] built on May 14 2021" {
+		t.Errorf("got title %q", se.Title())
+	}
+	if se.Timestamp() != 1623147342 || se.TimeRaw() != "Tue Jun  8 10:15:42 2021" {
+		t.Errorf("got time [%s]%d", se.TimeRaw(), se.Timestamp())
+	}
+	if len(se.Clients()) != 2 || len(se.Routes()) != 4 || se.GlobalStats().MaxBcastMcastQueueLen != 2 {
+		t.Fatalf("got %s", se)
+	}
+	c := se.Clients()[1]
+	if c.CommonName != "bob" || c.BytesRecv != 112388 || c.BytesSent != 98012 || c.ClientId != 7 || c.PeerId != 1 || c.DataChannelCipher != "CHACHA20-POLY1305" {
+		t.Errorf("got client %s", c)
+	}
+	if r := se.Routes()[3]; r.VirtualAddrFlags != "192.168.10.0/24" || r.CommonName != "bob" || r.LastRefTimestamp != 1623147341 {
+		t.Errorf("got route %s", r)
+	}
+	if !se.ReceivedAt().IsZero() {
+		t.Errorf("got ReceivedAt %s; want zero", se.ReceivedAt())
+	}
+
+	want, err := json.Marshal(se)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the same event regardless of line endings and END
+	text := string(data)
+	variants := []string{
+		strings.Replace(text, "\n", "\r\n", -1),
+		strings.TrimSuffix(text, "END\n"),
+		strings.TrimSuffix(text, "\nEND\n"),
+		text + "TITLE\tgarbage after END\n",
+	}
+	for i, v := range variants {
+		got, err := ParseStatus3(strings.NewReader(v), nil)
+		if err != nil {
+			t.Errorf("test %d ParseStatus3 returned error: %s", i, err)
+			continue
+		}
+		gotJSON, err := json.Marshal(got)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(gotJSON, want) {
+			t.Errorf("test %d ParseStatus3 returned\n%s\nwant\n%s", i, gotJSON, want)
+		}
+	}
+}
+
+func TestParseStatus3Errors(t *testing.T) {
+	type TestCase struct {
+		Input   string
+		WantErr bool
+	}
+
+	testCases := []TestCase{
+		{"", false},
+		{"END\n", false},
+		{"TIME\tnot a timestamp\n", true},
+		{"TIME\tMon Mar 23 17:53:22 2020\tnan\r\nEND\r\n", true},
+		{"TITLE\t" + strings.Repeat("x", 1<<17) + "\n", true},
+	}
+
+	for i, testCase := range testCases {
+		se, err := ParseStatus3(strings.NewReader(testCase.Input), nil)
+		if (err != nil) != testCase.WantErr {
+			t.Errorf("test %d ParseStatus3 returned error %v; want error %v", i, err, testCase.WantErr)
+		}
+		if err == nil && se == nil {
+			t.Errorf("test %d ParseStatus3 returned nil event", i)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package ovmgmt
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+//GLOBAL_STATS	Max bcast/mcast queue length	1
+//GLOBAL_STATS	dco_enabled	0
+
+const status3GlobalStatsKW = "GLOBAL_STATS"
+const globalStatMaxBcastMcastQueueLen = "Max bcast/mcast queue length"
+
+// GlobalStats are the server-wide statistics of GLOBAL_STATS lines.
+// Each line consists of tab-separated name/value pairs.
+type GlobalStats struct {
+	MaxBcastMcastQueueLen int
+	// Other keeps the stats not known to this package, e.g. dco_enabled
+	Other map[string]string
+	errs  []error
+}
+
+func (s GlobalStats) Raw() string {
+	return fmt.Sprintf("%d\t%v\t%s", s.MaxBcastMcastQueueLen, s.Other, s.errs)
+}
+
+func (s GlobalStats) String() string {
+	data := fmt.Sprintf("MaxBcastMcastQueueLen:%d\tOther:%s", s.MaxBcastMcastQueueLen, Sanitize(fmt.Sprint(s.Other)))
+	if len(s.errs) > 0 {
+		return fmt.Sprintf("InvalidGlobalStats(%s\tParsingErrors:%s)", data, s.Error())
+	}
+	return fmt.Sprintf("GlobalStats(%s)", data)
+}
+
+func (s GlobalStats) ParsingErrors() []error {
+	return s.errs
+}
+
+func (s GlobalStats) Error() string {
+	if len(s.errs) == 0 {
+		return ""
+	}
+
+	errstr := make([]string, len(s.errs))
+	for i, err := range s.errs {
+		errstr[i] = err.Error()
+	}
+	return strings.Join(errstr, "; ")
+}
+
+// add parses name/value pairs of a single GLOBAL_STATS line
+func (s *GlobalStats) add(fields []string) {
+	if len(fields)%2 != 0 {
+		s.errs = append(s.errs, errors.New("no value of global stat: "+fields[len(fields)-1]))
+		fields = fields[:len(fields)-1]
+	}
+
+	for i := 0; i < len(fields); i += 2 {
+		name, value := fields[i], fields[i+1]
+		switch name {
+		case globalStatMaxBcastMcastQueueLen:
+			v, err := strconv.Atoi(value)
+			if err != nil {
+				s.errs = append(s.errs, err)
+				continue
+			}
+			s.MaxBcastMcastQueueLen = v
+		default:
+			if s.Other == nil {
+				s.Other = make(map[string]string)
+			}
+			s.Other[name] = value
+		}
+	}
+}
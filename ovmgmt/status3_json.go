@@ -0,0 +1,152 @@
+package ovmgmt
+
+import (
+	"encoding/json"
+	"net"
+	"time"
+)
+
+// JSON representation of status snapshots. Times are RFC 3339 in UTC,
+// omitted when unknown; addresses are strings, real addresses in
+// the "ip:port" form ("[ip6]:port" for IPv6).
+
+// MarshalJSON encodes the address as "ip:port" string.
+func (ia *IPAddrPort) MarshalJSON() ([]byte, error) {
+	return json.Marshal(ia.String())
+}
+
+type status3ClientJSON struct {
+	CommonName         string      `json:"commonName"`
+	RealAddress        *IPAddrPort `json:"realAddress"`
+	VirtualAddress     string      `json:"virtualAddress,omitempty"`
+	VirtualIPv6Address string      `json:"virtualIPv6Address,omitempty"`
+	BytesReceived      int64       `json:"bytesReceived"`
+	BytesSent          int64       `json:"bytesSent"`
+	ConnectedSince     string      `json:"connectedSince,omitempty"`
+	Username           string      `json:"username"`
+	ClientID           int64       `json:"clientId"`
+	PeerID             int64       `json:"peerId"`
+	DataChannelCipher  string      `json:"dataChannelCipher,omitempty"`
+	ParsingErrors      []string    `json:"parsingErrors,omitempty"`
+	ParsingWarnings    []string    `json:"parsingWarnings,omitempty"`
+}
+
+func (s Status3Client) MarshalJSON() ([]byte, error) {
+	return json.Marshal(status3ClientJSON{
+		CommonName:         s.CommonName,
+		RealAddress:        s.RealAddr,
+		VirtualAddress:     s.VirtualAddrRaw,
+		VirtualIPv6Address: jsonIP(s.VirtualAddr6),
+		BytesReceived:      s.BytesRecv,
+		BytesSent:          s.BytesSent,
+		ConnectedSince:     jsonTime(s.ConnectedSinceTimestamp),
+		Username:           s.Username,
+		ClientID:           s.ClientId,
+		PeerID:             s.PeerId,
+		DataChannelCipher:  s.DataChannelCipher,
+		ParsingErrors:      jsonErrors(s.errs),
+		ParsingWarnings:    jsonErrors(s.warnings),
+	})
+}
+
+type status3RouteJSON struct {
+	VirtualAddress  string      `json:"virtualAddress"`
+	CommonName      string      `json:"commonName"`
+	RealAddress     *IPAddrPort `json:"realAddress"`
+	LastRef         string      `json:"lastRef,omitempty"`
+	ParsingErrors   []string    `json:"parsingErrors,omitempty"`
+	ParsingWarnings []string    `json:"parsingWarnings,omitempty"`
+}
+
+func (s Status3Route) MarshalJSON() ([]byte, error) {
+	return json.Marshal(status3RouteJSON{
+		VirtualAddress:  s.VirtualAddrFlags,
+		CommonName:      s.CommonName,
+		RealAddress:     s.RealAddr,
+		LastRef:         jsonTime(s.LastRefTimestamp),
+		ParsingErrors:   jsonErrors(s.errs),
+		ParsingWarnings: jsonErrors(s.warnings),
+	})
+}
+
+type globalStatsJSON struct {
+	MaxBcastMcastQueueLength int               `json:"maxBcastMcastQueueLength"`
+	Other                    map[string]string `json:"other,omitempty"`
+	ParsingErrors            []string          `json:"parsingErrors,omitempty"`
+}
+
+func (s GlobalStats) MarshalJSON() ([]byte, error) {
+	return json.Marshal(globalStatsJSON{
+		MaxBcastMcastQueueLength: s.MaxBcastMcastQueueLen,
+		Other:                    s.Other,
+		ParsingErrors:            jsonErrors(s.errs),
+	})
+}
+
+type status3EventJSON struct {
+	Title          string              `json:"title"`
+	Time           string              `json:"time,omitempty"`
+	Clients        []Status3Client     `json:"clients"`
+	Routes         []Status3Route      `json:"routes"`
+	InvalidClients []Status3Client     `json:"invalidClients"`
+	InvalidRoutes  []Status3Route      `json:"invalidRoutes"`
+	GlobalStats    GlobalStats         `json:"globalStats"`
+	Extra          map[string][]string `json:"extra,omitempty"`
+}
+
+// MarshalJSON encodes the snapshot, including the invalid clients and
+// routes under separate keys.
+func (se Status3Event) MarshalJSON() ([]byte, error) {
+	return json.Marshal(status3EventJSON{
+		Title:          se.title,
+		Time:           jsonTime(se.ts),
+		Clients:        nonNilClients(se.clients),
+		Routes:         nonNilRoutes(se.routes),
+		InvalidClients: nonNilClients(se.invalidClients),
+		InvalidRoutes:  nonNilRoutes(se.invalidRoutes),
+		GlobalStats:    se.globalStats,
+		Extra:          se.extra,
+	})
+}
+
+// jsonTime formats time_t as RFC 3339 in UTC, empty if it's unknown
+func jsonTime(ts int64) string {
+	if ts == 0 {
+		return ""
+	}
+	return time.Unix(ts, 0).UTC().Format(time.RFC3339)
+}
+
+// jsonIP formats the address, empty if it's unset or unspecified
+func jsonIP(ip net.IP) string {
+	if ip == nil || ip.IsUnspecified() {
+		return ""
+	}
+	return ip.String()
+}
+
+func jsonErrors(errs []error) []string {
+	if len(errs) == 0 {
+		return nil
+	}
+	s := make([]string, len(errs))
+	for i, err := range errs {
+		s[i] = err.Error()
+	}
+	return s
+}
+
+// empty lists are encoded as [] rather than null
+func nonNilClients(c []Status3Client) []Status3Client {
+	if c == nil {
+		return []Status3Client{}
+	}
+	return c
+}
+
+func nonNilRoutes(r []Status3Route) []Status3Route {
+	if r == nil {
+		return []Status3Route{}
+	}
+	return r
+}
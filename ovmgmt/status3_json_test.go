@@ -0,0 +1,83 @@
+package ovmgmt
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "update golden files in testdata")
+
+func TestStatus3EventJSON(t *testing.T) {
+	type TestCase struct {
+		Golden  string
+		Payload []string
+	}
+
+	testCases := []TestCase{
+		{"status3_24.golden.json", status3Payload24},
+		{"status3_iroute.golden.json", status3PayloadIroute},
+		{"status3_mixed.golden.json", append(append([]string{}, status3PayloadMixed...),
+			"ROUTING_TABLE\t10.8.0.6\talice\tnowhere\tMon Mar 23 17:53:20 2020\t1584986000",
+			"GLOBAL_STATS\tdco_enabled\t0",
+		)},
+		{"status3_empty.golden.json", nil},
+	}
+
+	for i, tc := range testCases {
+		se := mustStatus3Event(t, tc.Payload...)
+		got, err := json.MarshalIndent(se, "", "  ")
+		if err != nil {
+			t.Errorf("test %d MarshalJSON returned error: %s", i, err)
+			continue
+		}
+		got = append(got, '\n')
+
+		path := filepath.Join("testdata", tc.Golden)
+		if *updateGolden {
+			if err := ioutil.WriteFile(path, got, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		want, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("test %d MarshalJSON returned\n%s\nwant\n%s", i, got, want)
+		}
+	}
+}
+
+func TestIPAddrPortJSON(t *testing.T) {
+	type TestCase struct {
+		Addr     string
+		Expected string
+	}
+
+	testCases := []TestCase{
+		{"198.51.100.7:52331", `"198.51.100.7:52331"`},
+		{"[2001:db8::7]:1194", `"[2001:db8::7]:1194"`},
+		// native IPv6 real addresses are printed without the port
+		{"2001:db8::7", `"2001:db8::7"`},
+	}
+
+	for i, tc := range testCases {
+		addr, err := parseRealAddr(tc.Addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := json.Marshal(addr)
+		if err != nil || string(got) != tc.Expected {
+			t.Errorf("test %d Marshal returned %s, %v; want %s", i, got, err, tc.Expected)
+		}
+	}
+
+	var nilAddr *IPAddrPort
+	if got, err := json.Marshal(nilAddr); err != nil || string(got) != "null" {
+		t.Errorf("Marshal of nil returned %s, %v", got, err)
+	}
+}
@@ -0,0 +1,81 @@
+package ovmgmt
+
+import (
+	"strings"
+	"sync"
+)
+
+// status3Index holds lookup indexes of a snapshot, built on first use.
+// It's shared by copies of the event, which is fine as long as clients
+// and routes are not modified after parsing.
+type status3Index struct {
+	once          sync.Once
+	clientsByCID  map[int64]int
+	clientsByCN   map[string][]int
+	routesByVAddr map[string]int
+}
+
+func (se Status3Event) lookupIndex() *status3Index {
+	idx := se.index
+	if idx == nil {
+		// zero or hand-made event, don't cache
+		idx = &status3Index{}
+	}
+	idx.once.Do(func() {
+		idx.clientsByCID = make(map[int64]int, len(se.clients))
+		idx.clientsByCN = make(map[string][]int, len(se.clients))
+		for i, c := range se.clients {
+			if c.hasClientId {
+				if _, ok := idx.clientsByCID[c.ClientId]; !ok {
+					idx.clientsByCID[c.ClientId] = i
+				}
+			}
+			idx.clientsByCN[c.CommonName] = append(idx.clientsByCN[c.CommonName], i)
+		}
+
+		idx.routesByVAddr = make(map[string]int, len(se.routes))
+		// exact addresses take precedence over the ones with the suffix
+		// trimmed, e.g. 10.8.0.6C
+		for i, r := range se.routes {
+			addr := strings.TrimSuffix(r.VirtualAddrFlags, virtualAddrCachedSuffix)
+			if _, ok := idx.routesByVAddr[addr]; !ok && addr != r.VirtualAddrFlags {
+				idx.routesByVAddr[addr] = i
+			}
+		}
+		for i, r := range se.routes {
+			idx.routesByVAddr[r.VirtualAddrFlags] = i
+		}
+	})
+	return idx
+}
+
+// ClientByCID returns the client with the given Client ID.
+func (se Status3Event) ClientByCID(cid int64) (Status3Client, bool) {
+	i, ok := se.lookupIndex().clientsByCID[cid]
+	if !ok {
+		return Status3Client{}, false
+	}
+	return se.clients[i], true
+}
+
+// ClientsByCommonName returns all sessions of the common name, there may
+// be several of them with --duplicate-cn.
+func (se Status3Event) ClientsByCommonName(cn string) []Status3Client {
+	idxs := se.lookupIndex().clientsByCN[cn]
+	clients := make([]Status3Client, len(idxs))
+	for i, idx := range idxs {
+		clients[i] = se.clients[idx]
+	}
+	return clients
+}
+
+// RouteByVirtualAddr returns the route of the virtual address as printed
+// in the routing table, e.g. 10.8.0.6 or 192.168.10.0/24. The C suffix of
+// cached routes may be omitted.
+func (se Status3Event) RouteByVirtualAddr(addr string) (Status3Route, bool) {
+	i, ok := se.lookupIndex().routesByVAddr[addr]
+	if !ok {
+		return Status3Route{}, false
+	}
+	return se.routes[i], true
+}
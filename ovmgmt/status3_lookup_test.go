@@ -0,0 +1,58 @@
+package ovmgmt
+
+import (
+	"testing"
+)
+
+func TestStatus3EventLookups(t *testing.T) {
+	payload := append([]string{}, status3PayloadIroute...)
+	// second session of branch1 with --duplicate-cn
+	payload = append(payload, "CLIENT_LIST\tbranch1\t203.0.113.11:1194\t10.8.0.14\t\t1\t2\tTue Mar 24 09:50:00 2020\t1585043400\tUNDEF\t9\t4")
+	se := *mustStatus3Event(t, payload...)
+
+	if c, ok := se.ClientByCID(4); !ok || c.CommonName != "branch2" {
+		t.Errorf("ClientByCID(4) returned %s, %t", c, ok)
+	}
+	if c, ok := se.ClientByCID(42); ok {
+		t.Errorf("ClientByCID(42) returned %s", c)
+	}
+
+	if cs := se.ClientsByCommonName("branch1"); len(cs) != 2 || cs[0].ClientId != 3 || cs[1].ClientId != 9 {
+		t.Errorf("ClientsByCommonName returned %v", cs)
+	}
+	if cs := se.ClientsByCommonName("nobody"); len(cs) != 0 {
+		t.Errorf("ClientsByCommonName returned %v", cs)
+	}
+
+	type TestCase struct {
+		Addr string
+		CN   string
+	}
+	testCases := []TestCase{
+		{"10.8.0.10", "branch1"},
+		{"192.168.10.0/24", "branch1"},
+		{"192.168.30.7C", "branch3"},
+		{"192.168.30.7", "branch3"},
+		{"10.8.0.99", ""},
+	}
+	for i, tc := range testCases {
+		r, ok := se.RouteByVirtualAddr(tc.Addr)
+		if ok != (tc.CN != "") || r.CommonName != tc.CN {
+			t.Errorf("test %d RouteByVirtualAddr(%q) returned %s, %t; want %q", i, tc.Addr, r, ok, tc.CN)
+		}
+	}
+
+	// indexes of the merged view cover invalid clients
+	mixed := *mustStatus3Event(t, status3PayloadMixed...)
+	if _, ok := mixed.ClientByCID(7); ok {
+		t.Errorf("ClientByCID found an invalid client")
+	}
+	if c, ok := mixed.WithInvalidClients().ClientByCID(7); !ok || c.CommonName != "carol" {
+		t.Errorf("ClientByCID of WithInvalidClients returned %s, %t", c, ok)
+	}
+
+	var zero Status3Event
+	if _, ok := zero.ClientByCID(0); ok {
+		t.Errorf("ClientByCID of zero event found a client")
+	}
+}
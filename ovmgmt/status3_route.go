@@ -2,7 +2,7 @@ package ovmgmt
 
 import (
 	"fmt"
-	"strconv"
+	"net"
 	"strings"
 	"time"
 )
@@ -16,6 +16,7 @@ type Status3Route struct {
 	LastRefRaw       string
 	LastRefTimestamp int64
 	errs             []error
+	warnings         []error
 }
 
 func (s Status3Route) LastRefTime() time.Time {
@@ -27,17 +28,56 @@ func (s Status3Route) Raw() string {
 }
 
 func (s Status3Route) String() string {
-	data := fmt.Sprintf("VAddrFlags:%s\tCN:%s\tRAddr:%s\tLastRef:[%s]%d", s.VirtualAddrFlags, s.CommonName, s.RealAddr, s.LastRefRaw, s.LastRefTimestamp)
+	data := fmt.Sprintf("VAddrFlags:%s\tCN:%s\tRAddr:%s\tLastRef:[%s]%d", s.VirtualAddrFlags, Sanitize(s.CommonName), s.RealAddr, s.LastRefRaw, s.LastRefTimestamp)
 	if len(s.errs) > 0 {
 		return fmt.Sprintf("InvalidRoute(%s\tParsingErrors:%s)", data, s.Error())
 	}
 	return fmt.Sprintf("Route(%s)", data)
 }
 
+// VirtualAddr returns the virtual address of the route as a network, host
+// addresses have the full-length mask. It's false for MAC addresses of TAP
+// servers and unparsable values.
+func (s Status3Route) VirtualAddr() (*net.IPNet, bool) {
+	if _, ok := s.MACAddr(); ok {
+		return nil, false
+	}
+	n, _, err := ParseVirtualAddr(s.VirtualAddrFlags)
+	if err != nil {
+		return nil, false
+	}
+	return n, true
+}
+
+// MACAddr returns the virtual address of TAP server routes.
+func (s Status3Route) MACAddr() (net.HardwareAddr, bool) {
+	mac, err := net.ParseMAC(s.VirtualAddrFlags)
+	if err != nil {
+		return nil, false
+	}
+	return mac, true
+}
+
+// IsConnectedSuffix reports whether the virtual address has the C suffix,
+// see ParseVirtualAddr.
+func (s Status3Route) IsConnectedSuffix() bool {
+	if _, ok := s.MACAddr(); ok {
+		return false
+	}
+	_, suffix, err := ParseVirtualAddr(s.VirtualAddrFlags)
+	return err == nil && suffix
+}
+
 func (s Status3Route) ParsingErrors() []error {
 	return s.errs
 }
 
+// ParsingWarnings returns the problems the line was recovered from, e.g.
+// a common name containing tabs.
+func (s Status3Route) ParsingWarnings() []error {
+	return s.warnings
+}
+
 func (s Status3Route) Error() string {
 	if len(s.errs) == 0 {
 		return ""
@@ -61,26 +101,47 @@ const (
 	RTHeaderMax
 )
 
+// routingTableColumnNames are the column names of ROUTING_TABLE HEADER line
+var routingTableColumnNames = map[string]int{
+	"Virtual Address":   int(RTVirtualAddrFlags),
+	"Common Name":       int(RTCommonName),
+	"Real Address":      int(RTRealAddr),
+	"Last Ref":          int(RTLastRefRaw),
+	"Last Ref (time_t)": int(RTLastRefTimestamp),
+}
+
+// NewStatus3Route parses ROUTING_TABLE fields in the order of OpenVPN 2.4+
+// output, see RoutingTableHeader.
 func NewStatus3Route(fields []string) Status3Route {
-	if len(fields) < int(RTHeaderMax) {
-		buf := make([]string, RTHeaderMax)
-		copy(buf, fields)
-		fields = buf
-	}
+	return newStatus3Route(fields, positionalColumns(int(RTHeaderMax)), nil)
+}
+
+// NewStatus3RouteWithHeader parses ROUTING_TABLE fields in the order given
+// by the column names of the HEADER line. Unknown columns are ignored
+// and missing ones are left zero.
+func NewStatus3RouteWithHeader(header, fields []string) Status3Route {
+	return newStatus3Route(fields, headerColumns(header, routingTableColumnNames, int(RTHeaderMax)), nil)
+}
 
-	c := Status3Route{
-		VirtualAddrFlags: fields[RTVirtualAddrFlags],
-		CommonName:       fields[RTCommonName],
-		LastRefRaw:       fields[RTLastRefRaw],
+func newStatus3Route(fields []string, cols statusColumns, o *parseOptions) Status3Route {
+	c := Status3Route{}
+	fields, warn := cols.mergeSurplus(fields, int(RTCommonName), "Common Name", status3FieldSep)
+	if warn != nil {
+		c.warnings = append(c.warnings, warn)
 	}
+	c.VirtualAddrFlags, _ = cols.field(fields, int(RTVirtualAddrFlags))
+	c.CommonName, _ = cols.field(fields, int(RTCommonName))
+	c.LastRefRaw, _ = cols.field(fields, int(RTLastRefRaw))
 
 	var err error
-	c.RealAddr, err = ParseIPAddrPort(fields[RTRealAddr])
-	if err != nil {
-		c.errs = append(c.errs, err)
+	if v, ok := cols.field(fields, int(RTRealAddr)); ok {
+		c.RealAddr, err = parseRealAddr(v)
+		if err != nil {
+			c.errs = append(c.errs, err)
+		}
 	}
 
-	c.LastRefTimestamp, err = strconv.ParseInt(fields[RTLastRefTimestamp], 10, 64)
+	c.LastRefTimestamp, err = statusTimestamp(fields, cols, int(RTLastRefTimestamp), int(RTLastRefRaw), o.location())
 	if err != nil {
 		c.errs = append(c.errs, err)
 	}
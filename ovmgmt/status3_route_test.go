@@ -0,0 +1,46 @@
+package ovmgmt
+
+import (
+	"testing"
+)
+
+func TestStatus3RouteVirtualAddr(t *testing.T) {
+	type TestCase struct {
+		Row       string
+		Network   string
+		MAC       string
+		Connected bool
+	}
+
+	testCases := []TestCase{
+		{"ROUTING_TABLE\t10.8.0.6\talice\t198.51.100.7:52331\tMon Mar 23 17:53:20 2020\t1584986000", "10.8.0.6/32", "", false},
+		// iroute subnets
+		{"ROUTING_TABLE\t192.168.10.0/24\tbranch1\t203.0.113.10:1194\tTue Mar 24 10:02:10 2020\t1585044130", "192.168.10.0/24", "", false},
+		{"ROUTING_TABLE\tfd00:10::/64\tbranch1\t203.0.113.10:1194\tTue Mar 24 10:02:10 2020\t1585044130", "fd00:10::/64", "", false},
+		{"ROUTING_TABLE\t192.168.30.7C\tbranch3\t203.0.113.30:1194\tTue Mar 24 10:01:57 2020\t1585044117", "192.168.30.7/32", "", true},
+		// TAP server
+		{"ROUTING_TABLE\t2a:4c:0e:9f:10:01\ttap1\t203.0.113.40:1194\tTue Mar 24 10:01:57 2020\t1585044117", "", "2a:4c:0e:9f:10:01", false},
+		{"ROUTING_TABLE\t2a:4c:0e:9f:10:0C\ttap2\t203.0.113.41:1194\tTue Mar 24 10:01:57 2020\t1585044117", "", "2a:4c:0e:9f:10:0c", false},
+		{"ROUTING_TABLE\tgarbage\tnobody\t203.0.113.42:1194\tTue Mar 24 10:01:57 2020\t1585044117", "", "", false},
+	}
+
+	for i, tc := range testCases {
+		se := mustStatus3Event(t, tc.Row)
+		if len(se.Routes()) != 1 {
+			t.Fatalf("test %d got routes %v, invalid %v", i, se.Routes(), se.InvalidRoutes())
+		}
+		r := se.Routes()[0]
+
+		n, ok := r.VirtualAddr()
+		if ok != (tc.Network != "") || (ok && n.String() != tc.Network) {
+			t.Errorf("test %d VirtualAddr returned %v, %t; want %q", i, n, ok, tc.Network)
+		}
+		mac, ok := r.MACAddr()
+		if ok != (tc.MAC != "") || (ok && mac.String() != tc.MAC) {
+			t.Errorf("test %d MACAddr returned %v, %t; want %q", i, mac, ok, tc.MAC)
+		}
+		if r.IsConnectedSuffix() != tc.Connected {
+			t.Errorf("test %d IsConnectedSuffix returned %t", i, r.IsConnectedSuffix())
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package ovmgmt
+
+import (
+	"bytes"
+	"sort"
+)
+
+// ClientSortKey is the field to sort clients by, see SortClientsBy.
+type ClientSortKey int
+
+const (
+	SortByBytesSent ClientSortKey = iota
+	SortByBytesRecv
+	SortByConnectedSince
+	SortByCommonName
+	SortByRealAddr
+)
+
+// SortClientsBy sorts the clients in place by the key, ascending or
+// descending. Clients with equal keys are ordered by Client ID, then by
+// Common Name, ascending in both cases; the sort is stable, so the clients
+// equal in all of them (e.g. without the Client ID column) keep their order.
+//
+// Real addresses are compared as IPs: IPv4 ones go before IPv6 ones,
+// then ordered by the address bytes and the port. Clients without
+// the real address go last, descending too.
+func SortClientsBy(clients []Status3Client, key ClientSortKey, desc bool) {
+	sort.SliceStable(clients, func(i, j int) bool {
+		a, b := clients[i], clients[j]
+		if key == SortByRealAddr && (a.RealAddr == nil) != (b.RealAddr == nil) {
+			return b.RealAddr == nil
+		}
+		cmp := compareClients(a, b, key)
+		if cmp == 0 {
+			if a.ClientId != b.ClientId {
+				return a.ClientId < b.ClientId
+			}
+			return a.CommonName < b.CommonName
+		}
+		if desc {
+			return cmp > 0
+		}
+		return cmp < 0
+	})
+}
+
+func compareClients(a, b Status3Client, key ClientSortKey) int {
+	switch key {
+	case SortByBytesSent:
+		return compareInt64(a.BytesSent, b.BytesSent)
+	case SortByBytesRecv:
+		return compareInt64(a.BytesRecv, b.BytesRecv)
+	case SortByConnectedSince:
+		return compareInt64(a.ConnectedSinceTimestamp, b.ConnectedSinceTimestamp)
+	case SortByCommonName:
+		switch {
+		case a.CommonName < b.CommonName:
+			return -1
+		case a.CommonName > b.CommonName:
+			return 1
+		}
+		return 0
+	case SortByRealAddr:
+		return compareIPAddrPort(a.RealAddr, b.RealAddr)
+	}
+	return 0
+}
+
+func compareInt64(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// compareIPAddrPort orders IPv4 before IPv6 and nil last
+func compareIPAddrPort(a, b *IPAddrPort) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return 1
+	case b == nil:
+		return -1
+	}
+
+	a4, b4 := a.IP.To4(), b.IP.To4()
+	switch {
+	case a4 != nil && b4 == nil:
+		return -1
+	case a4 == nil && b4 != nil:
+		return 1
+	case a4 != nil:
+		if cmp := bytes.Compare(a4, b4); cmp != 0 {
+			return cmp
+		}
+	default:
+		if cmp := bytes.Compare(a.IP.To16(), b.IP.To16()); cmp != 0 {
+			return cmp
+		}
+	}
+	return compareInt64(int64(a.Port), int64(b.Port))
+}
@@ -0,0 +1,74 @@
+package ovmgmt
+
+import (
+	"testing"
+)
+
+func TestSortClientsBy(t *testing.T) {
+	type TestCase struct {
+		Key  ClientSortKey
+		Desc bool
+		CIDs []int64
+	}
+
+	se := mustStatus3Event(t,
+		status3ClientHeader,
+		"CLIENT_LIST\talice\t[2001:db8::10]:1194\t10.8.0.6\t\t300\t100\tMon Mar 23 17:51:49 2020\t1584985909\tUNDEF\t5\t0",
+		"CLIENT_LIST\tbob\t198.51.100.10:1194\t10.8.0.10\t\t100\t200\tMon Mar 23 17:42:00 2020\t1584985320\tUNDEF\t6\t1",
+		"CLIENT_LIST\tcarol\t198.51.100.9:40000\t10.8.0.14\t\t200\t200\tMon Mar 23 16:00:00 2020\t1584979200\tUNDEF\t7\t2",
+		"CLIENT_LIST\tdave\t[2001:db8::9]:1194\t10.8.0.18\t\t300\t50\tMon Mar 23 17:00:00 2020\t1584982800\tUNDEF\t8\t3",
+		"CLIENT_LIST\tbob\t198.51.100.9:1194\t10.8.0.22\t\t50\t200\tMon Mar 23 17:00:00 2020\t1584982800\tUNDEF\t4\t4",
+	)
+	if len(se.InvalidClients()) != 0 {
+		t.Fatalf("got invalid clients %v", se.InvalidClients())
+	}
+
+	testCases := []TestCase{
+		{SortByBytesSent, false, []int64{8, 5, 4, 6, 7}},
+		{SortByBytesSent, true, []int64{4, 6, 7, 5, 8}},
+		{SortByBytesRecv, true, []int64{5, 8, 7, 6, 4}},
+		{SortByConnectedSince, false, []int64{7, 4, 8, 6, 5}},
+		{SortByCommonName, false, []int64{5, 4, 6, 7, 8}},
+		{SortByCommonName, true, []int64{8, 7, 4, 6, 5}},
+		// 198.51.100.9 < 198.51.100.10 numerically, unlike lexically
+		{SortByRealAddr, false, []int64{4, 7, 6, 8, 5}},
+		{SortByRealAddr, true, []int64{5, 8, 6, 7, 4}},
+	}
+
+	for i, tc := range testCases {
+		clients := append([]Status3Client(nil), se.Clients()...)
+		SortClientsBy(clients, tc.Key, tc.Desc)
+		cids := make([]int64, len(clients))
+		for j, c := range clients {
+			cids[j] = c.ClientId
+		}
+		if len(cids) != len(tc.CIDs) {
+			t.Fatalf("test %d got %v", i, cids)
+		}
+		for j := range cids {
+			if cids[j] != tc.CIDs[j] {
+				t.Errorf("test %d sorted to %v; want %v", i, cids, tc.CIDs)
+				break
+			}
+		}
+	}
+
+	// clients without the real address go last
+	clients := []Status3Client{{ClientId: 1}, {ClientId: 2, RealAddr: &IPAddrPort{IP: se.Clients()[0].RealAddr.IP}}}
+	SortClientsBy(clients, SortByRealAddr, false)
+	if clients[0].ClientId != 2 {
+		t.Errorf("client without the real address sorted first")
+	}
+	clients[0], clients[1] = clients[1], clients[0]
+	SortClientsBy(clients, SortByRealAddr, true)
+	if clients[0].ClientId != 2 {
+		t.Errorf("client without the real address sorted first in descending order")
+	}
+
+	// without the Client ID column
+	clients = []Status3Client{{CommonName: "carol"}, {CommonName: "alice"}, {CommonName: "bob"}}
+	SortClientsBy(clients, SortByBytesSent, true)
+	if got := clients[0].CommonName + "," + clients[1].CommonName + "," + clients[2].CommonName; got != "alice,bob,carol" {
+		t.Errorf("clients without Client ID sorted to %s; want alice,bob,carol", got)
+	}
+}
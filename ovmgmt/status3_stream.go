@@ -0,0 +1,101 @@
+package ovmgmt
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Status3Record is a single client or route line of 'status 3' output,
+// see MgmtClient.StreamStatus3.
+type Status3Record struct {
+	// Keyword is either CLIENT_LIST or ROUTING_TABLE
+	Keyword string
+	// Client is set for CLIENT_LIST records
+	Client Status3Client
+	// Route is set for ROUTING_TABLE records
+	Route Status3Route
+}
+
+func (r Status3Record) IsClient() bool {
+	return r.Keyword == status3ClientListKW
+}
+
+func (r Status3Record) IsRoute() bool {
+	return r.Keyword == status3RoutingTableKW
+}
+
+func (r Status3Record) parsingErrors() []error {
+	if r.IsClient() {
+		return r.Client.ParsingErrors()
+	}
+	return r.Route.ParsingErrors()
+}
+
+// StreamStatus3 issues 'status 3' command and calls fn for each client and
+// route line as it is read, without keeping the whole reply in memory,
+// unlike LatestStatus3. Invalid records are passed to fn as well, their
+// ParsingErrors are not empty; in strict parsing mode the first one stops
+// the streaming with an error instead.
+//
+// When fn returns an error, the rest of the reply is read and discarded,
+// and the error is returned.
+func (c *MgmtClient) StreamStatus3(fn func(Status3Record) error) error {
+	start := time.Now()
+	err := c.streamStatus3(fn)
+	c.commandDone("status 3", err, start)
+	return err
+}
+
+func (c *MgmtClient) streamStatus3(fn func(Status3Record) error) error {
+	if err := c.acquireCommand(context.Background()); err != nil {
+		return commandError("status", err)
+	}
+	defer c.releaseCommand()
+
+	err := c.sendCommand("status 3")
+	if err != nil {
+		return commandError("status", err)
+	}
+
+	cols := newStatus3Layout()
+	var lineFields []string
+	for {
+		line, ok := c.readReply()
+		if !ok {
+			if err != nil {
+				return err
+			}
+			return commandError("status", c.closedError("connection closed before END recieved"))
+		}
+		if line == endMessage {
+			return err
+		}
+		if err != nil {
+			// draining
+			continue
+		}
+
+		lineFields = splitStatusFields(lineFields, line)
+		rec := Status3Record{Keyword: lineFields[0]}
+		switch rec.Keyword {
+		case status3HeaderKW:
+			if len(lineFields) > 1 {
+				cols.setHeader(lineFields[1], lineFields[2:])
+			}
+			continue
+		case status3ClientListKW:
+			rec.Client = newStatus3Client(lineFields[1:], cols.client, &c.opts.parse)
+		case status3RoutingTableKW:
+			rec.Route = newStatus3Route(lineFields[1:], cols.route, &c.opts.parse)
+		default:
+			continue
+		}
+
+		if errs := rec.parsingErrors(); c.opts.strictParsing && len(errs) > 0 {
+			err = commandError("status", fmt.Errorf("invalid %s record %q: %w", rec.Keyword, line, errs[0]))
+			continue
+		}
+		err = fn(rec)
+	}
+}
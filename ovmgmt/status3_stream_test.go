@@ -0,0 +1,176 @@
+package ovmgmt
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// replyWriter replies to each command written with the lines produced
+// by reply, as if it was OpenVPN on the other end of the pipe
+type replyWriter struct {
+	w     io.Writer
+	reply func(cmd string) []string
+}
+
+func (rw replyWriter) Write(p []byte) (int, error) {
+	lines := rw.reply(strings.TrimSpace(string(p)))
+	go func() {
+		for _, line := range lines {
+			if _, err := io.WriteString(rw.w, line+"\n"); err != nil {
+				return
+			}
+		}
+	}()
+	return len(p), nil
+}
+
+func newReplyingClient(t testing.TB, eventCh chan Event, reply func(cmd string) []string, opts ...Option) *MgmtClient {
+	r, w := io.Pipe()
+	t.Cleanup(func() { w.Close() })
+	return NewMgmtClientWithOptions(mockConn{r, replyWriter{w, reply}}, eventCh, opts...)
+}
+
+func TestStreamStatus3(t *testing.T) {
+	payload := append(append([]string{}, status3PayloadIroute...), "CLIENT_LIST\tbroken\tnowhere", "END")
+	c := newReplyingClient(t, make(chan Event, 10), func(string) []string { return payload })
+
+	records := make([]Status3Record, 0)
+	err := c.StreamStatus3(func(rec Status3Record) error {
+		records = append(records, rec)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("StreamStatus3 returned error: %s", err)
+	}
+
+	names := make([]string, 0)
+	for _, rec := range records {
+		switch {
+		case rec.IsClient():
+			names = append(names, "c:"+rec.Client.CommonName)
+		case rec.IsRoute():
+			names = append(names, "r:"+rec.Route.VirtualAddrFlags)
+		}
+	}
+	want := []string{
+		"c:branch1", "c:branch2", "c:branch3", "c:tap1",
+		"r:10.8.0.10", "r:192.168.10.0/24", "r:192.168.20.0/24", "r:192.168.30.7C",
+		"c:broken",
+	}
+	if !equalStrings(names, want) {
+		t.Errorf("StreamStatus3 got records %q; want %q", names, want)
+	}
+	// columns are mapped by the HEADER line
+	if rec := records[1]; rec.Client.ClientId != 4 || rec.Client.VirtualAddrRaw != "192.168.20.0/24" {
+		t.Errorf("StreamStatus3 got client %s", rec.Client)
+	}
+	if len(records[8].Client.ParsingErrors()) == 0 {
+		t.Errorf("StreamStatus3 got no parsing errors for %s", records[8].Client)
+	}
+
+	// callback error stops the streaming, the rest of the reply is drained
+	errStop := errors.New("stop")
+	calls := 0
+	err = c.StreamStatus3(func(rec Status3Record) error {
+		calls++
+		return errStop
+	})
+	if err != errStop || calls != 1 {
+		t.Errorf("StreamStatus3 returned %v after %d calls; want %v after 1", err, calls, errStop)
+	}
+	se, err := c.LatestStatus3()
+	if err != nil || len(se.Clients()) != 4 {
+		t.Errorf("LatestStatus3 after the stopped stream returned %v, %v", se, err)
+	}
+}
+
+func TestStreamStatus3Strict(t *testing.T) {
+	payload := append(append([]string{}, status3PayloadMixed...), "END")
+	c := newReplyingClient(t, make(chan Event, 10), func(string) []string { return payload }, WithStrictParsing())
+
+	calls := 0
+	err := c.StreamStatus3(func(rec Status3Record) error {
+		calls++
+		return nil
+	})
+	if err == nil || calls != 2 {
+		t.Errorf("StreamStatus3 returned %v after %d calls; want error after 2", err, calls)
+	}
+}
+
+func status3BenchPayload(n int) []string {
+	payload := []string{status3Payload24[0], status3Payload24[1], status3ClientHeader}
+	for i := 0; i < n; i++ {
+		payload = append(payload, fmt.Sprintf("CLIENT_LIST\tclient%d\t198.51.100.7:%d\t10.8.%d.%d\t\t5523\t7391\tMon Mar 23 17:51:49 2020\t1584985909\tUNDEF\t%d\t%d",
+			i, 1024+i%60000, i/250, i%250+2, i, i))
+	}
+	return append(payload, "END")
+}
+
+// heapInUse returns the live heap size after the garbage collection
+func heapInUse() uint64 {
+	var m runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&m)
+	return m.HeapAlloc
+}
+
+// The benchmarks report peak-heap-B, the live heap growth while
+// the snapshot is being processed: it's proportional to the number of
+// clients for LatestStatus3 and flat for StreamStatus3.
+
+func benchmarkLatestStatus3(b *testing.B, n int) {
+	payload := status3BenchPayload(n)
+	c := newReplyingClient(b, make(chan Event, 10), func(string) []string { return payload })
+	base := heapInUse()
+	var peak uint64
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		se, err := c.LatestStatus3()
+		if err != nil || len(se.Clients()) != n {
+			b.Fatalf("LatestStatus3 returned %v", err)
+		}
+		if i == 0 {
+			peak = heapInUse() - base
+			runtime.KeepAlive(se)
+		}
+	}
+	b.ReportMetric(float64(peak), "peak-heap-B")
+}
+
+func benchmarkStreamStatus3(b *testing.B, n int) {
+	payload := status3BenchPayload(n)
+	c := newReplyingClient(b, make(chan Event, 10), func(string) []string { return payload })
+	base := heapInUse()
+	var peak uint64
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		count := 0
+		err := c.StreamStatus3(func(rec Status3Record) error {
+			count++
+			if i == 0 && count == n {
+				if h := heapInUse(); h > base {
+					peak = h - base
+				}
+			}
+			return nil
+		})
+		if err != nil || count != n {
+			b.Fatalf("StreamStatus3 returned %v", err)
+		}
+	}
+	b.ReportMetric(float64(peak), "peak-heap-B")
+}
+
+func BenchmarkLatestStatus3_1k(b *testing.B)  { benchmarkLatestStatus3(b, 1000) }
+func BenchmarkLatestStatus3_10k(b *testing.B) { benchmarkLatestStatus3(b, 10000) }
+func BenchmarkStreamStatus3_1k(b *testing.B)  { benchmarkStreamStatus3(b, 1000) }
+func BenchmarkStreamStatus3_10k(b *testing.B) { benchmarkStreamStatus3(b, 10000) }
@@ -0,0 +1,35 @@
+package ovmgmt
+
+import (
+	"strconv"
+	"time"
+)
+
+// statusTimeLayout is the ctime(3) format of human-readable time columns
+// of status output, like "Mon Mar 23 17:53:22 2020"
+const statusTimeLayout = time.ANSIC
+
+// location returns the time zone of the daemon set by
+// WithStatusTimeLocation, time.Local by default
+func (o *parseOptions) location() *time.Location {
+	if o == nil || o.statusLocation == nil {
+		return time.Local
+	}
+	return o.statusLocation
+}
+
+// statusTimestamp parses the time_t column, falling back to the
+// human-readable one. Both missing or empty yield 0 without an error.
+func statusTimestamp(fields []string, cols statusColumns, tsCol, rawCol int, loc *time.Location) (int64, error) {
+	if v, ok := cols.field(fields, tsCol); ok && v != "" {
+		return strconv.ParseInt(v, 10, 64)
+	}
+	if v, ok := cols.field(fields, rawCol); ok && v != "" {
+		ts, err := time.ParseInLocation(statusTimeLayout, v, loc)
+		if err != nil {
+			return 0, err
+		}
+		return ts.Unix(), nil
+	}
+	return 0, nil
+}
@@ -0,0 +1,98 @@
+package ovmgmt
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStatus3TimeFallback(t *testing.T) {
+	type TestCase struct {
+		Header    string
+		Row       string
+		Timestamp int64
+		Error     bool
+	}
+
+	utc3 := time.FixedZone("UTC+3", 3*60*60)
+
+	testCases := []TestCase{
+		// both columns present, time_t wins
+		{
+			"HEADER\tCLIENT_LIST\tCommon Name\tReal Address\tConnected Since\tConnected Since (time_t)",
+			"CLIENT_LIST\talice\t198.51.100.7:52331\tMon Mar 23 17:51:49 2020\t1584985909",
+			1584985909,
+			false,
+		},
+		// only human-readable column
+		{
+			"HEADER\tCLIENT_LIST\tCommon Name\tReal Address\tConnected Since",
+			"CLIENT_LIST\talice\t198.51.100.7:52331\tMon Mar 23 17:51:49 2020",
+			time.Date(2020, time.March, 23, 17, 51, 49, 0, utc3).Unix(),
+			false,
+		},
+		// empty time_t column
+		{
+			"HEADER\tCLIENT_LIST\tCommon Name\tReal Address\tConnected Since\tConnected Since (time_t)",
+			"CLIENT_LIST\talice\t198.51.100.7:52331\tMon Mar  2 07:01:09 2020\t",
+			time.Date(2020, time.March, 2, 7, 1, 9, 0, utc3).Unix(),
+			false,
+		},
+		{
+			"HEADER\tCLIENT_LIST\tCommon Name\tReal Address\tConnected Since",
+			"CLIENT_LIST\talice\t198.51.100.7:52331\tsome time ago",
+			0,
+			true,
+		},
+		// routes
+		{
+			"HEADER\tROUTING_TABLE\tVirtual Address\tCommon Name\tReal Address\tLast Ref\tLast Ref (time_t)",
+			"ROUTING_TABLE\t10.8.0.6\talice\t198.51.100.7:52331\tMon Mar 23 17:53:20 2020\t1584986000",
+			1584986000,
+			false,
+		},
+		{
+			"HEADER\tROUTING_TABLE\tVirtual Address\tCommon Name\tReal Address\tLast Ref",
+			"ROUTING_TABLE\t10.8.0.6\talice\t198.51.100.7:52331\tMon Mar 23 17:53:20 2020",
+			time.Date(2020, time.March, 23, 17, 53, 20, 0, utc3).Unix(),
+			false,
+		},
+		{
+			"HEADER\tROUTING_TABLE\tVirtual Address\tCommon Name\tReal Address\tLast Ref",
+			"ROUTING_TABLE\t10.8.0.6\talice\t198.51.100.7:52331\tnever",
+			0,
+			true,
+		},
+	}
+
+	for i, tc := range testCases {
+		se, err := ParseStatus3(strings.NewReader(tc.Header+"\n"+tc.Row+"\n"), utc3)
+		if err != nil {
+			t.Errorf("test %d returned error: %s", i, err)
+			continue
+		}
+
+		var ts int64
+		var errs []error
+		if len(se.Clients())+len(se.InvalidClients()) > 0 {
+			c := append(se.Clients(), se.InvalidClients()...)[0]
+			ts, errs = c.ConnectedSinceTimestamp, c.ParsingErrors()
+		} else {
+			r := append(se.Routes(), se.InvalidRoutes()...)[0]
+			ts, errs = r.LastRefTimestamp, r.ParsingErrors()
+		}
+		if tc.Error != (len(errs) > 0) {
+			t.Errorf("test %d got errors %v; want error %t", i, errs, tc.Error)
+		}
+		if ts != tc.Timestamp {
+			t.Errorf("test %d got timestamp %d; want %d", i, ts, tc.Timestamp)
+		}
+	}
+
+	// time.Local by default
+	se, err := NewStatus3Event([]string{testCases[1].Header, testCases[1].Row})
+	want := time.Date(2020, time.March, 23, 17, 51, 49, 0, time.Local).Unix()
+	if err != nil || len(se.Clients()) != 1 || se.Clients()[0].ConnectedSinceTimestamp != want {
+		t.Errorf("NewStatus3Event returned %s, %v; want timestamp %d", se, err, want)
+	}
+}
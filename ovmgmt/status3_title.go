@@ -0,0 +1,97 @@
+package ovmgmt
+
+import (
+	"strconv"
+	"strings"
+)
+
+//TITLE	OpenVPN 2.4.8 x86_64-pc-linux-gnu [SSL (OpenSSL)] [LZO] [LZ4] [EPOLL] [PKCS11] [MH/PKTINFO] [AEAD] built on Oct 30 2019
+//TITLE	OpenVPN 2.5.1 [git:release/2.5/3fdb8a5b2e0bb0e5] Windows-MSVC [SSL (OpenSSL)] [LZO] [LZ4] [PKCS11] [AEAD] built on Feb 24 2021
+//TITLE	OpenVPN 2.6_git x86_64-pc-linux-gnu [SSL (OpenSSL)] [LZO] [LZ4] [EPOLL] [MH/PKTINFO] [AEAD] [DCO]
+
+const titleProductName = "OpenVPN"
+const titleGitTagPrefix = "git:"
+
+// OpenVPNVersion returns the daemon version parsed from the TITLE line.
+// Pre-release versions like 2.6_beta1 or 2.6_git are reported with the
+// patch number 0. ok is false if the title has no recognizable version.
+func (se Status3Event) OpenVPNVersion() (major, minor, patch int, ok bool) {
+	return parseTitleVersion(se.title)
+}
+
+// BuildFeatures returns the bracketed build feature tags of the TITLE line,
+// e.g. "SSL (OpenSSL)", "LZ4" or "AEAD", in order of appearance. The git
+// revision tag of development builds is not a feature and is omitted.
+func (se Status3Event) BuildFeatures() []string {
+	return parseTitleFeatures(se.title)
+}
+
+func parseTitleVersion(title string) (major, minor, patch int, ok bool) {
+	fields := strings.Fields(title)
+	for i := 0; i+1 < len(fields); i++ {
+		if fields[i] != titleProductName {
+			continue
+		}
+
+		parts := strings.SplitN(fields[i+1], ".", 3)
+		if len(parts) < 2 {
+			return 0, 0, 0, false
+		}
+		nums := [3]int{}
+		for j, part := range parts {
+			n, digits := leadingInt(part)
+			if digits == 0 {
+				if j < 2 {
+					return 0, 0, 0, false
+				}
+				break
+			}
+			nums[j] = n
+			if digits < len(part) {
+				// suffix like _beta1, the rest is not a version
+				break
+			}
+		}
+		return nums[0], nums[1], nums[2], true
+	}
+	return 0, 0, 0, false
+}
+
+// leadingInt parses the decimal digits at the start of s, returning
+// the number of digits consumed, 0 if there are none
+func leadingInt(s string) (int, int) {
+	end := 0
+	for end < len(s) && s[end] >= '0' && s[end] <= '9' {
+		end++
+	}
+	if end == 0 {
+		return 0, 0
+	}
+	n, err := strconv.Atoi(s[:end])
+	if err != nil {
+		return 0, 0
+	}
+	return n, end
+}
+
+func parseTitleFeatures(title string) []string {
+	features := make([]string, 0)
+	for {
+		start := strings.IndexByte(title, '[')
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(title[start:], ']')
+		if end < 0 {
+			// unterminated tag
+			break
+		}
+		tag := strings.TrimSpace(title[start+1 : start+end])
+		title = title[start+end+1:]
+		if tag == "" || strings.HasPrefix(tag, titleGitTagPrefix) {
+			continue
+		}
+		features = append(features, tag)
+	}
+	return features
+}
@@ -0,0 +1,71 @@
+package ovmgmt
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStatus3EventOpenVPNVersion(t *testing.T) {
+	type TestCase struct {
+		Title    string
+		Version  [3]int
+		OK       bool
+		Features []string
+	}
+
+	testCases := []TestCase{
+		{
+			Title:    "OpenVPN 2.4.8 x86_64-pc-linux-gnu [SSL (OpenSSL)] [LZO] [LZ4] [EPOLL] [PKCS11] [MH/PKTINFO] [AEAD] built on Oct 30 2019",
+			Version:  [3]int{2, 4, 8},
+			OK:       true,
+			Features: []string{"SSL (OpenSSL)", "LZO", "LZ4", "EPOLL", "PKCS11", "MH/PKTINFO", "AEAD"},
+		},
+		{
+			Title:    "OpenVPN 2.5.1 [git:release/2.5/3fdb8a5b2e0bb0e5] Windows-MSVC [SSL (OpenSSL)] [LZO] [LZ4] [PKCS11] [AEAD] built on Feb 24 2021",
+			Version:  [3]int{2, 5, 1},
+			OK:       true,
+			Features: []string{"SSL (OpenSSL)", "LZO", "LZ4", "PKCS11", "AEAD"},
+		},
+		{
+			Title:    "OpenVPN 2.6_git x86_64-pc-linux-gnu [SSL (OpenSSL)] [DCO]",
+			Version:  [3]int{2, 6, 0},
+			OK:       true,
+			Features: []string{"SSL (OpenSSL)", "DCO"},
+		},
+		{
+			Title:    "OpenVPN 2.5_beta3 x86_64-pc-linux-gnu",
+			Version:  [3]int{2, 5, 0},
+			OK:       true,
+			Features: []string{},
+		},
+		{
+			Title:    "OpenVPN 2.4.12 [SSL (OpenSSL) [LZO",
+			Version:  [3]int{2, 4, 12},
+			OK:       true,
+			Features: []string{},
+		},
+		{
+			Title:    "OpenVPN x86_64-pc-linux-gnu [LZO] []",
+			Features: []string{"LZO"},
+		},
+		{
+			Title:    "OpenVPN",
+			Features: []string{},
+		},
+		{
+			Title:    "",
+			Features: []string{},
+		},
+	}
+
+	for i, tc := range testCases {
+		se := Status3Event{title: tc.Title}
+		major, minor, patch, ok := se.OpenVPNVersion()
+		if ok != tc.OK || [3]int{major, minor, patch} != tc.Version {
+			t.Errorf("test %d OpenVPNVersion returned %d.%d.%d, %t; want %v, %t", i, major, minor, patch, ok, tc.Version, tc.OK)
+		}
+		if features := se.BuildFeatures(); !reflect.DeepEqual(features, tc.Features) {
+			t.Errorf("test %d BuildFeatures returned %q; want %q", i, features, tc.Features)
+		}
+	}
+}
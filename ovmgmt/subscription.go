@@ -0,0 +1,170 @@
+package ovmgmt
+
+import (
+	"reflect"
+	"sync"
+)
+
+// SubscriptionBuffer is the buffer depth of the channels of
+// the subscriptions, see SubscribeEvents.
+const SubscriptionBuffer = 64
+
+// subscription is the channel of the subscriber, offer sends the event
+// to it without blocking; it reports whether the event matches
+// the subscription, and whether it's sent
+type subscription struct {
+	offer func(evt Event) (matched, sent bool)
+	close func()
+}
+
+// subscriptions is the dispatcher of the events to the subscriptions,
+// alongside the event channel of the client
+type subscriptions struct {
+	// mu guards all the fields, it's held by dispatch, which never
+	// blocks on the subscribers
+	mu      sync.Mutex
+	subs    map[*subscription]struct{}
+	closed  bool
+	dropped uint64
+}
+
+// add adds the subscription and returns the function to cancel it,
+// the subscription is closed right away if the client is terminated
+func (s *subscriptions) add(sub *subscription) func() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		sub.close()
+		return func() {}
+	}
+	if s.subs == nil {
+		s.subs = make(map[*subscription]struct{})
+	}
+	s.subs[sub] = struct{}{}
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if _, ok := s.subs[sub]; ok {
+			delete(s.subs, sub)
+			sub.close()
+		}
+	}
+}
+
+// dispatch offers the event to all the subscriptions, it's dropped for
+// the ones which buffer is full
+func (s *subscriptions) dispatch(evt Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for sub := range s.subs {
+		if matched, sent := sub.offer(evt); matched && !sent {
+			s.dropped++
+		}
+	}
+}
+
+// closeAll closes the subscriptions once the client is terminated
+func (s *subscriptions) closeAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	for sub := range s.subs {
+		sub.close()
+	}
+	s.subs = nil
+}
+
+// SubscriptionDroppedEvents returns the number of events dropped, since
+// the buffers of the subscriptions were full.
+func (c *MgmtClient) SubscriptionDroppedEvents() uint64 {
+	c.subs.mu.Lock()
+	defer c.subs.mu.Unlock()
+	return c.subs.dropped
+}
+
+// SubscribeEvents returns the channel of the events which match is true
+// for, and the function to cancel the subscription, which closes
+// the channel. The Subscribe methods are the ones of the specific event
+// types.
+//
+// The subscriptions receive the events in addition to the event channel
+// of the client, or instead of it if it's nil. They never block the client:
+// the channels are buffered with SubscriptionBuffer, the events which don't
+// fit are dropped for the subscription and counted by
+// SubscriptionDroppedEvents. The channels are closed once the client
+// terminates, after FatalEvent, if any, which SubscribeFatal receives.
+// It's safe to cancel the subscription multiple times, after the client
+// is terminated as well.
+func (c *MgmtClient) SubscribeEvents(match func(evt Event) bool) (<-chan Event, func()) {
+	ch := make(chan Event, SubscriptionBuffer)
+	return ch, c.subscribe(ch, match)
+}
+
+// subscribe adds the subscription of ch, a channel of Event or of
+// the specific event type, to the events which match is true for;
+// they are converted to the element type of ch, so match must not
+// accept the events of other types
+func (c *MgmtClient) subscribe(ch interface{}, match func(evt Event) bool) func() {
+	v := reflect.ValueOf(ch)
+	return c.subs.add(&subscription{
+		offer: func(evt Event) (bool, bool) {
+			if !match(evt) {
+				return false, false
+			}
+			return true, v.TrySend(reflect.ValueOf(evt))
+		},
+		close: v.Close,
+	})
+}
+
+// SubscribeState returns the channel of StateEvent, see SubscribeEvents.
+func (c *MgmtClient) SubscribeState() (<-chan StateEvent, func()) {
+	ch := make(chan StateEvent, SubscriptionBuffer)
+	return ch, c.subscribe(ch, func(evt Event) bool { _, ok := evt.(StateEvent); return ok })
+}
+
+// SubscribeLog returns the channel of LogEvent, see SubscribeEvents.
+func (c *MgmtClient) SubscribeLog() (<-chan LogEvent, func()) {
+	ch := make(chan LogEvent, SubscriptionBuffer)
+	return ch, c.subscribe(ch, func(evt Event) bool { _, ok := evt.(LogEvent); return ok })
+}
+
+// SubscribeEcho returns the channel of EchoEvent, see SubscribeEvents.
+func (c *MgmtClient) SubscribeEcho() (<-chan EchoEvent, func()) {
+	ch := make(chan EchoEvent, SubscriptionBuffer)
+	return ch, c.subscribe(ch, func(evt Event) bool { _, ok := evt.(EchoEvent); return ok })
+}
+
+// SubscribeHold returns the channel of HoldEvent, see SubscribeEvents.
+func (c *MgmtClient) SubscribeHold() (<-chan HoldEvent, func()) {
+	ch := make(chan HoldEvent, SubscriptionBuffer)
+	return ch, c.subscribe(ch, func(evt Event) bool { _, ok := evt.(HoldEvent); return ok })
+}
+
+// SubscribeClient returns the channel of ClientEvent, see SubscribeEvents.
+func (c *MgmtClient) SubscribeClient() (<-chan ClientEvent, func()) {
+	ch := make(chan ClientEvent, SubscriptionBuffer)
+	return ch, c.subscribe(ch, func(evt Event) bool { _, ok := evt.(ClientEvent); return ok })
+}
+
+// SubscribeByteCount returns the channel of ByteCountEvent, see
+// SubscribeEvents.
+func (c *MgmtClient) SubscribeByteCount() (<-chan ByteCountEvent, func()) {
+	ch := make(chan ByteCountEvent, SubscriptionBuffer)
+	return ch, c.subscribe(ch, func(evt Event) bool { _, ok := evt.(ByteCountEvent); return ok })
+}
+
+// SubscribeByteCountClient returns the channel of ByteCountClientEvent,
+// see SubscribeEvents.
+func (c *MgmtClient) SubscribeByteCountClient() (<-chan ByteCountClientEvent, func()) {
+	ch := make(chan ByteCountClientEvent, SubscriptionBuffer)
+	return ch, c.subscribe(ch, func(evt Event) bool { _, ok := evt.(ByteCountClientEvent); return ok })
+}
+
+// SubscribeFatal returns the channel of FatalEvent, see SubscribeEvents.
+// The event of the client terminated due to the error is never dropped.
+func (c *MgmtClient) SubscribeFatal() (<-chan FatalEvent, func()) {
+	// it's the only one
+	ch := make(chan FatalEvent, 1)
+	return ch, c.subscribe(ch, func(evt Event) bool { _, ok := evt.(FatalEvent); return ok })
+}
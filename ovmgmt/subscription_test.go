@@ -0,0 +1,288 @@
+package ovmgmt
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// writeLines writes the lines as the daemon, and closes the connection
+func writeLines(conn net.Conn, lines ...string) {
+	defer conn.Close()
+	for _, line := range lines {
+		if _, err := io.WriteString(conn, line+"\n"); err != nil {
+			return
+		}
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	defer checkGoroutineLeaks(t)()
+
+	daemonConn, clientConn := net.Pipe()
+	eventCh := make(chan Event, 10)
+	c := NewMgmtClient(clientConn, eventCh)
+	defer c.Close()
+	stateCh, cancelState := c.SubscribeState()
+	defer cancelState()
+	logCh, cancelLog := c.SubscribeLog()
+	defer cancelLog()
+	fatalCh, cancelFatal := c.SubscribeFatal()
+	defer cancelFatal()
+	infoCh, cancelInfo := c.SubscribeEvents(func(evt Event) bool {
+		ke, ok := evt.(KeywordedEvent)
+		return ok && ke.Keyword() == infoEventKW
+	})
+	defer cancelInfo()
+	go writeLines(daemonConn,
+		testGreeting,
+		">STATE:1584536294,CONNECTED,SUCCESS,10.8.0.6,198.51.100.1",
+		">LOG:1584536294,I,msg 1",
+		">ECHO:1584536294,foo",
+		">LOG:1584536294,I,msg 2",
+	)
+
+	// the event channel is intact
+	var events []Event
+	for evt := range eventCh {
+		events = append(events, evt)
+	}
+	if len(events) != 6 {
+		t.Errorf("got events %v; want 6", events)
+	}
+
+	var states []string
+	for evt := range stateCh {
+		states = append(states, evt.NewState())
+	}
+	var logs []string
+	for evt := range logCh {
+		logs = append(logs, evt.Message())
+	}
+	var infos []Event
+	for evt := range infoCh {
+		infos = append(infos, evt)
+	}
+	var fatals []FatalEvent
+	for evt := range fatalCh {
+		fatals = append(fatals, evt)
+	}
+	if len(states) != 1 || states[0] != "CONNECTED" {
+		t.Errorf("got states %v; want CONNECTED", states)
+	}
+	if fmt.Sprint(logs) != "[msg 1 msg 2]" {
+		t.Errorf("got logs %q; want msg 1, msg 2", logs)
+	}
+	if len(infos) != 1 || infos[0].Raw() != testGreeting[1:] {
+		t.Errorf("got events %v; want the greeting", infos)
+	}
+	if len(fatals) != 1 || !errors.Is(fatals[0].Err(), io.EOF) {
+		t.Errorf("got fatal events %v; want EOF", fatals)
+	}
+	if n := c.SubscriptionDroppedEvents(); n != 0 {
+		t.Errorf("SubscriptionDroppedEvents returned %d; want 0", n)
+	}
+
+	// the subscription of the terminated client is closed, canceling
+	// is safe
+	lateCh, cancelLate := c.SubscribeLog()
+	if _, ok := <-lateCh; ok {
+		t.Errorf("the subscription of the terminated client is open")
+	}
+	cancelLate()
+	cancelLog()
+}
+
+// TestSubscribeTypes checks that each of the typed subscriptions receives
+// the events of its type only
+func TestSubscribeTypes(t *testing.T) {
+	defer checkGoroutineLeaks(t)()
+
+	type TestCase struct {
+		Name      string
+		Subscribe func(c *MgmtClient) (interface{}, func())
+	}
+
+	testCases := []TestCase{
+		{"state", func(c *MgmtClient) (interface{}, func()) { return c.SubscribeState() }},
+		{"log", func(c *MgmtClient) (interface{}, func()) { return c.SubscribeLog() }},
+		{"echo", func(c *MgmtClient) (interface{}, func()) { return c.SubscribeEcho() }},
+		{"hold", func(c *MgmtClient) (interface{}, func()) { return c.SubscribeHold() }},
+		{"client", func(c *MgmtClient) (interface{}, func()) { return c.SubscribeClient() }},
+		{"bytecount", func(c *MgmtClient) (interface{}, func()) { return c.SubscribeByteCount() }},
+		{"bytecount client", func(c *MgmtClient) (interface{}, func()) { return c.SubscribeByteCountClient() }},
+		{"fatal", func(c *MgmtClient) (interface{}, func()) { return c.SubscribeFatal() }},
+	}
+
+	daemonConn, clientConn := net.Pipe()
+	c := NewMgmtClient(clientConn, nil)
+	defer c.Close()
+	chans := make([]reflect.Value, len(testCases))
+	for i, tc := range testCases {
+		ch, cancel := tc.Subscribe(c)
+		defer cancel()
+		chans[i] = reflect.ValueOf(ch)
+	}
+	go writeLines(daemonConn,
+		">STATE:1584536294,CONNECTED,SUCCESS,10.8.0.6,198.51.100.1",
+		">LOG:1584536294,I,msg",
+		">ECHO:1584536294,foo",
+		">HOLD:Waiting for hold release",
+		">CLIENT:ESTABLISHED,1",
+		">CLIENT:ENV,common_name=alice",
+		">CLIENT:ENV,END",
+		">BYTECOUNT:100,200",
+		">BYTECOUNT_CLI:1,100,200",
+	)
+
+	for i, tc := range testCases {
+		n := 0
+		for _, ok := chans[i].Recv(); ok; _, ok = chans[i].Recv() {
+			n++
+		}
+		if n != 1 {
+			t.Errorf("test %d (%s) got %d events; want 1", i, tc.Name, n)
+		}
+	}
+}
+
+func TestSubscribeNilEventCh(t *testing.T) {
+	defer checkGoroutineLeaks(t)()
+
+	daemonConn, clientConn := net.Pipe()
+	defer daemonConn.Close()
+	c := NewMgmtClient(clientConn, nil)
+	logCh, cancel := c.SubscribeLog()
+	defer cancel()
+	go greetingDaemon(daemonConn, func(cmd string) []string {
+		if cmd == "pid" {
+			return []string{">LOG:1584536294,I,pid", "SUCCESS: pid=42"}
+		}
+		return nil
+	})
+
+	if pid, err := c.Pid(); err != nil || pid != 42 {
+		t.Errorf("Pid returned %d, %v; want 42", pid, err)
+	}
+	select {
+	case evt := <-logCh:
+		if evt.Message() != "pid" {
+			t.Errorf("got %v; want the log of pid", evt)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("no event")
+	}
+	c.Close()
+	if _, ok := <-logCh; ok {
+		t.Errorf("the subscription is open after Close")
+	}
+}
+
+func TestSubscribeSlow(t *testing.T) {
+	defer checkGoroutineLeaks(t)()
+
+	const extra = 10
+	daemonConn, clientConn := net.Pipe()
+	eventCh := make(chan Event, 10)
+	c := NewMgmtClient(clientConn, eventCh)
+	defer c.Close()
+	// one is read along with the event channel, the other one isn't
+	fastCh, cancelFast := c.SubscribeLog()
+	defer cancelFast()
+	slowCh, cancelSlow := c.SubscribeLog()
+	defer cancelSlow()
+
+	var lines []string
+	for i := 0; i < SubscriptionBuffer+extra; i++ {
+		lines = append(lines, fmt.Sprintf(">LOG:1584536294,I,%d", i))
+	}
+	go writeLines(daemonConn, lines...)
+
+	fast := 0
+	for range eventCh {
+		select {
+		case _, ok := <-fastCh:
+			if ok {
+				fast++
+			}
+		default:
+		}
+	}
+	for range fastCh {
+		fast++
+	}
+	if fast != len(lines) {
+		t.Errorf("the fast subscriber got %d events; want %d", fast, len(lines))
+	}
+
+	// the slow one gets the events up to its buffer, the newer ones
+	// are dropped
+	i := 0
+	for evt := range slowCh {
+		if want := fmt.Sprint(i); evt.Message() != want {
+			t.Errorf("got %v; want %s", evt, want)
+		}
+		i++
+	}
+	if i != SubscriptionBuffer {
+		t.Errorf("the slow subscriber got %d events; want %d", i, SubscriptionBuffer)
+	}
+	if n := c.SubscriptionDroppedEvents(); n != extra {
+		t.Errorf("SubscriptionDroppedEvents returned %d; want %d", n, extra)
+	}
+}
+
+func TestSubscribeCancel(t *testing.T) {
+	defer checkGoroutineLeaks(t)()
+
+	daemonConn, clientConn := net.Pipe()
+	defer daemonConn.Close()
+	eventCh := make(chan Event, 10)
+	c := NewMgmtClient(clientConn, eventCh)
+	defer c.Close()
+	logCh, cancel := c.SubscribeLog()
+	go func() {
+		for i := 0; ; i++ {
+			if _, err := fmt.Fprintf(daemonConn, ">LOG:1584536294,I,%d\n", i); err != nil {
+				return
+			}
+		}
+	}()
+
+	// canceled while the dispatcher is busy with the full subscription
+	for c.SubscriptionDroppedEvents() == 0 {
+		<-eventCh
+	}
+	canceled := make(chan struct{})
+	go func() {
+		defer close(canceled)
+		cancel()
+		cancel()
+	}()
+	for done := false; !done; {
+		select {
+		case <-canceled:
+			done = true
+		case <-eventCh:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("cancel is blocked")
+		}
+	}
+	n := 0
+	for range logCh {
+		n++
+	}
+	if n != SubscriptionBuffer {
+		t.Errorf("got %d events of the canceled subscription; want %d", n, SubscriptionBuffer)
+	}
+
+	// the event channel goes on
+	nextEventOf(t, eventCh)
+	c.Close()
+	for range eventCh {
+	}
+}
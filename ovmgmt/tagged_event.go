@@ -0,0 +1,55 @@
+package ovmgmt
+
+import "fmt"
+
+// TaggedEvent is the event of the client tagged with the name of its
+// instance: the events of MgmtPool, and all the events of the client
+// configured with WithTag, including FatalEvent.
+type TaggedEvent struct {
+	Instance string
+	Event    Event
+}
+
+func (e TaggedEvent) Raw() string {
+	if e.Event == nil {
+		return ""
+	}
+	return e.Event.Raw()
+}
+
+// Keyword returns the keyword of the tagged event, as InvalidEvent does.
+func (e TaggedEvent) Keyword() string {
+	if ke, ok := e.Event.(KeywordedEvent); ok {
+		return ke.Keyword()
+	}
+	return ""
+}
+
+// Tag returns the name of the instance.
+func (e TaggedEvent) Tag() string {
+	return e.Instance
+}
+
+func (e TaggedEvent) String() string {
+	return fmt.Sprintf("%s: %s", e.Instance, e.Event)
+}
+
+// untagEvent returns the event without the tags, if any
+func untagEvent(evt Event) Event {
+	for {
+		tagged, ok := evt.(TaggedEvent)
+		if !ok {
+			return evt
+		}
+		evt = tagged.Event
+	}
+}
+
+// tagged returns the event to be delivered, tagged if the client is
+// configured with WithTag
+func (c *MgmtClient) tagged(evt Event) Event {
+	if c.opts.tag == "" {
+		return evt
+	}
+	return TaggedEvent{Instance: c.opts.tag, Event: evt}
+}
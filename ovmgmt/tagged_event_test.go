@@ -0,0 +1,107 @@
+package ovmgmt
+
+import (
+	"errors"
+	"io"
+	"net"
+	"testing"
+)
+
+func TestWithTag(t *testing.T) {
+	defer checkGoroutineLeaks(t)()
+
+	type TestCase struct {
+		Line    string
+		Keyword string
+		Check   func(evt Event) bool
+	}
+
+	testCases := []TestCase{
+		{testGreeting, infoEventKW, func(evt Event) bool {
+			_, ok := evt.(SimpleEvent)
+			return ok
+		}},
+		{">LOG:1584536294,I,msg", logEventKW, func(evt Event) bool {
+			log, ok := evt.(LogEvent)
+			return ok && log.Message() == "msg"
+		}},
+		{">ECHO:,foo", echoEventKW, func(evt Event) bool {
+			inv, ok := evt.(InvalidEvent)
+			if !ok {
+				return false
+			}
+			_, ok = inv.Origin().(EchoEvent)
+			return ok
+		}},
+		{">XYZZY:bar", "XYZZY", func(evt Event) bool {
+			unknown, ok := evt.(UnknownEvent)
+			return ok && unknown.Body() == "bar"
+		}},
+		{"garbage", "", func(evt Event) bool {
+			_, ok := evt.(MalformedEvent)
+			return ok
+		}},
+	}
+
+	daemonConn, clientConn := net.Pipe()
+	go func() {
+		for _, tc := range testCases {
+			if _, err := io.WriteString(daemonConn, tc.Line+"\n"); err != nil {
+				return
+			}
+		}
+		daemonConn.Close()
+	}()
+	eventCh := make(chan Event, 10)
+	c := NewMgmtClientWithOptions(clientConn, eventCh, WithTag("tun0"))
+	defer c.Close()
+
+	var events []Event
+	for evt := range eventCh {
+		events = append(events, evt)
+	}
+	if len(events) != len(testCases)+1 {
+		t.Fatalf("got events %v; want %d", events, len(testCases)+1)
+	}
+	for i, tc := range testCases {
+		tagged, ok := events[i].(TaggedEvent)
+		if !ok || tagged.Tag() != "tun0" {
+			t.Errorf("test %d got %T %v; want TaggedEvent of tun0", i, events[i], events[i])
+			continue
+		}
+		if !tc.Check(tagged.Event) {
+			t.Errorf("test %d got %T %v", i, tagged.Event, tagged.Event)
+		}
+		if tagged.Keyword() != tc.Keyword {
+			t.Errorf("test %d Keyword returned %q; want %q", i, tagged.Keyword(), tc.Keyword)
+		}
+		if tagged.Raw() != tagged.Event.Raw() {
+			t.Errorf("test %d Raw returned %q; want %q", i, tagged.Raw(), tagged.Event.Raw())
+		}
+	}
+
+	// the final event is tagged as well
+	tagged, ok := events[len(testCases)].(TaggedEvent)
+	if !ok || tagged.Tag() != "tun0" {
+		t.Fatalf("got %T %v; want TaggedEvent of tun0", events[len(testCases)], events[len(testCases)])
+	}
+	if fatal, ok := tagged.Event.(FatalEvent); !ok || !errors.Is(fatal.Err(), io.EOF) {
+		t.Errorf("got %v; want FatalEvent of EOF", tagged.Event)
+	}
+}
+
+func TestWithTagDisabled(t *testing.T) {
+	daemonConn, clientConn := net.Pipe()
+	go func() {
+		io.WriteString(daemonConn, testGreeting+"\n")
+		daemonConn.Close()
+	}()
+	eventCh := make(chan Event, 10)
+	c := NewMgmtClientWithOptions(clientConn, eventCh, WithTag(""))
+	defer c.Close()
+	for evt := range eventCh {
+		if _, ok := evt.(TaggedEvent); ok {
+			t.Errorf("got %v; want the untagged event", evt)
+		}
+	}
+}
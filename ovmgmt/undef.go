@@ -0,0 +1,21 @@
+package ovmgmt
+
+// UndefValue is printed by OpenVPN in place of the common name and
+// the username of clients which haven't completed authentication,
+// as well as of clients authenticated without a username.
+const UndefValue = "UNDEF"
+
+// undef maps UNDEF to the empty string if it's turned on by
+// WithNormalizeUndef
+func (o *parseOptions) undef(s string) string {
+	if s != UndefValue || o == nil || !o.normalizeUndef {
+		return s
+	}
+	return ""
+}
+
+// isKnownCommonName reports whether the common name is of the client which
+// has completed authentication
+func isKnownCommonName(cn string) bool {
+	return cn != "" && cn != UndefValue
+}
@@ -0,0 +1,116 @@
+package ovmgmt
+
+import (
+	"testing"
+)
+
+func TestNormalizeUndef(t *testing.T) {
+	type TestCase struct {
+		Options       []Option
+		CommonName    string
+		Username      string
+		EnvCN         string
+		EnvUser       string
+		CommonNameRaw string
+		UsernameRaw   string
+	}
+
+	testCases := []TestCase{
+		{nil, "UNDEF", "UNDEF", "UNDEF", "UNDEF", "UNDEF", "UNDEF"},
+		{[]Option{WithNormalizeUndef()}, "", "", "", "", "UNDEF", "UNDEF"},
+	}
+
+	row := "CLIENT_LIST\tUNDEF\t198.51.100.7:52331\t\t\t0\t0\tMon Mar 23 17:51:49 2020\t1584985909\tUNDEF\t5\t0"
+	for i, tc := range testCases {
+		opts := defaultClientOptions()
+		for _, opt := range tc.Options {
+			opt(&opts)
+		}
+
+		se, err := newStatus3Event([]string{row}, &opts.parse)
+		if err != nil || len(se.Clients()) != 1 {
+			t.Fatalf("test %d newStatus3Event returned %s, %v", i, se, err)
+		}
+		c := se.Clients()[0]
+		if c.CommonName != tc.CommonName || c.Username != tc.Username {
+			t.Errorf("test %d got CommonName %q, Username %q; want %q, %q", i, c.CommonName, c.Username, tc.CommonName, tc.Username)
+		}
+		if c.CommonNameRaw != tc.CommonNameRaw || c.UsernameRaw != tc.UsernameRaw {
+			t.Errorf("test %d got CommonNameRaw %q, UsernameRaw %q", i, c.CommonNameRaw, c.UsernameRaw)
+		}
+		if c.IsAuthenticated() {
+			t.Errorf("test %d IsAuthenticated returned true for UNDEF client", i)
+		}
+
+		events := replayEvents([]string{
+			">CLIENT:CONNECT,5,1",
+			">CLIENT:ENV,common_name=UNDEF",
+			">CLIENT:ENV,username=UNDEF",
+			">CLIENT:ENV,END",
+		}, tc.Options...)
+		if len(events) != 1 {
+			t.Fatalf("test %d got %d events; want 1", i, len(events))
+		}
+		e, ok := events[0].(ClientEvent)
+		if !ok {
+			t.Fatalf("test %d got %s; want ClientEvent", i, events[0])
+		}
+		if cn, ok := e.CommonName(); !ok || cn != tc.EnvCN {
+			t.Errorf("test %d ClientEvent CommonName returned %q, %t; want %q", i, cn, ok, tc.EnvCN)
+		}
+		if u, ok := e.Username(); !ok || u != tc.EnvUser {
+			t.Errorf("test %d ClientEvent Username returned %q, %t; want %q", i, u, ok, tc.EnvUser)
+		}
+		if v, _ := e.Env(EnvCommonName); v != UndefValue {
+			t.Errorf("test %d ClientEvent Env returned %q; want raw value", i, v)
+		}
+		if e.IsAuthenticated() {
+			t.Errorf("test %d ClientEvent IsAuthenticated returned true for UNDEF", i)
+		}
+	}
+
+	// the events parsed outside of the client keep UNDEF
+	e := mustClientEvent(t, "CONNECT,5,1", "ENV,common_name=UNDEF")
+	if cn, _ := e.CommonName(); cn != UndefValue {
+		t.Errorf("ClientEvent CommonName returned %q; want %q", cn, UndefValue)
+	}
+
+	// authenticated with a certificate only, no username
+	se, _ := NewStatus3Event(status3Payload24)
+	if c := se.Clients()[0]; !c.IsAuthenticated() || c.Username != UndefValue {
+		t.Errorf("got %s; want authenticated client", c)
+	}
+	if e := mustClientEvent(t, connectEnvPayload...); !e.IsAuthenticated() {
+		t.Errorf("ClientEvent IsAuthenticated returned false")
+	}
+}
+
+func TestIsAuthenticated(t *testing.T) {
+	type TestCase struct {
+		CommonName    string
+		Authenticated bool
+	}
+
+	testCases := []TestCase{
+		{"alice", true},
+		{"UNDEF", false},
+		{"", false},
+		{"undef", true},
+	}
+
+	for i, tc := range testCases {
+		c := NewStatus3Client([]string{tc.CommonName, "198.51.100.7:52331", "10.8.0.6", "", "0", "0", "Mon Mar 23 17:51:49 2020", "1584985909", "UNDEF", "5", "0"})
+		if got := c.IsAuthenticated(); got != tc.Authenticated {
+			t.Errorf("test %d Status3Client IsAuthenticated returned %t; want %t", i, got, tc.Authenticated)
+		}
+		e := mustClientEvent(t, "CONNECT,5,1", "ENV,common_name="+tc.CommonName)
+		if got := e.IsAuthenticated(); got != tc.Authenticated {
+			t.Errorf("test %d ClientEvent IsAuthenticated returned %t; want %t", i, got, tc.Authenticated)
+		}
+	}
+
+	// no common_name at all
+	if e := mustClientEvent(t, "CONNECT,5,1", "ENV,username=alice"); e.IsAuthenticated() {
+		t.Errorf("ClientEvent IsAuthenticated returned true without common_name")
+	}
+}
@@ -0,0 +1,89 @@
+package ovmgmt
+
+import (
+	"errors"
+	"fmt"
+)
+
+// UPDOWN notifications are sent when OpenVPN runs with --management-up-down
+// and the TUN/TAP device goes up or down. The environmental variables passed
+// are equivalent to those that would be passed to an --up or --down script:
+//
+//     >UPDOWN:UP|DOWN
+//     >UPDOWN:ENV,name1=val1
+//     >UPDOWN:ENV,name2=val2
+//     >UPDOWN:ENV,...
+//     >UPDOWN:ENV,END
+
+type UpDownDirection string
+
+const (
+	UDUnknown UpDownDirection = "UNKNOWN"
+	UDUp      UpDownDirection = "UP"
+	UDDown    UpDownDirection = "DOWN"
+)
+
+type UpDownEvent struct {
+	receivedAt
+	rawHeader string
+	direction UpDownDirection
+	envs      envBlock
+	// options of the client which received the event
+	opts *parseOptions
+}
+
+func NewUpDownEvent(payload []string) (UpDownEvent, error) {
+	e := UpDownEvent{direction: UDUnknown}
+	if len(payload) == 0 {
+		return e, errors.New("empty updown event")
+	}
+
+	e.rawHeader = payload[0]
+	switch UpDownDirection(payload[0]) {
+	case UDUp:
+		e.direction = UDUp
+	case UDDown:
+		e.direction = UDDown
+	default:
+		return e, errors.New("unknown updown event direction: " + payload[0])
+	}
+
+	var err error
+	e.envs, err = parseEnvLines(payload[1:])
+	return e, err
+}
+
+func (e UpDownEvent) Keyword() string {
+	return updownEventKW
+}
+
+func (e UpDownEvent) Raw() string {
+	return fmt.Sprintf("%s\t%s", e.rawHeader, e.envs.vars)
+}
+
+func (e UpDownEvent) Direction() UpDownDirection {
+	return e.direction
+}
+
+func (e UpDownEvent) RawEnv(key string) string {
+	return e.opts.sanitize(e.envs.vars[key])
+}
+
+// Env returns the value of env variable and whether it is present.
+func (e UpDownEvent) Env(key string) (string, bool) {
+	return e.envs.env(key, e.opts)
+}
+
+// Envs returns a copy of env variables in the wire order.
+func (e UpDownEvent) Envs() []EnvVar {
+	return e.envs.list(e.opts)
+}
+
+// EnvKeys returns names of env variables in the wire order.
+func (e UpDownEvent) EnvKeys() []string {
+	return e.envs.keys()
+}
+
+func (e UpDownEvent) String() string {
+	return Sanitize(fmt.Sprintf("[%s]%s:env:%v", updownEventKW, e.Direction(), e.envs.vars))
+}
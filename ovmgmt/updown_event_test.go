@@ -0,0 +1,123 @@
+package ovmgmt
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUpDownEvent(t *testing.T) {
+	lines := []string{
+		">STATE:1584536294,ASSIGN_IP,,10.8.0.6,",
+		">UPDOWN:UP",
+		">UPDOWN:ENV,dev=tun0",
+		">UPDOWN:ENV,ifconfig_local=10.8.0.6",
+		">UPDOWN:ENV,ifconfig_netmask=255.255.255.0",
+		">UPDOWN:ENV,foreign_option_1=dhcp-option DNS 10.8.0.1",
+		">UPDOWN:ENV,tun_mtu=1500",
+		">UPDOWN:ENV,END",
+		">STATE:1584536295,CONNECTED,SUCCESS,10.8.0.6,192.168.4.1",
+	}
+
+	events := replayEvents(lines)
+	if len(events) != 3 {
+		t.Fatalf("got %d events; want 3: %v", len(events), events)
+	}
+
+	if _, ok := events[0].(StateEvent); !ok {
+		t.Errorf("event 0 got %T; want StateEvent", events[0])
+	}
+	if _, ok := events[2].(StateEvent); !ok {
+		t.Errorf("event 2 got %T; want StateEvent", events[2])
+	}
+
+	ud, ok := events[1].(UpDownEvent)
+	if !ok {
+		t.Fatalf("event 1 got %T; want %T", events[1], ud)
+	}
+	if got, want := ud.Direction(), UDUp; got != want {
+		t.Errorf("Direction returned %q; want %q", got, want)
+	}
+
+	wantEnv := map[string]string{
+		"dev":              "tun0",
+		"ifconfig_local":   "10.8.0.6",
+		"ifconfig_netmask": "255.255.255.0",
+		"foreign_option_1": "dhcp-option DNS 10.8.0.1",
+		"tun_mtu":          "1500",
+	}
+	for k, want := range wantEnv {
+		if got := ud.RawEnv(k); got != want {
+			t.Errorf("RawEnv(%q) returned %q; want %q", k, got, want)
+		}
+		if got, ok := ud.Env(k); !ok || got != want {
+			t.Errorf("Env(%q) returned %q, %t; want %q", k, got, ok, want)
+		}
+	}
+	if got, ok := ud.Env("ifconfig_remote"); ok || got != "" {
+		t.Errorf("Env of the missing variable returned %q, %t", got, ok)
+	}
+
+	wantKeys := []string{"dev", "ifconfig_local", "ifconfig_netmask", "foreign_option_1", "tun_mtu"}
+	if got := ud.EnvKeys(); !reflect.DeepEqual(got, wantKeys) {
+		t.Errorf("EnvKeys returned %q; want %q", got, wantKeys)
+	}
+	envs := ud.Envs()
+	if len(envs) != len(wantKeys) {
+		t.Fatalf("Envs returned %v; want %d variables", envs, len(wantKeys))
+	}
+	for i, v := range envs {
+		if v.Name != wantKeys[i] || v.Value != wantEnv[v.Name] {
+			t.Errorf("Envs returned %v at %d; want %s=%s", v, i, wantKeys[i], wantEnv[wantKeys[i]])
+		}
+	}
+}
+
+func TestUpDownEventPayload(t *testing.T) {
+	type TestCase struct {
+		Payload       []string
+		WantErr       bool
+		WantDirection UpDownDirection
+		WantDev       string
+	}
+	testCases := []TestCase{
+		{
+			// truncated: no ENV lines at all
+			Payload:       []string{"DOWN"},
+			WantDirection: UDDown,
+		},
+		{
+			// truncated in the middle of ENV block
+			Payload:       []string{"UP", "ENV,dev=tun0"},
+			WantDirection: UDUp,
+			WantDev:       "tun0",
+		},
+		{
+			Payload:       []string{"SIDEWAYS", "ENV,dev=tun0"},
+			WantErr:       true,
+			WantDirection: UDUnknown,
+		},
+		{
+			Payload:       []string{"UP", "dev=tun0"},
+			WantErr:       true,
+			WantDirection: UDUp,
+		},
+		{
+			Payload:       []string{},
+			WantErr:       true,
+			WantDirection: UDUnknown,
+		},
+	}
+
+	for i, testCase := range testCases {
+		ud, err := NewUpDownEvent(testCase.Payload)
+		if (err != nil) != testCase.WantErr {
+			t.Errorf("test %d returned error %v; want error: %t", i, err, testCase.WantErr)
+		}
+		if got, want := ud.Direction(), testCase.WantDirection; got != want {
+			t.Errorf("test %d Direction returned %q; want %q", i, got, want)
+		}
+		if got, want := ud.RawEnv("dev"), testCase.WantDev; got != want {
+			t.Errorf("test %d RawEnv returned %q; want %q", i, got, want)
+		}
+	}
+}